@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Event kinds recorded in the audit log.
+const (
+	KindSessionStart = "session.start"
+	KindSessionEnd   = "session.end"
+	KindApproval     = "approval"
+	KindGrant        = "grant"
+	KindTraffic      = "traffic"
+)
+
+// Event is a single line of the project audit log.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Session  string    `json:"session,omitempty"`
+	Kind     string    `json:"kind"`
+	Command  []string  `json:"command,omitempty"`
+	ExitCode *int      `json:"exitCode,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+	Traffic  []Traffic `json:"traffic,omitempty"`
+}
+
+// Session is an enter/exec session reconstructed from start/end events.
+type Session struct {
+	ID       string
+	Command  []string
+	Start    time.Time
+	End      time.Time // zero while the session is still running (or was killed)
+	ExitCode *int
+}
+
+// Path returns the audit log location for a project. It lives under .airlock/ so it is never
+// visible from inside the sandbox.
+func Path(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "audit.log")
+}
+
+// NewSessionID returns a short random identifier for an enter/exec session.
+func NewSessionID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// Append writes an event to the audit log at path, creating it if needed.
+func Append(path string, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Read returns all events in the audit log at path. A missing log yields no events.
+func Read(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// Skip corrupt lines rather than losing the rest of the log.
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, sc.Err()
+}
+
+// Sessions pairs session start/end events, in start order.
+func Sessions(events []Event) []Session {
+	var sessions []Session
+	index := map[string]int{}
+	for _, e := range events {
+		switch e.Kind {
+		case KindSessionStart:
+			index[e.Session] = len(sessions)
+			sessions = append(sessions, Session{ID: e.Session, Command: e.Command, Start: e.Time})
+		case KindSessionEnd:
+			if i, ok := index[e.Session]; ok {
+				sessions[i].End = e.Time
+				sessions[i].ExitCode = e.ExitCode
+			}
+		}
+	}
+	return sessions
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendReadSessions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-audit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, ".airlock", "audit.log")
+	code := 3
+	if err := Append(path, Event{Session: "s1", Kind: KindSessionStart, Command: []string{"make", "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, Event{Session: "s2", Kind: KindSessionStart, Command: []string{"bash"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, Event{Session: "s1", Kind: KindSessionEnd, ExitCode: &code}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	sessions := Sessions(events)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].ID != "s1" || sessions[0].End.IsZero() || sessions[0].ExitCode == nil || *sessions[0].ExitCode != 3 {
+		t.Errorf("unexpected first session: %+v", sessions[0])
+	}
+	if !sessions[1].End.IsZero() {
+		t.Errorf("expected second session to still be open: %+v", sessions[1])
+	}
+}
+
+func TestParseSeccompLog(t *testing.T) {
+	log := `audit: type=1326 audit(1712345678.120:123): auid=4294967295 uid=1000 gid=1000 ses=4294967295 pid=4242 comm="node" exe="/usr/bin/node" sig=0 arch=c000003e syscall=165 compat=0 ip=0x7f0 code=0x7ffc0000
+some unrelated kernel line
+type=SECCOMP msg=audit(1712345679.500:124): pid=4243 comm="strace" exe="/usr/bin/strace" sig=0 arch=c00000b7 syscall=117 compat=0 ip=0x1 code=0x50001
+`
+	events := ParseSeccompLog(strings.NewReader(log))
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Syscall != "mount" || events[0].Comm != "node" || events[0].Action != "log" || events[0].PID != 4242 {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[0].Time.Unix() != 1712345678 {
+		t.Errorf("unexpected time: %v", events[0].Time)
+	}
+	if events[1].Syscall != "ptrace" || events[1].Action != "errno" {
+		t.Errorf("unexpected second event: %+v", events[1])
+	}
+
+	summary := Summarize(append(events, events[0]))
+	if summary[0].Syscall != "mount" || summary[0].Count != 2 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestTrafficReport(t *testing.T) {
+	now := time.Now()
+	events := []Event{
+		{Time: now.Add(-48 * time.Hour), Kind: KindTraffic, Session: "old", Traffic: []Traffic{{Host: "pypi.org", Sent: 1000, Received: 1000}}},
+		{Time: now, Kind: KindSessionStart, Session: "s1"},
+		{Time: now, Kind: KindTraffic, Session: "s1", Traffic: []Traffic{{Host: "pypi.org", Sent: 10, Received: 200}, {Host: "github.com", Sent: 5, Received: 5}}},
+		{Time: now, Kind: KindTraffic, Session: "s2", Traffic: []Traffic{{Host: "pypi.org", Sent: 1, Received: 2}}},
+	}
+	report := TrafficReport(events, now.Add(-24*time.Hour))
+	if len(report) != 2 {
+		t.Fatalf("expected 2 hosts, got %+v", report)
+	}
+	if report[0].Host != "pypi.org" || report[0].Sent != 11 || report[0].Received != 202 || report[0].Sessions != 2 {
+		t.Errorf("unexpected pypi.org totals: %+v", report[0])
+	}
+	if report[1].Host != "github.com" || report[1].Sessions != 1 {
+		t.Errorf("unexpected github.com totals: %+v", report[1])
+	}
+}
+
+func TestParseCommits(t *testing.T) {
+	out := "aaa\x1f1700000000\x1fAdd feature\x1fs-1\x1fcodex\x1e\n" +
+		"bbb\x1f1700000100\x1fHuman commit\x1f\x1f\x1e\n" +
+		"ccc\x1f1700000200\x1fNo agent\x1fs-2\x1f\x1e\n"
+	commits := parseCommits(out)
+	if len(commits) != 2 {
+		t.Fatalf("got %d commits, want 2: %+v", len(commits), commits)
+	}
+	if c := commits[0]; c.Hash != "aaa" || c.Session != "s-1" || c.Agent != "codex" || c.Subject != "Add feature" || c.Time.Unix() != 1700000000 {
+		t.Errorf("commits[0] = %+v", c)
+	}
+	if c := commits[1]; c.Hash != "ccc" || c.Session != "s-2" || c.Agent != "" {
+		t.Errorf("commits[1] = %+v", c)
+	}
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provenance trailers that git.provenance adds to commits made in the sandbox.
+const (
+	TrailerSession = "Airlock-Session"
+	TrailerAgent   = "Airlock-Agent"
+)
+
+// Commit is a commit made in an airlock session.
+type Commit struct {
+	Hash    string
+	Time    time.Time
+	Subject string
+	Session string
+	Agent   string
+}
+
+// commitFormat separates fields with US and commits with RS, which don't occur in subjects.
+const commitFormat = "%H%x1f%ct%x1f%s%x1f%(trailers:key=" + TrailerSession + ",valueonly,separator=%x2C)%x1f%(trailers:key=" + TrailerAgent + ",valueonly,separator=%x2C)%x1e"
+
+// ReadCommits returns the commits reachable from HEAD in the repository at dir, made since since,
+// that carry a session trailer, newest first.
+func ReadCommits(ctx context.Context, dir string, since time.Time) ([]Commit, error) {
+	cmd := exec.CommandContext(ctx, "git", "log", "--since", since.Format(time.RFC3339), "--format="+commitFormat)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %w", err)
+	}
+	return parseCommits(string(out)), nil
+}
+
+func parseCommits(out string) []Commit {
+	var commits []Commit
+	for _, rec := range strings.Split(out, "\x1e") {
+		f := strings.Split(strings.TrimSpace(rec), "\x1f")
+		if len(f) != 5 || f[3] == "" {
+			continue
+		}
+		secs, _ := strconv.ParseInt(f[1], 10, 64)
+		commits = append(commits, Commit{
+			Hash:    f[0],
+			Time:    time.Unix(secs, 0),
+			Subject: f[2],
+			Session: strings.TrimSpace(f[3]),
+			Agent:   strings.TrimSpace(f[4]),
+		})
+	}
+	return commits
+}
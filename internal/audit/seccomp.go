@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyscallEvent is a seccomp audit record from the host kernel log.
+type SyscallEvent struct {
+	Time    time.Time
+	PID     int
+	Comm    string
+	Exe     string
+	Syscall string
+	Action  string
+}
+
+var (
+	seccompLine = regexp.MustCompile(`type=(1326|SECCOMP)`)
+	auditStamp  = regexp.MustCompile(`audit\((\d+)\.(\d+):\d+\)`)
+	kvField     = regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`)
+)
+
+// ParseSeccompLog extracts seccomp records from kernel/audit log output.
+func ParseSeccompLog(r io.Reader) []SyscallEvent {
+	var events []SyscallEvent
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if !seccompLine.MatchString(line) {
+			continue
+		}
+		var e SyscallEvent
+		if m := auditStamp.FindStringSubmatch(line); m != nil {
+			sec, _ := strconv.ParseInt(m[1], 10, 64)
+			ms, _ := strconv.ParseInt(m[2], 10, 64)
+			e.Time = time.Unix(sec, ms*int64(time.Millisecond)).UTC()
+		}
+		fields := map[string]string{}
+		for _, m := range kvField.FindAllStringSubmatch(line, -1) {
+			fields[m[1]] = strings.Trim(m[2], `"`)
+		}
+		e.PID, _ = strconv.Atoi(fields["pid"])
+		e.Comm = fields["comm"]
+		e.Exe = fields["exe"]
+		e.Syscall = SyscallName(fields["arch"], fields["syscall"])
+		e.Action = seccompAction(fields["code"])
+		events = append(events, e)
+	}
+	return events
+}
+
+// ReadKernelSeccomp reads seccomp records logged by the host kernel since the given time.
+func ReadKernelSeccomp(ctx context.Context, since time.Time) ([]SyscallEvent, error) {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return nil, fmt.Errorf("journalctl not found: syscall auditing requires a Linux host with systemd-journald")
+	}
+	out, err := exec.CommandContext(ctx, "journalctl", "-k", "--no-pager", "-o", "cat", "--since", fmt.Sprintf("@%d", since.Unix())).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel log: %w", err)
+	}
+	return ParseSeccompLog(strings.NewReader(string(out))), nil
+}
+
+// SyscallCount is an aggregated row of the syscall report.
+type SyscallCount struct {
+	Syscall string
+	Comm    string
+	Action  string
+	Count   int
+}
+
+// Summarize aggregates syscall events by syscall, process name, and action, most frequent first.
+func Summarize(events []SyscallEvent) []SyscallCount {
+	counts := map[SyscallCount]int{}
+	for _, e := range events {
+		counts[SyscallCount{Syscall: e.Syscall, Comm: e.Comm, Action: e.Action}]++
+	}
+	var out []SyscallCount
+	for k, n := range counts {
+		k.Count = n
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Syscall+out[i].Comm < out[j].Syscall+out[j].Comm
+	})
+	return out
+}
+
+func seccompAction(code string) string {
+	v, err := strconv.ParseUint(strings.TrimPrefix(code, "0x"), 16, 32)
+	if err != nil {
+		return "unknown"
+	}
+	switch v & 0xffff0000 {
+	case 0x7ffc0000:
+		return "log"
+	case 0x00050000:
+		return "errno"
+	case 0x00030000:
+		return "trap"
+	case 0x7ff00000:
+		return "trace"
+	case 0x00000000, 0x80000000:
+		return "kill"
+	}
+	return "unknown"
+}
+
+// Audit arch identifiers.
+const (
+	archX8664   = "c000003e"
+	archAArch64 = "c00000b7"
+)
+
+// syscallNames covers the syscalls outside the audit profile's allowlist that are worth naming.
+// Anything else is reported by number.
+var syscallNames = map[string]map[int]string{
+	archX8664: {
+		101: "ptrace", 103: "syslog", 134: "uselib", 135: "personality", 136: "ustat", 139: "sysfs",
+		153: "vhangup", 155: "pivot_root", 161: "chroot", 163: "acct", 164: "settimeofday", 165: "mount",
+		166: "umount2", 167: "swapon", 168: "swapoff", 169: "reboot", 170: "sethostname", 171: "setdomainname",
+		172: "iopl", 173: "ioperm", 174: "create_module", 175: "init_module", 176: "delete_module",
+		177: "get_kernel_syms", 178: "query_module", 179: "quotactl", 180: "nfsservctl", 212: "lookup_dcookie",
+		227: "clock_settime", 237: "mbind", 238: "set_mempolicy", 239: "get_mempolicy", 246: "kexec_load",
+		248: "add_key", 249: "request_key", 250: "keyctl", 256: "migrate_pages", 272: "unshare",
+		279: "move_pages", 298: "perf_event_open", 300: "fanotify_init", 303: "name_to_handle_at",
+		304: "open_by_handle_at", 308: "setns", 310: "process_vm_readv", 311: "process_vm_writev",
+		312: "kcmp", 313: "finit_module", 319: "memfd_create", 321: "bpf", 322: "execveat", 323: "userfaultfd",
+	},
+	archAArch64: {
+		39: "umount2", 40: "mount", 41: "pivot_root", 51: "chroot", 89: "acct", 92: "personality",
+		97: "unshare", 104: "kexec_load", 105: "init_module", 106: "delete_module", 116: "syslog",
+		117: "ptrace", 142: "reboot", 161: "sethostname", 162: "setdomainname", 170: "settimeofday",
+		217: "add_key", 218: "request_key", 219: "keyctl", 224: "swapon", 225: "swapoff",
+		241: "perf_event_open", 264: "name_to_handle_at", 265: "open_by_handle_at", 268: "setns",
+		270: "process_vm_readv", 271: "process_vm_writev", 272: "kcmp", 273: "finit_module",
+		279: "memfd_create", 280: "bpf", 281: "execveat", 282: "userfaultfd",
+	},
+}
+
+// Syscall numbers from 403 up are shared by all architectures.
+var commonSyscallNames = map[int]string{
+	424: "pidfd_send_signal", 425: "io_uring_setup", 426: "io_uring_enter", 427: "io_uring_register",
+	428: "open_tree", 429: "move_mount", 430: "fsopen", 431: "fsconfig", 432: "fsmount", 433: "fspick",
+	434: "pidfd_open", 435: "clone3", 438: "pidfd_getfd", 442: "mount_setattr",
+}
+
+// SyscallName maps an audit arch and syscall number to a name, falling back to the number.
+func SyscallName(arch, nr string) string {
+	n, err := strconv.Atoi(nr)
+	if err != nil {
+		return nr
+	}
+	if name, ok := syscallNames[strings.ToLower(arch)][n]; ok {
+		return name
+	}
+	if name, ok := commonSyscallNames[n]; ok {
+		return name
+	}
+	return "syscall " + nr
+}
+
+// BySession attributes syscall events to the sessions whose time window contains them. Kernel records
+// carry no container identity, so attribution is by time; events outside any session are returned separately.
+func BySession(sessions []Session, events []SyscallEvent) (map[string][]SyscallEvent, []SyscallEvent) {
+	attributed := map[string][]SyscallEvent{}
+	var rest []SyscallEvent
+	for _, e := range events {
+		found := false
+		for _, s := range sessions {
+			end := s.End
+			if end.IsZero() {
+				end = time.Now()
+			}
+			if !e.Time.Before(s.Start.Truncate(time.Second)) && !e.Time.After(end) {
+				attributed[s.ID] = append(attributed[s.ID], e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			rest = append(rest, e)
+		}
+	}
+	return attributed, rest
+}
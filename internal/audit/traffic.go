@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"sort"
+	"time"
+)
+
+// Traffic is the egress accounting for one allowlisted destination during a session.
+type Traffic struct {
+	Host     string `json:"host"` // the network.allow entry the destination was resolved from
+	Sent     uint64 `json:"sent"`
+	Received uint64 `json:"received"`
+}
+
+// HostTraffic is a destination's traffic summed over sessions.
+type HostTraffic struct {
+	Traffic
+	Sessions int
+}
+
+// TrafficReport sums traffic events recorded at or after since per host, busiest first.
+func TrafficReport(events []Event, since time.Time) []HostTraffic {
+	byHost := map[string]*HostTraffic{}
+	for _, e := range events {
+		if e.Kind != KindTraffic || e.Time.Before(since) {
+			continue
+		}
+		for _, t := range e.Traffic {
+			h, ok := byHost[t.Host]
+			if !ok {
+				h = &HostTraffic{Traffic: Traffic{Host: t.Host}}
+				byHost[t.Host] = h
+			}
+			h.Sent += t.Sent
+			h.Received += t.Received
+			h.Sessions++
+		}
+	}
+	report := make([]HostTraffic, 0, len(byHost))
+	for _, h := range byHost {
+		report = append(report, *h)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		ti, tj := report[i].Sent+report[i].Received, report[j].Sent+report[j].Received
+		if ti != tj {
+			return ti > tj
+		}
+		return report[i].Host < report[j].Host
+	})
+	return report
+}
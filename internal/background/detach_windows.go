@@ -0,0 +1,11 @@
+//go:build windows
+
+package background
+
+import "syscall"
+
+func detachAttr() *syscall.SysProcAttr {
+	const createNewProcessGroup = 0x00000200
+	const detachedProcess = 0x00000008
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
@@ -0,0 +1,251 @@
+// Package batch runs a list of steps (commands, file copies, snapshots) against a sandbox in order,
+// with per-step timeouts, and reports each step's outcome in a machine-readable form, so an
+// orchestrator can drive a multi-step job through one airlock invocation.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/donjaime/airlock/internal/config"
+	"github.com/donjaime/airlock/internal/sanitize"
+)
+
+// Step kinds.
+const (
+	KindExec     = "exec"
+	KindCopy     = "copy"
+	KindSnapshot = "snapshot"
+)
+
+// Step statuses.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusTimeout = "timeout"
+	StatusSkipped = "skipped" // an earlier step failed
+)
+
+// maxOutput is how much of a step's output the report keeps (the end of it).
+const maxOutput = 64 << 10
+
+// Plan is a batch file: YAML, or JSON (which YAML parses as well).
+type Plan struct {
+	// Timeout applies to steps without their own; zero means no limit.
+	Timeout config.Duration `yaml:"timeout"`
+	Steps   []Step          `yaml:"steps"`
+}
+
+// Step does exactly one of Exec, Copy, or Snapshot.
+type Step struct {
+	Name string `yaml:"name"`
+	// Exec is the command to run in the sandbox; a string runs through sh -c.
+	Exec    Command           `yaml:"exec"`
+	WorkDir string            `yaml:"workdir"`
+	User    string            `yaml:"user"`
+	Env     map[string]string `yaml:"env"`
+	// Copy copies between the host and the sandbox, like `airlock cp`.
+	Copy *Copy `yaml:"copy"`
+	// Snapshot snapshots the sandbox home ("home"), like `airlock home snapshot`.
+	Snapshot string          `yaml:"snapshot"`
+	Timeout  config.Duration `yaml:"timeout"`
+	// ContinueOnError runs the following steps even if this one fails.
+	ContinueOnError bool `yaml:"continueOnError"`
+}
+
+// Copy names a source and destination, one of them container:<path>.
+type Copy struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// Command is a command line as a list, or a string for sh -c.
+type Command []string
+
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = Command{"sh", "-c", value.Value}
+		return nil
+	}
+	var s []string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	*c = s
+	return nil
+}
+
+// Kind returns which of exec, copy, or snapshot the step does.
+func (s Step) Kind() string {
+	switch {
+	case len(s.Exec) > 0:
+		return KindExec
+	case s.Copy != nil:
+		return KindCopy
+	case s.Snapshot != "":
+		return KindSnapshot
+	}
+	return ""
+}
+
+// Load reads and validates a batch file; "-" reads stdin.
+func Load(path string) (*Plan, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses and validates a batch file's contents.
+func Parse(b []byte) (*Plan, error) {
+	var p Plan
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Steps) == 0 {
+		return nil, errors.New("the batch has no steps")
+	}
+	for i, s := range p.Steps {
+		set := 0
+		for _, ok := range []bool{len(s.Exec) > 0, s.Copy != nil, s.Snapshot != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("steps[%d]: a step needs exactly one of exec, copy, or snapshot", i)
+		}
+		if s.Copy != nil && (s.Copy.From == "" || s.Copy.To == "" || s.Copy.From == "-" || s.Copy.To == "-") {
+			return nil, fmt.Errorf("steps[%d]: copy needs from and to, and can't stream through stdin or stdout (-)", i)
+		}
+		if s.Snapshot != "" && s.Snapshot != "home" {
+			return nil, fmt.Errorf("steps[%d]: snapshot must be \"home\", got %q", i, s.Snapshot)
+		}
+		if s.Kind() != KindExec && (s.WorkDir != "" || s.User != "" || len(s.Env) > 0) {
+			return nil, fmt.Errorf("steps[%d]: workdir, user, and env only apply to exec steps", i)
+		}
+	}
+	return &p, nil
+}
+
+// Sandbox carries out steps.
+type Sandbox interface {
+	// Exec runs the step's command, writing its stdout and stderr to out. A non-zero exit status
+	// is reported with ExitCode.
+	Exec(ctx context.Context, step Step, out io.Writer) error
+	Copy(ctx context.Context, from, to string) error
+	// SnapshotHome snapshots the sandbox home and returns the snapshot's name.
+	SnapshotHome(ctx context.Context) (string, error)
+}
+
+// ExitCode is implemented by the error Sandbox.Exec returns for a command that exited non-zero.
+type ExitCode interface {
+	ExitCode() int
+}
+
+// Report is the outcome of a batch.
+type Report struct {
+	OK    bool     `json:"ok"`
+	Steps []Result `json:"steps"`
+}
+
+// Result is the outcome of a step.
+type Result struct {
+	Name       string `json:"name,omitempty"`
+	Kind       string `json:"kind"`
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exitCode,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Output     string `json:"output,omitempty"` // an exec step's output as plain text, or its end when long
+	Snapshot   string `json:"snapshot,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Run carries out the plan's steps in order in sb. A failed step skips the rest unless it has
+// ContinueOnError. Exec output is also written to progress as it happens.
+func Run(ctx context.Context, p *Plan, sb Sandbox, progress io.Writer) *Report {
+	report := &Report{OK: true}
+	stopped := false
+	for _, step := range p.Steps {
+		res := Result{Name: step.Name, Kind: step.Kind()}
+		if stopped {
+			res.Status = StatusSkipped
+			report.Steps = append(report.Steps, res)
+			continue
+		}
+		timeout := time.Duration(step.Timeout)
+		if timeout == 0 {
+			timeout = time.Duration(p.Timeout)
+		}
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			stepCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		start := time.Now()
+		var err error
+		switch res.Kind {
+		case KindExec:
+			out := &tail{}
+			err = sb.Exec(stepCtx, step, io.MultiWriter(progress, out))
+			res.Output = sanitize.Text(out.b)
+			code := 0
+			var exit ExitCode
+			if errors.As(err, &exit) {
+				code = exit.ExitCode()
+			}
+			if err == nil || code != 0 {
+				res.ExitCode = &code
+			}
+		case KindCopy:
+			err = sb.Copy(stepCtx, step.Copy.From, step.Copy.To)
+		case KindSnapshot:
+			res.Snapshot, err = sb.SnapshotHome(stepCtx)
+		}
+		res.DurationMs = time.Since(start).Milliseconds()
+		switch {
+		case err == nil:
+			res.Status = StatusOK
+		case errors.Is(stepCtx.Err(), context.DeadlineExceeded):
+			res.Status = StatusTimeout
+			res.Error = fmt.Sprintf("timed out after %s", timeout)
+		default:
+			res.Status = StatusFailed
+			res.Error = err.Error()
+		}
+		cancel()
+		if res.Status != StatusOK {
+			report.OK = false
+			stopped = !step.ContinueOnError
+		}
+		report.Steps = append(report.Steps, res)
+	}
+	return report
+}
+
+// tail keeps the last maxOutput bytes written to it.
+type tail struct {
+	b []byte
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.b = append(t.b, p...)
+	if len(t.b) > maxOutput {
+		t.b = t.b[len(t.b)-maxOutput:]
+	}
+	return len(p), nil
+}
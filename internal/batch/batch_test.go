@@ -0,0 +1,136 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+type exitErr int
+
+func (e exitErr) Error() string { return fmt.Sprintf("exit %d", int(e)) }
+func (e exitErr) ExitCode() int { return int(e) }
+
+type fakeSandbox struct {
+	ran []string
+}
+
+func (f *fakeSandbox) Exec(ctx context.Context, step Step, out io.Writer) error {
+	f.ran = append(f.ran, strings.Join(step.Exec, " "))
+	switch step.Exec[0] {
+	case "fail":
+		fmt.Fprintln(out, "boom")
+		return exitErr(3)
+	case "hang":
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	fmt.Fprintln(out, "hello")
+	return nil
+}
+
+func (f *fakeSandbox) Copy(ctx context.Context, from, to string) error {
+	f.ran = append(f.ran, "cp "+from+" "+to)
+	if from == "container:missing" {
+		return errors.New("no such file")
+	}
+	return nil
+}
+
+func (f *fakeSandbox) SnapshotHome(ctx context.Context) (string, error) {
+	f.ran = append(f.ran, "snapshot")
+	return "20260101-000000", nil
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`timeout: 10m
+steps:
+  - name: build
+    exec: make build
+    env: {CI: "1"}
+  - exec: [go, test, ./...]
+    timeout: 30s
+  - copy: {from: "container:dist/app", to: ./out}
+  - snapshot: home
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(p.Steps) != 4 || time.Duration(p.Timeout) != 10*time.Minute {
+		t.Fatalf("unexpected plan: %+v", p)
+	}
+	if got := strings.Join(p.Steps[0].Exec, " "); got != "sh -c make build" {
+		t.Errorf("string exec = %q, want it run through sh -c", got)
+	}
+	if p.Steps[1].Kind() != KindExec || time.Duration(p.Steps[1].Timeout) != 30*time.Second {
+		t.Errorf("unexpected step: %+v", p.Steps[1])
+	}
+	if p.Steps[2].Kind() != KindCopy || p.Steps[3].Kind() != KindSnapshot {
+		t.Errorf("unexpected kinds: %s, %s", p.Steps[2].Kind(), p.Steps[3].Kind())
+	}
+
+	if _, err := Parse([]byte(`{"steps": [{"exec": ["true"]}]}`)); err != nil {
+		t.Errorf("JSON batch: %v", err)
+	}
+	for _, bad := range []string{
+		"steps: []\n",
+		"steps:\n  - name: nothing\n",
+		"steps:\n  - exec: ls\n    snapshot: home\n",
+		"steps:\n  - copy: {from: container:a}\n",
+		"steps:\n  - copy: {from: container:a, to: \"-\"}\n",
+		"steps:\n  - snapshot: workspace\n",
+		"steps:\n  - snapshot: home\n    user: root\n",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	p := &Plan{Steps: []Step{
+		{Name: "ok", Exec: Command{"echo"}},
+		{Name: "tolerated", Exec: Command{"fail"}, ContinueOnError: true},
+		{Name: "copy", Copy: &Copy{From: "container:a", To: "b"}},
+		{Name: "snap", Snapshot: "home"},
+		{Name: "slow", Exec: Command{"hang"}, Timeout: config.Duration(10 * time.Millisecond)},
+		{Name: "never", Exec: Command{"echo"}},
+	}}
+	sb := &fakeSandbox{}
+	var progress strings.Builder
+	report := Run(context.Background(), p, sb, &progress)
+
+	if report.OK {
+		t.Error("expected the report to fail")
+	}
+	want := []string{StatusOK, StatusFailed, StatusOK, StatusOK, StatusTimeout, StatusSkipped}
+	for i, res := range report.Steps {
+		if res.Status != want[i] {
+			t.Errorf("step %s: status %s, want %s", res.Name, res.Status, want[i])
+		}
+	}
+	if r := report.Steps[0]; r.Output != "hello\n" || r.ExitCode == nil || *r.ExitCode != 0 {
+		t.Errorf("unexpected ok step: %+v", r)
+	}
+	if r := report.Steps[1]; r.ExitCode == nil || *r.ExitCode != 3 || r.Output != "boom\n" {
+		t.Errorf("unexpected failed step: %+v", r)
+	}
+	if r := report.Steps[3]; r.Snapshot != "20260101-000000" {
+		t.Errorf("unexpected snapshot step: %+v", r)
+	}
+	if r := report.Steps[4]; r.ExitCode != nil || r.Error == "" {
+		t.Errorf("unexpected timed out step: %+v", r)
+	}
+	if len(sb.ran) != 5 {
+		t.Errorf("ran %v, want the last step skipped", sb.ran)
+	}
+	if progress.String() != "hello\nboom\n" {
+		t.Errorf("progress = %q", progress.String())
+	}
+}
@@ -0,0 +1,228 @@
+package broker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ContainerDir is where the broker directory is mounted inside the sandbox.
+const ContainerDir = "/run/airlock/broker"
+
+// ClientName is the in-container client script agents run to ask for access.
+const ClientName = "airlock-request"
+
+// Request kinds.
+const (
+	KindMount  = "mount"
+	KindPort   = "port"
+	KindDomain = "domain"
+)
+
+// Request is an access request filed from inside the sandbox.
+type Request struct {
+	ID     string
+	Kind   string
+	Value  string // host path, port mapping, or domain
+	Target string // container path for mounts
+	Mode   string // ro or rw for mounts
+	Reason string
+}
+
+// String describes the request for prompts and the audit log.
+func (r Request) String() string {
+	var s string
+	switch r.Kind {
+	case KindMount:
+		s = fmt.Sprintf("mount %s -> %s (%s)", r.Value, r.Target, r.Mode)
+	default:
+		s = r.Kind + " " + r.Value
+	}
+	if r.Reason != "" {
+		s += ": " + r.Reason
+	}
+	return s
+}
+
+// Dir returns the host-side broker directory for a project.
+func Dir(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "broker")
+}
+
+// Ensure creates the broker directory layout and installs the client script.
+func Ensure(dir string) error {
+	for _, d := range []string{filepath.Join(dir, "pending"), filepath.Join(dir, "done")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return err
+		}
+		if err := checkDir(d); err != nil {
+			return err
+		}
+	}
+	return writeFile(filepath.Join(dir, ClientName), []byte(clientScript), 0755)
+}
+
+// checkDir refuses a broker subdirectory the sandbox replaced with a symlink, which would point the
+// host's reads, writes, and removals elsewhere.
+func checkDir(d string) error {
+	fi, err := os.Lstat(d)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", d)
+	}
+	return nil
+}
+
+// writeFile replaces path's contents through a temp file and a rename. The broker dir is writable
+// from the sandbox, so path may be a planted symlink: it is refused rather than followed.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if fi, err := os.Lstat(path); err == nil && !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Pending returns unresolved requests, oldest first. Malformed requests are rejected immediately
+// so a misbehaving sandbox cannot block the queue.
+func Pending(dir string) ([]Request, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, "pending"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDir(filepath.Join(dir, "pending")); err != nil {
+		return nil, err
+	}
+	var reqs []Request
+	for _, e := range entries {
+		// Symlinks and FIFOs could make the host read its own files or block.
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), ".req") {
+			continue
+		}
+		req, err := parseRequest(filepath.Join(dir, "pending", e.Name()))
+		if err != nil {
+			if err := Resolve(dir, req, "rejected: invalid request: "+err.Error()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].ID < reqs[j].ID })
+	return reqs, nil
+}
+
+// Resolve records the decision for a request where the in-container client can see it.
+func Resolve(dir string, req Request, decision string) error {
+	if err := checkDir(filepath.Join(dir, "done")); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, "done", req.ID+".status"), []byte(decision+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(dir, "pending", req.ID+".req"))
+}
+
+// parseRequest reads a request file of key=value lines, as written by the client script.
+func parseRequest(path string) (Request, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Request{ID: strings.TrimSuffix(filepath.Base(path), ".req")}, err
+	}
+	defer f.Close()
+
+	req := Request{ID: strings.TrimSuffix(filepath.Base(path), ".req")}
+	invalid := func(err error) (Request, error) { return Request{ID: req.ID}, err }
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "kind":
+			req.Kind = v
+		case "value":
+			req.Value = v
+		case "target":
+			req.Target = v
+		case "mode":
+			req.Mode = v
+		case "reason":
+			req.Reason = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return invalid(err)
+	}
+
+	switch req.Kind {
+	case KindMount:
+		if !filepath.IsAbs(req.Value) {
+			return invalid(fmt.Errorf("mount source must be an absolute host path: %q", req.Value))
+		}
+		if req.Target == "" {
+			req.Target = "/mnt/airlock/" + filepath.Base(req.Value)
+		}
+		if req.Mode != "rw" {
+			req.Mode = "ro"
+		}
+	case KindPort, KindDomain:
+		if req.Value == "" {
+			return invalid(fmt.Errorf("%s request without a value", req.Kind))
+		}
+	default:
+		return invalid(fmt.Errorf("unknown request kind %q", req.Kind))
+	}
+	return req, nil
+}
+
+const clientScript = `#!/bin/sh
+# Ask the host for extra access. The request shows up in 'airlock approvals' on the host.
+#
+#   airlock-request mount <host-path> [target] [ro|rw] [reason...]
+#   airlock-request port <host:container> [reason...]
+#   airlock-request domain <domain> [reason...]
+set -e
+dir=/run/airlock/broker
+kind="$1"
+[ -n "$kind" ] && [ -n "$2" ] || { sed -n '2,7p' "$0" | sed 's/^# \{0,1\}//'; exit 2; }
+value="$2"; shift 2
+target=""; mode=""
+if [ "$kind" = mount ]; then
+  case "$1" in /*) target="$1"; shift ;; esac
+  case "$1" in ro|rw) mode="$1"; shift ;; esac
+fi
+id="$(date +%s)-$$"
+tmp="$dir/pending/.$id"
+printf 'kind=%s\nvalue=%s\ntarget=%s\nmode=%s\nreason=%s\n' "$kind" "$value" "$target" "$mode" "$*" | tr -d '\r' > "$tmp"
+mv "$tmp" "$dir/pending/$id.req"
+echo "Request $id filed. Waiting for approval on the host (airlock approvals)..."
+while [ ! -f "$dir/done/$id.status" ]; do sleep 2; done
+status="$(cat "$dir/done/$id.status")"
+echo "Request $id: $status"
+[ "$status" = approved ]
+`
@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPendingAndResolve(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-broker-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Ensure(dir); err != nil {
+		t.Fatalf("Ensure failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ClientName)); err != nil {
+		t.Fatalf("client script not installed: %v", err)
+	}
+
+	reqs := map[string]string{
+		"1-1.req": "kind=mount\nvalue=/data/models\ntarget=\nmode=\nreason=need weights\n",
+		"2-1.req": "kind=domain\nvalue=pypi.org\nreason=\n",
+		".3-1":    "kind=port\nvalue=8080:8080\n", // still being written
+	}
+	for name, body := range reqs {
+		if err := os.WriteFile(filepath.Join(dir, "pending", name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, err := Pending(dir)
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending requests, got %d", len(pending))
+	}
+	m := pending[0]
+	if m.Kind != KindMount || m.Value != "/data/models" || m.Target != "/mnt/airlock/models" || m.Mode != "ro" || m.Reason != "need weights" {
+		t.Errorf("unexpected mount request: %+v", m)
+	}
+	if pending[1].Kind != KindDomain || pending[1].Value != "pypi.org" {
+		t.Errorf("unexpected domain request: %+v", pending[1])
+	}
+
+	if err := Resolve(dir, m, "approved"); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "done", "1-1.status"))
+	if err != nil || string(b) != "approved\n" {
+		t.Errorf("expected approved status, got %q (%v)", string(b), err)
+	}
+	pending, _ = Pending(dir)
+	if len(pending) != 1 {
+		t.Errorf("expected 1 pending request after resolve, got %d", len(pending))
+	}
+}
+
+func TestRejectsInvalidRequest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-broker-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Ensure(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pending", "1-1.req"), []byte("kind=mount\nvalue=../etc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := Pending(dir)
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected invalid request to be dropped, got %+v", pending)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "done", "1-1.status"))
+	if err != nil || len(b) == 0 || string(b[:8]) != "rejected" {
+		t.Errorf("expected request to be rejected, got %q (%v)", string(b), err)
+	}
+}
+
+func TestRefusesPlantedSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(t.TempDir(), "bashrc")
+	if err := os.WriteFile(victim, []byte("keep me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ensure(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A status file pointing at a host file must not be written through.
+	if err := os.Symlink(victim, filepath.Join(dir, "done", "1-1.status")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pending", "1-1.req"), []byte("kind=bogus\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pending(dir); err == nil {
+		t.Errorf("expected a symlinked status file to be refused")
+	}
+
+	// Nor the client script, which Ensure rewrites on every up.
+	if err := os.Remove(filepath.Join(dir, ClientName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, filepath.Join(dir, ClientName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Ensure(dir); err == nil {
+		t.Errorf("expected a symlinked client script to be refused")
+	}
+
+	// A request that is a symlink to a host file is not read.
+	if err := os.Symlink(victim, filepath.Join(dir, "pending", "2-1.req")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "pending", "1-1.req")); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := Pending(dir); err != nil || len(pending) != 0 {
+		t.Errorf("expected a symlinked request to be skipped, got %+v (%v)", pending, err)
+	}
+
+	// A done dir replaced with a symlink to another directory is refused.
+	if err := os.RemoveAll(filepath.Join(dir, "done")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Dir(victim), filepath.Join(dir, "done")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resolve(dir, Request{ID: "bashrc"}, "approved"); err == nil {
+		t.Errorf("expected a symlinked done dir to be refused")
+	}
+
+	if b, _ := os.ReadFile(victim); string(b) != "keep me\n" {
+		t.Errorf("host file was overwritten: %q", b)
+	}
+}
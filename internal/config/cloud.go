@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cloud mints short-lived cloud credentials with host tooling each time a session starts. Only
+// the temporary tokens enter the sandbox; the long-lived keys used to mint them stay on the host.
+type Cloud struct {
+	AWS *AWSCredentials `yaml:"aws"`
+	GCP *GCPCredentials `yaml:"gcp"`
+}
+
+// AWSCredentials assumes an IAM role with `aws sts assume-role`.
+type AWSCredentials struct {
+	RoleARN string `yaml:"roleArn"`
+	// Profile is the host AWS CLI profile used to assume the role; empty uses the default chain.
+	Profile  string   `yaml:"profile"`
+	Region   string   `yaml:"region"`
+	Duration Duration `yaml:"duration"` // 15m to 12h; defaults to 1h
+}
+
+// GCPCredentials impersonates a service account with `gcloud auth print-access-token`. Access
+// tokens last an hour.
+type GCPCredentials struct {
+	ServiceAccount string `yaml:"serviceAccount"`
+}
+
+func (c *Cloud) validate() error {
+	if c.AWS != nil {
+		if c.AWS.RoleARN == "" {
+			return errors.New("cloud.aws.roleArn is required")
+		}
+		if d := time.Duration(c.AWS.Duration); d != 0 && (d < 15*time.Minute || d > 12*time.Hour) {
+			return fmt.Errorf("cloud.aws.duration must be between 15m and 12h, got %s", d)
+		}
+	}
+	if c.GCP != nil && c.GCP.ServiceAccount == "" {
+		return errors.New("cloud.gcp.serviceAccount is required")
+	}
+	return nil
+}
+
+// Env mints the configured credentials and returns them as KEY=VALUE pairs for a session.
+func (c *Cloud) Env(ctx context.Context, projectName string) ([]string, error) {
+	var env []string
+	if c.AWS != nil {
+		aws, err := c.AWS.mint(ctx, projectName)
+		if err != nil {
+			return nil, fmt.Errorf("cloud.aws: %w", err)
+		}
+		env = append(env, aws...)
+	}
+	if c.GCP != nil {
+		token, err := hostCommand(ctx, "gcloud", "auth", "print-access-token", "--impersonate-service-account="+c.GCP.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("cloud.gcp: %w", err)
+		}
+		token = strings.TrimSpace(token)
+		// gcloud and the Terraform google provider read these.
+		env = append(env, "CLOUDSDK_AUTH_ACCESS_TOKEN="+token, "GOOGLE_OAUTH_ACCESS_TOKEN="+token)
+	}
+	return env, nil
+}
+
+var sessionNameInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+
+func (a *AWSCredentials) mint(ctx context.Context, projectName string) ([]string, error) {
+	duration := time.Duration(a.Duration)
+	if duration == 0 {
+		duration = time.Hour
+	}
+	// Session names show up in CloudTrail, so make them identify the sandbox.
+	session := sessionNameInvalid.ReplaceAllString("airlock-"+projectName, "-")
+	if len(session) > 64 {
+		session = session[:64]
+	}
+	args := []string{"sts", "assume-role", "--role-arn", a.RoleARN, "--role-session-name", session,
+		"--duration-seconds", strconv.Itoa(int(duration.Seconds())), "--output", "json"}
+	if a.Profile != "" {
+		args = append(args, "--profile", a.Profile)
+	}
+	out, err := hostCommand(ctx, "aws", args...)
+	if err != nil {
+		return nil, err
+	}
+	env, err := parseAssumeRole([]byte(out))
+	if err != nil {
+		return nil, err
+	}
+	if a.Region != "" {
+		env = append(env, "AWS_REGION="+a.Region, "AWS_DEFAULT_REGION="+a.Region)
+	}
+	return env, nil
+}
+
+// parseAssumeRole turns `aws sts assume-role` output into the AWS SDK's env variables.
+func parseAssumeRole(out []byte) ([]string, error) {
+	var resp struct {
+		Credentials struct {
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      string
+		}
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("unexpected assume-role output: %w", err)
+	}
+	cr := resp.Credentials
+	if cr.AccessKeyId == "" || cr.SecretAccessKey == "" || cr.SessionToken == "" {
+		return nil, errors.New("assume-role returned no credentials")
+	}
+	return []string{
+		"AWS_ACCESS_KEY_ID=" + cr.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY=" + cr.SecretAccessKey,
+		"AWS_SESSION_TOKEN=" + cr.SessionToken,
+		"AWS_CREDENTIAL_EXPIRATION=" + cr.Expiration,
+	}, nil
+}
+
+// hostCommand runs a host CLI and returns its stdout, folding stderr into the error.
+func hostCommand(ctx context.Context, name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s CLI not found on the host", name)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s failed: %s", name, args[0], msg)
+		}
+		return "", fmt.Errorf("%s %s failed: %w", name, args[0], err)
+	}
+	return string(out), nil
+}
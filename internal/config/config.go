@@ -3,9 +3,14 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,11 +21,107 @@ type Config struct {
 	WorkDir    string       `yaml:"workdir"`    // defaults to "."
 	Image      string       `yaml:"image"`
 	Build      *BuildConfig `yaml:"build"`
-	Engine     string       `yaml:"engine"` // "podman" or "docker" or empty
+	Engine     EngineConfig `yaml:"engine"`
 	HomeDir    string       `yaml:"home"`
 	CacheDir   string       `yaml:"cache"`
 	Mounts     []Mount      `yaml:"mounts"`
-	Env        EnvVars      `yaml:"env"`
+	// Tmpfs lists in-memory scratch directories, e.g. /tmp or a tool's cache, that are emptied when
+	// the container stops.
+	Tmpfs []Tmpfs `yaml:"tmpfs"`
+	// Platform is the os/arch[/variant] the sandbox image is built, pulled, and run for, e.g.
+	// linux/amd64 on an arm64 host (emulated). Empty uses the engine's native platform.
+	Platform string `yaml:"platform"`
+	// Sync keeps a copy of the workspace on an engine volume in sync with the host instead of
+	// bind mounting it (see SyncConfig).
+	Sync *SyncConfig `yaml:"sync"`
+	// ContainerWorkDir is where workdir is mounted in the container and where sessions start.
+	// Defaults to the target of a mount of workdir, else the image's WorkingDir, else /workspace.
+	ContainerWorkDir string `yaml:"containerWorkdir"`
+	// User overrides the image's user (see User).
+	User *User `yaml:"user"`
+	// Command replaces `sleep infinity` as the container's main process, e.g. a dev server that
+	// `airlock attach` connects to. It runs with a TTY and stdin open.
+	Command []string `yaml:"command"`
+	// DetachKeys is the key sequence that detaches `airlock attach` from the main process
+	// (default ctrl-p,ctrl-q).
+	DetachKeys string `yaml:"detachKeys"`
+	// Protect lists workspace globs (e.g. ".github/workflows/**") mounted read-only in the sandbox.
+	Protect []string `yaml:"protect"`
+	Ports   []Port   `yaml:"ports"`
+	Env     EnvVars  `yaml:"env"`
+	// EnvFile lists dotenv files (relative to the project root) read when a session starts.
+	// Entries in env take precedence over them.
+	EnvFile StringList `yaml:"envFile"`
+	// EnvSources are env entries resolved on the host when a session starts (see EnvSource).
+	EnvSources map[string]EnvSource `yaml:"-"`
+	// Cloud mints short-lived cloud credentials for each session (see Cloud).
+	Cloud *Cloud `yaml:"cloud"`
+	// SSO forwards host Kerberos tickets and SSO helper sockets, read-only (see SSO).
+	SSO       *SSO      `yaml:"sso"`
+	Network   Network   `yaml:"network"`
+	Resources Resources `yaml:"resources"`
+	Shell     Shell     `yaml:"shell"`
+	Propagate Propagate `yaml:"propagate"`
+	Git       Git       `yaml:"git"`
+	Hooks     Hooks     `yaml:"hooks"`
+	Security  Security  `yaml:"security"`
+	Approvals bool      `yaml:"approvals"` // let the sandbox request extra access via airlock-request
+	// Policy is a preset of network, capability, protect, envDeny, and resource settings: strict,
+	// standard, or open (see policyPresets).
+	Policy string `yaml:"policy"`
+	// EnvDeny lists glob patterns of env names (e.g. "*TOKEN*") never passed from the host into the
+	// sandbox through env, envFile, or -e. fromFile, fromCommand, and cloud credentials are exempt.
+	EnvDeny []string `yaml:"envDeny"`
+	// SharedHost namespaces containers, networks, and state dirs per UNIX user, for dev servers
+	// where several engineers share one engine (see SharedHostEnv). Usually set in the local config.
+	SharedHost bool `yaml:"sharedHost"`
+	// Owner is the (sanitized) UNIX user a shared-host project belongs to.
+	Owner string `yaml:"-"`
+	// CrossPlatform defaults git and shell settings for a workspace shared with a Windows or macOS
+	// host: git.autocrlf input, git.fileMode false, git.safeDirectory, and shell.umask 0022.
+	CrossPlatform bool `yaml:"crossPlatform"`
+	// NestedContainers prepares the sandbox for running podman inside it (e.g. for testcontainers).
+	NestedContainers bool `yaml:"nestedContainers"`
+	// EngineSocket exposes a filtered engine API to the sandbox instead of the raw socket.
+	EngineSocket *EngineSocket `yaml:"engineSocket"`
+	// Services are auxiliary containers started by up on a network shared with the sandbox.
+	Services map[string]Service `yaml:"services"`
+	// Compose is an existing compose stack managed alongside the sandbox.
+	Compose  *Compose           `yaml:"compose"`
+	GC       GC                 `yaml:"gc"`
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Instances declare per-instance settings for `airlock --instance` (see Instance).
+	Instances map[string]Instance `yaml:"instances"`
+	// Labels and Annotations are added to the sandbox and service containers (and labels to built
+	// images), e.g. for inventory systems. Keys starting with "airlock." are reserved.
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+
+	// Profile is the profile applied by ApplyProfile, if any.
+	Profile string `yaml:"-"`
+	// Instance is the instance applied by ApplyInstance, if any.
+	Instance string `yaml:"-"`
+	// ContainerName, when set, names the sandbox container instead of Name, for a throwaway copy
+	// of it (exec --network). Volumes, networks, and labels stay the project's.
+	ContainerName string `yaml:"-"`
+
+	// ExecDir is the directory, relative to the workspace mount, that enter/exec start in.
+	// It is set by subdirectory overlays and is empty when commands run from the project root.
+	ExecDir string `yaml:"-"`
+	// ExecEnv is the env set by subdirectory overlays. Only enter/exec sessions get it, so it
+	// never changes the container the whole project shares.
+	ExecEnv EnvVars `yaml:"-"`
+	// Overlays lists the overlay files applied on top of the root config, outermost first.
+	Overlays []string `yaml:"-"`
+}
+
+// Overlay is an airlock.yaml fragment in a project subdirectory, marked with `overlay: true`.
+// When a command is invoked from within that subtree it is layered on top of the root config
+// while still reusing the root project's sandbox container.
+type Overlay struct {
+	Overlay bool    `yaml:"overlay"`
+	WorkDir string  `yaml:"workdir"` // relative to the overlay's directory; defaults to "."
+	Env     EnvVars `yaml:"env"`
 }
 
 type EnvVars map[string]string
@@ -31,12 +132,17 @@ func (e *EnvVars) UnmarshalYAML(value *yaml.Node) error {
 	}
 	switch value.Kind {
 	case yaml.MappingNode:
-		var m map[string]string
-		if err := value.Decode(&m); err != nil {
-			return err
-		}
-		for k, v := range m {
-			(*e)[k] = v
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			k, v := value.Content[i], value.Content[i+1]
+			// {fromFile: ...} and {fromCommand: ...} values are collected into Config.EnvSources.
+			if v.Kind == yaml.MappingNode {
+				continue
+			}
+			var s string
+			if err := v.Decode(&s); err != nil {
+				return err
+			}
+			(*e)[k.Value] = s
 		}
 	case yaml.SequenceNode:
 		var s []string
@@ -58,16 +164,376 @@ func (e *EnvVars) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// Network modes.
+const (
+	NetworkBridge = "bridge" // the engine's default isolated network
+	NetworkNone   = "none"   // no network at all
+	NetworkHost   = "host"   // share the host's network stack (no isolation)
+)
+
+// Network configures the sandbox's network isolation.
+type Network struct {
+	Mode string `yaml:"mode"` // bridge (default), none, or host
+	// Allow restricts egress to these domains, IPs, and CIDRs (plus DNS). Empty means unrestricted.
+	// Domains are resolved on the host each time the policy is applied. Requires bridge mode.
+	Allow []string `yaml:"allow"`
+	// Profiles are named egress allowlists for running a single command more strictly than the
+	// container default, e.g. `airlock exec --network allowlist:registry -- npm ci`.
+	Profiles map[string][]string `yaml:"profiles"`
+	// ExtraHosts adds /etc/hosts entries mapping a hostname to an IP (or host-gateway, the host),
+	// e.g. for internal services the sandbox's resolvers don't know.
+	ExtraHosts map[string]string `yaml:"extraHosts"`
+	// DNS and DNSSearch replace the engine's resolvers and search domains, e.g. with a corporate
+	// network's. Require bridge mode.
+	DNS       []string `yaml:"dns"`
+	DNSSearch []string `yaml:"dnsSearch"`
+}
+
+// HostGateway is the extraHosts address the engine replaces with the host's.
+const HostGateway = "host-gateway"
+
+var hostnameRe = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_])?$`)
+
+// validateResolution checks extraHosts, dns, and dnsSearch.
+func (n Network) validateResolution() error {
+	for host, addr := range n.ExtraHosts {
+		if !hostnameRe.MatchString(host) {
+			return fmt.Errorf("network.extraHosts: %q is not a hostname", host)
+		}
+		if addr != HostGateway && net.ParseIP(addr) == nil {
+			return fmt.Errorf("network.extraHosts.%s must be an IP address or %q, got %q", host, HostGateway, addr)
+		}
+	}
+	if (len(n.DNS) > 0 || len(n.DNSSearch) > 0) && n.Mode != NetworkBridge {
+		return fmt.Errorf("network.dns and network.dnsSearch require network.mode %q (got %q)", NetworkBridge, n.Mode)
+	}
+	for _, ip := range n.DNS {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("network.dns: %q is not an IP address", ip)
+		}
+	}
+	for _, domain := range n.DNSSearch {
+		if !hostnameRe.MatchString(domain) {
+			return fmt.Errorf("network.dnsSearch: %q is not a domain", domain)
+		}
+	}
+	return nil
+}
+
+// Restrict returns the network policy described by spec ("none" or "allowlist:<profile>"). The
+// result may only be stricter than n: an allowlist can't add destinations n.Allow doesn't permit,
+// and nothing loosens a container without network.
+func (n Network) Restrict(spec string) (Network, error) {
+	if spec == NetworkNone {
+		return Network{Mode: NetworkNone, ExtraHosts: n.ExtraHosts}, nil
+	}
+	profile, ok := strings.CutPrefix(spec, "allowlist:")
+	if !ok {
+		return Network{}, fmt.Errorf("network override must be %q or \"allowlist:<profile>\", got %q", NetworkNone, spec)
+	}
+	allow, ok := n.Profiles[profile]
+	if !ok {
+		return Network{}, fmt.Errorf("network profile %q is not defined in network.profiles", profile)
+	}
+	if n.Mode == NetworkNone {
+		return Network{}, fmt.Errorf("the sandbox has no network; allowlist:%s would loosen it", profile)
+	}
+	if len(n.Allow) > 0 {
+		permitted := map[string]bool{}
+		for _, a := range n.Allow {
+			permitted[a] = true
+		}
+		for _, a := range allow {
+			if !permitted[a] {
+				return Network{}, fmt.Errorf("network profile %q allows %s, which network.allow does not; a per-command policy can only narrow it", profile, a)
+			}
+		}
+	}
+	return Network{Mode: NetworkBridge, Allow: allow, ExtraHosts: n.ExtraHosts, DNS: n.DNS, DNSSearch: n.DNSSearch}, nil
+}
+
+// Resources caps what the sandbox may consume. Zero values leave the engine default (unlimited).
+type Resources struct {
+	CPUs   float64  `yaml:"cpus"`   // e.g. 2 or 1.5
+	Memory ByteSize `yaml:"memory"` // e.g. 4g
+	Pids   int64    `yaml:"pids"`   // max processes/threads, e.g. 512
+}
+
+// Shell modes control how enter and exec start commands.
+const (
+	ShellLogin = "login" // wrap in a login shell (`bash -l`), sourcing profiles
+	ShellPlain = "plain" // wrap in a non-login shell
+	ShellNone  = "none"  // run argv directly, no shell (exec only)
+)
+
+// Shell configures the shell used by enter and exec.
+type Shell struct {
+	Program string `yaml:"program"` // default "bash"
+	Enter   string `yaml:"enter"`   // login or plain (default)
+	Exec    string `yaml:"exec"`    // login, plain, or none (default)
+	Umask   string `yaml:"umask"`   // octal umask for enter, exec, and hook sessions, e.g. "0022"
+}
+
+var umaskRe = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// Propagate carries host settings into the sandbox, so timestamps and sorting match the host's.
+type Propagate struct {
+	Timezone bool `yaml:"timezone"` // the host's TZ, with /etc/localtime mounted read-only
+	Locale   bool `yaml:"locale"`   // the host's LANG
+}
+
+// Hooks are shell commands run at lifecycle points. Most run inside the container (as the sandbox
+// user, in the workdir); OnExit and OnDown run on the host, in the project dir, for cleanup such as
+// revoking credentials issued for a session.
+type Hooks struct {
+	PostCreate []string `yaml:"postCreate"` // once, after the container is first created and started
+	PostStart  []string `yaml:"postStart"`  // every time the container is started
+	PreStop    []string `yaml:"preStop"`    // before the container is stopped by down
+	OnExit     []string `yaml:"onExit"`     // on the host, after each enter/exec session ends
+	OnDown     []string `yaml:"onDown"`     // on the host, after down removed the container
+}
+
+// Git controls how the host's git setup is carried into the sandbox home on up.
+type Git struct {
+	// Identity copies the host's user.name and user.email into the sandbox's ~/.gitconfig.
+	Identity bool `yaml:"identity"`
+	// Credentials lists hosts (e.g. github.com) whose credentials are fetched from the host's git
+	// credential helper and stored in the sandbox home for git's "store" helper.
+	Credentials []string `yaml:"credentials"`
+	// AutoCRLF sets core.autocrlf in the sandbox: "input" commits LF even if a tool writes CRLF.
+	AutoCRLF string `yaml:"autocrlf"`
+	// FileMode false sets core.fileMode false, so the mode bits a Windows or macOS mount reports
+	// (often 0777) don't show up as changes.
+	FileMode *bool `yaml:"fileMode"`
+	// SafeDirectory marks repositories as safe in the sandbox, for mounts owned by another uid.
+	SafeDirectory bool `yaml:"safeDirectory"`
+	// Provenance adds Airlock-Session and Airlock-Agent trailers to commits made in the sandbox,
+	// so `airlock audit commits` can match them to sessions.
+	Provenance bool `yaml:"provenance"`
+}
+
+// Security holds sandbox hardening and auditing options.
+type Security struct {
+	// AuditSyscalls runs the sandbox under a logging seccomp profile so unusual syscalls show up
+	// in the host kernel log (see `airlock audit syscalls`). The profile allows no more than the
+	// engine's default one. Takes effect when the container is created.
+	AuditSyscalls bool `yaml:"auditSyscalls"`
+	// CapDrop lists Linux capabilities dropped from the sandbox, e.g. NET_RAW, or ALL.
+	CapDrop []string `yaml:"capDrop"`
+	// CapAdd lists Linux capabilities granted to the sandbox, applied after CapDrop, so
+	// capDrop: [ALL] with capAdd: [CHOWN] keeps only CHOWN.
+	CapAdd []string `yaml:"capAdd"`
+	// Hardened starts from minimum privilege: it drops all capabilities (capAdd grants back what the
+	// project needs).
+	Hardened bool `yaml:"hardened"`
+	// SeccompProfile is a seccomp profile JSON file, relative to the project, that replaces the
+	// engine's default profile; "unconfined" disables seccomp filtering.
+	SeccompProfile string `yaml:"seccompProfile"`
+	// ApparmorProfile is an AppArmor profile file in the project, or the name of a profile loaded on
+	// the host, to confine the sandbox with instead of the engine's default.
+	ApparmorProfile string `yaml:"apparmorProfile"`
+	// NoNewPrivileges stops sandbox processes from gaining privileges through setuid binaries or
+	// file capabilities (e.g. sudo). Defaults to on, except with nestedContainers or privileged.
+	NoNewPrivileges *bool `yaml:"noNewPrivileges"`
+	// Privileged runs the sandbox with every capability and the host's devices, for projects that
+	// talk to hardware. It removes most of the isolation airlock provides.
+	Privileged bool `yaml:"privileged"`
+	// ReadOnlyRootfs mounts the container's root filesystem read-only, with tmpfs on /tmp, /var/tmp,
+	// and /run, so only the workspace, home, cache, and mounts are writable.
+	ReadOnlyRootfs bool `yaml:"readOnlyRootfs"`
+}
+
+// EngineSocket configures the filtering engine socket proxy. The sandbox sees a Docker API socket
+// (DOCKER_HOST) that only pulls, builds, and runs the listed images, never privileged or with host
+// mounts or namespaces, and only manages containers it created itself.
+type EngineSocket struct {
+	// Images are glob patterns of allowed image references, e.g. "postgres:*" or "ghcr.io/acme/*:*".
+	Images []string `yaml:"images"`
+}
+
+func (e *EngineSocket) validate() error {
+	if len(e.Images) == 0 {
+		return errors.New("engineSocket.images must list at least one allowed image pattern")
+	}
+	for _, img := range e.Images {
+		if _, err := path.Match(img, ""); err != nil {
+			return fmt.Errorf("engineSocket.images: %q: %w", img, err)
+		}
+	}
+	return nil
+}
+
+// GC is the automatic cleanup policy, enforced opportunistically on up/down. Zero values disable each rule.
+type GC struct {
+	RemoveStoppedAfter Duration `yaml:"removeStoppedAfter"` // remove stopped airlock containers older than this, e.g. 14d
+	KeepImages         int      `yaml:"keepImages"`         // keep only the N most recent builds of this project's image
+	MaxCacheSize       ByteSize `yaml:"maxCacheSize"`       // trim the cache dir (oldest files first) above this size, e.g. 10g
+}
+
+// validateProtect checks that a protect glob is relative to the workspace and well-formed.
+func validateProtect(pattern string) error {
+	return validateRelGlob("protect", "the workspace", pattern)
+}
+
+// validateRelGlob checks that the field's glob is relative to dir and well-formed.
+func validateRelGlob(field, dir, pattern string) error {
+	if pattern == "" || path.IsAbs(pattern) || filepath.IsAbs(pattern) {
+		return fmt.Errorf("%s: %q must be a glob relative to %s", field, pattern, dir)
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == ".." {
+			return fmt.Errorf("%s: %q must not leave %s", field, pattern, dir)
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("%s: %q: %w", field, pattern, err)
+		}
+	}
+	return nil
+}
+
+var platformRe = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
 type BuildConfig struct {
 	Context       string `yaml:"context"`
 	Containerfile string `yaml:"containerfile"`
 	Tag           string `yaml:"tag"`
+	// Inputs are globs, relative to the context, of files the image depends on besides the
+	// Containerfile (e.g. a lockfile it installs from). A change to any of them rebuilds the image.
+	Inputs []string `yaml:"inputs"`
+	// AutoRecreate recreates the container when the image is rebuilt for a changed Containerfile or
+	// input, instead of asking first.
+	AutoRecreate bool `yaml:"autoRecreate"`
+	// CacheFrom are build caches to import layers from: registry repositories, or host directories
+	// (starting with "." or "/", relative to the project) that a cacheTo build exported to.
+	CacheFrom []string `yaml:"cacheFrom"`
+	// CacheTo is a registry repository or host directory to export the build cache to after each
+	// build.
+	CacheTo string `yaml:"cacheTo"`
+	// Publish is the registry reference `airlock push` tags and pushes the built image to, e.g.
+	// ghcr.io/acme/dev:latest.
+	Publish string `yaml:"publish"`
 }
 
+// Mount types.
+const (
+	MountBind   = "bind"   // a host path (the default)
+	MountVolume = "volume" // an engine-managed named volume
+	MountTmpfs  = "tmpfs"  // an in-memory filesystem
+)
+
 type Mount struct {
-	Source string `yaml:"source"`
+	Source string `yaml:"source"` // host path; for a volume, its name (defaults to one derived from target)
 	Target string `yaml:"target"`
 	Mode   string `yaml:"mode"` // "rw" or "ro"
+	Type   string `yaml:"type"` // MountBind (default), MountVolume, or MountTmpfs
+	// Options are engine mount options, e.g. cached or delegated on Docker Desktop, or z for a
+	// shared SELinux label. z, Z, or nolabel replace the automatic SELinux relabeling (Z).
+	Options []string `yaml:"options"`
+	// Exclude lists globs, relative to a bind mount's source (e.g. "node_modules" or
+	// "**/target"), of directories hidden behind empty volumes, so their contents stay on one side
+	// of the mount.
+	Exclude []string `yaml:"exclude"`
+}
+
+// IsBind reports whether m binds a host path.
+func (m Mount) IsBind() bool { return m.Type == "" || m.Type == MountBind }
+
+// Tmpfs is an in-memory filesystem mounted in the sandbox.
+type Tmpfs struct {
+	Target string   `yaml:"target"`
+	Size   ByteSize `yaml:"size"` // e.g. 512m; unset is the engine's default (half the memory)
+	Mode   string   `yaml:"mode"` // octal permissions, defaults to 1777
+}
+
+// TmpfsMounts returns the tmpfs entries followed by the mounts of type MountTmpfs, which are
+// shorthand for entries with the default size and mode.
+func (c *Config) TmpfsMounts() []Tmpfs {
+	tmpfs := slices.Clone(c.Tmpfs)
+	for _, m := range c.Mounts {
+		if m.Type == MountTmpfs {
+			tmpfs = append(tmpfs, Tmpfs{Target: path.Clean(m.Target), Mode: "1777"})
+		}
+	}
+	return tmpfs
+}
+
+var tmpfsModeRe = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// validateTmpfs checks the tmpfs entries and fills in their default mode.
+func (c *Config) validateTmpfs() error {
+	seen := map[string]bool{}
+	for i := range c.Tmpfs {
+		t := &c.Tmpfs[i]
+		if !path.IsAbs(t.Target) || path.Clean(t.Target) == "/" {
+			return fmt.Errorf("tmpfs[%d]: target must be an absolute container path other than /, got %q", i, t.Target)
+		}
+		t.Target = path.Clean(t.Target)
+		if seen[t.Target] {
+			return fmt.Errorf("tmpfs[%d]: %s is listed more than once", i, t.Target)
+		}
+		seen[t.Target] = true
+		if t.Mode == "" {
+			t.Mode = "1777"
+		}
+		if !tmpfsModeRe.MatchString(t.Mode) {
+			return fmt.Errorf("tmpfs[%d]: mode must be octal, e.g. 1777 or 0700, got %q", i, t.Mode)
+		}
+	}
+	return nil
+}
+
+// Sync conflict winners.
+const (
+	SyncPreferHost      = "host"
+	SyncPreferContainer = "container"
+)
+
+// SyncConfig replaces the workspace bind mount with a copy on an engine volume that a background
+// process keeps in sync with the host in both directions, for engines whose bind mounts are slow
+// (Docker Desktop, podman machine) or can't reach the host at all (remote engines).
+type SyncConfig struct {
+	// Ignore lists globs left out of the sync in both directions, e.g. node_modules or *.log. One
+	// containing a slash matches from the workspace root.
+	Ignore []string `yaml:"ignore"`
+	// Interval is how often the background sync runs (default 2s).
+	Interval Duration `yaml:"interval"`
+	// Conflicts is the side whose version wins when a file changed on both: SyncPreferHost (the
+	// default) or SyncPreferContainer. The losing version is kept next to it on the host.
+	Conflicts string `yaml:"conflicts"`
+}
+
+// validateSync checks the sync settings and fills in their defaults.
+func (c *Config) validateSync() error {
+	s := c.Sync
+	if s == nil {
+		return nil
+	}
+	if s.Interval == 0 {
+		s.Interval = Duration(2 * time.Second)
+	}
+	if s.Interval < Duration(100*time.Millisecond) {
+		return fmt.Errorf("sync.interval must be at least 100ms, got %s", time.Duration(s.Interval))
+	}
+	switch s.Conflicts {
+	case "":
+		s.Conflicts = SyncPreferHost
+	case SyncPreferHost, SyncPreferContainer:
+	default:
+		return fmt.Errorf("sync.conflicts must be %q or %q, got %q", SyncPreferHost, SyncPreferContainer, s.Conflicts)
+	}
+	for _, pattern := range s.Ignore {
+		if err := validateRelGlob("sync.ignore", "the workspace", pattern); err != nil {
+			return err
+		}
+	}
+	if c.ContainerWorkDir != "" {
+		for _, m := range c.Mounts {
+			if path.Clean(m.Target) == path.Clean(c.ContainerWorkDir) {
+				return fmt.Errorf("mounts: %s is the workspace, which sync keeps on its own volume", m.Target)
+			}
+		}
+	}
+	return nil
 }
 
 func Load(path string) (*Config, error) {
@@ -76,10 +542,21 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if isOverlayFile(path) {
+		return nil, fmt.Errorf("%s is a subdirectory overlay (overlay: true), not a project config", path)
+	}
+
 	var c Config
 	if err := yaml.Unmarshal(b, &c); err != nil {
 		return nil, err
 	}
+	if err := c.mergeEnvSources(b, false); err != nil {
+		return nil, err
+	}
+	// Like env sources, host hooks run on the host, so the sandbox must not be able to set them.
+	if len(c.Hooks.OnExit) > 0 || len(c.Hooks.OnDown) > 0 {
+		return nil, errors.New("hooks.onExit and hooks.onDown run on the host, so they are only honored in .airlock/airlock.local.yaml, which the sandbox can't edit")
+	}
 
 	// Try to load .airlock/airlock.local.yaml relative to the config file or project root
 	localPath := filepath.Join(filepath.Dir(path), ".airlock", "airlock.local.yaml")
@@ -91,6 +568,9 @@ func Load(path string) (*Config, error) {
 			if err := yaml.Unmarshal(lb, &c); err != nil {
 				return nil, fmt.Errorf("failed to parse local config: %w", err)
 			}
+			if err := c.mergeEnvSources(lb, true); err != nil {
+				return nil, fmt.Errorf("failed to parse local config: %w", err)
+			}
 			// Re-read both to handle fieldMentioned/fieldWasExplicitlyFalse if we want to be very precise,
 			// but for now let's focus on the primary merge.
 			// We combine the bytes for the fieldMentioned checks later.
@@ -99,30 +579,54 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
+	if err := c.interpolate(); err != nil {
+		return nil, err
+	}
+
 	// defaults
 	dir := filepath.Dir(path)
+
+	grants, err := ReadGrants(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grants: %w", err)
+	}
+	c.applyGrants(grants)
+
 	if c.Name == "" {
 		c.Name = filepath.Base(dir)
 	}
+	if err := c.applySharedHost(); err != nil {
+		return nil, err
+	}
 	if c.ProjectDir == "" {
 		c.ProjectDir = dir
 	}
 	if c.WorkDir == "" {
 		c.WorkDir = "."
 	}
+	if c.ContainerWorkDir != "" && (!strings.HasPrefix(c.ContainerWorkDir, "/") || strings.Trim(c.ContainerWorkDir, "/") == "") {
+		return nil, fmt.Errorf("containerWorkdir must be an absolute container path other than /, got %q", c.ContainerWorkDir)
+	}
+
+	if err := c.validateTmpfs(); err != nil {
+		return nil, err
+	}
+	if err := c.validateSync(); err != nil {
+		return nil, err
+	}
 
-	if c.Image != "" && c.Build != nil {
-		return nil, errors.New("Only one of either Image or Build can be configured")
+	if c.Platform != "" && !platformRe.MatchString(c.Platform) {
+		return nil, fmt.Errorf("platform must be os/arch or os/arch/variant, e.g. linux/amd64, got %q", c.Platform)
 	}
 
 	// If neither image nor build is set, try to default to build if Containerfile exists
 	if c.Image == "" && c.Build == nil {
-		if _, err := os.Stat("Containerfile"); err == nil {
+		if _, err := os.Stat(filepath.Join(dir, "Containerfile")); err == nil {
 			c.Build = &BuildConfig{
 				Context:       ".",
 				Containerfile: "Containerfile",
 			}
-		} else if _, err := os.Stat("env/Containerfile"); err == nil {
+		} else if _, err := os.Stat(filepath.Join(dir, "env", "Containerfile")); err == nil {
 			c.Build = &BuildConfig{
 				Context:       "./env",
 				Containerfile: "./env/Containerfile",
@@ -140,6 +644,20 @@ func Load(path string) (*Config, error) {
 		if c.Build.Tag == "" {
 			c.Build.Tag = "airlock:" + sanitizeTag(c.Name)
 		}
+		for _, pattern := range c.Build.Inputs {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("build.inputs: %q: %w", pattern, err)
+			}
+		}
+		// Entries interpolated to nothing (e.g. ${CACHE_REPO:-} outside CI) are dropped.
+		var cacheFrom []string
+		for _, ref := range c.Build.CacheFrom {
+			if ref = strings.TrimSpace(ref); ref != "" {
+				cacheFrom = append(cacheFrom, ref)
+			}
+		}
+		c.Build.CacheFrom = cacheFrom
+		c.Build.CacheTo = strings.TrimSpace(c.Build.CacheTo)
 	}
 
 	if c.HomeDir == "" {
@@ -153,12 +671,279 @@ func Load(path string) (*Config, error) {
 		c.Env = EnvVars{}
 	}
 
+	if err := c.applyPolicy(); err != nil {
+		return nil, err
+	}
+	c.applyHardened()
+	if err := c.Security.normalizeCaps(); err != nil {
+		return nil, err
+	}
+	if c.Network.Mode == "" {
+		c.Network.Mode = NetworkBridge
+	}
+	switch c.Network.Mode {
+	case NetworkBridge:
+	case NetworkNone, NetworkHost:
+		if len(c.Network.Allow) > 0 {
+			return nil, fmt.Errorf("network.allow requires network.mode %q (got %q)", NetworkBridge, c.Network.Mode)
+		}
+	default:
+		return nil, fmt.Errorf("network.mode must be %q, %q, or %q, got %q", NetworkBridge, NetworkNone, NetworkHost, c.Network.Mode)
+	}
+	if err := c.Network.validateResolution(); err != nil {
+		return nil, err
+	}
+	for name := range c.Instances {
+		if !instanceNameRe.MatchString(name) {
+			return nil, fmt.Errorf("instances.%s: names must start with a letter or digit and contain only letters, digits, '_', '.', and '-'", name)
+		}
+	}
+	for name, allow := range c.Network.Profiles {
+		// An empty allowlist means unrestricted, the opposite of what a profile is for.
+		if len(allow) == 0 {
+			return nil, fmt.Errorf("network.profiles.%s must list at least one destination", name)
+		}
+	}
+
+	if c.NestedContainers {
+		for _, cp := range c.Security.CapDrop {
+			if cp == "ALL" {
+				return nil, errors.New("nestedContainers can't be combined with security.capDrop ALL (or policy strict, or security.hardened): an inner engine needs capabilities such as SYS_ADMIN")
+			}
+		}
+	}
+	if c.NestedContainers && c.Security.AuditSyscalls {
+		return nil, errors.New("nestedContainers can't be combined with security.auditSyscalls: its seccomp profile blocks the mounts nested containers need")
+	}
+	if c.NestedContainers && (c.Security.SeccompProfile != "" || c.Security.ApparmorProfile != "") {
+		return nil, errors.New("nestedContainers can't be combined with security.seccompProfile or security.apparmorProfile: nested containers need seccomp and AppArmor unconfined")
+	}
+	if c.Security.AuditSyscalls && c.Security.SeccompProfile != "" {
+		return nil, errors.New("security.auditSyscalls and security.seccompProfile both set the seccomp profile; use one")
+	}
+	if c.Security.Privileged && c.Security.Hardened {
+		return nil, errors.New("security.privileged and security.hardened contradict each other; use one")
+	}
+	if nnp := c.Security.NoNewPrivileges; nnp == nil {
+		// Rootless podman in the sandbox needs the setuid newuidmap.
+		on := !c.NestedContainers && !c.Security.Privileged
+		c.Security.NoNewPrivileges = &on
+	} else if *nnp && c.NestedContainers {
+		return nil, errors.New("nestedContainers can't be combined with security.noNewPrivileges: an inner engine needs the setuid newuidmap and newgidmap")
+	}
+
+	if c.Cloud != nil {
+		if err := c.Cloud.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.User != nil {
+		if err := c.User.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.SSO != nil {
+		if err := c.SSO.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Engine.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateServices(); err != nil {
+		return nil, err
+	}
+
+	if c.EngineSocket != nil {
+		if err := c.EngineSocket.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range c.Protect {
+		if err := validateProtect(p); err != nil {
+			return nil, err
+		}
+	}
+	for i, m := range c.Mounts {
+		if len(m.Exclude) > 0 && !m.IsBind() {
+			return nil, fmt.Errorf("mounts[%d]: exclude only applies to bind mounts", i)
+		}
+		for _, p := range m.Exclude {
+			if err := validateRelGlob(fmt.Sprintf("mounts[%d].exclude", i), "the mount's source", p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for field, m := range map[string]map[string]string{"labels": c.Labels, "annotations": c.Annotations} {
+		for k := range m {
+			if k == "" || strings.ContainsAny(k, "= ") || strings.HasPrefix(k, "airlock.") {
+				return nil, fmt.Errorf("%s: invalid key %q (keys can't be empty, contain '=' or spaces, or start with \"airlock.\")", field, k)
+			}
+		}
+	}
+	if err := c.validateEnvDeny(); err != nil {
+		return nil, err
+	}
+
+	if c.Resources.CPUs < 0 || c.Resources.Pids < 0 {
+		return nil, errors.New("resources.cpus and resources.pids must not be negative")
+	}
+
+	if c.Shell.Program == "" {
+		c.Shell.Program = "bash"
+	}
+	if c.Shell.Enter == "" {
+		c.Shell.Enter = ShellPlain
+	}
+	if c.Shell.Exec == "" {
+		c.Shell.Exec = ShellNone
+	}
+	if c.CrossPlatform {
+		if c.Git.AutoCRLF == "" {
+			c.Git.AutoCRLF = "input"
+		}
+		if c.Git.FileMode == nil {
+			off := false
+			c.Git.FileMode = &off
+		}
+		c.Git.SafeDirectory = true
+		if c.Shell.Umask == "" {
+			c.Shell.Umask = "0022"
+		}
+	}
+	if c.Shell.Umask != "" && !umaskRe.MatchString(c.Shell.Umask) {
+		return nil, fmt.Errorf("shell.umask must be an octal mask like 0022, got %q", c.Shell.Umask)
+	}
+	switch c.Git.AutoCRLF {
+	case "", "true", "false", "input":
+	default:
+		return nil, fmt.Errorf("git.autocrlf must be true, false, or input, got %q", c.Git.AutoCRLF)
+	}
+	if c.Shell.Enter != ShellLogin && c.Shell.Enter != ShellPlain {
+		return nil, fmt.Errorf("shell.enter must be %q or %q, got %q", ShellLogin, ShellPlain, c.Shell.Enter)
+	}
+	if c.Shell.Exec != ShellLogin && c.Shell.Exec != ShellPlain && c.Shell.Exec != ShellNone {
+		return nil, fmt.Errorf("shell.exec must be %q, %q, or %q, got %q", ShellLogin, ShellPlain, ShellNone, c.Shell.Exec)
+	}
+
 	if c.Name == "" {
 		return nil, errors.New("name is required")
 	}
 	return &c, nil
 }
 
+// DefaultProjectName is the project name used by init when none is given.
+const DefaultProjectName = "my-project"
+
+// ConfigFileNames are the file names recognized as an airlock project config, in order of preference.
+var ConfigFileNames = []string{"airlock.yaml", "airlock.yml"}
+
+// Find walks up from dir looking for an airlock config file and returns its absolute path.
+// This lets airlock commands be run from any subdirectory of a project. Overlay files are
+// skipped so the root project config is always returned.
+func Find(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range ConfigFileNames {
+			cand := filepath.Join(abs, name)
+			if fi, err := os.Stat(cand); err == nil && !fi.IsDir() && !isOverlayFile(cand) {
+				return cand, nil
+			}
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", fmt.Errorf("no airlock.yaml found in %s or any parent directory", dir)
+		}
+		abs = parent
+	}
+}
+
+// ApplyOverlays layers any overlay files found between dir and the project root on top of c.
+// Overlays are applied outermost first, so the one closest to dir wins.
+func (c *Config) ApplyOverlays(dir string) error {
+	absProj, err := filepath.Abs(c.ProjectDir)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absProj, abs); err != nil || rel == "." || outside(rel) {
+		return nil
+	}
+
+	var paths []string
+	for d := abs; d != absProj; d = filepath.Dir(d) {
+		for _, name := range ConfigFileNames {
+			cand := filepath.Join(d, name)
+			if isOverlayFile(cand) {
+				paths = append([]string{cand}, paths...)
+				break
+			}
+		}
+	}
+
+	workspace := c.WorkDir
+	if !filepath.IsAbs(workspace) {
+		workspace = filepath.Join(absProj, workspace)
+	}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var o Overlay
+		if err := yaml.Unmarshal(b, &o); err != nil {
+			return fmt.Errorf("failed to parse overlay %s: %w", p, err)
+		}
+		for k, v := range o.Env {
+			if c.ExecEnv == nil {
+				c.ExecEnv = EnvVars{}
+			}
+			c.ExecEnv[k] = v
+		}
+		wd := o.WorkDir
+		if wd == "" {
+			wd = "."
+		}
+		rel, err := filepath.Rel(workspace, filepath.Join(filepath.Dir(p), wd))
+		if err == nil && !outside(rel) {
+			c.ExecDir = filepath.ToSlash(rel)
+		}
+		c.Overlays = append(c.Overlays, p)
+	}
+	return nil
+}
+
+// outside reports whether rel, a filepath.Rel result, leaves the base directory. A name that merely
+// starts with ".." (e.g. "..cache") stays inside.
+func outside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isOverlayFile(path string) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var o struct {
+		Overlay bool `yaml:"overlay"`
+	}
+	if err := yaml.Unmarshal(b, &o); err != nil {
+		return false
+	}
+	return o.Overlay
+}
+
 func InitFiles(dir string, name string) error {
 	cfgPath := filepath.Join(dir, "airlock.yaml")
 	localCfgPath := filepath.Join(dir, ".airlock", "airlock.local.yaml")
@@ -166,7 +951,7 @@ func InitFiles(dir string, name string) error {
 	containerfilePath := filepath.Join(dir, "Containerfile")
 
 	if name == "" {
-		name = "my-project"
+		name = DefaultProjectName
 	}
 
 	// config only if missing
@@ -209,6 +994,9 @@ func defaultLocalYAML() string {
 # Properties here will merge with and override airlock.yaml.
 # This is a good place for personal API tokens or local environment overrides.
 
+# Use a different engine than the project's, e.g. with only Docker Desktop installed:
+# engine: docker
+
 env:
   vars:
     # GITHUB_TOKEN: "your-token-here"
@@ -242,6 +1030,10 @@ cache: ./.airlock/cache
 
 workdir: .
 
+# Copy your host git user.name/user.email into the sandbox so commits work out of the box.
+git:
+  identity: true
+
 env:
   - EXAMPLE_VAR: "hello"
 `, name, name)
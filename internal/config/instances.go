@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Instance is a parallel copy of the sandbox, selected with `airlock --instance <name>`, e.g. one
+// per branch an agent works on. Instances don't have to be declared; declaring one lets it use its
+// own workdir (typically a git worktree of the branch) and env.
+type Instance struct {
+	WorkDir string  `yaml:"workdir"`
+	Env     EnvVars `yaml:"env"`
+}
+
+var instanceNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ApplyInstance switches c to the named instance. The instance gets its own container (named after
+// the project and instance) and its own home and cache, next to the project's; the image is shared.
+// An empty name is a no-op.
+func (c *Config) ApplyInstance(name string) error {
+	if name == "" {
+		return nil
+	}
+	if !instanceNameRe.MatchString(name) {
+		return fmt.Errorf("instance name %q must start with a letter or digit and contain only letters, digits, '_', '.', and '-'", name)
+	}
+	if inst, ok := c.Instances[name]; ok {
+		if inst.WorkDir != "" {
+			c.WorkDir = inst.WorkDir
+		}
+		for k, v := range inst.Env {
+			c.Env[k] = v
+			delete(c.EnvSources, k)
+		}
+	}
+	c.Name = c.Name + "-" + name
+	c.HomeDir = c.HomeDir + "-" + name
+	c.CacheDir = c.CacheDir + "-" + name
+	c.Instance = name
+	return nil
+}
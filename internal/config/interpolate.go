@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// interpolate expands ${VAR} and ${VAR:-default} in the config values that commonly differ between
+// machines: the image, platform, and build settings, host paths, mounts, labels and annotations, and env
+// values, including profiles', instances', and services'.
+func (c *Config) interpolate() error {
+	fields := []*string{&c.Image, &c.Platform, &c.WorkDir, &c.ContainerWorkDir, &c.HomeDir, &c.CacheDir}
+	if c.Build != nil {
+		fields = append(fields, &c.Build.Context, &c.Build.Containerfile, &c.Build.Tag, &c.Build.CacheTo, &c.Build.Publish)
+		for i := range c.Build.CacheFrom {
+			fields = append(fields, &c.Build.CacheFrom[i])
+		}
+	}
+	fields = append(fields, mountFields(c.Mounts)...)
+	if c.Compose != nil {
+		fields = append(fields, &c.Compose.File)
+	}
+	envs := []EnvVars{c.Env}
+	for name, p := range c.Profiles {
+		fields = append(fields, mountFields(p.Mounts)...)
+		envs = append(envs, p.Env)
+		if p.Image != "" {
+			v, err := expandVars(p.Image, os.LookupEnv)
+			if err != nil {
+				return err
+			}
+			p.Image = v
+			c.Profiles[name] = p
+		}
+	}
+	for name, inst := range c.Instances {
+		envs = append(envs, inst.Env)
+		v, err := expandVars(inst.WorkDir, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		inst.WorkDir = v
+		c.Instances[name] = inst
+	}
+	for name, s := range c.Services {
+		envs = append(envs, s.Env)
+		v, err := expandVars(s.Image, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		s.Image = v
+		c.Services[name] = s
+	}
+	for _, f := range fields {
+		v, err := expandVars(*f, os.LookupEnv)
+		if err != nil {
+			return err
+		}
+		*f = v
+	}
+	for field, m := range map[string]map[string]string{"labels": c.Labels, "annotations": c.Annotations} {
+		for k, v := range m {
+			expanded, err := expandVars(v, os.LookupEnv)
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", field, k, err)
+			}
+			m[k] = expanded
+		}
+	}
+	for _, env := range envs {
+		for k, v := range env {
+			expanded, err := expandVars(v, os.LookupEnv)
+			if err != nil {
+				return fmt.Errorf("env.%s: %w", k, err)
+			}
+			env[k] = expanded
+		}
+	}
+	return nil
+}
+
+func mountFields(mounts []Mount) []*string {
+	var fields []*string
+	for i := range mounts {
+		fields = append(fields, &mounts[i].Source, &mounts[i].Target)
+	}
+	return fields
+}
+
+// expandVars replaces ${VAR} with the variable's value (empty when unset) and ${VAR:-default} with
+// default when VAR is unset or empty. A bare $VAR is left alone so values such as passwords keep
+// their dollar signs; $${ produces a literal ${.
+func expandVars(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		expr := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def, hasDef := strings.Cut(expr, ":-")
+		if !envKeyName(name) {
+			return "", fmt.Errorf("invalid variable reference ${%s}", expr)
+		}
+		v, _ := lookup(name)
+		if v == "" && hasDef {
+			v = def
+		}
+		b.WriteString(v)
+	}
+}
+
+func envKeyName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
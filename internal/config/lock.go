@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockFileName is the project-level lockfile recording the exact sandbox image in use.
+// Unlike .airlock/ it is meant to be committed alongside airlock.yaml.
+const LockFileName = "airlock.lock"
+
+// Lock pins the sandbox image by reference and image ID.
+type Lock struct {
+	Image   string `yaml:"image"`
+	ImageID string `yaml:"imageId"`
+	// RepoDigest is the image's registry digest (repo@sha256:...), when it was pulled or pushed.
+	// Unlike the image ID, which some engines and image stores compute differently, it is the same
+	// on every machine.
+	RepoDigest string `yaml:"repoDigest,omitempty"`
+}
+
+// ReadLock reads the lockfile from projectDir. It returns nil without error if there is none.
+func ReadLock(projectDir string) (*Lock, error) {
+	b, err := os.ReadFile(filepath.Join(projectDir, LockFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l struct {
+		Lock   `yaml:",inline"`
+		Digest string `yaml:"digest"` // the image ID, in lockfiles written before imageId
+	}
+	if err := yaml.Unmarshal(b, &l); err != nil {
+		return nil, err
+	}
+	if l.ImageID == "" {
+		l.ImageID = l.Digest
+	}
+	return &l.Lock, nil
+}
+
+// WriteLock writes the lockfile into projectDir.
+func WriteLock(projectDir string, l *Lock) error {
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	header := "# Generated by airlock. Pins the sandbox image; commit this file.\n"
+	return os.WriteFile(filepath.Join(projectDir, LockFileName), append([]byte(header), b...), 0644)
+}
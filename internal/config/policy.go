@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Policy presets, from most to least restrictive.
+const (
+	PolicyStrict   = "strict"
+	PolicyStandard = "standard"
+	PolicyOpen     = "open"
+)
+
+// policyPreset bundles the settings a policy fills in. Network mode and resource limits only apply
+// where the config leaves them unset; capability drops, protected paths, and denied env names are
+// added to the config's own, so a preset can't loosen an explicit setting.
+type policyPreset struct {
+	network   string
+	capDrop   []string
+	protect   []string
+	envDeny   []string
+	resources Resources
+}
+
+var secretEnvNames = []string{"*TOKEN*", "*SECRET*", "*PASSWORD*", "*PASSWD*"}
+
+var policyPresets = map[string]policyPreset{
+	PolicyStrict: {
+		network: NetworkNone,
+		capDrop: []string{"ALL"},
+		protect: []string{".git/config", ".git/hooks/**", ".github/workflows/**", ".gitlab-ci.yml", "airlock.yaml"},
+		envDeny: append([]string{"*_KEY", "*_CREDENTIALS", "AWS_*", "SSH_AUTH_SOCK"}, secretEnvNames...),
+		resources: Resources{
+			CPUs:   2,
+			Memory: 4 << 30,
+			Pids:   512,
+		},
+	},
+	PolicyStandard: {
+		capDrop: []string{"AUDIT_WRITE", "MKNOD", "NET_RAW"},
+		protect: []string{".git/hooks/**", ".github/workflows/**"},
+		envDeny: secretEnvNames,
+		resources: Resources{
+			Pids: 4096,
+		},
+	},
+	PolicyOpen: {},
+}
+
+// applyPolicy layers the configured policy preset onto c. It runs before defaults are filled in,
+// so it can tell which settings were left unset.
+func (c *Config) applyPolicy() error {
+	if c.Policy == "" {
+		return nil
+	}
+	p, ok := policyPresets[c.Policy]
+	if !ok {
+		return fmt.Errorf("policy must be %q, %q, or %q, got %q", PolicyStrict, PolicyStandard, PolicyOpen, c.Policy)
+	}
+	// An allowlist needs the bridge network, so it takes precedence over the preset's mode.
+	if c.Network.Mode == "" && len(c.Network.Allow) == 0 {
+		c.Network.Mode = p.network
+	}
+	if c.Resources.CPUs == 0 {
+		c.Resources.CPUs = p.resources.CPUs
+	}
+	if c.Resources.Memory == 0 {
+		c.Resources.Memory = p.resources.Memory
+	}
+	if c.Resources.Pids == 0 {
+		c.Resources.Pids = p.resources.Pids
+	}
+	c.Security.CapDrop = union(c.Security.CapDrop, p.capDrop)
+	c.Protect = union(c.Protect, p.protect)
+	c.EnvDeny = union(c.EnvDeny, p.envDeny)
+	return nil
+}
+
+// applyHardened layers security.hardened onto c. Like a policy preset, it only adds restrictions.
+func (c *Config) applyHardened() {
+	if c.Security.Hardened {
+		c.Security.CapDrop = union(c.Security.CapDrop, []string{"ALL"})
+	}
+}
+
+var capNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// normalizeCaps upper-cases capDrop and capAdd and strips their CAP_ prefixes, as the engines
+// accept either spelling. A capability in capAdd is removed from capDrop, so the project can grant
+// back one that a policy preset drops.
+func (s *Security) normalizeCaps() error {
+	added := map[string]bool{}
+	for i, cp := range s.CapAdd {
+		if s.CapAdd[i] = normalizeCap(cp); !capNameRe.MatchString(s.CapAdd[i]) {
+			return fmt.Errorf("security.capAdd: %q is not a capability name", cp)
+		}
+		added[s.CapAdd[i]] = true
+	}
+	var drop []string
+	for _, cp := range s.CapDrop {
+		name := normalizeCap(cp)
+		if !capNameRe.MatchString(name) {
+			return fmt.Errorf("security.capDrop: %q is not a capability name", cp)
+		}
+		if !added[name] {
+			drop = union(drop, []string{name})
+		}
+	}
+	s.CapDrop = drop
+	return nil
+}
+
+func normalizeCap(cp string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(cp)), "CAP_")
+}
+
+// union returns a followed by the entries of b it doesn't already contain.
+func union(a, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+// EnvDenied reports whether the env variable name matches an envDeny pattern, meaning airlock must
+// not pass it into the sandbox.
+func (c *Config) EnvDenied(name string) bool {
+	for _, pattern := range c.EnvDeny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEnvDeny checks the envDeny patterns, and that env doesn't set a variable they deny.
+func (c *Config) validateEnvDeny() error {
+	for _, pattern := range c.EnvDeny {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("envDeny: %q: %w", pattern, err)
+		}
+	}
+	var denied []string
+	for k := range c.Env {
+		if c.EnvDenied(k) {
+			denied = append(denied, k)
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("env sets %s, which envDeny (or the policy) keeps out of the sandbox; pass secrets with fromFile or fromCommand in .airlock/airlock.local.yaml instead", strings.Join(denied, ", "))
+	}
+	return nil
+}
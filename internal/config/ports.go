@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Port publishes a container port on the host. In YAML it is either a string in the engine's `-p`
+// syntax ("8080:8080", "127.0.0.1:5432:5432", "9229/udp") or a mapping with host/container keys.
+type Port struct {
+	HostIP    string `yaml:"hostIP"`
+	Host      int    `yaml:"host"`
+	Container int    `yaml:"container"`
+	Protocol  string `yaml:"protocol"` // "tcp" (default) or "udp"
+}
+
+func (p *Port) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		parsed, err := ParsePort(value.Value)
+		if err != nil {
+			return err
+		}
+		*p = parsed
+	case yaml.MappingNode:
+		type plain Port
+		var v plain
+		if err := value.Decode(&v); err != nil {
+			return err
+		}
+		*p = Port(v)
+		if p.Host == 0 {
+			p.Host = p.Container
+		}
+	default:
+		return fmt.Errorf("ports entries must be a string like \"8080:8080\" or a host/container mapping")
+	}
+	return p.validate()
+}
+
+// ParsePort parses a `-p` style spec: [hostIP:][hostPort:]containerPort[/protocol].
+func ParsePort(s string) (Port, error) {
+	var p Port
+	spec := strings.TrimSpace(s)
+	if rest, proto, ok := strings.Cut(spec, "/"); ok {
+		spec, p.Protocol = rest, proto
+	}
+	// A bracketed IPv6 host IP may itself contain colons.
+	if strings.HasPrefix(spec, "[") {
+		end := strings.Index(spec, "]:")
+		if end < 0 {
+			return Port{}, fmt.Errorf("invalid port %q", s)
+		}
+		p.HostIP, spec = spec[1:end], spec[end+2:]
+	}
+	parts := strings.Split(spec, ":")
+	if len(parts) == 3 && p.HostIP == "" {
+		p.HostIP, parts = parts[0], parts[1:]
+	}
+	var err error
+	switch len(parts) {
+	case 1:
+		p.Container, err = strconv.Atoi(parts[0])
+		p.Host = p.Container
+	case 2:
+		if p.Host, err = strconv.Atoi(parts[0]); err == nil {
+			p.Container, err = strconv.Atoi(parts[1])
+		}
+	default:
+		return Port{}, fmt.Errorf("invalid port %q", s)
+	}
+	if err != nil {
+		return Port{}, fmt.Errorf("invalid port %q", s)
+	}
+	return p, p.validate()
+}
+
+func (p Port) validate() error {
+	for _, n := range []int{p.Host, p.Container} {
+		if n < 1 || n > 65535 {
+			return fmt.Errorf("port %d out of range in %q", n, p.String())
+		}
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" && p.Protocol != "udp" {
+		return fmt.Errorf("port protocol must be tcp or udp, got %q", p.Protocol)
+	}
+	return nil
+}
+
+// String renders the port in the engine's `-p` syntax.
+func (p Port) String() string {
+	s := fmt.Sprintf("%d:%d", p.Host, p.Container)
+	if p.HostIP != "" {
+		ip := p.HostIP
+		if strings.Contains(ip, ":") {
+			ip = "[" + ip + "]"
+		}
+		s = ip + ":" + s
+	}
+	if p.Protocol != "" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
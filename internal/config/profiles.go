@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named variant of the sandbox, selected with `airlock --profile <name>`. Each set
+// field overrides the base config: mounts replace base mounts with the same target, env entries are
+// merged over the base env, and non-zero resource limits replace the base limits.
+type Profile struct {
+	Image     string    `yaml:"image"`
+	Mounts    []Mount   `yaml:"mounts"`
+	Env       EnvVars   `yaml:"env"`
+	Resources Resources `yaml:"resources"` // only non-zero limits override
+}
+
+// ApplyProfile layers the named profile onto c. The profile gets its own container (named after
+// the project and profile) so different shapes can run side by side; home and cache are shared.
+// An empty name is a no-op.
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("profile %q not found: airlock.yaml defines no profiles", name)
+		}
+		return fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	if p.Image != "" {
+		c.Image = p.Image
+		c.Build = nil
+	}
+	for _, m := range p.Mounts {
+		replaced := false
+		for i := range c.Mounts {
+			if c.Mounts[i].Target == m.Target {
+				c.Mounts[i] = m
+				replaced = true
+			}
+		}
+		if !replaced {
+			c.Mounts = append(c.Mounts, m)
+		}
+	}
+	for k, v := range p.Env {
+		c.Env[k] = v
+		delete(c.EnvSources, k)
+	}
+	if p.Resources.CPUs != 0 {
+		c.Resources.CPUs = p.Resources.CPUs
+	}
+	if p.Resources.Memory != 0 {
+		c.Resources.Memory = p.Resources.Memory
+	}
+	if p.Resources.Pids != 0 {
+		c.Resources.Pids = p.Resources.Pids
+	}
+	if c.Resources.CPUs < 0 || c.Resources.Pids < 0 {
+		return fmt.Errorf("profiles.%s: resources.cpus and resources.pids must not be negative", name)
+	}
+
+	c.Name = c.Name + "-" + sanitizeTag(name)
+	c.Profile = name
+	return nil
+}
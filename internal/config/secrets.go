@@ -0,0 +1,104 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvSource is an env value resolved on the host each time a session starts, so secrets never have
+// to be written into airlock.yaml or the container's configuration:
+//
+//	env:
+//	  GITHUB_TOKEN: {fromCommand: "gh auth token"}
+//	  NPM_TOKEN: {fromFile: ~/.secrets/npm}
+type EnvSource struct {
+	FromFile    string `yaml:"fromFile"`    // host file, relative to the project root; a trailing newline is dropped
+	FromCommand string `yaml:"fromCommand"` // host shell command whose stdout is the value
+}
+
+// Resolve reads the file or runs the command and returns the value.
+func (s EnvSource) Resolve(ctx context.Context, projectDir string) (string, error) {
+	if s.FromFile != "" {
+		b, err := os.ReadFile(s.Path(projectDir))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.FromCommand)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", s.FromCommand)
+	}
+	cmd.Dir = projectDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%q failed: %s", s.FromCommand, msg)
+		}
+		return "", fmt.Errorf("%q failed: %w", s.FromCommand, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// Path returns the absolute host path of FromFile.
+func (s EnvSource) Path(projectDir string) string {
+	p := s.FromFile
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(projectDir, p)
+	}
+	return p
+}
+
+// mergeEnvSources records the env entries of a config document whose value is an EnvSource. A later
+// document's plain value for the same key replaces an earlier source, and vice versa. Sources read
+// host files and run host commands, so only the local config (.airlock/airlock.local.yaml, hidden
+// from the sandbox) may declare them: the sandbox can edit airlock.yaml in the workspace.
+func (c *Config) mergeEnvSources(b []byte, local bool) error {
+	var doc struct {
+		Env yaml.Node `yaml:"env"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if doc.Env.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(doc.Env.Content); i += 2 {
+		k, v := doc.Env.Content[i].Value, doc.Env.Content[i+1]
+		if v.Kind != yaml.MappingNode {
+			delete(c.EnvSources, k)
+			continue
+		}
+		var s EnvSource
+		if err := v.Decode(&s); err != nil {
+			return fmt.Errorf("env.%s: %w", k, err)
+		}
+		if (s.FromFile == "") == (s.FromCommand == "") {
+			return fmt.Errorf("env.%s must set exactly one of fromFile or fromCommand", k)
+		}
+		if !local {
+			return fmt.Errorf("env.%s: fromFile and fromCommand run on the host, so they are only honored in .airlock/airlock.local.yaml, which the sandbox can't edit", k)
+		}
+		if c.EnvSources == nil {
+			c.EnvSources = map[string]EnvSource{}
+		}
+		c.EnvSources[k] = s
+		delete(c.Env, k)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Service is an auxiliary container (e.g. a database or cache) run next to the sandbox on a shared
+// network, where the sandbox reaches it by its name.
+type Service struct {
+	Image string  `yaml:"image"`
+	Env   EnvVars `yaml:"env"`
+	// Ports are published on the host, in the same syntax as the sandbox's ports. The sandbox
+	// doesn't need them: it reaches the service's ports directly.
+	Ports []Port `yaml:"ports"`
+}
+
+// Compose brings an existing compose stack up and down alongside the sandbox, as an alternative to
+// services for projects that already have a compose file.
+type Compose struct {
+	File string `yaml:"file"` // relative to the project root
+	// Attach joins the sandbox to the stack's network so it reaches compose services by name.
+	Attach bool `yaml:"attach"`
+	// Network is the compose network to join; defaults to the stack's "default" network.
+	Network string `yaml:"network"`
+}
+
+var serviceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// validateServices checks that services have usable names and images, that the compose settings
+// are complete, and that the sandbox can share a network with either.
+func (c *Config) validateServices() error {
+	if len(c.Services) > 0 && c.Network.Mode != NetworkBridge {
+		return fmt.Errorf("services require network.mode %q (got %q)", NetworkBridge, c.Network.Mode)
+	}
+	if c.Compose != nil {
+		if c.Compose.File == "" {
+			return fmt.Errorf("compose.file is required")
+		}
+		if c.Compose.Attach && c.Network.Mode != NetworkBridge {
+			return fmt.Errorf("compose.attach requires network.mode %q (got %q)", NetworkBridge, c.Network.Mode)
+		}
+		if c.Compose.Attach && len(c.Services) > 0 {
+			return fmt.Errorf("compose.attach can't be combined with services: the sandbox joins a single network")
+		}
+	}
+	for name, s := range c.Services {
+		if !serviceNameRe.MatchString(name) {
+			return fmt.Errorf("services.%s: name must be lowercase letters, digits, '.', '_', or '-'", name)
+		}
+		if s.Image == "" {
+			return fmt.Errorf("services.%s: image is required", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// SharedHostEnv turns on shared-host mode for every project on a machine, e.g. from /etc/profile.d
+// on a shared dev server, without editing each project's config.
+const SharedHostEnv = "AIRLOCK_SHARED_HOST"
+
+// applySharedHost namespaces the project per UNIX user when several engineers share one engine
+// (typically rootful docker on a dev server). The container, image tag, and networks all derive
+// from Name, so prefixing it with the user keeps their sandboxes apart; default home and cache
+// move under .airlock/users/<user> in case a checkout is shared too.
+func (c *Config) applySharedHost() error {
+	if !c.SharedHost {
+		switch os.Getenv(SharedHostEnv) {
+		case "", "0", "false":
+			return nil
+		}
+		c.SharedHost = true
+	}
+	u, err := user.Current()
+	if err != nil {
+		return fmt.Errorf("sharedHost: %w", err)
+	}
+	c.Owner = sanitizeUser(u.Username)
+	c.Name = c.Owner + "-" + c.Name
+	if c.HomeDir == "" {
+		c.HomeDir = "./.airlock/users/" + c.Owner + "/home"
+	}
+	if c.CacheDir == "" {
+		c.CacheDir = "./.airlock/users/" + c.Owner + "/cache"
+	}
+	return nil
+}
+
+// sanitizeUser makes a user name (which may be DOMAIN\user or user@realm) usable in container
+// and network names.
+func sanitizeUser(name string) string {
+	if _, after, ok := strings.Cut(name, `\`); ok {
+		name = after
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, name)
+}
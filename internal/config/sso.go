@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SSO forwards the host's single sign-on credentials into the sandbox read-only, so internal git
+// and artifact servers work without storing passwords in the container. The host keeps refreshing
+// them (kinit, the SSO agent); the sandbox only ever reads them.
+type SSO struct {
+	// Kerberos copies the host's credential cache (KRB5CCNAME, or /tmp/krb5cc_<uid>) and
+	// /etc/krb5.conf into the sandbox on every up/enter/exec, so renewed tickets are picked up.
+	Kerberos bool `yaml:"kerberos"`
+	// Sockets are host helper sockets, e.g. a corporate SSO agent, bind-mounted into the sandbox.
+	Sockets []SSOSocket `yaml:"sockets"`
+}
+
+// SSOSocket is a host unix socket forwarded into the sandbox.
+type SSOSocket struct {
+	Source string `yaml:"source"` // host path; ~ is the host home
+	Target string `yaml:"target"` // defaults to /run/airlock-sso/<name of source>
+	Env    string `yaml:"env"`    // optional variable set to the target path, e.g. SSO_AGENT_SOCK
+}
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (s *SSO) validate() error {
+	targets := map[string]bool{}
+	for i, sock := range s.Sockets {
+		if sock.Source == "" {
+			return fmt.Errorf("sso.sockets[%d]: source is required", i)
+		}
+		if sock.Target == "" {
+			s.Sockets[i].Target = "/run/airlock-sso/" + filepath.Base(sock.Source)
+		} else if !strings.HasPrefix(sock.Target, "/") {
+			return fmt.Errorf("sso.sockets[%d]: target %q must be an absolute container path", i, sock.Target)
+		}
+		if targets[s.Sockets[i].Target] {
+			return fmt.Errorf("sso.sockets[%d]: target %s is used more than once", i, s.Sockets[i].Target)
+		}
+		targets[s.Sockets[i].Target] = true
+		if sock.Env != "" && !envNameRe.MatchString(sock.Env) {
+			return fmt.Errorf("sso.sockets[%d]: env %q is not a valid variable name", i, sock.Env)
+		}
+	}
+	return nil
+}
+
+// Path returns the absolute host path of the socket.
+func (s SSOSocket) Path(projectDir string) string {
+	p := s.Source
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			p = filepath.Join(home, p[1:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(projectDir, p)
+	}
+	return p
+}
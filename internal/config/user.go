@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var userNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// User overrides the sandbox user the image declares, for images whose baked-in user doesn't match
+// the team's conventions. It drives --user, podman's keep-id mapping, and where the persistent
+// home is mounted. A uid the image has no user for is added to the container's /etc/passwd.
+type User struct {
+	Name string `yaml:"name"` // must exist in the image unless uid is set
+	UID  *int   `yaml:"uid"`
+	GID  *int   `yaml:"gid"`  // defaults to uid
+	Home string `yaml:"home"` // defaults to /home/<name> (/root for root)
+}
+
+func (u *User) validate() error {
+	if u.Name == "" && u.UID == nil {
+		return errors.New("user.name or user.uid is required")
+	}
+	if u.Name != "" && !userNameRe.MatchString(u.Name) {
+		return fmt.Errorf("user.name %q must contain only letters, digits, '_', '.', and '-'", u.Name)
+	}
+	if (u.UID != nil && *u.UID < 0) || (u.GID != nil && *u.GID < 0) {
+		return errors.New("user.uid and user.gid must not be negative")
+	}
+	if u.GID != nil && u.UID == nil {
+		return errors.New("user.gid requires user.uid")
+	}
+	if u.Home != "" && !strings.HasPrefix(u.Home, "/") {
+		return errors.New("user.home must be an absolute container path")
+	}
+	if u.Home == "" && u.Name == "" && *u.UID != 0 {
+		return errors.New("user.home is required when only user.uid is set")
+	}
+	return nil
+}
+
+// Spec returns the value for the engine's --user flag: uid:gid when a uid is set, else the name.
+func (u *User) Spec() string {
+	if u.UID == nil {
+		return u.Name
+	}
+	gid := *u.UID
+	if u.GID != nil {
+		gid = *u.GID
+	}
+	return strconv.Itoa(*u.UID) + ":" + strconv.Itoa(gid)
+}
+
+// HomeDir returns the sandbox user's home directory.
+func (u *User) HomeDir() string {
+	switch {
+	case u.Home != "":
+		return u.Home
+	case u.Name == "root", u.Name == "" && *u.UID == 0:
+		return "/root"
+	}
+	return "/home/" + u.Name
+}
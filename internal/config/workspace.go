@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WorkspaceFileName is the file listing the projects of a multi-project workspace (see `airlock ws`).
+const WorkspaceFileName = "airlock.workspace.yaml"
+
+// Workspace groups several airlock projects, e.g. sibling repos worked on together.
+type Workspace struct {
+	// Projects are project directories, relative to the workspace file's directory.
+	Projects []string `yaml:"projects"`
+	// Dir is the absolute directory containing the workspace file.
+	Dir string `yaml:"-"`
+}
+
+// FindWorkspace walks up from dir looking for a workspace file and returns its absolute path.
+func FindWorkspace(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		cand := filepath.Join(abs, WorkspaceFileName)
+		if fi, err := os.Stat(cand); err == nil && !fi.IsDir() {
+			return cand, nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return "", fmt.Errorf("no %s found in %s or any parent directory", WorkspaceFileName, dir)
+		}
+		abs = parent
+	}
+}
+
+// LoadWorkspace reads and validates a workspace file.
+func LoadWorkspace(path string) (*Workspace, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var w Workspace
+	if err := yaml.Unmarshal(b, &w); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(w.Projects) == 0 {
+		return nil, fmt.Errorf("%s: projects must list at least one project directory", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	w.Dir = filepath.Dir(abs)
+	seen := map[string]bool{}
+	for _, p := range w.Projects {
+		dir := w.ProjectDir(p)
+		if seen[dir] {
+			return nil, fmt.Errorf("%s: project %s is listed twice", path, p)
+		}
+		seen[dir] = true
+		if _, err := w.ProjectConfig(p); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &w, nil
+}
+
+// ProjectDir returns the absolute directory of a project entry.
+func (w *Workspace) ProjectDir(project string) string {
+	if filepath.IsAbs(project) {
+		return filepath.Clean(project)
+	}
+	return filepath.Join(w.Dir, project)
+}
+
+// ProjectConfig returns the airlock config file of a project entry.
+func (w *Workspace) ProjectConfig(project string) (string, error) {
+	dir := w.ProjectDir(project)
+	for _, name := range ConfigFileNames {
+		cand := filepath.Join(dir, name)
+		if fi, err := os.Stat(cand); err == nil && !fi.IsDir() {
+			return cand, nil
+		}
+	}
+	return "", fmt.Errorf("project %s has no airlock.yaml (run: airlock init in %s)", project, dir)
+}
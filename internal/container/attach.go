@@ -0,0 +1,34 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// defaultDetachKeys is what both engines use when none are configured.
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+// Attach connects the terminal to the container's main process (the command setting), for a
+// service that is more than `sleep infinity`. The detach keys leave it running; without a terminal,
+// only its output is followed.
+func (r *Runner) Attach(ctx context.Context, cfg *config.Config) error {
+	if len(cfg.Command) == 0 {
+		return errors.New("the container's main process is `sleep infinity`; set command in airlock.yaml to run a service there, or attach to a job (see: airlock jobs)")
+	}
+	if _, running := r.containerState(ctx, containerName(cfg)); !running {
+		return errors.New("the container is not running (run: airlock up)")
+	}
+	keys := cfg.DetachKeys
+	if keys == "" {
+		keys = defaultDetachKeys
+	}
+	args := []string{"attach", "--detach-keys", keys}
+	if !isTerminal(os.Stdin) {
+		args = append(args, "--no-stdin")
+		return r.runCmdStdin(ctx, nil, r.engineBin(), append(args, containerName(cfg))...)
+	}
+	return r.runTTY(ctx, os.Stdin, append(args, containerName(cfg))...)
+}
@@ -0,0 +1,117 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// BenchOptions controls the size of the filesystem benchmark.
+type BenchOptions struct {
+	SizeMB int // size of the sequential read/write file
+	Files  int // number of small files for the metadata test
+}
+
+// BenchResult holds filesystem measurements for one location inside the sandbox.
+type BenchResult struct {
+	Target      string
+	Path        string
+	WriteMBps   float64
+	ReadMBps    float64
+	CreatePerS  float64
+	StatLatency time.Duration
+}
+
+// Bench measures bind-mount throughput and latency from inside the sandbox, comparing the workspace and
+// home mounts against the container's own filesystem. Each operation runs as a separate exec and is
+// timed from the host, with the engine's exec overhead subtracted.
+func (r *Runner) Bench(ctx context.Context, cfg *config.Config, opts BenchOptions) ([]BenchResult, error) {
+	if opts.SizeMB <= 0 {
+		opts.SizeMB = 256
+	}
+	if opts.Files <= 0 {
+		opts.Files = 1000
+	}
+	userConfig, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	overhead := time.Duration(1<<63 - 1)
+	for i := 0; i < 3; i++ {
+		d, err := r.timeExec(ctx, cfg, userConfig.Name, "true")
+		if err != nil {
+			return nil, err
+		}
+		if d < overhead {
+			overhead = d
+		}
+	}
+
+	// /tmp is a tmpfs under readOnlyRootfs (and in some images), so name what is mounted there
+	// rather than passing tmpfs numbers off as the container's writable layer.
+	scratch := "container fs"
+	if fs, err := r.output(ctx, "exec", containerName(cfg), "awk", `$2 == "/tmp" { t = $3 } END { print t }`, "/proc/mounts"); err == nil && fs != "" {
+		scratch = fs + " (/tmp)"
+	}
+	targets := []struct{ name, dir string }{
+		{"workspace (bind)", userConfig.WorkDir},
+		{"home (bind)", userConfig.Home},
+		{scratch, "/tmp"},
+	}
+	var results []BenchResult
+	for _, t := range targets {
+		f := path.Join(t.dir, ".airlock-bench")
+		d := path.Join(t.dir, ".airlock-bench.d")
+		steps := []string{
+			fmt.Sprintf("dd if=/dev/zero of=%s bs=1M count=%d conv=fsync 2>/dev/null", f, opts.SizeMB),
+			fmt.Sprintf("cat %s > /dev/null", f),
+			fmt.Sprintf("mkdir -p %s && i=0; while [ $i -lt %d ]; do : > %s/$i; i=$((i+1)); done", d, opts.Files, d),
+			fmt.Sprintf("ls -l %s > /dev/null", d),
+		}
+		var times []time.Duration
+		for _, s := range steps {
+			elapsed, err := r.timeExec(ctx, cfg, userConfig.Name, s)
+			if err != nil {
+				_, _ = r.timeExec(ctx, cfg, userConfig.Name, fmt.Sprintf("rm -rf %s %s", f, d))
+				return nil, fmt.Errorf("bench %s: %w", t.name, err)
+			}
+			elapsed -= overhead
+			if elapsed <= 0 {
+				elapsed = time.Microsecond
+			}
+			times = append(times, elapsed)
+		}
+		if _, err := r.timeExec(ctx, cfg, userConfig.Name, fmt.Sprintf("rm -rf %s %s", f, d)); err != nil {
+			return nil, err
+		}
+		results = append(results, BenchResult{
+			Target:      t.name,
+			Path:        t.dir,
+			WriteMBps:   float64(opts.SizeMB) / times[0].Seconds(),
+			ReadMBps:    float64(opts.SizeMB) / times[1].Seconds(),
+			CreatePerS:  float64(opts.Files) / times[2].Seconds(),
+			StatLatency: times[3],
+		})
+	}
+	return results, nil
+}
+
+func (r *Runner) timeExec(ctx context.Context, cfg *config.Config, user string, script string) (time.Duration, error) {
+	args := []string{"exec", "--user", user, containerName(cfg), "sh", "-c", script}
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	start := time.Now()
+	out, err := exec.CommandContext(ctx, r.engineBin(), args...).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return time.Since(start), nil
+}
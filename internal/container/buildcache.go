@@ -0,0 +1,61 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// localCache reports whether a build.cacheFrom or build.cacheTo value names a host directory
+// rather than a registry repository, which never starts with "." or "/".
+func localCache(ref string) bool {
+	return strings.HasPrefix(ref, ".") || strings.HasPrefix(ref, "/")
+}
+
+// buildCacheArgs returns the --cache-from and --cache-to flags for the build's cache settings.
+// Docker (BuildKit) takes them as type=... specs, and podman as bare registry repositories; podman
+// can't use host directories. A cacheFrom directory that doesn't exist yet, as on the first build
+// that exports to it, is skipped.
+func (r *Runner) buildCacheArgs(cfg *config.Config, absProjectDir string) ([]string, error) {
+	b := cfg.Build
+	var args []string
+	spec := func(ref, dirKey string) (string, error) {
+		switch {
+		case r.Engine == EngineDocker && strings.HasPrefix(ref, "type="):
+			return ref, nil
+		case !localCache(ref) && r.Engine == EngineDocker:
+			return "type=registry,ref=" + ref, nil
+		case !localCache(ref):
+			return ref, nil
+		case r.Engine == EngineDocker:
+			return "type=local," + dirKey + "=" + resolveHostPath(absProjectDir, ref), nil
+		}
+		return "", fmt.Errorf("build cache %q: podman only imports and exports build caches from a registry repository", ref)
+	}
+	for _, ref := range b.CacheFrom {
+		if localCache(ref) {
+			if _, err := os.Stat(resolveHostPath(absProjectDir, ref)); err != nil {
+				continue
+			}
+		}
+		s, err := spec(ref, "src")
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--cache-from", s)
+	}
+	if b.CacheTo != "" {
+		s, err := spec(b.CacheTo, "dest")
+		if err != nil {
+			return nil, err
+		}
+		if r.Engine == EngineDocker && !strings.HasPrefix(b.CacheTo, "type=") {
+			// Export every stage's layers, not only the final image's.
+			s += ",mode=max"
+		}
+		args = append(args, "--cache-to", s)
+	}
+	return args, nil
+}
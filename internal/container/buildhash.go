@@ -0,0 +1,70 @@
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelBuildHash records, on the image and on the container created from it, a hash of the
+// Containerfile and build inputs the image was built from.
+const labelBuildHash = "airlock.build.hash"
+
+// buildHash fingerprints the Containerfile, the files matching build.inputs, and the platform, so a
+// change to any of them can be told from the image label without running a build.
+func buildHash(cfg *config.Config, absProjectDir string) (string, error) {
+	df := resolveHostPath(absProjectDir, cfg.Build.Containerfile)
+	buildCtx := resolveHostPath(absProjectDir, cfg.Build.Context)
+	files := []string{df}
+	for _, pattern := range cfg.Build.Inputs {
+		matches, err := filepath.Glob(filepath.Join(buildCtx, pattern))
+		if err != nil {
+			return "", fmt.Errorf("build.inputs: %q: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	h := sha256.New()
+	if cfg.Platform != "" {
+		// Left out when unset, so hashes recorded before platforms were configurable still match.
+		fmt.Fprintf(h, "platform=%s\x00", cfg.Platform)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(buildCtx, f)
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), len(b))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// imageBuildHash returns the build hash recorded on the image, or "" when the image is missing or
+// was built before build hashes were recorded.
+func (r *Runner) imageBuildHash(ctx context.Context, image string) string {
+	out, err := r.output(ctx, "image", "inspect", "--format", `{{index .Config.Labels "`+labelBuildHash+`"}}`, image)
+	if err != nil || out == "<no value>" {
+		return ""
+	}
+	return out
+}
+
+// buildChanged reports whether the container d was created from an image built from a different
+// Containerfile or build inputs than the current ones. Containers created before build hashes were
+// recorded never count as changed.
+func buildChanged(cfg *config.Config, absProjectDir string, d *containerDetails) bool {
+	created := d.Config.Labels[labelBuildHash]
+	if cfg.Build == nil || created == "" {
+		return false
+	}
+	current, err := buildHash(cfg, absProjectDir)
+	return err == nil && current != created
+}
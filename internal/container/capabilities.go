@@ -0,0 +1,215 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Capabilities describes what the installed engine supports, so Runner can adapt its flags instead
+// of assuming per-engine behavior that breaks on older podman or Docker Desktop.
+type Capabilities struct {
+	Engine   Engine `json:"engine"`
+	Version  string `json:"version"`
+	Rootless bool   `json:"rootless"`
+	CgroupV2 bool   `json:"cgroupV2"`
+	SELinux  bool   `json:"selinux"`
+	KeepID   bool   `json:"keepID"` // podman --userns=keep-id
+	GPUs     bool   `json:"gpus"`   // --gpus (docker with the nvidia runtime, podman with CDI)
+	Userns   bool   `json:"userns"` // docker daemon with userns-remap, which shifts container uids
+	Probed   bool   `json:"probed"` // false when probing failed and these are fallbacks
+}
+
+// fallbackCapabilities mirrors airlock's historical assumptions, used when probing fails.
+func fallbackCapabilities(e Engine) *Capabilities {
+	return &Capabilities{Engine: e, CgroupV2: true, SELinux: true, KeepID: e == EnginePodman}
+}
+
+// capabilities returns the engine's capabilities, probing at most once per engine binary version.
+// Results are cached on disk keyed by the binary's path, size, and mtime (and the remote daemon, if
+// any), so upgrading the engine triggers a fresh probe without costing an extra engine call on
+// every invocation.
+func (r *Runner) capabilities(ctx context.Context) *Capabilities {
+	if r.caps != nil {
+		return r.caps
+	}
+	cachePath := capabilitiesCachePath(r.engineBin())
+	if cachePath != "" {
+		if b, err := os.ReadFile(cachePath); err == nil {
+			var c Capabilities
+			if json.Unmarshal(b, &c) == nil && c.Engine == r.Engine && c.Probed {
+				r.caps = &c
+				return r.caps
+			}
+		}
+	}
+
+	c, err := r.probeCapabilities(ctx)
+	if err != nil {
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "warning: could not probe %s capabilities: %v\n", r.Engine, err)
+		}
+		r.caps = fallbackCapabilities(r.Engine)
+		return r.caps
+	}
+	if cachePath != "" {
+		if b, err := json.Marshal(c); err == nil {
+			_ = os.MkdirAll(filepath.Dir(cachePath), 0700)
+			_ = os.WriteFile(cachePath, b, 0600)
+		}
+	}
+	r.caps = c
+	return c
+}
+
+func (r *Runner) probeCapabilities(ctx context.Context) (*Capabilities, error) {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s info --format json\n", r.engineBin())
+	}
+	format := "json"
+	if r.Engine == EngineDocker {
+		format = "{{json .}}"
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), "info", "--format", format).Output()
+	if err != nil {
+		return nil, err
+	}
+	if r.Engine == EnginePodman {
+		return parsePodmanInfo(out)
+	}
+	return parseDockerInfo(out)
+}
+
+func parsePodmanInfo(out []byte) (*Capabilities, error) {
+	var info struct {
+		Host struct {
+			CgroupVersion string `json:"cgroupVersion"`
+			Security      struct {
+				Rootless       bool `json:"rootless"`
+				SELinuxEnabled bool `json:"selinuxEnabled"`
+			} `json:"security"`
+		} `json:"host"`
+		Version struct {
+			Version string `json:"Version"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse podman info: %w", err)
+	}
+	c := &Capabilities{
+		Engine:   EnginePodman,
+		Version:  info.Version.Version,
+		Rootless: info.Host.Security.Rootless,
+		CgroupV2: info.Host.CgroupVersion == "v2",
+		SELinux:  info.Host.Security.SELinuxEnabled,
+		Probed:   true,
+	}
+	// keep-id exists since podman 1.5 and only applies to rootless mode.
+	c.KeepID = c.Rootless && versionAtLeast(c.Version, 1, 5)
+	// --gpus is accepted since podman 5.0 (via CDI).
+	c.GPUs = versionAtLeast(c.Version, 5, 0)
+	return c, nil
+}
+
+func parseDockerInfo(out []byte) (*Capabilities, error) {
+	var info struct {
+		ServerVersion   string                     `json:"ServerVersion"`
+		CgroupVersion   string                     `json:"CgroupVersion"`
+		SecurityOptions []string                   `json:"SecurityOptions"`
+		Runtimes        map[string]json.RawMessage `json:"Runtimes"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse docker info: %w", err)
+	}
+	c := &Capabilities{
+		Engine:   EngineDocker,
+		Version:  info.ServerVersion,
+		CgroupV2: info.CgroupVersion == "2",
+		Probed:   true,
+	}
+	for _, opt := range info.SecurityOptions {
+		switch {
+		case strings.Contains(opt, "name=selinux"):
+			c.SELinux = true
+		case strings.Contains(opt, "name=rootless"):
+			c.Rootless = true
+		case strings.Contains(opt, "name=userns"):
+			c.Userns = true
+		}
+	}
+	_, c.GPUs = info.Runtimes["nvidia"]
+	return c, nil
+}
+
+// lines renders the capabilities for `info`.
+func (c *Capabilities) lines() []string {
+	probed := ""
+	if !c.Probed {
+		probed = " (not probed; assumed)"
+	}
+	return []string{
+		"engine.version: " + c.Version + probed,
+		"engine.rootless: " + strconv.FormatBool(c.Rootless),
+		"engine.cgroupV2: " + strconv.FormatBool(c.CgroupV2),
+		"engine.selinux: " + strconv.FormatBool(c.SELinux),
+		"engine.keepID: " + strconv.FormatBool(c.KeepID),
+		"engine.usernsRemap: " + strconv.FormatBool(c.Userns),
+		"engine.gpus: " + strconv.FormatBool(c.GPUs),
+	}
+}
+
+// resourceLimits reports whether cpu/memory/pids limits can be enforced: rootless engines need cgroups v2.
+func (c *Capabilities) resourceLimits() bool {
+	return c.CgroupV2 || !c.Rootless
+}
+
+// relabel returns the bind mount option that relabels content for SELinux, when SELinux is on.
+func (c *Capabilities) relabel() string {
+	if c.SELinux {
+		return "Z"
+	}
+	return ""
+}
+
+func capabilitiesCachePath(bin string) string {
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	key := fmt.Sprintf("%s-%d-%d", sanitizeLockName(strings.TrimPrefix(path, "/")), fi.Size(), fi.ModTime().Unix())
+	// A remote daemon has its own capabilities.
+	if target := os.Getenv("DOCKER_HOST") + os.Getenv("DOCKER_CONTEXT") + os.Getenv("CONTAINER_HOST") + os.Getenv("CONTAINER_CONNECTION"); target != "" {
+		key += "-" + specHash([]string{target})
+	}
+	return filepath.Join(dir, "airlock", "capabilities", key+".json")
+}
+
+// versionAtLeast compares a dotted version's major.minor against the given minimum.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	maj, err1 := strconv.Atoi(parts[0])
+	min, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return maj > major || (maj == major && min >= minor)
+}
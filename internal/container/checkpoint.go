@@ -0,0 +1,59 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// Checkpoint freezes the running sandbox to disk using podman's CRIU support. With an archive the
+// checkpoint is exported to a file, otherwise it is kept in podman's storage, which survives host reboots.
+func (r *Runner) Checkpoint(ctx context.Context, cfg *config.Config, archive string) error {
+	if err := r.checkCheckpointSupport(ctx); err != nil {
+		return err
+	}
+	args := []string{"container", "checkpoint"}
+	if archive != "" {
+		args = append(args, "--export", archive)
+	}
+	args = append(args, containerName(cfg))
+	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+}
+
+// Restore resumes a sandbox previously frozen with Checkpoint, optionally from an exported archive.
+func (r *Runner) Restore(ctx context.Context, cfg *config.Config, archive string) error {
+	if err := r.checkCheckpointSupport(ctx); err != nil {
+		return err
+	}
+	args := []string{"container", "restore"}
+	if archive != "" {
+		// An imported checkpoint recreates the container under its original name.
+		args = append(args, "--import", archive)
+	} else {
+		args = append(args, containerName(cfg))
+	}
+	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+}
+
+// checkCheckpointSupport asks the engine, which may run on another machine, whether it has CRIU.
+// Podman versions that don't report it are left to fail in the checkpoint itself.
+func (r *Runner) checkCheckpointSupport(ctx context.Context) error {
+	if r.Engine != EnginePodman {
+		return errors.New("checkpoint/restore requires podman")
+	}
+	out, err := r.output(ctx, "info", "--format", "json")
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Host struct {
+			CRIUEnabled *bool `json:"criuEnabled"`
+		} `json:"host"`
+	}
+	if err := json.Unmarshal([]byte(out), &info); err == nil && info.Host.CRIUEnabled != nil && !*info.Host.CRIUEnabled {
+		return errors.New("checkpoint/restore requires CRIU, which podman reports is not available")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// maxClockDrift is how far the podman machine's clock may be off the host's. TLS certificate checks
+// and build caches break well before drift reaches minutes; the measurement itself (an ssh round
+// trip, at one-second resolution) is good to a second or two.
+const maxClockDrift = 5 * time.Second
+
+// clockCheckInterval limits how often up measures drift, since it takes an ssh into the machine.
+const clockCheckInterval = 10 * time.Minute
+
+// usesMachine reports whether the engine runs in a local podman machine VM, whose clock falls
+// behind the host's when the host sleeps.
+func (r *Runner) usesMachine(ctx context.Context) bool {
+	return r.Engine == EnginePodman && runtime.GOOS != "linux" && os.Getenv("CONTAINER_HOST") == "" && r.remoteDaemon(ctx) == ""
+}
+
+// clockDrift returns how far the podman machine's clock is ahead of the host's (negative when
+// behind).
+func (r *Runner) clockDrift(ctx context.Context) (time.Duration, error) {
+	before := time.Now()
+	out, err := r.output(ctx, "machine", "ssh", "date", "+%s")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the podman machine's clock: %w", err)
+	}
+	host := before.Add(time.Since(before) / 2)
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected output from date in the podman machine: %q", out)
+	}
+	secs, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output from date in the podman machine: %q", out)
+	}
+	return time.Unix(secs, 0).Sub(host.Truncate(time.Second)), nil
+}
+
+// syncClock sets the podman machine's clock to the host's.
+func (r *Runner) syncClock(ctx context.Context) error {
+	if _, err := r.output(ctx, "machine", "ssh", "sudo", "date", "-u", "-s", "@"+strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return fmt.Errorf("failed to set the podman machine's clock: %w", err)
+	}
+	return nil
+}
+
+// checkClock warns when the podman machine's clock drifted from the host's, or resets it when
+// engine.syncClock is set. It is best effort, and an in-sync clock isn't measured again for
+// clockCheckInterval.
+func (r *Runner) checkClock(ctx context.Context, cfg *config.Config, absProjectDir string) {
+	if !r.usesMachine(ctx) {
+		return
+	}
+	stamp := filepath.Join(stateDir(absProjectDir), "clock-checked")
+	if fi, err := os.Stat(stamp); err == nil && time.Since(fi.ModTime()) < clockCheckInterval {
+		return
+	}
+	drift, err := r.clockDrift(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		return
+	}
+	if drift.Abs() > maxClockDrift {
+		if !cfg.Engine.SyncClock {
+			fmt.Fprintf(os.Stderr, "warning: the podman machine's clock is %s off the host's, which breaks TLS certificate checks and build caching; fix it with `airlock doctor --fix`, or set engine.syncClock: true\n", drift.Abs())
+			return
+		}
+		if err := r.syncClock(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "airlock: reset the podman machine's clock, which was %s off the host's\n", drift.Abs())
+	}
+	if err := os.MkdirAll(filepath.Dir(stamp), 0700); err == nil {
+		_ = os.WriteFile(stamp, nil, 0600)
+	}
+}
+
+// Doctor checks that the engine is usable: that it is reachable, that a podman machine's clock
+// matches the host's, and that the inotify limits are high enough for file watchers. With fix, it
+// resets a drifted clock and raises low limits.
+func (r *Runner) Doctor(ctx context.Context, fix bool) []CheckResult {
+	if msg := r.daemonDown(ctx); msg != "" {
+		return []CheckResult{{Name: "engine", Status: CheckFail, Detail: msg + "; " + r.daemonHint()}}
+	}
+	return []CheckResult{
+		{Name: "engine", Status: CheckPass, Detail: string(r.Engine) + " is reachable"},
+		r.clockCheck(ctx, fix),
+		r.inotifyCheck(ctx, fix),
+	}
+}
+
+// clockCheck is Doctor's clock check. With fix, it resets a drifted clock.
+func (r *Runner) clockCheck(ctx context.Context, fix bool) CheckResult {
+	if !r.usesMachine(ctx) {
+		return CheckResult{Name: "clock", Status: CheckSkip, Detail: "the engine doesn't run in a podman machine"}
+	}
+	clock := CheckResult{Name: "clock"}
+	drift, err := r.clockDrift(ctx)
+	switch {
+	case err != nil:
+		clock.Status, clock.Detail = CheckFail, err.Error()
+	case drift.Abs() <= maxClockDrift:
+		clock.Status, clock.Detail = CheckPass, "the podman machine's clock matches the host's"
+	case !fix:
+		clock.Status, clock.Detail = CheckFail, fmt.Sprintf("the podman machine's clock is %s off the host's; run: airlock doctor --fix", drift.Abs())
+	default:
+		if err := r.syncClock(ctx); err != nil {
+			clock.Status, clock.Detail = CheckFail, err.Error()
+		} else {
+			clock.Status, clock.Detail = CheckPass, fmt.Sprintf("reset the podman machine's clock, which was %s off", drift.Abs())
+		}
+	}
+	return clock
+}
@@ -0,0 +1,69 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// composeProject is the compose project name of the sandbox's stack. Compose only accepts
+// lowercase letters, digits, '-', and '_'.
+func composeProject(cfg *config.Config) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, containerName(cfg))
+}
+
+// composeNetwork is the compose network the sandbox joins with compose.attach.
+func composeNetwork(cfg *config.Config) string {
+	network := cfg.Compose.Network
+	if network == "" {
+		network = "default"
+	}
+	return composeProject(cfg) + "_" + network
+}
+
+// sharedNetwork returns the network the sandbox shares with its services or compose stack, or "".
+func sharedNetwork(cfg *config.Config) string {
+	switch {
+	case len(cfg.Services) > 0:
+		return servicesNetwork(cfg)
+	case cfg.Compose != nil && cfg.Compose.Attach:
+		return composeNetwork(cfg)
+	}
+	return ""
+}
+
+// compose runs `<engine> compose` for the project's stack. Podman delegates to podman-compose or
+// docker-compose, whichever is installed.
+func (r *Runner) compose(ctx context.Context, cfg *config.Config, absProjectDir string, args ...string) error {
+	base := []string{"compose", "-p", composeProject(cfg), "-f", resolveHostPath(absProjectDir, cfg.Compose.File)}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), append(base, args...)...); err != nil {
+		return fmt.Errorf("%s compose %s failed: %w", r.engineBin(), args[0], err)
+	}
+	return nil
+}
+
+// composeUp brings the compose stack up (idempotent) before the sandbox is created, so its network exists.
+func (r *Runner) composeUp(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	if cfg.Compose == nil {
+		return nil
+	}
+	return r.compose(ctx, cfg, absProjectDir, "up", "-d")
+}
+
+// composeDown stops and removes the compose stack.
+func (r *Runner) composeDown(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	if cfg.Compose == nil {
+		return nil
+	}
+	return r.compose(ctx, cfg, absProjectDir, "down")
+}
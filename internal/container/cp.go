@@ -0,0 +1,44 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// cpPrefix marks the container side of `airlock cp`.
+const cpPrefix = "container:"
+
+// Copy copies files between the host and the project's container with the engine's cp, for paths
+// that aren't mounted. Exactly one of src and dst is "container:<path>"; a relative container path
+// is inside the workspace.
+func (r *Runner) Copy(ctx context.Context, cfg *config.Config, src, dst string) error {
+	srcIn, dstIn := strings.HasPrefix(src, cpPrefix), strings.HasPrefix(dst, cpPrefix)
+	if srcIn == dstIn {
+		return errors.New("exactly one of the source and destination must be container:<path>")
+	}
+	if _, running := r.containerState(ctx, containerName(cfg)); !running {
+		return errors.New("the container is not running (run: airlock up)")
+	}
+	u, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	resolve := func(spec string) string {
+		// Not path.Join: a trailing "/" or "/." means something to cp.
+		p := strings.TrimPrefix(spec, cpPrefix)
+		if !path.IsAbs(p) {
+			p = strings.TrimSuffix(u.WorkDir, "/") + "/" + p
+		}
+		return containerName(cfg) + ":" + p
+	}
+	if srcIn {
+		src = resolve(src)
+	} else {
+		dst = resolve(dst)
+	}
+	return r.runCmdInteractive(ctx, r.engineBin(), "cp", src, dst)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package container
+
+import "syscall"
+
+func freeBytes(path string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return st.Bavail * uint64(st.Bsize), true
+}
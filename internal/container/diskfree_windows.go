@@ -0,0 +1,8 @@
+//go:build windows
+
+package container
+
+// freeBytes is not implemented on Windows; the disk space check is skipped.
+func freeBytes(path string) (uint64, bool) {
+	return 0, false
+}
@@ -1,8 +1,14 @@
 package container
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"os"
 	"os/exec"
+	"runtime"
+	"strings"
 )
 
 type Engine string
@@ -36,3 +42,94 @@ func commandExists(name string) bool {
 	_, err := exec.LookPath(name)
 	return err == nil
 }
+
+// remoteDaemon returns the address of the engine when it runs on another machine (via DOCKER_HOST,
+// engine.host, or a docker context; CONTAINER_HOST or a podman connection), or "" when it is local.
+// A podman machine is reached over localhost and counts as local.
+func (r *Runner) remoteDaemon(ctx context.Context) string {
+	var host string
+	if r.Engine == EngineDocker {
+		host = os.Getenv("DOCKER_HOST")
+		if host == "" {
+			host, _ = r.output(ctx, "context", "inspect", "--format", "{{.Endpoints.docker.Host}}")
+		}
+	} else {
+		host = os.Getenv("CONTAINER_HOST")
+		if conn := os.Getenv("CONTAINER_CONNECTION"); host == "" && conn != "" {
+			out, _ := r.output(ctx, "system", "connection", "list", "--format", "{{.Name}} {{.URI}}")
+			for _, line := range strings.Split(out, "\n") {
+				if name, uri, ok := strings.Cut(strings.TrimSpace(line), " "); ok && name == conn {
+					host = uri
+				}
+			}
+		}
+	}
+	if host == "" || strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://") {
+		return ""
+	}
+	if u, err := url.Parse(host); err == nil {
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return ""
+		}
+	}
+	return host
+}
+
+// daemonDownMessages are what the engine CLIs print when the binary is installed but nothing is
+// serving it: a stopped podman machine or socket, or Docker Desktop not running.
+var daemonDownMessages = []string{
+	"cannot connect to podman",
+	"unable to connect to podman",
+	"cannot connect to the docker daemon",
+	"is the docker daemon running",
+	"error during connect",
+}
+
+// daemonDown runs a cheap engine call and returns the engine's message if it failed because the
+// daemon or machine isn't running. Other failures are left to the command that hits them.
+func (r *Runner) daemonDown(ctx context.Context) string {
+	args := []string{"info", "--format", "{{.Host.OS}}"}
+	if r.Engine == EngineDocker {
+		args = []string{"version", "--format", "{{.Server.Version}}"}
+	}
+	_, err := r.output(ctx, args...)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	msg := strings.TrimSpace(string(exitErr.Stderr))
+	lower := strings.ToLower(msg)
+	for _, m := range daemonDownMessages {
+		if strings.Contains(lower, m) {
+			return msg
+		}
+	}
+	return ""
+}
+
+// ensureDaemon turns "daemon not running" into an actionable error, starting the podman machine
+// first when autoStart is set.
+func (r *Runner) ensureDaemon(ctx context.Context, autoStart bool) error {
+	msg := r.daemonDown(ctx)
+	if msg == "" {
+		return nil
+	}
+	if r.Engine == EngineDocker {
+		return fmt.Errorf("the docker daemon is not running (%s); %s", msg, r.daemonHint())
+	}
+	if runtime.GOOS == "linux" && os.Getenv("CONTAINER_CONNECTION") == "" && os.Getenv("CONTAINER_HOST") == "" {
+		return fmt.Errorf("podman cannot reach its service (%s); %s", msg, r.daemonHint())
+	}
+	if !autoStart {
+		return fmt.Errorf("the podman machine is not running (%s); %s", msg, r.daemonHint())
+	}
+	fmt.Fprintln(os.Stderr, "airlock: the podman machine is not running; starting it")
+	if err := r.runCmdInteractive(ctx, r.engineBin(), "machine", "start"); err != nil {
+		return fmt.Errorf("podman machine start: %w", err)
+	}
+	if msg := r.daemonDown(ctx); msg != "" {
+		return fmt.Errorf("the podman machine started but podman still cannot reach it: %s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EngineError is an engine failure airlock recognized, translated into what went wrong and how to
+// fix it. The engine's own error is kept for errors.As.
+type EngineError struct {
+	Err     error
+	Problem string
+	Hint    string
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("%s (%v); %s", e.Problem, e.Err, e.Hint)
+}
+
+func (e *EngineError) Unwrap() error { return e.Err }
+
+// engineFailure recognizes an engine failure by its message.
+type engineFailure struct {
+	messages []string // lowercase substrings of the engine's stderr
+	problem  string
+	hint     func(r *Runner) string
+}
+
+var engineFailures = []engineFailure{
+	{
+		messages: []string{"is already in use"},
+		problem:  "a container with this name already exists",
+		hint: func(r *Runner) string {
+			return "if it is this project's, remove it with `airlock down`; `airlock list` shows which project owns each container"
+		},
+	},
+	{
+		messages: []string{"selinux", "relabel", "lsetxattr", "avc:"},
+		problem:  "SELinux refused a bind mount",
+		hint: func(r *Runner) string {
+			return "the mount source can't be relabeled for containers (often it is on NFS or another filesystem without SELinux labels); move it to a local filesystem, or look for denials with `sudo ausearch -m avc -ts recent`"
+		},
+	},
+	{
+		messages: daemonDownMessages,
+		problem:  "the container engine is not reachable",
+		hint:     (*Runner).daemonHint,
+	},
+	{
+		messages: []string{"newuidmap", "newgidmap", "/etc/subuid", "/etc/subgid", "user namespaces are not enabled", "unprivileged_userns_clone", "insufficient uids or gids", "cannot set up namespace"},
+		problem:  "user namespaces are not available for rootless containers",
+		hint: func(r *Runner) string {
+			return "enable them (e.g. `sudo sysctl kernel.unprivileged_userns_clone=1`) and give your user subordinate IDs with `sudo usermod --add-subuids 100000-165535 --add-subgids 100000-165535 $USER`, then run `podman system migrate`"
+		},
+	},
+	{
+		messages: []string{"no space left on device"},
+		problem:  "the engine ran out of disk space",
+		hint: func(r *Runner) string {
+			return fmt.Sprintf("free space with `%s system prune`, or bound airlock's own usage with gc.keepImages and gc.maxCacheSize", r.engineBin())
+		},
+	},
+}
+
+// translateEngineError returns err as an *EngineError when stderr (the failed command's) matches a
+// known failure, and err unchanged otherwise.
+func (r *Runner) translateEngineError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	lower := strings.ToLower(stderr)
+	for _, f := range engineFailures {
+		for _, m := range f.messages {
+			if strings.Contains(lower, m) {
+				return &EngineError{Err: err, Problem: f.problem, Hint: f.hint(r)}
+			}
+		}
+	}
+	return err
+}
+
+// exitStderr returns the stderr captured in err, if it is an *exec.ExitError from Output.
+func exitStderr(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
+// daemonHint says how to start the engine when it isn't reachable.
+func (r *Runner) daemonHint() string {
+	if r.Engine == EngineDocker {
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			return "start Docker Desktop and wait for it to report that it is running"
+		}
+		return "start it with `sudo systemctl start docker`"
+	}
+	if runtime.GOOS == "linux" && os.Getenv("CONTAINER_CONNECTION") == "" && os.Getenv("CONTAINER_HOST") == "" {
+		return "check `podman system connection list`, or start it with `systemctl --user start podman.socket`"
+	}
+	return "start it with `podman machine start`, or set engine.autoStartMachine: true"
+}
+
+// stderrTail keeps the end of an engine command's stderr, for translateEngineError, while it is
+// also copied to the terminal.
+type stderrTail struct{ b []byte }
+
+const maxStderrTail = 8 << 10
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.b = append(t.b, p...)
+	if len(t.b) > maxStderrTail {
+		t.b = t.b[len(t.b)-maxStderrTail:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,39 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// engineSocketTarget is where the sandbox sees the filtering engine socket proxy (see config.EngineSocket).
+const engineSocketTarget = "/run/airlock-engine"
+
+// EngineSocketPath returns the host path of the engine's Docker-compatible API socket, which the
+// engine socket proxy forwards allowed requests to.
+func (r *Runner) EngineSocketPath(ctx context.Context) (string, error) {
+	var sock string
+	if r.Engine == EnginePodman {
+		out, err := r.output(ctx, "info", "--format", "{{.Host.RemoteSocket.Path}}")
+		if err != nil {
+			return "", fmt.Errorf("failed to locate the podman API socket: %w", err)
+		}
+		sock = strings.TrimPrefix(out, "unix://")
+	} else {
+		sock = "/var/run/docker.sock"
+		if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok {
+			sock = host
+		} else if os.Getenv("DOCKER_HOST") != "" {
+			return "", fmt.Errorf("engineSocket requires a local unix socket, but DOCKER_HOST is %s", os.Getenv("DOCKER_HOST"))
+		}
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		hint := ""
+		if r.Engine == EnginePodman {
+			hint = " (start it with: systemctl --user enable --now podman.socket)"
+		}
+		return "", fmt.Errorf("engine API socket %s is not available%s", sock, hint)
+	}
+	return sock, nil
+}
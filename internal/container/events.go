@@ -0,0 +1,43 @@
+package container
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ContainerEvents streams the names of containers the engine reports events for (start, stop, die,
+// remove, ...) until ctx is done or the engine's event stream ends, at which point the channel closes.
+func (r *Runner) ContainerEvents(ctx context.Context) (<-chan string, error) {
+	format := "{{.Name}}"
+	if r.Engine == EngineDocker {
+		format = "{{.Actor.Attributes.name}}"
+	}
+	args := []string{"events", "--filter", "type=container", "--format", format}
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	cmd := exec.CommandContext(ctx, r.engineBin(), args...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	names := make(chan string)
+	go func() {
+		defer close(names)
+		sc := bufio.NewScanner(out)
+		for sc.Scan() {
+			if name := strings.TrimSpace(sc.Text()); name != "" {
+				names <- name
+			}
+		}
+		_ = cmd.Wait()
+	}()
+	return names, nil
+}
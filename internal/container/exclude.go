@@ -0,0 +1,54 @@
+package container
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// excludedTargets returns the container paths that bind mounts' exclude globs hide behind empty
+// anonymous volumes, like the workspace's .airlock. A glob matches directories under the mount's
+// source when the container is created; one without wildcards is excluded even before it exists,
+// so e.g. a node_modules installed later in the sandbox never reaches the host.
+func excludedTargets(cfg *config.Config, absProjectDir string) ([]string, error) {
+	seen := map[string]bool{}
+	var targets []string
+	for _, m := range cfg.Mounts {
+		if !m.IsBind() || len(m.Exclude) == 0 {
+			continue
+		}
+		src := resolveHostPath(absProjectDir, m.Source)
+		matches, err := protectedPaths(src, m.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		var rels []string
+		for _, rel := range matches {
+			if fi, err := os.Stat(filepath.Join(src, filepath.FromSlash(rel))); err == nil && fi.IsDir() {
+				rels = append(rels, rel)
+			}
+		}
+		for _, pattern := range m.Exclude {
+			pattern = strings.TrimSuffix(path.Clean(pattern), "/**")
+			if staticPrefix(pattern) != pattern {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(src, filepath.FromSlash(pattern))); os.IsNotExist(err) {
+				rels = append(rels, pattern)
+			}
+		}
+		for _, rel := range rels {
+			t := path.Join(m.Target, rel)
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
@@ -0,0 +1,67 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// When both image and build are configured, the prebuilt image is preferred and build is the
+// fallback: the image is pulled and tagged as build.tag, and only built locally when the pull fails,
+// the pulled image isn't the one airlock.lock pins, or it was built from a different Containerfile
+// or build inputs than the local ones.
+
+// reusePulled reports whether the build.tag image is a previously pulled copy of the prebuilt image
+// that is still acceptable, so up doesn't pull on every run. Like a prebuilt-only image, it is
+// refreshed by `airlock rebuild`.
+func (r *Runner) reusePulled(ctx context.Context, cfg *config.Config, absProjectDir string) bool {
+	id, err := r.imageID(ctx, cfg.Build.Tag)
+	if err != nil {
+		return false
+	}
+	pulled, err := r.imageID(ctx, cfg.Image)
+	return err == nil && pulled == id && r.lockAllows(ctx, cfg, absProjectDir, id)
+}
+
+// pullOrBuild pulls the prebuilt image and tags it as build.tag, or builds build.tag locally when
+// the pulled image can't be used. hash is the current build hash.
+func (r *Runner) pullOrBuild(ctx context.Context, cfg *config.Config, absProjectDir, hash string) error {
+	args := append([]string{"pull"}, platformArgs(cfg)...)
+	if err := r.runCmdInteractive(ctx, r.engineBin(), append(args, cfg.Image)...); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't pull %s (%v); building %s locally instead\n", cfg.Image, err, cfg.Build.Tag)
+		return r.buildImage(ctx, cfg, absProjectDir)
+	}
+	id, err := r.imageID(ctx, cfg.Image)
+	if err != nil {
+		return err
+	}
+	switch built := r.imageBuildHash(ctx, cfg.Image); {
+	case !r.lockAllows(ctx, cfg, absProjectDir, id):
+		fmt.Fprintf(os.Stderr, "%s doesn't match the image pinned in %s; building %s locally instead\n", cfg.Image, config.LockFileName, cfg.Build.Tag)
+	case built != "" && built != hash:
+		fmt.Fprintf(os.Stderr, "%s was built from a different Containerfile or build inputs; building %s locally instead\n", cfg.Image, cfg.Build.Tag)
+	default:
+		if cfg.Image != cfg.Build.Tag {
+			if _, err := r.output(ctx, "tag", cfg.Image, cfg.Build.Tag); err != nil {
+				return fmt.Errorf("failed to tag %s as %s: %w", cfg.Image, cfg.Build.Tag, err)
+			}
+		}
+		return nil
+	}
+	return r.buildImage(ctx, cfg, absProjectDir)
+}
+
+// lockAllows reports whether airlock.lock, if it pins the prebuilt image or build.tag, pins the
+// pulled prebuilt image, which has this ID.
+func (r *Runner) lockAllows(ctx context.Context, cfg *config.Config, absProjectDir, id string) bool {
+	lock, err := config.ReadLock(absProjectDir)
+	if err != nil || lock == nil || lock.ImageID == "" {
+		return true
+	}
+	if lock.Image != cfg.Image && lock.Image != cfg.Build.Tag {
+		return true
+	}
+	return lockPins(lock, id, r.lockRepoDigests(ctx, lock, cfg.Image))
+}
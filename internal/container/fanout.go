@@ -0,0 +1,146 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// FanoutTarget is one command of a fan-out, labeled with the name its output lines are prefixed with.
+type FanoutTarget struct {
+	Name string
+	Cmd  *exec.Cmd
+}
+
+// Fanout runs every target's command concurrently, prefixing each line of their output with the
+// target's name, and returns the names of the targets whose command failed, in target order.
+func Fanout(targets []FanoutTarget, stdout, stderr io.Writer) []string {
+	width := 0
+	for _, t := range targets {
+		width = max(width, len(t.Name))
+	}
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		failed = make([]bool, len(targets))
+	)
+	for i, t := range targets {
+		prefix := fmt.Sprintf("[%-*s] ", width, t.Name)
+		out := &prefixWriter{mu: &mu, w: stdout, prefix: prefix}
+		errOut := &prefixWriter{mu: &mu, w: stderr, prefix: prefix}
+		t.Cmd.Stdout, t.Cmd.Stderr = out, errOut
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := t.Cmd.Run()
+			out.flush()
+			errOut.flush()
+			if err != nil {
+				failed[i] = true
+				mu.Lock()
+				fmt.Fprintf(stderr, "%s%v\n", prefix, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	var names []string
+	for i, f := range failed {
+		if f {
+			names = append(names, targets[i].Name)
+		}
+	}
+	return names
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix. Writers sharing mu never
+// interleave within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// flush writes a trailing partial line.
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix)
+	p.w.Write(line)
+}
+
+// ExecCommand returns a non-interactive engine exec of cmd in the named container, for Fanout.
+func (r *Runner) ExecCommand(ctx context.Context, name string, env []string, user string, cmd []string) *exec.Cmd {
+	args := []string{"exec"}
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	args = append(append(args, name), cmd...)
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	return exec.CommandContext(ctx, r.engineBin(), args...)
+}
+
+// ServiceContainers returns the container names of the project's services, sorted.
+func ServiceContainers(cfg *config.Config) []string {
+	var names []string
+	for name := range cfg.Services {
+		names = append(names, serviceContainerName(cfg, name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MatchContainers returns the running airlock containers listed with opts whose name matches the
+// glob pattern, with or without the airlock- prefix.
+func (r *Runner) MatchContainers(ctx context.Context, pattern string, opts ListOptions) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	names, err := r.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, name := range names {
+		a, _ := path.Match(pattern, name)
+		b, _ := path.Match(pattern, strings.TrimPrefix(name, "airlock-"))
+		if a || b {
+			matched = append(matched, name)
+		}
+	}
+	return matched, nil
+}
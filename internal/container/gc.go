@@ -0,0 +1,172 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelProject marks images (and containers) built by airlock with the project name.
+const labelProject = "airlock.project"
+
+// GC enforces the configured cleanup policy. It is best effort: failures are reported as warnings
+// so housekeeping never blocks up/down.
+func (r *Runner) GC(ctx context.Context, cfg *config.Config, absProjectDir string) {
+	if d := time.Duration(cfg.GC.RemoveStoppedAfter); d > 0 {
+		if err := r.removeStoppedContainers(ctx, cfg, d); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: gc: %v\n", err)
+		}
+	}
+	if cfg.GC.KeepImages > 0 && cfg.Build != nil {
+		if err := r.pruneImages(ctx, cfg, cfg.GC.KeepImages); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: gc: %v\n", err)
+		}
+	}
+	if cfg.GC.MaxCacheSize > 0 {
+		if err := trimDir(resolveHostPath(absProjectDir, cfg.CacheDir), int64(cfg.GC.MaxCacheSize)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: gc: %v\n", err)
+		}
+	}
+}
+
+// stoppedContainersArgs lists the project's exited containers. Other projects' sandboxes, and on a
+// shared host other users', are left to their own gc settings.
+func stoppedContainersArgs(cfg *config.Config) []string {
+	args := []string{"ps", "-a", "--filter", "label=" + labelProject + "=" + cfg.Name}
+	if cfg.SharedHost {
+		args = append(args, "--filter", "label="+labelUser+"="+cfg.Owner)
+	}
+	return append(args, "--filter", "status=exited", "--format", "{{.Names}}")
+}
+
+func (r *Runner) removeStoppedContainers(ctx context.Context, cfg *config.Config, olderThan time.Duration) error {
+	out, err := r.output(ctx, stoppedContainersArgs(cfg)...)
+	if err != nil {
+		return fmt.Errorf("failed to list stopped containers: %w", err)
+	}
+	for _, name := range strings.Fields(out) {
+		finished, err := r.output(ctx, "inspect", "-f", "{{.State.FinishedAt}}", name)
+		if err != nil {
+			continue
+		}
+		t, err := parseEngineTime(finished)
+		if err != nil || time.Since(t) < olderThan {
+			continue
+		}
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "gc: removing %s (stopped %s)\n", name, t.Format(time.RFC3339))
+		}
+		_, _ = r.output(ctx, "rm", "-v", name)
+	}
+	return nil
+}
+
+func (r *Runner) pruneImages(ctx context.Context, cfg *config.Config, keep int) error {
+	out, err := r.output(ctx, "images", "-q", "--no-trunc", "--filter", "label="+labelProject+"="+cfg.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	type image struct {
+		id      string
+		created time.Time
+	}
+	var images []image
+	seen := map[string]bool{}
+	for _, id := range strings.Fields(out) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		created, err := r.output(ctx, "image", "inspect", "--format", "{{.Created}}", id)
+		if err != nil {
+			continue
+		}
+		t, _ := parseEngineTime(created)
+		images = append(images, image{id: id, created: t})
+	}
+	if len(images) <= keep {
+		return nil
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].created.After(images[j].created) })
+
+	current, _ := r.imageID(ctx, imageRef(cfg))
+	for _, img := range images[keep:] {
+		if strings.TrimPrefix(img.id, "sha256:") == strings.TrimPrefix(current, "sha256:") {
+			continue
+		}
+		if r.Verbose {
+			fmt.Fprintf(os.Stderr, "gc: removing superseded image %s\n", img.id)
+		}
+		// Images still used by a container fail to remove; that's fine.
+		_, _ = r.output(ctx, "rmi", img.id)
+	}
+	return nil
+}
+
+// trimDir deletes the least recently modified files under dir until its total size is at most max.
+func trimDir(dir string, max int64) error {
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil || total <= max {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= max {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+	return nil
+}
+
+// output runs an engine command and returns its trimmed stdout.
+func (r *Runner) output(ctx context.Context, args ...string) (string, error) {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), args...).Output()
+	return strings.TrimSpace(string(out)), r.translateEngineError(err, exitStderr(err))
+}
+
+// parseEngineTime parses the timestamp formats used by podman and docker inspect output.
+func parseEngineTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	layouts := []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST", "2006-01-02 15:04:05.999999999 -0700 -0700"}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
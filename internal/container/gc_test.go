@@ -0,0 +1,23 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+func TestStoppedContainersArgs(t *testing.T) {
+	args := strings.Join(stoppedContainersArgs(&config.Config{Name: "api"}), " ")
+	if !strings.Contains(args, "--filter label=airlock.project=api") || !strings.Contains(args, "--filter status=exited") {
+		t.Errorf("expected the project's exited containers, got %q", args)
+	}
+	if strings.Contains(args, "name=") || strings.Contains(args, labelUser) {
+		t.Errorf("expected no name or user filter, got %q", args)
+	}
+
+	args = strings.Join(stoppedContainersArgs(&config.Config{Name: "api", SharedHost: true, Owner: "alice"}), " ")
+	if !strings.Contains(args, "--filter label=airlock.project=api") || !strings.Contains(args, "--filter label="+labelUser+"=alice") {
+		t.Errorf("expected the project's and owner's containers on a shared host, got %q", args)
+	}
+}
@@ -0,0 +1,264 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/audit"
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// prepareGit carries the host's git identity and, for the configured hosts, its credentials into the
+// sandbox home, applies the cross-platform settings (autocrlf, fileMode, safe.directory), and
+// installs the provenance hooks. It edits a copy of ~/.gitconfig with `git config --file` and
+// renames it into place, so settings made inside the sandbox are kept and a symlink the sandbox
+// planted in its home is never followed. A host without git is skipped silently.
+func (r *Runner) prepareGit(ctx context.Context, cfg *config.Config, homeHost, home string) error {
+	g := cfg.Git
+	if !g.Identity && len(g.Credentials) == 0 && g.AutoCRLF == "" && g.FileMode == nil && !g.SafeDirectory && !g.Provenance {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil
+	}
+	dst := filepath.Join(homeHost, ".gitconfig")
+	existing, err := readHomeFile(dst)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(homeHost, ".gitconfig.*")
+	if err != nil {
+		return err
+	}
+	gitconfig := f.Name()
+	defer os.Remove(gitconfig)
+	_, err = f.Write(existing)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(gitconfig, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if err := configureGit(ctx, cfg, gitconfig, homeHost, home); err != nil {
+		return err
+	}
+	return os.Rename(gitconfig, dst)
+}
+
+// configureGit applies the git settings to gitconfig, prepareGit's staging copy of ~/.gitconfig.
+func configureGit(ctx context.Context, cfg *config.Config, gitconfig, homeHost, home string) error {
+	g := cfg.Git
+	var settings [][2]string
+	if g.AutoCRLF != "" {
+		settings = append(settings, [2]string{"core.autocrlf", g.AutoCRLF})
+	}
+	if g.FileMode != nil {
+		settings = append(settings, [2]string{"core.fileMode", strconv.FormatBool(*g.FileMode)})
+	}
+	for _, kv := range settings {
+		if err := exec.CommandContext(ctx, "git", "config", "--file", gitconfig, kv[0], kv[1]).Run(); err != nil {
+			return fmt.Errorf("failed to set sandbox git %s: %w", kv[0], err)
+		}
+	}
+	if g.SafeDirectory {
+		// The sandbox only holds this project, so every repository in it is trusted. safe.directory
+		// is multi-valued; add "*" once and keep any entries made inside the sandbox.
+		out, _ := exec.CommandContext(ctx, "git", "config", "--file", gitconfig, "--get-all", "safe.directory").Output()
+		if !slices.Contains(strings.Split(strings.TrimSpace(string(out)), "\n"), "*") {
+			if err := exec.CommandContext(ctx, "git", "config", "--file", gitconfig, "--add", "safe.directory", "*").Run(); err != nil {
+				return fmt.Errorf("failed to set sandbox git safe.directory: %w", err)
+			}
+		}
+	}
+
+	if g.Provenance {
+		if err := installProvenanceHooks(homeHost); err != nil {
+			return fmt.Errorf("failed to install provenance hooks: %w", err)
+		}
+		if err := exec.CommandContext(ctx, "git", "config", "--file", gitconfig, "core.hooksPath", path.Join(home, provenanceHooksDir)).Run(); err != nil {
+			return fmt.Errorf("failed to set sandbox git core.hooksPath: %w", err)
+		}
+	}
+
+	if cfg.Git.Identity {
+		for _, key := range []string{"user.name", "user.email"} {
+			out, err := exec.CommandContext(ctx, "git", "config", "--global", "--get", key).Output()
+			value := strings.TrimSpace(string(out))
+			if err != nil || value == "" {
+				fmt.Fprintf(os.Stderr, "warning: host git %s is not set; not copying it into the sandbox\n", key)
+				continue
+			}
+			if err := exec.CommandContext(ctx, "git", "config", "--file", gitconfig, key, value).Run(); err != nil {
+				return fmt.Errorf("failed to set sandbox git %s: %w", key, err)
+			}
+		}
+	}
+
+	if len(cfg.Git.Credentials) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, host := range cfg.Git.Credentials {
+		cred, err := hostCredential(ctx, host)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: no host git credentials for %s: %v\n", host, err)
+			continue
+		}
+		lines = append(lines, cred)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	if err := writeHomeFile(filepath.Join(homeHost, ".git-credentials"), []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		return err
+	}
+	return exec.CommandContext(ctx, "git", "config", "--file", gitconfig, "credential.helper", "store").Run()
+}
+
+// readHomeFile reads a file in the sandbox home, or returns nil when it doesn't exist. The sandbox
+// can replace anything in its home, so anything but a regular file is refused.
+func readHomeFile(path string) ([]byte, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("refusing to use %s: not a regular file", path)
+	}
+	return os.ReadFile(path)
+}
+
+// writeHomeFile replaces a file in the sandbox home through a temporary file and a rename, so a
+// symlink the sandbox planted at path is replaced rather than followed. Anything at path but a
+// regular file is refused.
+func writeHomeFile(path string, data []byte, perm os.FileMode) error {
+	if fi, err := os.Lstat(path); err == nil && !fi.Mode().IsRegular() {
+		return fmt.Errorf("refusing to write %s: not a regular file", path)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// hostCredential asks the host's credential helpers for host and returns it in git-credentials form.
+// Prompting is disabled, so only already-stored credentials are used.
+func hostCredential(ctx context.Context, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git credential fill failed")
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			fields[k] = v
+		}
+	}
+	if fields["username"] == "" || fields["password"] == "" {
+		return "", fmt.Errorf("no stored credential")
+	}
+	u := urlEscape(fields["username"]) + ":" + urlEscape(fields["password"])
+	return "https://" + u + "@" + host, nil
+}
+
+func urlEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// provenanceHooksDir, in the sandbox home, holds the hooks git.provenance points core.hooksPath at.
+const provenanceHooksDir = ".airlock-git-hooks"
+
+// provenanceHooks are the hooks installed for git.provenance. core.hooksPath replaces the
+// repository's own hooks, so each one runs the repository's hook of the same name, if any.
+var provenanceHooks = []string{
+	"applypatch-msg", "pre-applypatch", "post-applypatch", "pre-commit", "pre-merge-commit",
+	"prepare-commit-msg", "commit-msg", "post-commit", "pre-rebase", "post-checkout", "post-merge",
+	"pre-push", "post-rewrite", "pre-auto-gc",
+}
+
+const repoHookScript = `hook="$(git rev-parse --git-common-dir)/hooks/$(basename "$0")"
+if [ -x "$hook" ]; then exec "$hook" "$@"; fi
+`
+
+// commitMsgScript adds the session trailers, which every session sets through AIRLOCK_SESSION and,
+// for exec, AIRLOCK_AGENT.
+const commitMsgScript = `if [ -n "$AIRLOCK_SESSION" ]; then
+	git interpret-trailers --in-place --if-exists replace --trailer "` + audit.TrailerSession + `: $AIRLOCK_SESSION" "$1" || exit 1
+	if [ -n "$AIRLOCK_AGENT" ]; then
+		git interpret-trailers --in-place --if-exists replace --trailer "` + audit.TrailerAgent + `: $AIRLOCK_AGENT" "$1" || exit 1
+	fi
+fi
+`
+
+func installProvenanceHooks(homeHost string) error {
+	dir := filepath.Join(homeHost, provenanceHooksDir)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	if fi, err := os.Lstat(dir); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("refusing to use %s: not a directory", dir)
+	}
+	for _, name := range provenanceHooks {
+		script := "#!/bin/sh\n# Installed by airlock for git.provenance.\n"
+		if name == "commit-msg" {
+			script += commitMsgScript
+		}
+		script += repoHookScript
+		if err := writeHomeFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agentEnv names the agent in provenance trailers: AIRLOCK_AGENT from env if set there, else the
+// program an exec session runs.
+func agentEnv(cfg *config.Config, cmd []string) []string {
+	if !cfg.Git.Provenance || len(cmd) == 0 {
+		return nil
+	}
+	if _, ok := cfg.Env["AIRLOCK_AGENT"]; ok {
+		return nil
+	}
+	return []string{"AIRLOCK_AGENT=" + path.Base(cmd[0])}
+}
@@ -0,0 +1,40 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHomeFilesRefuseSymlinks(t *testing.T) {
+	home := t.TempDir()
+	victim := filepath.Join(t.TempDir(), "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".gitconfig", ".git-credentials"} {
+		if err := os.Symlink(victim, filepath.Join(home, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := readHomeFile(filepath.Join(home, ".gitconfig")); err == nil {
+		t.Error("expected a symlinked .gitconfig to be refused")
+	}
+	if err := writeHomeFile(filepath.Join(home, ".git-credentials"), []byte("secret\n"), 0600); err == nil {
+		t.Error("expected a symlinked .git-credentials to be refused")
+	}
+	if b, _ := os.ReadFile(victim); string(b) != "keep" {
+		t.Errorf("symlink target was written: %q", b)
+	}
+
+	path := filepath.Join(home, "plain")
+	if err := writeHomeFile(path, []byte("one"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := readHomeFile(path); err != nil || string(b) != "one" {
+		t.Errorf("expected %q, got %q, %v", "one", b, err)
+	}
+	if b, err := readHomeFile(filepath.Join(home, "missing")); err != nil || b != nil {
+		t.Errorf("expected a missing file to read as nil, got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,65 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// runHooks runs each hook command with `sh -c` inside the container, as the sandbox user with the
+// sandbox env, streaming output. It stops at the first failing command.
+func (r *Runner) runHooks(ctx context.Context, cfg *config.Config, stage string, commands []string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	u, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+	sourced, err := r.sessionEnv(ctx, cfg, absProjectDir)
+	if err != nil {
+		return fmt.Errorf("%s hooks: %w", stage, err)
+	}
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "airlock: %s hook: %s\n", stage, c)
+		args := []string{"exec", "-i", "--user", u.Name}
+		for _, e := range r.getMergedEnv(cfg, u, sourced) {
+			args = append(args, "-e", e)
+		}
+		args = append(args, containerName(cfg))
+		args = append(args, umaskWrap(cfg, []string{"sh", "-c", c})...)
+		if err := r.runCmdInteractive(ctx, r.engineBin(), args...); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", stage, c, err)
+		}
+	}
+	return nil
+}
+
+// runHostHooks runs each hook command on the host (`sh -c`, or `cmd /C` on Windows) in the project
+// dir, with the host env plus AIRLOCK_PROJECT, AIRLOCK_CONTAINER, and extra. Host hooks do cleanup,
+// so a failing command is reported and the remaining ones still run.
+func (r *Runner) runHostHooks(ctx context.Context, cfg *config.Config, stage string, commands []string, extra ...string) {
+	absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+	env := append(os.Environ(), "AIRLOCK_PROJECT="+cfg.Name, "AIRLOCK_CONTAINER="+containerName(cfg))
+	env = append(env, extra...)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "airlock: %s hook: %s\n", stage, c)
+		cmd := exec.CommandContext(ctx, "sh", "-c", c)
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", c)
+		}
+		cmd.Dir = absProjectDir
+		cmd.Env = env
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s hook %q failed: %v\n", stage, c, err)
+		}
+	}
+}
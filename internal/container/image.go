@@ -0,0 +1,125 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// DefaultImageArchive is the archive name used by image save/load when none is given.
+func DefaultImageArchive(cfg *config.Config) string {
+	return "airlock-" + cfg.Name + ".tar"
+}
+
+// SaveImage writes the project's sandbox image to an archive so it can be carried into an
+// airgapped environment, and pins it in the project lockfile.
+func (r *Runner) SaveImage(ctx context.Context, cfg *config.Config, absProjectDir string, archive string) error {
+	image := imageRef(cfg)
+	if image == "" {
+		return fmt.Errorf("no image or build configured")
+	}
+	if archive == "" {
+		archive = DefaultImageArchive(cfg)
+	}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), "save", "-o", archive, image); err != nil {
+		return err
+	}
+	return r.lockImage(ctx, absProjectDir, image)
+}
+
+// LoadImage loads a sandbox image archive produced by SaveImage and updates the project lockfile.
+func (r *Runner) LoadImage(ctx context.Context, cfg *config.Config, absProjectDir string, archive string) error {
+	if archive == "" {
+		archive = DefaultImageArchive(cfg)
+	}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), "load", "-i", archive); err != nil {
+		return err
+	}
+	return r.lockImage(ctx, absProjectDir, imageRef(cfg))
+}
+
+func (r *Runner) lockImage(ctx context.Context, absProjectDir string, image string) error {
+	id, err := r.imageID(ctx, image)
+	if err != nil {
+		return err
+	}
+	digests, err := r.imageRepoDigests(ctx, image)
+	if err != nil {
+		return err
+	}
+	return config.WriteLock(absProjectDir, &config.Lock{Image: image, ImageID: id, RepoDigest: repoDigestFor(image, digests)})
+}
+
+// imageRepoDigests returns the image's registry digests (repo@sha256:...); a locally built or
+// loaded image has none.
+func (r *Runner) imageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	out, err := r.output(ctx, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	var digests []string
+	if err := json.Unmarshal([]byte(out), &digests); err != nil {
+		return nil, fmt.Errorf("failed to parse the repo digests of %s: %w", image, err)
+	}
+	return digests, nil
+}
+
+// repoDigestFor returns the digest in digests from image's repository, or "".
+func repoDigestFor(image string, digests []string) string {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, d := range digests {
+		if name, _, _ := strings.Cut(d, "@"); name == repo || strings.HasSuffix(name, "/"+repo) {
+			return d
+		}
+	}
+	return ""
+}
+
+// lockRepoDigests returns the image's repo digests when lock pins one, to compare against it.
+func (r *Runner) lockRepoDigests(ctx context.Context, lock *config.Lock, image string) []string {
+	if lock == nil || lock.RepoDigest == "" {
+		return nil
+	}
+	digests, _ := r.imageRepoDigests(ctx, image)
+	return digests
+}
+
+// warnLockMismatch warns when airlock.lock pins the project's image to an image other than the one
+// up is about to run.
+func (r *Runner) warnLockMismatch(ctx context.Context, cfg *config.Config, absProjectDir, id string) {
+	lock, err := config.ReadLock(absProjectDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to read %s: %v\n", config.LockFileName, err)
+		return
+	}
+	image := imageRef(cfg)
+	if msg := lockMismatch(lock, image, id, r.lockRepoDigests(ctx, lock, image)); msg != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", msg)
+	}
+}
+
+// lockMismatch describes how the local image with this ID and these repo digests differs from the
+// one lock pins, or returns "" when lock doesn't pin image or pins this one.
+func lockMismatch(lock *config.Lock, image, id string, repoDigests []string) string {
+	if lock == nil || lock.Image != image || lock.ImageID == "" || id == "" || lockPins(lock, id, repoDigests) {
+		return ""
+	}
+	pinned := lock.ImageID
+	if lock.RepoDigest != "" {
+		pinned = lock.RepoDigest
+	}
+	return fmt.Sprintf("%s is image %s here, but %s pins %s; run `airlock image load` with the pinned archive, or `airlock image save` to pin this one", image, id, config.LockFileName, pinned)
+}
+
+// lockPins reports whether lock pins the image with this ID or one of these repo digests.
+func lockPins(lock *config.Lock, id string, repoDigests []string) bool {
+	return sameImageID(lock.ImageID, id) || (lock.RepoDigest != "" && slices.Contains(repoDigests, lock.RepoDigest))
+}
@@ -0,0 +1,50 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+func TestLockMismatch(t *testing.T) {
+	lock := &config.Lock{Image: "airlock-api:latest", ImageID: "sha256:aaa"}
+	pulled := &config.Lock{Image: "ghcr.io/acme/api:1", ImageID: "sha256:aaa", RepoDigest: "ghcr.io/acme/api@sha256:ddd"}
+	tests := []struct {
+		lock        *config.Lock
+		image, id   string
+		repoDigests []string
+		mismatch    bool
+	}{
+		{nil, "airlock-api:latest", "sha256:bbb", nil, false},
+		{lock, "airlock-api:latest", "sha256:aaa", nil, false},
+		{lock, "airlock-api:latest", "aaa", nil, false}, // podman reports IDs without the algorithm
+		{lock, "other:latest", "sha256:bbb", nil, false},
+		{lock, "airlock-api:latest", "sha256:bbb", nil, true},
+		// Another engine gives the same pulled image another ID; the registry digest still matches.
+		{pulled, "ghcr.io/acme/api:1", "sha256:bbb", []string{"ghcr.io/acme/api@sha256:ddd"}, false},
+		{pulled, "ghcr.io/acme/api:1", "sha256:bbb", []string{"ghcr.io/acme/api@sha256:eee"}, true},
+	}
+	for _, tt := range tests {
+		if got := lockMismatch(tt.lock, tt.image, tt.id, tt.repoDigests); (got != "") != tt.mismatch {
+			t.Errorf("lockMismatch(%+v, %q, %q, %q) = %q, want mismatch %v", tt.lock, tt.image, tt.id, tt.repoDigests, got, tt.mismatch)
+		}
+	}
+}
+
+func TestRepoDigestFor(t *testing.T) {
+	tests := []struct {
+		image   string
+		digests []string
+		want    string
+	}{
+		{"airlock-api:latest", nil, ""},
+		{"ghcr.io/acme/api:1", []string{"ghcr.io/other/api@sha256:aaa", "ghcr.io/acme/api@sha256:bbb"}, "ghcr.io/acme/api@sha256:bbb"},
+		{"localhost:5000/api", []string{"localhost:5000/api@sha256:ccc"}, "localhost:5000/api@sha256:ccc"},
+		{"alpine:3", []string{"docker.io/library/alpine@sha256:ddd"}, "docker.io/library/alpine@sha256:ddd"}, // podman
+	}
+	for _, tt := range tests {
+		if got := repoDigestFor(tt.image, tt.digests); got != tt.want {
+			t.Errorf("repoDigestFor(%q, %q) = %q, want %q", tt.image, tt.digests, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Inotify limits below which agent tooling's file watchers (dev servers, test runners, language
+// servers) commonly run out, failing with ENOSPC or "too many open files" far from the cause.
+// They match what editors such as VS Code recommend.
+const (
+	minInotifyWatches   = 524288
+	minInotifyInstances = 512
+)
+
+const inotifySysctl = "/proc/sys/fs/inotify/"
+
+// inotifyLimits returns max_user_watches and max_user_instances of the kernel the containers run on:
+// the host's on Linux, or the podman machine's. where names that kernel; it is empty when the
+// limits can't be read from here (Docker Desktop, a remote engine).
+func (r *Runner) inotifyLimits(ctx context.Context) (watches, instances int, where string, err error) {
+	var out string
+	switch {
+	case r.usesMachine(ctx):
+		where = "the podman machine"
+		out, err = r.output(ctx, "machine", "ssh", "cat", inotifySysctl+"max_user_watches", inotifySysctl+"max_user_instances")
+	case runtime.GOOS == "linux" && r.remoteDaemon(ctx) == "":
+		where = "this host"
+		var w, i []byte
+		if w, err = os.ReadFile(inotifySysctl + "max_user_watches"); err == nil {
+			i, err = os.ReadFile(inotifySysctl + "max_user_instances")
+		}
+		out = string(w) + " " + string(i)
+	default:
+		return 0, 0, "", nil
+	}
+	if err != nil {
+		return 0, 0, where, fmt.Errorf("failed to read the inotify limits of %s: %w", where, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, where, fmt.Errorf("unexpected inotify limits from %s: %q", where, out)
+	}
+	if watches, err = strconv.Atoi(fields[0]); err == nil {
+		instances, err = strconv.Atoi(fields[1])
+	}
+	if err != nil {
+		return 0, 0, where, fmt.Errorf("unexpected inotify limits from %s: %q", where, out)
+	}
+	return watches, instances, where, nil
+}
+
+// raiseInotifyLimits raises the limits to the minimums where airlock can: in the podman machine
+// (where the ssh user may sudo) or when running as root. The change lasts until the next reboot.
+func (r *Runner) raiseInotifyLimits(ctx context.Context) error {
+	w, i := strconv.Itoa(minInotifyWatches), strconv.Itoa(minInotifyInstances)
+	switch {
+	case r.usesMachine(ctx):
+		if _, err := r.output(ctx, "machine", "ssh", "sudo", "sysctl", "-w", "fs.inotify.max_user_watches="+w, "fs.inotify.max_user_instances="+i); err != nil {
+			return fmt.Errorf("failed to raise the podman machine's inotify limits: %w", err)
+		}
+		return nil
+	case runtime.GOOS == "linux" && os.Geteuid() == 0:
+		if err := os.WriteFile(inotifySysctl+"max_user_watches", []byte(w), 0644); err != nil {
+			return err
+		}
+		return os.WriteFile(inotifySysctl+"max_user_instances", []byte(i), 0644)
+	}
+	return fmt.Errorf("raising inotify limits needs root; run: %s", inotifyFixCommand())
+}
+
+// inotifyFixCommand is the command that raises the host's limits for good.
+func inotifyFixCommand() string {
+	return fmt.Sprintf("printf 'fs.inotify.max_user_watches=%d\\nfs.inotify.max_user_instances=%d\\n' | sudo tee /etc/sysctl.d/90-airlock-inotify.conf && sudo sysctl --system", minInotifyWatches, minInotifyInstances)
+}
+
+// inotifyLow describes which limits are below the minimums, or returns "" when neither is.
+func inotifyLow(watches, instances int) string {
+	var low []string
+	if watches < minInotifyWatches {
+		low = append(low, fmt.Sprintf("max_user_watches is %d (want %d)", watches, minInotifyWatches))
+	}
+	if instances < minInotifyInstances {
+		low = append(low, fmt.Sprintf("max_user_instances is %d (want %d)", instances, minInotifyInstances))
+	}
+	return strings.Join(low, ", ")
+}
+
+// checkInotify raises low inotify limits where it can and warns where it can't. It is best effort,
+// and like checkClock only runs every clockCheckInterval.
+func (r *Runner) checkInotify(ctx context.Context, absProjectDir string) {
+	stamp := filepath.Join(stateDir(absProjectDir), "inotify-checked")
+	if fi, err := os.Stat(stamp); err == nil && time.Since(fi.ModTime()) < clockCheckInterval {
+		return
+	}
+	watches, instances, where, err := r.inotifyLimits(ctx)
+	if err != nil || where == "" {
+		return
+	}
+	if low := inotifyLow(watches, instances); low != "" {
+		if err := r.raiseInotifyLimits(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: the inotify limits of %s are low (%s); file watchers in the sandbox may fail with ENOSPC or \"too many open files\". To raise them, run: %s\n", where, low, inotifyFixCommand())
+			return
+		}
+		fmt.Fprintf(os.Stderr, "airlock: raised the inotify limits of %s, which were low (%s)\n", where, low)
+	}
+	if err := os.MkdirAll(filepath.Dir(stamp), 0700); err == nil {
+		_ = os.WriteFile(stamp, nil, 0600)
+	}
+}
+
+// inotifyCheck is Doctor's inotify check. With fix, it raises low limits where it can.
+func (r *Runner) inotifyCheck(ctx context.Context, fix bool) CheckResult {
+	res := CheckResult{Name: "inotify"}
+	watches, instances, where, err := r.inotifyLimits(ctx)
+	switch {
+	case err != nil:
+		res.Status, res.Detail = CheckFail, err.Error()
+		return res
+	case where == "":
+		res.Status, res.Detail = CheckSkip, "the engine's kernel isn't reachable from here"
+		return res
+	}
+	low := inotifyLow(watches, instances)
+	switch {
+	case low == "":
+		res.Status, res.Detail = CheckPass, fmt.Sprintf("the inotify limits of %s are sufficient", where)
+	case !fix:
+		res.Status, res.Detail = CheckWarn, fmt.Sprintf("the inotify limits of %s are low (%s); run: airlock doctor --fix", where, low)
+	default:
+		if err := r.raiseInotifyLimits(ctx); err != nil {
+			res.Status, res.Detail = CheckWarn, fmt.Sprintf("the inotify limits of %s are low (%s); %v", where, low, err)
+		} else {
+			res.Status, res.Detail = CheckPass, fmt.Sprintf("raised the inotify limits of %s, which were low (%s)", where, low)
+		}
+	}
+	return res
+}
@@ -0,0 +1,137 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// containerDetails is the subset of `container inspect` output airlock cares about.
+type containerDetails struct {
+	Image  string         `json:"Image"`
+	State  containerState `json:"State"`
+	Config struct {
+		User   string            `json:"User"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+	HostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+		Memory      int64  `json:"Memory"`
+		NanoCpus    int64  `json:"NanoCpus"`
+		PidsLimit   *int64 `json:"PidsLimit"`
+	} `json:"HostConfig"`
+}
+
+type containerState struct {
+	Running   bool   `json:"Running"`
+	StartedAt string `json:"StartedAt"`
+	Health    *struct {
+		Status string `json:"Status"`
+	} `json:"Health"`
+	// Healthcheck is where podman before 4.x reports health.
+	Healthcheck *struct {
+		Status string `json:"Status"`
+	} `json:"Healthcheck"`
+}
+
+// health returns the healthcheck status, or "" when the image defines no healthcheck.
+func (s containerState) health() string {
+	if s.Health != nil && s.Health.Status != "" {
+		return s.Health.Status
+	}
+	if s.Healthcheck != nil {
+		return s.Healthcheck.Status
+	}
+	return ""
+}
+
+func (r *Runner) inspectContainer(ctx context.Context, name string) (*containerDetails, error) {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s container inspect %s\n", r.engineBin(), name)
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), "container", "inspect", name).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	var data []containerDetails
+	if err := json.Unmarshal(out, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse container inspect output: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data returned from container inspect %s", name)
+	}
+	return &data[0], nil
+}
+
+// runtimeLines renders the live container's effective settings for `info`.
+func (d *containerDetails) runtimeLines() []string {
+	lines := []string{
+		"runtime.user: " + d.Config.User,
+		"runtime.network: " + d.HostConfig.NetworkMode,
+		"runtime.memory: " + formatLimit(d.HostConfig.Memory),
+		"runtime.cpus: " + formatCPUs(d.HostConfig.NanoCpus),
+	}
+	pids := "unlimited"
+	if d.HostConfig.PidsLimit != nil && *d.HostConfig.PidsLimit > 0 {
+		pids = strconv.FormatInt(*d.HostConfig.PidsLimit, 10)
+	}
+	lines = append(lines, "runtime.pids: "+pids)
+	for _, m := range d.Mounts {
+		mode := "ro"
+		if m.RW {
+			mode = "rw"
+		}
+		src := m.Source
+		if m.Type == "volume" && m.Name != "" {
+			src = "volume:" + m.Name
+		}
+		lines = append(lines, fmt.Sprintf("runtime.mount: %s -> %s (%s)", src, m.Destination, mode))
+	}
+	for _, e := range d.Config.Env {
+		lines = append(lines, "runtime.env: "+redactEnv(e))
+	}
+	return lines
+}
+
+func formatLimit(bytes int64) string {
+	if bytes <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(bytes, 10) + " bytes"
+}
+
+func formatCPUs(nano int64) string {
+	if nano <= 0 {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(float64(nano)/1e9, 'f', -1, 64)
+}
+
+var secretEnvMarkers = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "API_KEY", "APIKEY", "PRIVATE_KEY", "ACCESS_KEY", "AUTH"}
+
+// redactEnv masks the value of KEY=VALUE pairs whose key looks like it holds a secret.
+func redactEnv(kv string) string {
+	k, v, ok := strings.Cut(kv, "=")
+	if !ok || v == "" {
+		return kv
+	}
+	upper := strings.ToUpper(k)
+	for _, m := range secretEnvMarkers {
+		if strings.Contains(upper, m) {
+			return k + "=<redacted>"
+		}
+	}
+	return kv
+}
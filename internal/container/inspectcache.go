@@ -0,0 +1,109 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// inspectCache is the on-disk cache of the inspect results of the image the sandbox container was
+// created from, so enter/exec can skip an engine round-trip, which is noticeable when the engine
+// runs in a VM. A build or pull only retags the image; the container keeps running the old one
+// until `up` recreates it, and `up` checks the cache against the container each time.
+type inspectCache struct {
+	Engine  Engine     `json:"engine"`
+	Image   string     `json:"image"`
+	ImageID string     `json:"imageId"`
+	User    UserConfig `json:"user"`
+}
+
+func inspectCachePath(absProjectDir string) string {
+	return filepath.Join(stateDir(absProjectDir), "image-inspect.json")
+}
+
+// userConfig returns the sandbox user config: the container's image's, from the cache when there
+// is one, with the config's user block and workspace applied.
+func (r *Runner) userConfig(ctx context.Context, cfg *config.Config) (*UserConfig, error) {
+	absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+	if u := r.cachedUserConfig(absProjectDir, cfg); u != nil {
+		return withConfigOverrides(cfg, r.capabilities(ctx), u), nil
+	}
+	// Without a container there is nothing to cache for; the caller fails to reach it anyway.
+	id, err := r.containerImageID(ctx, containerName(cfg))
+	if err != nil {
+		id = imageRef(cfg)
+	}
+	u, err := r.inspectImage(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if id != imageRef(cfg) {
+		r.cacheUserConfig(absProjectDir, cfg, u)
+	}
+	return withConfigOverrides(cfg, r.capabilities(ctx), u), nil
+}
+
+// cachedUserConfig returns the cached inspect result of the container's image, or nil.
+func (r *Runner) cachedUserConfig(absProjectDir string, cfg *config.Config) *UserConfig {
+	b, err := os.ReadFile(inspectCachePath(absProjectDir))
+	if err != nil {
+		return nil
+	}
+	var c inspectCache
+	if json.Unmarshal(b, &c) != nil || c.Engine != r.Engine || c.ImageID == "" {
+		return nil
+	}
+	return &c.User
+}
+
+// withConfigOverrides applies cfg.User, docker's uid mapping (see mapDockerUser), and the workspace
+// (see workspaceTarget) to the image's user config. The cache keeps the image's own values, so
+// editing either takes effect without inspecting the image again.
+func withConfigOverrides(cfg *config.Config, caps *Capabilities, u *UserConfig) *UserConfig {
+	absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+	o := *u
+	o.WorkDir, _ = workspaceTarget(cfg, absProjectDir, u.WorkDir)
+	if cfg.User != nil {
+		o.Name = cfg.User.Spec()
+		o.Home = cfg.User.HomeDir()
+		o.UID, o.GID, _ = strings.Cut(o.Name, ":")
+		if cfg.User.UID == nil {
+			o.UID, o.GID = "", ""
+		}
+		// A user the image has keeps its home from the image's /etc/passwd, unless user.home is set.
+		if e, ok := lookupPasswd(u.Passwd, cfg.User.Name); ok && cfg.User.UID == nil {
+			o.UID, o.GID = e.UID, e.GID
+			if cfg.User.Home == "" {
+				o.Home = e.Home
+			}
+		}
+	}
+	mapDockerUser(cfg, caps, &o)
+	return &o
+}
+
+func (r *Runner) cacheUserConfig(absProjectDir string, cfg *config.Config, u *UserConfig) {
+	b, err := json.Marshal(inspectCache{Engine: r.Engine, Image: imageRef(cfg), ImageID: u.ImageID, User: *u})
+	if err != nil {
+		return
+	}
+	path := inspectCachePath(absProjectDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, b, 0600)
+}
+
+// sameImageID reports whether two image IDs name the same image; podman omits the sha256: prefix.
+func sameImageID(a, b string) bool {
+	return a != "" && strings.TrimPrefix(a, "sha256:") == strings.TrimPrefix(b, "sha256:")
+}
+
+// invalidateInspectCache drops cached inspect results that don't describe the container's image.
+func invalidateInspectCache(absProjectDir string) {
+	_ = os.Remove(inspectCachePath(absProjectDir))
+}
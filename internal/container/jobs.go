@@ -0,0 +1,239 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/audit"
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// jobsDirName holds detached exec jobs in the sandbox home, one directory per job, so the host can
+// read their output and status without an engine round-trip, even after the container is gone.
+const jobsDirName = ".airlock-jobs"
+
+// Job statuses.
+const (
+	JobRunning = "running"
+	JobExited  = "exited"
+	JobLost    = "lost" // the container or the job's process went away before it could record an exit
+)
+
+// Job is a command started with `exec -d`.
+type Job struct {
+	ID       string    `json:"id"`
+	Command  []string  `json:"command"`
+	Started  time.Time `json:"started"`
+	Status   string    `json:"-"`
+	ExitCode int       `json:"-"` // valid when Status is JobExited
+	pid      string
+}
+
+func jobsDir(cfg *config.Config, absProjectDir string) string {
+	return filepath.Join(resolveHostPath(absProjectDir, cfg.HomeDir), jobsDirName)
+}
+
+// ExecDetached starts cmd in the container without waiting for it and records it as a job. Its
+// stdout and stderr go to the job's log, which AttachJob follows.
+func (r *Runner) ExecDetached(ctx context.Context, cfg *config.Config, absProjectDir string, cmd []string, opts ExecOptions) (*Job, error) {
+	userConfig, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	sourced, err := r.sessionEnv(ctx, cfg, absProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{ID: audit.NewSessionID(), Command: cmd, Started: time.Now().UTC()}
+	hostDir := filepath.Join(jobsDir(cfg, absProjectDir), job.ID)
+	if err := os.MkdirAll(hostDir, 0700); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "job.json"), b, 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"exec", "-d", "--user", sessionUser(userConfig, opts.User)}
+	if wd := execWorkDir(cfg, userConfig, opts.WorkDir); wd != "" {
+		args = append(args, "-w", wd)
+	}
+	for _, e := range r.getMergedEnv(cfg, userConfig, slices.Concat(agentEnv(cfg, cmd), sourced, overlayEnv(cfg), allowedEnv(cfg, opts.Env))) {
+		args = append(args, "-e", e)
+	}
+	args = append(args, "-e", "AIRLOCK_SESSION="+job.ID, containerName(cfg))
+	// A small sh records the job's pid, output, and exit status in its directory ($0).
+	const wrapper = `echo $$ > "$0/pid"; "$@" > "$0/output.log" 2>&1 < /dev/null; echo $? > "$0/exit"`
+	args = append(args, "sh", "-c", wrapper, path.Join(userConfig.Home, jobsDirName, job.ID))
+	args = append(args, umaskWrap(cfg, shellWrap(cfg, cmd))...)
+
+	if err := audit.Append(audit.Path(absProjectDir), audit.Event{Session: job.ID, Kind: audit.KindSessionStart, Command: cmd, Detail: "detached"}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), args...); err != nil {
+		_ = os.RemoveAll(hostDir)
+		return nil, fmt.Errorf("failed to start job: %w", err)
+	}
+	return job, nil
+}
+
+// Jobs returns the project's detached jobs, oldest first.
+func (r *Runner) Jobs(ctx context.Context, cfg *config.Config, absProjectDir string) ([]Job, error) {
+	dir := jobsDir(cfg, absProjectDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	var pids []string
+	for _, e := range entries {
+		job, err := readJob(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		if job.Status == JobRunning && job.pid != "" {
+			pids = append(pids, job.pid)
+		}
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.Before(jobs[j].Started) })
+
+	// Jobs without an exit status are only running if their process still is.
+	alive := map[string]bool{}
+	_, running := r.containerState(ctx, containerName(cfg))
+	if running && len(pids) > 0 {
+		const check = `for p; do kill -0 "$p" 2>/dev/null && echo "$p"; done`
+		out, _ := r.output(ctx, append([]string{"exec", containerName(cfg), "sh", "-c", check, "sh"}, pids...)...)
+		for _, p := range strings.Fields(out) {
+			alive[p] = true
+		}
+	}
+	for i := range jobs {
+		// A job that hasn't written its pid yet has only just started.
+		if jobs[i].Status == JobRunning && (!running || jobs[i].pid != "" && !alive[jobs[i].pid]) {
+			// Recheck: the job may have finished since it was read.
+			if job, err := readJob(filepath.Join(dir, jobs[i].ID)); err == nil && job.Status == JobExited {
+				jobs[i] = *job
+			} else {
+				jobs[i].Status = JobLost
+			}
+		}
+	}
+	return jobs, nil
+}
+
+func readJob(dir string) (*Job, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "job.json"))
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(b, &job); err != nil {
+		return nil, err
+	}
+	job.Status = JobRunning
+	if b, err := os.ReadFile(filepath.Join(dir, "pid")); err == nil {
+		job.pid = strings.TrimSpace(string(b))
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "exit")); err == nil {
+		job.Status = JobExited
+		job.ExitCode, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+	return &job, nil
+}
+
+// findJob resolves a job ID or a unique prefix of one.
+func (r *Runner) findJob(ctx context.Context, cfg *config.Config, absProjectDir, id string) (*Job, error) {
+	jobs, err := r.Jobs(ctx, cfg, absProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	var match *Job
+	for i := range jobs {
+		if strings.HasPrefix(jobs[i].ID, id) {
+			if match != nil {
+				return nil, fmt.Errorf("job ID %q is ambiguous", id)
+			}
+			match = &jobs[i]
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no job %q (see: airlock jobs)", id)
+	}
+	return match, nil
+}
+
+// AttachJob copies a job's output to w from the beginning and follows it until the job ends, then
+// returns its exit status as an *ExitError (nil for 0). Cancelling ctx detaches without affecting
+// the job.
+func (r *Runner) AttachJob(ctx context.Context, cfg *config.Config, absProjectDir, id string, w io.Writer) error {
+	job, err := r.findJob(ctx, cfg, absProjectDir, id)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(jobsDir(cfg, absProjectDir), job.ID)
+	var offset int64
+	for polls := 1; ; polls++ {
+		offset, err = copyFrom(filepath.Join(dir, "output.log"), offset, w)
+		if err != nil {
+			return err
+		}
+		switch job.Status {
+		case JobExited:
+			if job.ExitCode != 0 {
+				return &ExitError{Code: job.ExitCode}
+			}
+			return nil
+		case JobLost:
+			return errors.New("the job ended without recording an exit status (was the container stopped?)")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(250 * time.Millisecond):
+		}
+		// Read the status before the next copy, so output written just before the exit is kept.
+		// Checking whether the process is still alive takes an engine exec, so only do it every few
+		// seconds; the exit file is enough to notice a normal end.
+		if polls%20 == 0 {
+			job, err = r.findJob(ctx, cfg, absProjectDir, job.ID)
+		} else {
+			job, err = readJob(dir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyFrom copies what has been appended to the file at p since offset and returns the new offset.
+func copyFrom(p string, offset int64, w io.Writer) (int64, error) {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return offset, nil
+	} else if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(w, f)
+	return offset + n, err
+}
@@ -0,0 +1,28 @@
+package container
+
+import (
+	"sort"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// userLabelArgs returns the --label and --annotation flags for the configured labels and
+// annotations, sorted so the container's config hash is stable.
+func userLabelArgs(cfg *config.Config) []string {
+	var args []string
+	args = append(args, mapFlags("--label", cfg.Labels)...)
+	return append(args, mapFlags("--annotation", cfg.Annotations)...)
+}
+
+func mapFlags(flag string, m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		args = append(args, flag, k+"="+m[k])
+	}
+	return args
+}
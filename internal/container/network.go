@@ -0,0 +1,367 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/audit"
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// egressChain is the iptables chain holding the sandbox's egress allowlist.
+const egressChain = "AIRLOCK-EGRESS"
+
+// Accounting chains count traffic to and from allowlisted destinations for the audit log.
+const (
+	acctOutChain = "AIRLOCK-ACCT-OUT"
+	acctInChain  = "AIRLOCK-ACCT-IN"
+)
+
+// egressReadyDir is a root-owned tmpfs, emptied on every start, where the allowlist script marks
+// the rules installed. The main process waits for the mark (see egressWaitScript), so it never runs
+// with open egress; the sandbox user can't write there to fake it.
+const egressReadyDir = "/run/airlock-egress"
+
+// egressWaitScript is the `sh -c` wrapper around a command-running container's entrypoint with
+// network.allow set.
+const egressWaitScript = `while [ ! -e ` + egressReadyDir + `/ready ]; do sleep 0.2 2>/dev/null || sleep 1; done; exec "$@"`
+
+// networkArgs returns the `run` flags for the configured network mode, hosts, and resolvers.
+func networkArgs(cfg *config.Config) []string {
+	var args []string
+	switch cfg.Network.Mode {
+	case config.NetworkNone, config.NetworkHost:
+		args = append(args, "--network", cfg.Network.Mode)
+	default:
+		if network := sharedNetwork(cfg); network != "" {
+			args = append(args, "--network", network)
+		}
+	}
+	if len(cfg.Network.Allow) > 0 {
+		// Needed by root inside the container to install the allowlist. The sandbox user runs
+		// unprivileged (see egressProblem), so it never holds the capability and can't change the
+		// rules.
+		args = append(args, "--cap-add", "NET_ADMIN", "--tmpfs", egressReadyDir+":rw,noexec,nosuid,nodev,mode=755")
+	}
+	hosts := make([]string, 0, len(cfg.Network.ExtraHosts))
+	for host := range cfg.Network.ExtraHosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		args = append(args, "--add-host", host+":"+cfg.Network.ExtraHosts[host])
+	}
+	for _, ip := range cfg.Network.DNS {
+		args = append(args, "--dns", ip)
+	}
+	for _, domain := range cfg.Network.DNSSearch {
+		args = append(args, "--dns-search", domain)
+	}
+	return args
+}
+
+// egressProblem explains why network.allow can't be enforced for sandbox user u, or returns "".
+// The container holds NET_ADMIN to install the allowlist, so a sandbox running as root, or
+// privileged, could flush the rules.
+func egressProblem(cfg *config.Config, u *UserConfig) string {
+	switch {
+	case len(cfg.Network.Allow) == 0:
+		return ""
+	case cfg.Security.Privileged:
+		return "network.allow can't be enforced with security.privileged: the sandbox could remove the allowlist"
+	case u != nil && runsAsRoot(u):
+		return fmt.Sprintf("network.allow needs an unprivileged sandbox user, but it runs as %s, which could remove the allowlist; set user (e.g. uid: 1000) or use an image with a non-root USER", u.Name)
+	}
+	return ""
+}
+
+// runsAsRoot reports whether the sandbox user is root inside the container.
+func runsAsRoot(u *UserConfig) bool {
+	user, _, _ := strings.Cut(u.Name, ":")
+	return u.UID == "0" || user == "0" || user == "root"
+}
+
+// ApplyNetworkPolicy installs (or refreshes) the egress allowlist inside the running container.
+// Rules live in the container's network namespace, so they are reapplied on every up; this also
+// picks up DNS changes for allowed domains. It is a no-op when the container isn't running.
+func (r *Runner) ApplyNetworkPolicy(ctx context.Context, cfg *config.Config) error {
+	if len(cfg.Network.Allow) == 0 {
+		return nil
+	}
+	if _, running := r.containerState(ctx, containerName(cfg)); !running {
+		return nil
+	}
+	allow := cfg.Network.Allow
+	if network := sharedNetwork(cfg); network != "" {
+		subnets, err := r.networkSubnets(ctx, network)
+		if err != nil {
+			return err
+		}
+		allow = append(append([]string(nil), allow...), subnets...)
+	}
+	v4, v6, err := resolveAllow(ctx, allow, cfg.Network.ExtraHosts)
+	if err != nil {
+		return err
+	}
+	name := containerName(cfg)
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s exec --user root %s sh (egress allowlist: %s)\n", r.engineBin(), name, strings.Join(cfg.Network.Allow, ", "))
+	}
+	cmd := exec.CommandContext(ctx, r.engineBin(), "exec", "-i", "--user", "root", name, "sh", "-s")
+	cmd.Stdin = strings.NewReader(egressScript(v4, v6))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		msg := strings.TrimSpace(string(out))
+		if strings.Contains(msg, "iptables: not found") || strings.Contains(msg, "iptables: command not found") {
+			return fmt.Errorf("network.allow requires iptables in the sandbox image")
+		}
+		if strings.Contains(msg, "ip6tables: unusable") {
+			return fmt.Errorf("network.allow can't restrict IPv6: ip6tables is missing or unusable in the sandbox, but it has IPv6 connectivity; install ip6tables in the image or disable IPv6 for the sandbox")
+		}
+		return fmt.Errorf("failed to apply egress allowlist: %s", msg)
+	}
+	return nil
+}
+
+// execIsolated runs cmd in a throwaway container that mirrors the project's container (same image,
+// mounts, volumes, home, and cache) but uses opts.Network, and removes it afterwards.
+func (r *Runner) execIsolated(ctx context.Context, cfg *config.Config, absProjectDir string, cmd []string, opts ExecOptions) error {
+	userConfig, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	iso, spec, err := r.isolatedArgs(ctx, cfg, userConfig, absProjectDir, *opts.Network)
+	if err != nil {
+		return err
+	}
+	// Output is captured so the container ID doesn't end up in the command's stdout.
+	if _, err := r.output(ctx, append([]string{"run", "-d"}, spec...)...); err != nil {
+		return fmt.Errorf("failed to start the isolated container: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so an interrupted command still cleans up. -v removes only the
+		// anonymous volumes the container created; the project's named volumes stay.
+		_, _ = r.output(context.Background(), "rm", "-f", "-v", containerName(iso))
+	}()
+	if err := r.ApplyNetworkPolicy(ctx, iso); err != nil {
+		return err
+	}
+	opts.Network = nil
+	return r.Exec(ctx, iso, absProjectDir, cmd, opts)
+}
+
+// isolatedArgs returns the config and `run` arguments of execIsolated's throwaway container. It
+// keeps the project's name, so it mounts the project's volumes (and synced workspace), under a
+// container name of its own.
+func (r *Runner) isolatedArgs(ctx context.Context, cfg *config.Config, u *UserConfig, absProjectDir string, network config.Network) (*config.Config, []string, error) {
+	iso := *cfg
+	iso.ContainerName = containerName(cfg) + "-exec-" + audit.NewSessionID()
+	iso.Network = network
+	// Published ports are held by the project's container, and the throwaway container stays off
+	// the services and compose networks. It runs only the exec'd command: a second copy of the
+	// main process would start before the network policy is applied.
+	iso.Ports = nil
+	iso.Services = nil
+	iso.Compose = nil
+	iso.Command = nil
+	if p := egressProblem(&iso, u); p != "" {
+		return nil, nil, errors.New(p)
+	}
+	spec, err := r.createArgs(ctx, &iso, u, absProjectDir,
+		resolveHostPath(absProjectDir, cfg.HomeDir),
+		resolveHostPath(absProjectDir, cfg.CacheDir),
+		resolveHostPath(absProjectDir, cfg.WorkDir))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &iso, spec, nil
+}
+
+// allowDest is a resolved allowlist destination and the network.allow entry it came from.
+type allowDest struct {
+	Addr string
+	Host string
+}
+
+// resolveAllow turns allowlist entries (domains, IPs, CIDRs) into IPv4 and IPv6 destinations. A
+// domain in extraHosts resolves to its entry's IP, as it does inside the sandbox.
+func resolveAllow(ctx context.Context, allow []string, extraHosts map[string]string) (v4, v6 []allowDest, err error) {
+	seen := map[string]bool{}
+	add := func(dest, host string, ipv6 bool) {
+		if seen[dest] {
+			return
+		}
+		seen[dest] = true
+		if ipv6 {
+			v6 = append(v6, allowDest{dest, host})
+		} else {
+			v4 = append(v4, allowDest{dest, host})
+		}
+	}
+	var unresolved []string
+	for _, entry := range allow {
+		entry = strings.TrimSpace(entry)
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			add(n.String(), entry, n.IP.To4() == nil)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			add(ip.String(), entry, ip.To4() == nil)
+			continue
+		}
+		if ip := net.ParseIP(extraHosts[entry]); ip != nil {
+			add(ip.String(), entry, ip.To4() == nil)
+			continue
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, entry)
+		if err != nil || len(ips) == 0 {
+			unresolved = append(unresolved, entry)
+			continue
+		}
+		for _, ip := range ips {
+			add(ip.IP.String(), entry, ip.IP.To4() == nil)
+		}
+	}
+	if len(unresolved) > 0 {
+		return nil, nil, fmt.Errorf("could not resolve network.allow entries: %s", strings.Join(unresolved, ", "))
+	}
+	byAddr := func(d []allowDest) func(i, j int) bool {
+		return func(i, j int) bool { return d[i].Addr < d[j].Addr }
+	}
+	sort.Slice(v4, byAddr(v4))
+	sort.Slice(v6, byAddr(v6))
+	return v4, v6, nil
+}
+
+// egressScript renders the shell script that installs the allowlist: loopback, established flows,
+// DNS to the container's resolvers, and the allowed destinations; everything else is rejected.
+// Accounting chains count bytes to and from each allowed destination, labeled with its host.
+func egressScript(v4, v6 []allowDest) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	b.WriteString("command -v iptables >/dev/null || { echo 'iptables: not found' >&2; exit 1; }\n")
+	b.WriteString("nameservers=$(awk '/^nameserver/ {print $2}' /etc/resolv.conf)\n")
+	for _, fam := range []struct {
+		bin   string
+		dests []allowDest
+		v6    bool
+	}{{"iptables", v4, false}, {"ip6tables", v6, true}} {
+		ipt := fam.bin + " -w"
+		if fam.v6 {
+			// Without a usable ip6tables (missing, or a legacy/nft mismatch), IPv6 can't be
+			// restricted, which is only fine when the sandbox has no IPv6 connectivity: no global
+			// address and no default route. Otherwise the allowlist fails closed.
+			b.WriteString("if ! { command -v ip6tables >/dev/null && ip6tables -L >/dev/null 2>&1; }; then\n")
+			b.WriteString("  if awk '$4 == \"00\" {f=1} END {exit !f}' /proc/net/if_inet6 2>/dev/null ||\n")
+			b.WriteString("    awk '$1 ~ /^0+$/ && $2 == \"00\" && $10 != \"lo\" {f=1} END {exit !f}' /proc/net/ipv6_route 2>/dev/null; then\n")
+			b.WriteString("    echo 'ip6tables: unusable, but the sandbox has IPv6 connectivity' >&2; exit 1\n")
+			b.WriteString("  fi\n")
+			b.WriteString("else\n")
+		}
+		fmt.Fprintf(&b, "%s -N %s 2>/dev/null || %s -F %s\n", ipt, egressChain, ipt, egressChain)
+		fmt.Fprintf(&b, "%s -C OUTPUT -j %s 2>/dev/null || %s -I OUTPUT -j %s\n", ipt, egressChain, ipt, egressChain)
+		fmt.Fprintf(&b, "%s -A %s -o lo -j RETURN\n", ipt, egressChain)
+		fmt.Fprintf(&b, "%s -A %s -m conntrack --ctstate ESTABLISHED,RELATED -j RETURN\n", ipt, egressChain)
+		match := `case "$ns" in *:*) ;; *) continue ;; esac`
+		if !fam.v6 {
+			match = `case "$ns" in *:*) continue ;; esac`
+		}
+		fmt.Fprintf(&b, "for ns in $nameservers; do %s\n", match)
+		fmt.Fprintf(&b, "  %s -A %s -d \"$ns\" -p udp --dport 53 -j RETURN\n", ipt, egressChain)
+		fmt.Fprintf(&b, "  %s -A %s -d \"$ns\" -p tcp --dport 53 -j RETURN\n", ipt, egressChain)
+		b.WriteString("done\n")
+		for _, d := range fam.dests {
+			fmt.Fprintf(&b, "%s -A %s -d %s -j RETURN\n", ipt, egressChain, d.Addr)
+		}
+		fmt.Fprintf(&b, "%s -A %s -j REJECT\n", ipt, egressChain)
+		for _, acct := range []struct{ chain, hook, dir string }{{acctOutChain, "OUTPUT", "-d"}, {acctInChain, "INPUT", "-s"}} {
+			fmt.Fprintf(&b, "%s -N %s 2>/dev/null || %s -F %s\n", ipt, acct.chain, ipt, acct.chain)
+			fmt.Fprintf(&b, "%s -C %s -j %s 2>/dev/null || %s -I %s -j %s\n", ipt, acct.hook, acct.chain, ipt, acct.hook, acct.chain)
+			for _, d := range fam.dests {
+				// Accounting is best effort: a kernel without the comment match must not cost the allowlist.
+				fmt.Fprintf(&b, "%s -A %s %s %s -m comment --comment %s -j RETURN || true\n", ipt, acct.chain, acct.dir, d.Addr, shellQuote(d.Host))
+			}
+		}
+		if fam.v6 {
+			b.WriteString("fi\n")
+		}
+	}
+	// Containers created before the ready mark existed have no tmpfs for it.
+	fmt.Fprintf(&b, "if [ -d %s ]; then touch %s/ready; fi\n", egressReadyDir, egressReadyDir)
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// trafficScript prints both accounting chains with exact byte counts, each line prefixed by its direction.
+const trafficScript = `for t in iptables ip6tables; do
+  command -v $t >/dev/null || continue
+  $t -w -L ` + acctOutChain + ` -v -x -n 2>/dev/null | sed 's/^/out /'
+  $t -w -L ` + acctInChain + ` -v -x -n 2>/dev/null | sed 's/^/in /'
+done`
+
+// trafficCounters reads the cumulative bytes sent to and received from each allowlisted host.
+// It returns nil when the sandbox has no allowlist (so nothing is accounted) or the counters can't be read.
+func (r *Runner) trafficCounters(ctx context.Context, cfg *config.Config) map[string]audit.Traffic {
+	if len(cfg.Network.Allow) == 0 {
+		return nil
+	}
+	out, _, err := r.execCapture(ctx, cfg, "root", []string{"sh", "-c", trafficScript})
+	if err != nil {
+		return nil
+	}
+	return parseTrafficCounters(out)
+}
+
+var trafficComment = regexp.MustCompile(`/\* (.*) \*/`)
+
+// parseTrafficCounters parses trafficScript output: "<dir> <pkts> <bytes> RETURN ... /* host */".
+func parseTrafficCounters(out string) map[string]audit.Traffic {
+	counters := map[string]audit.Traffic{}
+	for _, line := range strings.Split(out, "\n") {
+		m := trafficComment.FindStringSubmatch(line)
+		f := strings.Fields(line)
+		if m == nil || len(f) < 3 {
+			continue
+		}
+		n, err := strconv.ParseUint(f[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		t := counters[m[1]]
+		t.Host = m[1]
+		if f[0] == "out" {
+			t.Sent += n
+		} else {
+			t.Received += n
+		}
+		counters[m[1]] = t
+	}
+	return counters
+}
+
+// trafficDelta returns per-host traffic between two counter readings, skipping idle hosts. Counters
+// are reset when the policy is reapplied; then the later reading is the best available figure.
+func trafficDelta(before, after map[string]audit.Traffic) []audit.Traffic {
+	var delta []audit.Traffic
+	for host, a := range after {
+		b := before[host]
+		if a.Sent < b.Sent || a.Received < b.Received {
+			b = audit.Traffic{}
+		}
+		if d := (audit.Traffic{Host: host, Sent: a.Sent - b.Sent, Received: a.Received - b.Received}); d.Sent+d.Received > 0 {
+			delta = append(delta, d)
+		}
+	}
+	sort.Slice(delta, func(i, j int) bool { return delta[i].Host < delta[j].Host })
+	return delta
+}
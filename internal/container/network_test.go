@@ -0,0 +1,86 @@
+package container
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// isolatedTestArgs returns the throwaway container's config and run args for exec --network none.
+func isolatedTestArgs(t *testing.T, cfg *config.Config) (*config.Config, []string) {
+	t.Helper()
+	r := &Runner{Engine: EngineDocker, caps: &Capabilities{Engine: EngineDocker}}
+	u := &UserConfig{Name: "dev", Home: "/home/dev", WorkDir: "/workspace"}
+	iso, args, err := r.isolatedArgs(context.Background(), cfg, u, t.TempDir(), config.Network{Mode: "none"})
+	if err != nil {
+		t.Fatalf("isolatedArgs failed: %v", err)
+	}
+	return iso, args
+}
+
+func TestIsolatedArgsKeepProjectVolumes(t *testing.T) {
+	cfg := &config.Config{
+		Name:    "api",
+		Image:   "alpine",
+		WorkDir: ".",
+		Mounts:  []config.Mount{{Type: config.MountVolume, Target: "/workspace/node_modules"}},
+	}
+	iso, args := isolatedTestArgs(t, cfg)
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "-v airlock-api-workspace-node_modules:/workspace/node_modules") {
+		t.Errorf("expected the project's node_modules volume, got %q", joined)
+	}
+	if name := containerName(iso); name == containerName(cfg) || !strings.HasPrefix(name, "airlock-api-exec-") {
+		t.Errorf("expected a throwaway container name, got %q", name)
+	}
+	if i := slices.Index(args, "--name"); i < 0 || args[i+1] != containerName(iso) {
+		t.Errorf("expected --name %s, got %q", containerName(iso), joined)
+	}
+}
+
+func TestIsolatedArgsKeepSyncedWorkspace(t *testing.T) {
+	cfg := &config.Config{Name: "api", Image: "alpine", WorkDir: ".", Sync: &config.SyncConfig{}}
+	_, args := isolatedTestArgs(t, cfg)
+	if joined := strings.Join(args, " "); !strings.Contains(joined, "-v "+workspaceVolume(cfg)+":/workspace:nocopy") {
+		t.Errorf("expected the project's synced workspace volume %s, got %q", workspaceVolume(cfg), joined)
+	}
+}
+
+func TestIsolatedArgsSkipMainProcess(t *testing.T) {
+	cfg := &config.Config{Name: "api", Image: "alpine", WorkDir: ".", Command: []string{"npm", "run", "dev"}}
+	_, args := isolatedTestArgs(t, cfg)
+	if slices.Contains(args, "npm") || !slices.Equal(args[len(args)-3:], []string{"alpine", "sleep", "infinity"}) {
+		t.Errorf("expected the throwaway container to sleep instead of running the command, got %q", args)
+	}
+}
+
+func TestCreateArgsHoldCommandForAllowlist(t *testing.T) {
+	cfg := &config.Config{
+		Name:    "api",
+		Image:   "alpine",
+		WorkDir: ".",
+		Command: []string{"npm", "run", "dev"},
+		Network: config.Network{Mode: "bridge", Allow: []string{"registry.npmjs.org"}},
+	}
+	r := &Runner{Engine: EngineDocker, caps: &Capabilities{Engine: EngineDocker}}
+	u := &UserConfig{Name: "dev", Home: "/home/dev", WorkDir: "/workspace", Entrypoint: []string{"/init"}}
+	dir := t.TempDir()
+	args, err := r.createArgs(context.Background(), cfg, u, dir, dir, dir, dir)
+	if err != nil {
+		t.Fatalf("createArgs failed: %v", err)
+	}
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--tmpfs "+egressReadyDir+":") {
+		t.Errorf("expected a tmpfs for the ready mark, got %q", joined)
+	}
+	want := []string{"--entrypoint", "sh", "alpine", "-c", egressWaitScript, "airlock-egress-wait", "/init", "npm", "run", "dev"}
+	if len(args) < len(want) || !slices.Equal(args[len(args)-len(want):], want) {
+		t.Errorf("expected the command to wait for the allowlist, got %q", args)
+	}
+	if !strings.Contains(egressScript(nil, nil), egressReadyDir+"/ready") {
+		t.Error("expected the allowlist script to mark the rules installed")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package container
+
+import "os"
+
+// fileOwner is not implemented on Windows; the shared-host ownership check is skipped.
+func fileOwner(fi os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,103 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// passwdEntry is a user from the image's /etc/passwd.
+type passwdEntry struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+	GID  string `json:"gid"`
+	Home string `json:"home"`
+}
+
+// parsePasswd parses /etc/passwd, skipping malformed lines.
+func parsePasswd(b []byte) []passwdEntry {
+	entries := []passwdEntry{}
+	for _, line := range strings.Split(string(b), "\n") {
+		f := strings.Split(strings.TrimSpace(line), ":")
+		if len(f) < 6 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		entries = append(entries, passwdEntry{Name: f[0], UID: f[2], GID: f[3], Home: f[5]})
+	}
+	return entries
+}
+
+// lookupPasswd finds the user a --user value (name or uid, optionally with :group) refers to.
+func lookupPasswd(entries []passwdEntry, spec string) (passwdEntry, bool) {
+	user, _, _ := strings.Cut(spec, ":")
+	for _, e := range entries {
+		if e.Name == user || e.UID == user {
+			return e, true
+		}
+	}
+	return passwdEntry{}, false
+}
+
+// imagePasswd returns the image's /etc/passwd, copied out of a created (never started) container,
+// so it works for images without a shell or getent. An image without one yields nothing.
+func (r *Runner) imagePasswd(ctx context.Context, image string) ([]byte, error) {
+	// The command is never run; it only satisfies images without a default command.
+	id, err := r.output(ctx, "create", "--entrypoint", "", image, "true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a container to read %s's /etc/passwd: %w", image, err)
+	}
+	defer func() { _, _ = r.output(context.Background(), "rm", "-f", "-v", id) }()
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s cp %s:/etc/passwd -\n", r.engineBin(), id)
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), "cp", id+":/etc/passwd", "-").Output()
+	if err != nil {
+		return nil, nil
+	}
+	tr := tar.NewReader(bytes.NewReader(out))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return nil, nil
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// resolveUser fills in the home, uid, and gid of u.Name from the image's passwd entries, falling
+// back to /home/<name> (or /root) for a user the image doesn't list.
+func resolveUser(u *UserConfig) {
+	if e, ok := lookupPasswd(u.Passwd, u.Name); ok {
+		u.Home, u.UID, u.GID = e.Home, e.UID, e.GID
+		if _, group, ok := strings.Cut(u.Name, ":"); ok && isNumeric(group) {
+			u.GID = group
+		}
+		return
+	}
+	user, _, _ := strings.Cut(u.Name, ":")
+	switch {
+	case user == "root" || user == "0":
+		u.Home, u.UID, u.GID = "/root", "0", "0"
+	case user != "":
+		u.Home = "/home/" + user
+	}
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
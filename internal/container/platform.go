@@ -0,0 +1,32 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// platformArgs returns the --platform flag for the configured platform, if any.
+func platformArgs(cfg *config.Config) []string {
+	if cfg.Platform == "" {
+		return nil
+	}
+	return []string{"--platform", cfg.Platform}
+}
+
+// ensurePlatform pulls the configured prebuilt image for cfg.Platform when the local copy is
+// missing or was pulled for another platform; a tag holds one platform's image at a time.
+func (r *Runner) ensurePlatform(ctx context.Context, cfg *config.Config) error {
+	out, err := r.output(ctx, "image", "inspect", "--format", "{{.Os}}/{{.Architecture}}", cfg.Image)
+	if err == nil && strings.HasPrefix(cfg.Platform+"/", out+"/") {
+		return nil
+	}
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "%s is for %s; pulling it for %s\n", cfg.Image, out, cfg.Platform)
+	}
+	args := append([]string{"pull"}, platformArgs(cfg)...)
+	return r.runCmdInteractive(ctx, r.engineBin(), append(args, cfg.Image)...)
+}
@@ -0,0 +1,56 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// Prefetch downloads everything `up` would otherwise fetch on first use: it builds the sandbox
+// image (pulling its base layers) or pulls the configured image, and pulls service and compose
+// images. Images already present are not pulled again.
+func (r *Runner) Prefetch(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	if cfg.Build != nil && cfg.Image != "" {
+		if err := r.ensureImage(ctx, cfg, absProjectDir); err != nil {
+			return err
+		}
+	} else if cfg.Build != nil {
+		if err := r.buildImage(ctx, cfg, absProjectDir); err != nil {
+			return fmt.Errorf("failed to build %s: %w", cfg.Build.Tag, err)
+		}
+	} else if cfg.Platform != "" {
+		if err := r.ensurePlatform(ctx, cfg); err != nil {
+			return fmt.Errorf("failed to pull %s: %w", cfg.Image, err)
+		}
+	} else if err := r.pullMissing(ctx, cfg.Image); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := r.pullMissing(ctx, cfg.Services[name].Image); err != nil {
+			return fmt.Errorf("services.%s: %w", name, err)
+		}
+	}
+	if cfg.Compose != nil {
+		return r.compose(ctx, cfg, absProjectDir, "pull")
+	}
+	return nil
+}
+
+// pullMissing pulls image unless it is already present locally.
+func (r *Runner) pullMissing(ctx context.Context, image string) error {
+	if _, err := r.imageID(ctx, image); err == nil {
+		return nil
+	}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), "pull", image); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	return nil
+}
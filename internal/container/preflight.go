@@ -0,0 +1,204 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelProjectDir records which project directory a container was created for.
+const labelProjectDir = "airlock.project.dir"
+
+// minFreeBytes is the free space required on the filesystems backing home and cache.
+const minFreeBytes = 512 << 20
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var mountOptionPattern = regexp.MustCompile(`^[A-Za-z0-9_.=-]+$`)
+
+// PreflightError aggregates every problem found before invoking the engine, so users can fix them
+// all at once instead of iterating through sequential engine failures.
+type PreflightError struct {
+	Problems []string
+}
+
+func (e *PreflightError) Error() string {
+	return "preflight checks failed:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Preflight validates the config and host state locally before any container is created.
+func (r *Runner) Preflight(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	var problems []string
+	add := func(format string, args ...any) { problems = append(problems, fmt.Sprintf(format, args...)) }
+
+	switch {
+	case cfg.Build != nil:
+		df := cfg.Build.Containerfile
+		if !filepath.IsAbs(df) {
+			df = filepath.Join(absProjectDir, df)
+		}
+		if fi, err := os.Stat(df); err != nil || fi.IsDir() {
+			add("build.containerfile %s does not exist", cfg.Build.Containerfile)
+		}
+		if fi, err := os.Stat(resolveHostPath(absProjectDir, cfg.Build.Context)); err != nil || !fi.IsDir() {
+			add("build.context %s is not a directory", cfg.Build.Context)
+		}
+	case cfg.Image == "":
+		add("no image or build configured (and no Containerfile found)")
+	}
+
+	if fi, err := os.Stat(resolveHostPath(absProjectDir, cfg.WorkDir)); err != nil || !fi.IsDir() {
+		add("workdir %s is not a directory", cfg.WorkDir)
+	}
+
+	targets := map[string]bool{}
+	for i, m := range cfg.Mounts {
+		label := fmt.Sprintf("mounts[%d]", i)
+		switch {
+		case !m.IsBind() && m.Type != config.MountVolume && m.Type != config.MountTmpfs:
+			add("%s: type must be %s, %s, or %s, got %q", label, config.MountBind, config.MountVolume, config.MountTmpfs, m.Type)
+		case m.Type == config.MountVolume:
+			if m.Source != "" && !volumeNameRe.MatchString(m.Source) {
+				add("%s: volume name %q must start with a letter or digit and contain only letters, digits, '_', '.', and '-'", label, m.Source)
+			}
+			if cfg.Sync != nil && volumeName(cfg, m) == workspaceVolume(cfg) {
+				add("%s: volume %s is the synced workspace's", label, volumeName(cfg, m))
+			}
+		case m.Type == config.MountTmpfs:
+			if m.Source != "" {
+				add("%s: a tmpfs mount has no source", label)
+			}
+			if len(m.Options) > 0 || m.Mode == "ro" {
+				add("%s: a tmpfs mount takes no options or mode; use a tmpfs entry to set its size or mode", label)
+			}
+		case m.Source == "":
+			add("%s: source is required", label)
+		default:
+			if _, err := os.Stat(resolveHostPath(absProjectDir, m.Source)); err != nil {
+				add("%s: source %s does not exist", label, m.Source)
+			}
+		}
+		if !strings.HasPrefix(m.Target, "/") {
+			add("%s: target %q must be an absolute container path", label, m.Target)
+		} else if targets[m.Target] {
+			add("%s: target %s is mounted more than once", label, m.Target)
+		}
+		targets[m.Target] = true
+		if m.Mode != "" && m.Mode != "rw" && m.Mode != "ro" {
+			add("%s: mode must be rw or ro, got %q", label, m.Mode)
+		}
+		for _, o := range m.Options {
+			if !mountOptionPattern.MatchString(o) {
+				add("%s: %q is not a mount option", label, o)
+			}
+		}
+	}
+
+	for i, t := range cfg.Tmpfs {
+		if targets[t.Target] {
+			add("tmpfs[%d]: %s is also a mount target", i, t.Target)
+		}
+	}
+
+	published := map[string]bool{}
+	for _, p := range cfg.Ports {
+		key := fmt.Sprintf("%s:%d/%s", p.HostIP, p.Host, p.Protocol)
+		if published[key] {
+			add("ports: host port %d is published more than once", p.Host)
+		}
+		published[key] = true
+	}
+
+	for k := range cfg.Env {
+		if !envKeyPattern.MatchString(k) {
+			add("env: %q is not a valid variable name", k)
+		}
+	}
+	for _, f := range cfg.EnvFile {
+		if _, err := os.Stat(config.EnvFilePath(absProjectDir, f)); err != nil {
+			add("envFile: %s does not exist", f)
+		}
+	}
+	for k, src := range cfg.EnvSources {
+		if !envKeyPattern.MatchString(k) {
+			add("env: %q is not a valid variable name", k)
+		}
+		if src.FromFile != "" {
+			if _, err := os.Stat(src.Path(absProjectDir)); err != nil {
+				add("env.%s: fromFile %s does not exist", k, src.FromFile)
+			}
+		}
+	}
+
+	if cfg.Compose != nil {
+		if fi, err := os.Stat(resolveHostPath(absProjectDir, cfg.Compose.File)); err != nil || fi.IsDir() {
+			add("compose.file %s does not exist", cfg.Compose.File)
+		}
+	}
+
+	if cfg.SSO != nil {
+		for i, sock := range cfg.SSO.Sockets {
+			if fi, err := os.Stat(sock.Path(absProjectDir)); err != nil || fi.Mode()&os.ModeSocket == 0 {
+				add("sso.sockets[%d]: %s is not a socket (is the SSO helper running?)", i, sock.Source)
+			}
+		}
+	}
+
+	problems = append(problems, r.securityProfileProblems(ctx, cfg, absProjectDir)...)
+
+	// The image's user is only known here once it has been inspected; Up checks it again after.
+	var u *UserConfig
+	if cached := r.cachedUserConfig(absProjectDir, cfg); cached != nil {
+		u = withConfigOverrides(cfg, r.capabilities(ctx), cached)
+	} else if cfg.User != nil {
+		u = &UserConfig{Name: cfg.User.Spec()}
+	}
+	if p := egressProblem(cfg, u); p != "" {
+		add("%s", p)
+	}
+
+	for _, d := range []struct{ name, path string }{{"home", cfg.HomeDir}, {"cache", cfg.CacheDir}} {
+		p := resolveHostPath(absProjectDir, d.path)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			add("%s %s exists but is not a directory", d.name, d.path)
+			continue
+		}
+		if free, ok := freeBytes(existingParent(p)); ok && free < minFreeBytes {
+			add("%s %s: only %d MiB free on its filesystem", d.name, d.path, free>>20)
+		}
+	}
+
+	// Only engine lookup from here on.
+	name := containerName(cfg)
+	if exists, _ := r.containerExists(ctx, name); exists {
+		owner, err := r.output(ctx, "inspect", "-f", `{{index .Config.Labels "`+labelProjectDir+`"}}`, name)
+		if err == nil && owner != "" && owner != "<no value>" && owner != absProjectDir {
+			add("container name %s is already used by the project at %s; set a different name in airlock.yaml", name, owner)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PreflightError{Problems: problems}
+	}
+	return nil
+}
+
+// existingParent walks up from p to the nearest path that exists, so free space can be checked
+// before state dirs are created.
+func existingParent(p string) string {
+	for {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// hostLocaltime is the host's timezone file, mounted over the sandbox's with propagate.timezone.
+const hostLocaltime = "/etc/localtime"
+
+// zoneinfoDir holds the timezone files TZ names, on the host and in most images.
+const zoneinfoDir = "/usr/share/zoneinfo"
+
+// propagatedEnv returns the host's TZ and LANG for propagate.timezone and propagate.locale. It is
+// resolved for every session, so a host that changed timezone carries it into new sessions.
+func propagatedEnv(cfg *config.Config) map[string]string {
+	env := map[string]string{}
+	if cfg.Propagate.Timezone {
+		if tz := hostTimezone(); tz != "" {
+			env["TZ"] = tz
+		}
+	}
+	if cfg.Propagate.Locale {
+		if lang := os.Getenv("LANG"); lang != "" {
+			env["LANG"] = lang
+		}
+	}
+	return env
+}
+
+// hostTimezone returns the host's timezone name: TZ when it names one, else the zoneinfo file
+// /etc/localtime links to (e.g. /usr/share/zoneinfo/Europe/Berlin), or "" when neither says.
+func hostTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" && !strings.HasPrefix(tz, ":") {
+		return tz
+	}
+	target, err := filepath.EvalSymlinks(hostLocaltime)
+	if err != nil {
+		return ""
+	}
+	if _, name, ok := strings.Cut(filepath.ToSlash(target), "/zoneinfo/"); ok {
+		return name
+	}
+	return ""
+}
+
+// localtimeArgs mounts the host's /etc/localtime read-only for programs that ignore TZ, and the
+// host's zoneinfo file for TZ, so the name resolves in images without tzdata. Only Linux hosts share
+// them with the engine; Docker Desktop and podman machines don't see the host's /etc. They are never
+// relabeled: that would take the host files away from the host's own programs under SELinux.
+func localtimeArgs(cfg *config.Config) []string {
+	if !cfg.Propagate.Timezone || runtime.GOOS != "linux" {
+		return nil
+	}
+	var args []string
+	if _, err := os.Stat(hostLocaltime); err == nil {
+		args = append(args, "-v", mountSpec(hostLocaltime, hostLocaltime, "ro"))
+	}
+	if tz := hostTimezone(); tz != "" && !strings.Contains(tz, "..") {
+		zone := path.Join(zoneinfoDir, tz)
+		if fi, err := os.Stat(zone); err == nil && fi.Mode().IsRegular() {
+			args = append(args, "-v", mountSpec(zone, zone, "ro"))
+		}
+	}
+	return args
+}
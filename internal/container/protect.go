@@ -0,0 +1,103 @@
+package container
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// protectedPaths returns the workspace-relative paths (slash-separated) under root that match any
+// of the protect globs. A matching directory is returned without descending into it, since mounting
+// it read-only covers everything inside. Symlinks are skipped: bind-mounting one would expose its
+// host target instead of protecting the link.
+func protectedPaths(root string, patterns []string) ([]string, error) {
+	var matches []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(path.Clean(pattern), "/**")
+		base := staticPrefix(pattern)
+		start := filepath.Join(root, filepath.FromSlash(base))
+		err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == start {
+					// Nothing to protect (yet) under this prefix.
+					return fs.SkipAll
+				}
+				return err
+			}
+			rel, _ := filepath.Rel(root, p)
+			rel = filepath.ToSlash(rel)
+			if rel == ".airlock" || strings.HasPrefix(rel, ".airlock/") {
+				return fs.SkipDir
+			}
+			if d.Type()&fs.ModeSymlink != 0 || !matchGlob(pattern, rel) {
+				return nil
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				matches = append(matches, rel)
+			}
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// protectedPath reports whether the workspace-relative path rel is, or is inside, a path matching
+// one of the protect globs.
+func protectedPath(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(path.Clean(pattern), "/**")
+		for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+			if matchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// staticPrefix returns the leading path segments of pattern that contain no glob characters.
+func staticPrefix(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	for i, s := range segs {
+		if strings.ContainsAny(s, "*?[") {
+			return strings.Join(segs[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// matchGlob matches a slash-separated path against a glob where "**" spans any number of segments
+// and other segments follow path.Match.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, name []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
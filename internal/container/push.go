@@ -0,0 +1,41 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// Push publishes the project's built image to ref (default build.publish), building it first
+// unless it is up to date, so teammates can run the prebuilt image instead of building it. It
+// returns the reference pushed.
+func (r *Runner) Push(ctx context.Context, cfg *config.Config, absProjectDir string, ref string) (string, error) {
+	if cfg.Build == nil {
+		return "", errors.New("push publishes the image airlock builds, but this project runs a prebuilt image")
+	}
+	if ref == "" {
+		ref = cfg.Build.Publish
+	}
+	if ref == "" {
+		return "", errors.New("no image reference to push to: pass one, or set build.publish")
+	}
+	if err := r.ensureDaemon(ctx, cfg.Engine.AutoStartMachine); err != nil {
+		return "", err
+	}
+	if err := r.ensureImage(ctx, cfg, absProjectDir); err != nil {
+		return "", err
+	}
+	if ref != cfg.Build.Tag {
+		if _, err := r.output(ctx, "tag", cfg.Build.Tag, ref); err != nil {
+			return "", fmt.Errorf("failed to tag %s as %s: %w", cfg.Build.Tag, ref, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Pushing %s\n", ref)
+	if err := r.runCmdInteractive(ctx, r.engineBin(), "push", ref); err != nil {
+		return "", fmt.Errorf("failed to push %s: %w", ref, err)
+	}
+	return ref, nil
+}
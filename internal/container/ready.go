@@ -0,0 +1,119 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// ReadyStatus is the structured result of waiting for the sandbox to become ready.
+type ReadyStatus struct {
+	Container string       `json:"container"`
+	Running   bool         `json:"running"`
+	Health    string       `json:"health"` // "healthy", "unhealthy", "starting", or "none" without a healthcheck
+	Ports     []PortStatus `json:"ports,omitempty"`
+	Ready     bool         `json:"ready"`
+	Waited    string       `json:"waited"`
+}
+
+// PortStatus reports whether a declared port has a listener inside the container.
+type PortStatus struct {
+	Port      string `json:"port"`
+	Listening bool   `json:"listening"`
+}
+
+// WaitReady polls until the container is running, its healthcheck (if the image defines one) passes,
+// and every declared TCP port has a listener inside the container, or until timeout elapses.
+// Ports are checked from inside the container because engine port proxies accept host connections
+// even when nothing is listening.
+func (r *Runner) WaitReady(ctx context.Context, cfg *config.Config, timeout time.Duration) (*ReadyStatus, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for {
+		st, err := r.readyStatus(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		st.Waited = time.Since(start).Round(time.Millisecond).String()
+		if st.Ready {
+			return st, nil
+		}
+		if time.Now().After(deadline) || st.Health == "unhealthy" {
+			return st, fmt.Errorf("container not ready after %s", st.Waited)
+		}
+		select {
+		case <-ctx.Done():
+			return st, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (r *Runner) readyStatus(ctx context.Context, cfg *config.Config) (*ReadyStatus, error) {
+	name := containerName(cfg)
+	st := &ReadyStatus{Container: name, Health: "none"}
+
+	if exists, _ := r.containerState(ctx, name); !exists {
+		return st, nil
+	}
+	d, err := r.inspectContainer(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	st.Running = d.State.Running
+	if h := d.State.health(); h != "" {
+		st.Health = h
+	}
+
+	listening := map[int]bool{}
+	if st.Running && len(cfg.Ports) > 0 {
+		u, err := r.userConfig(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		tables, _, err := r.execCapture(ctx, cfg, u.Name, []string{"cat", "/proc/net/tcp", "/proc/net/tcp6"})
+		if err != nil && r.Verbose {
+			fmt.Fprintf(os.Stderr, "warning: could not read listening ports: %v\n", err)
+		}
+		listening = listeningPorts(tables)
+	}
+
+	allPorts := true
+	for _, p := range cfg.Ports {
+		ps := PortStatus{Port: p.String(), Listening: true}
+		// UDP has no listen state to observe; treat it as ready.
+		if p.Protocol != "udp" {
+			ps.Listening = listening[p.Container]
+		}
+		allPorts = allPorts && ps.Listening
+		st.Ports = append(st.Ports, ps)
+	}
+
+	st.Ready = st.Running && (st.Health == "none" || st.Health == "healthy") && allPorts
+	return st, nil
+}
+
+// listeningPorts parses /proc/net/tcp{,6} contents and returns the local ports in LISTEN state.
+func listeningPorts(tables string) map[int]bool {
+	ports := map[int]bool{}
+	for _, line := range strings.Split(tables, "\n") {
+		f := strings.Fields(line)
+		// sl local_address rem_address st ...
+		if len(f) < 4 || f[3] != "0A" {
+			continue
+		}
+		i := strings.LastIndex(f[1], ":")
+		if i < 0 {
+			continue
+		}
+		if port, err := strconv.ParseUint(f[1][i+1:], 16, 16); err == nil {
+			ports[int(port)] = true
+		}
+	}
+	return ports
+}
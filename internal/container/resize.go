@@ -0,0 +1,43 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resizeSettle is when a TTY session is told to re-read the terminal size once more after it
+// starts, for a resize made while the engine was still attaching (which the engine drops).
+const resizeSettle = 500 * time.Millisecond
+
+// sizeWrap starts cmd with its TTY at the host terminal's size. The engine sets the size only once
+// the exec session is attached, so without this full-screen programs can draw their first frame
+// at 80x24 (or 0x0) and stay that way until the terminal is resized.
+func sizeWrap(cmd []string) []string {
+	rows, cols, ok := terminalSize(os.Stdout)
+	if !ok {
+		return cmd
+	}
+	return append([]string{"sh", "-c", `stty rows "$1" cols "$2" 2>/dev/null; shift 2; exec "$@"`, "sh", strconv.Itoa(rows), strconv.Itoa(cols)}, cmd...)
+}
+
+// runTTY runs an engine exec that has a TTY, passing terminal resizes on to the engine's CLI, which
+// resizes the session's TTY.
+func (r *Runner) runTTY(ctx context.Context, stdin io.Reader, args ...string) error {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	cmd := exec.CommandContext(ctx, r.engineBin(), args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := forwardResize(cmd.Process)
+	defer stop()
+	return cmd.Wait()
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package container
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// terminalSize returns the size of the terminal f is attached to.
+func terminalSize(f *os.File) (rows, cols int, ok bool) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); errno != 0 || ws.Row == 0 || ws.Col == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Row), int(ws.Col), true
+}
+
+// forwardResize sends p a SIGWINCH whenever the terminal is resized, and once more after
+// resizeSettle. p normally gets SIGWINCH from the terminal itself; forwarding covers an engine CLI
+// that isn't in the terminal's foreground process group. The returned func stops forwarding.
+func forwardResize(p *os.Process) func() {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		settle := time.NewTimer(resizeSettle)
+		defer settle.Stop()
+		for {
+			select {
+			case <-winch:
+			case <-settle.C:
+			case <-done:
+				return
+			}
+			_ = p.Signal(syscall.SIGWINCH)
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
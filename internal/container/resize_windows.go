@@ -0,0 +1,16 @@
+//go:build windows
+
+package container
+
+import "os"
+
+// terminalSize is not implemented on Windows; sessions start at the engine's default size.
+func terminalSize(f *os.File) (rows, cols int, ok bool) {
+	return 0, 0, false
+}
+
+// forwardResize is a no-op on Windows, which has no SIGWINCH; the engine's CLI polls the console
+// size itself.
+func forwardResize(p *os.Process) func() {
+	return func() {}
+}
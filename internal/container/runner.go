@@ -3,25 +3,48 @@ package container
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/donjaime/airlock/internal/audit"
+	"github.com/donjaime/airlock/internal/broker"
 	"github.com/donjaime/airlock/internal/config"
+	"github.com/donjaime/airlock/internal/filelock"
+	"github.com/donjaime/airlock/internal/sanitize"
+	"github.com/donjaime/airlock/internal/sockproxy"
 )
 
 type UserConfig struct {
 	Name    string
 	Home    string
+	UID     string // from the image's /etc/passwd; empty when it doesn't list the user
+	GID     string
 	WorkDir string
 	Env     []string
+	ImageID string
+	// Entrypoint is the image's, run before the main process when createArgs replaces it.
+	Entrypoint []string
+	// Passwd is the image's /etc/passwd, for resolving a user.name override's home.
+	Passwd []passwdEntry
 }
 
 type Runner struct {
 	Engine  Engine
 	Verbose bool
+	Version string // airlock's own version, exposed inside the sandbox
+
+	caps *Capabilities // probed lazily; see capabilities
 }
 
 func NewRunner(e Engine) *Runner { return &Runner{Engine: e} }
@@ -31,71 +54,290 @@ func (r *Runner) Info(ctx context.Context, cfg *config.Config, absProjectDir str
 	cacheHost := resolveHostPath(absProjectDir, cfg.CacheDir)
 	workDirHost := resolveHostPath(absProjectDir, cfg.WorkDir)
 
-	image := cfg.Image
-	if cfg.Build != nil {
-		image = cfg.Build.Tag
+	image := imageRef(cfg)
+
+	lines := []string{"engine: " + string(r.Engine)}
+	lines = append(lines, r.capabilities(ctx).lines()...)
+	lines = append(lines,
+		"config.name: "+cfg.Name,
+		"projectDir: "+absProjectDir,
+		"containerName: "+containerName(cfg),
+		"image: "+image,
+		"workHostDir: "+workDirHost,
+		"homeHostDir: "+homeHost,
+		"cacheHostDir: "+cacheHost,
+	)
+	// The workspace depends on the image, which may not be built yet.
+	if u, err := r.userConfig(ctx, cfg); err == nil {
+		lines = append(lines, "workspace: "+u.WorkDir)
+		user := u.Name
+		if u.UID != "" {
+			user += fmt.Sprintf(" (uid %s, gid %s)", u.UID, u.GID)
+		}
+		lines = append(lines, "user: "+user, "userHome: "+u.Home)
 	}
 
-	lines := []string{
-		"engine: " + string(r.Engine),
-		"config.name: " + cfg.Name,
-		"projectDir: " + absProjectDir,
-		"containerName: " + containerName(cfg),
-		"image: " + image,
-		"workHostDir: " + workDirHost,
-		"homeHostDir: " + homeHost,
-		"cacheHostDir: " + cacheHost,
+	exists, err := r.containerExists(ctx, containerName(cfg))
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		details, err := r.inspectContainer(ctx, containerName(cfg))
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, details.runtimeLines()...)
+	} else {
+		lines = append(lines, "runtime: container not created (run: airlock up)")
 	}
 	return strings.Join(lines, "\n"), nil
 }
 
-func (r *Runner) Up(ctx context.Context, cfg *config.Config, absProjectDir string) error {
-	if cfg.Build != nil {
-		if err := r.buildImage(ctx, cfg, absProjectDir); err != nil {
-			return err
+// Which describes how the current invocation resolved its project context: the config file in use,
+// the project root, and the state of the project's container.
+func (r *Runner) Which(ctx context.Context, cfg *config.Config, cfgFile string, absProjectDir string) (string, error) {
+	absCfg, err := filepath.Abs(cfgFile)
+	if err != nil {
+		return "", err
+	}
+	name := containerName(cfg)
+	exists, err := r.containerExists(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	state := "absent"
+	if exists {
+		running, err := r.containerRunning(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		state = "stopped"
+		if running {
+			state = "running"
 		}
 	}
 
-	image := cfg.Image
-	if cfg.Build != nil {
-		image = cfg.Build.Tag
+	lines := []string{
+		"config: " + absCfg,
+	}
+	for _, o := range cfg.Overlays {
+		lines = append(lines, "overlay: "+o)
 	}
+	lines = append(lines,
+		"projectDir: "+absProjectDir,
+		"containerName: "+name,
+		"container: "+state,
+	)
+	if cfg.ExecDir != "" {
+		lines = append(lines, "execDir: "+cfg.ExecDir)
+	}
+	return strings.Join(lines, "\n"), nil
+}
 
-	userConfig, err := r.inspectImage(ctx, image)
-	if err != nil {
+func (r *Runner) Up(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	if err := r.ensureDaemon(ctx, cfg.Engine.AutoStartMachine); err != nil {
 		return err
 	}
+	r.checkClock(ctx, cfg, absProjectDir)
+	r.checkInotify(ctx, absProjectDir)
+	if err := r.Preflight(ctx, cfg, absProjectDir); err != nil {
+		return err
+	}
+
+	if cfg.Build != nil {
+		if err := r.ensureImage(ctx, cfg, absProjectDir); err != nil {
+			return err
+		}
+	} else if cfg.Platform != "" {
+		if err := r.ensurePlatform(ctx, cfg); err != nil {
+			return err
+		}
+	}
 
 	homeHost := resolveHostPath(absProjectDir, cfg.HomeDir)
 	cacheHost := resolveHostPath(absProjectDir, cfg.CacheDir)
 	workDirHost := resolveHostPath(absProjectDir, cfg.WorkDir)
-	if err := os.MkdirAll(homeHost, 0700); err != nil {
+
+	// Image inspection, state dir setup, and the container state lookup are independent; on slow
+	// (e.g. NFS-backed) homes running them serially adds seconds to every command.
+	var (
+		wg                  sync.WaitGroup
+		userConfig          *UserConfig
+		exists, running     bool
+		inspectErr, dirsErr error
+	)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		userConfig, inspectErr = r.inspectImage(ctx, imageRef(cfg), r.cachedUserConfig(absProjectDir, cfg))
+	}()
+	go func() {
+		defer wg.Done()
+		dirsErr = prepareStateDirs(cfg, absProjectDir, homeHost, cacheHost)
+	}()
+	go func() {
+		defer wg.Done()
+		exists, running = r.containerState(ctx, containerName(cfg))
+	}()
+	wg.Wait()
+	if err := errors.Join(inspectErr, dirsErr); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(cacheHost, 0700); err != nil {
+	r.warnLockMismatch(ctx, cfg, absProjectDir, userConfig.ImageID)
+	inspected := userConfig
+	if !exists {
+		_, warnings := workspaceTarget(cfg, absProjectDir, userConfig.WorkDir)
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+	}
+	userConfig = withConfigOverrides(cfg, r.capabilities(ctx), userConfig)
+	if p := egressProblem(cfg, userConfig); p != "" {
+		return errors.New(p)
+	}
+	if err := r.writeSandboxInfo(cfg, absProjectDir, userConfig); err != nil {
 		return err
 	}
-
-	exists, err := r.containerExists(ctx, containerName(cfg))
-	if err != nil {
+	if err := r.prepareGit(ctx, cfg, homeHost, userConfig.Home); err != nil {
 		return err
 	}
+	if err := refreshKerberos(cfg, absProjectDir); err != nil {
+		return err
+	}
+	if err := r.startServices(ctx, cfg); err != nil {
+		return err
+	}
+	if !running {
+		// compose up is slow even when nothing changed, so a running sandbox's stack is left alone.
+		if err := r.composeUp(ctx, cfg, absProjectDir); err != nil {
+			return err
+		}
+	}
+
 	if !exists {
 		if err := r.createContainer(ctx, cfg, userConfig, absProjectDir, homeHost, cacheHost, workDirHost); err != nil {
 			return err
 		}
+		r.cacheUserConfig(absProjectDir, cfg, inspected)
+	} else if id, err := r.containerImageID(ctx, containerName(cfg)); err == nil && sameImageID(id, inspected.ImageID) {
+		r.cacheUserConfig(absProjectDir, cfg, inspected)
+	} else {
+		// The image changed since the container was created; enter/exec inspect the one it runs.
+		invalidateInspectCache(absProjectDir)
+	}
+	if !running {
+		if err := r.runCmdInteractive(ctx, r.engineBin(), "start", containerName(cfg)); err != nil {
+			return err
+		}
+	}
+	if !exists {
+		r.ensureUser(ctx, cfg, userConfig)
+	}
+	if cfg.Sync != nil {
+		// Before the hooks, which usually work on the workspace (e.g. installing dependencies).
+		if _, err := r.SyncWorkspace(ctx, cfg, absProjectDir); err != nil {
+			return fmt.Errorf("failed to sync the workspace into the container: %w", err)
+		}
+	}
+	if err := r.ApplyNetworkPolicy(ctx, cfg); err != nil {
+		// Don't leave the sandbox running without its allowlist. Use a fresh context so an
+		// interrupted up still stops it.
+		if len(cfg.Network.Allow) == 0 {
+			return err
+		}
+		_, _ = r.output(context.Background(), "stop", containerName(cfg))
+		return fmt.Errorf("%w (the container was stopped)", err)
+	}
+	if !exists {
+		if err := r.runHooks(ctx, cfg, "postCreate", cfg.Hooks.PostCreate); err != nil {
+			return fmt.Errorf("%w (the container was kept; fix the hook, then run: airlock down && airlock up)", err)
+		}
+	}
+	if !running {
+		if err := r.runHooks(ctx, cfg, "postStart", cfg.Hooks.PostStart); err != nil {
+			return err
+		}
 	}
+	r.GC(ctx, cfg, absProjectDir)
+	return nil
+}
 
-	running, err := r.containerRunning(ctx, containerName(cfg))
-	if err != nil {
+// prepareStateDirs creates the host-side home and cache dirs (and the broker queue and engine socket
+// dir when those are configured).
+func prepareStateDirs(cfg *config.Config, absProjectDir, homeHost, cacheHost string) error {
+	if err := os.MkdirAll(homeHost, 0700); err != nil {
 		return err
 	}
-	if !running {
-		return r.runCmdInteractive(ctx, r.engineBin(), "start", containerName(cfg))
+	if err := os.MkdirAll(cacheHost, 0700); err != nil {
+		return err
+	}
+	if cfg.EngineSocket != nil {
+		if err := os.MkdirAll(sockproxy.Dir(absProjectDir), 0700); err != nil {
+			return err
+		}
+	}
+	if cfg.SSO != nil && cfg.SSO.Kerberos {
+		if err := os.MkdirAll(kerberosDir(absProjectDir), 0700); err != nil {
+			return err
+		}
+	}
+	if err := privateStateDirs(cfg, absProjectDir, homeHost, cacheHost); err != nil {
+		return err
+	}
+	if cfg.Approvals {
+		return broker.Ensure(broker.Dir(absProjectDir))
 	}
 	return nil
 }
 
+// Recreate removes the project's container (if any) and brings it back up with the current config.
+func (r *Runner) Recreate(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	exists, err := r.containerExists(ctx, containerName(cfg))
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := r.Down(ctx, cfg, ""); err != nil {
+			return err
+		}
+	}
+	return r.Up(ctx, cfg, absProjectDir)
+}
+
+// Rebuild forces a fresh image (a rebuild, or a pull for prebuilt images; with both configured, a
+// pull that falls back to a rebuild unless noCache) and recreates the container from it, even if
+// one already exists.
+func (r *Runner) Rebuild(ctx context.Context, cfg *config.Config, absProjectDir string, noCache bool) error {
+	if cfg.Build != nil && cfg.Image != "" && !noCache {
+		hash, err := buildHash(cfg, absProjectDir)
+		if err != nil {
+			return err
+		}
+		if err := r.pullOrBuild(ctx, cfg, absProjectDir, hash); err != nil {
+			return err
+		}
+	} else if cfg.Build != nil {
+		var extra []string
+		if noCache {
+			extra = append(extra, "--no-cache")
+		}
+		if err := r.buildImage(ctx, cfg, absProjectDir, extra...); err != nil {
+			return err
+		}
+	} else {
+		args := append([]string{"pull"}, platformArgs(cfg)...)
+		if err := r.runCmdInteractive(ctx, r.engineBin(), append(args, cfg.Image)...); err != nil {
+			return err
+		}
+	}
+	return r.Recreate(ctx, cfg, absProjectDir)
+}
+
+// Exists reports whether the project's container has been created.
+func (r *Runner) Exists(ctx context.Context, cfg *config.Config) (bool, error) {
+	return r.containerExists(ctx, containerName(cfg))
+}
+
 func (r *Runner) getMergedEnv(cfg *config.Config, u *UserConfig, extraEnv []string) []string {
 	envMap := make(map[string]string)
 
@@ -107,12 +349,19 @@ func (r *Runner) getMergedEnv(cfg *config.Config, u *UserConfig, extraEnv []stri
 		}
 	}
 
-	// 2. Airlock yaml defaults
-	for k, v := range cfg.Env {
+	// 2. Host timezone and locale (propagate)
+	for k, v := range propagatedEnv(cfg) {
 		envMap[k] = v
 	}
 
-	// 3. Command line overrides (-e)
+	// 3. Airlock yaml defaults (load rejects denied names, but profiles and overlays add env later)
+	for k, v := range cfg.Env {
+		if !cfg.EnvDenied(k) {
+			envMap[k] = v
+		}
+	}
+
+	// 4. Command line overrides (-e)
 	for _, e := range extraEnv {
 		parts := strings.SplitN(e, "=", 2)
 		if len(parts) == 2 {
@@ -120,60 +369,274 @@ func (r *Runner) getMergedEnv(cfg *config.Config, u *UserConfig, extraEnv []stri
 		}
 	}
 
-	// 4. Airlock internal overrides
+	// 5. Airlock internal overrides
 	home := u.Home
 	envMap["HOME"] = home
 	envMap["XDG_CACHE_HOME"] = home + "/.cache"
 	envMap["XDG_CONFIG_HOME"] = home + "/.config"
 	envMap["XDG_DATA_HOME"] = home + "/.local/share"
 	envMap["WORKDIR"] = u.WorkDir
+	envMap["AIRLOCK"] = "1"
+	envMap["AIRLOCK_PROJECT"] = cfg.Name
 
 	var env []string
 	for k, v := range envMap {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
+	sort.Strings(env)
 	return env
 }
 
-func (r *Runner) Enter(ctx context.Context, cfg *config.Config, absProjectDir string, env []string) error {
-	image := cfg.Image
-	if cfg.Build != nil {
-		image = cfg.Build.Tag
+// sessionEnv returns the env passed to each enter/exec/hook session on top of the container's own:
+// envFile entries not overridden by env, env.*.fromFile and fromCommand entries resolved as
+// KEY=VALUE pairs, freshly minted cloud credentials, and AIRLOCK_VERSION. They are not baked into
+// the container, so edits, upgrades, and rotated secrets apply without a recreate, and secrets never
+// show up in the container's inspect output.
+func (r *Runner) sessionEnv(ctx context.Context, cfg *config.Config, absProjectDir string) ([]string, error) {
+	var env []string
+	for _, f := range cfg.EnvFile {
+		entries, err := config.ReadEnvFile(config.EnvFilePath(absProjectDir, f))
+		if err != nil {
+			return nil, fmt.Errorf("envFile: %w", err)
+		}
+		for _, e := range allowedEnv(cfg, entries) {
+			k, _, _ := strings.Cut(e, "=")
+			_, inEnv := cfg.Env[k]
+			_, inSources := cfg.EnvSources[k]
+			if !inEnv && !inSources {
+				env = append(env, e)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(cfg.EnvSources))
+	for k := range cfg.EnvSources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := cfg.EnvSources[k].Resolve(ctx, absProjectDir)
+		if err != nil {
+			return nil, fmt.Errorf("env.%s: %w", k, err)
+		}
+		env = append(env, k+"="+v)
+	}
+	if cfg.Cloud != nil {
+		creds, err := cfg.Cloud.Env(ctx, cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, creds...)
+	}
+	return append(env, "AIRLOCK_VERSION="+r.Version), nil
+}
+
+// overlayEnv returns the env of the active subdirectory overlays as KEY=VALUE pairs, for enter/exec
+// sessions only.
+func overlayEnv(cfg *config.Config) []string {
+	var env []string
+	for k, v := range cfg.ExecEnv {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return allowedEnv(cfg, env)
+}
+
+// allowedEnv drops the KEY=VALUE pairs envDeny keeps out of the sandbox, with a warning for each.
+func allowedEnv(cfg *config.Config, env []string) []string {
+	var allowed []string
+	for _, e := range env {
+		k, _, _ := strings.Cut(e, "=")
+		if cfg.EnvDenied(k) {
+			fmt.Fprintf(os.Stderr, "warning: not passing %s into the sandbox: it matches envDeny\n", k)
+			continue
+		}
+		allowed = append(allowed, e)
 	}
-	userConfig, err := r.inspectImage(ctx, image)
+	return allowed
+}
+
+// EnterOptions are per-invocation settings for Enter.
+type EnterOptions struct {
+	Env     []string // extra KEY=VALUE pairs (the -e flag)
+	WorkDir string   // start here instead of the workspace; relative paths are inside the workspace
+	User    string   // run as this user (name or uid[:gid]) instead of the sandbox user
+}
+
+func (r *Runner) Enter(ctx context.Context, cfg *config.Config, absProjectDir string, opts EnterOptions) error {
+	userConfig, err := r.userConfig(ctx, cfg)
 	if err != nil {
 		return err
 	}
 
-	mergedEnv := r.getMergedEnv(cfg, userConfig, env)
+	sourced, err := r.sessionEnv(ctx, cfg, absProjectDir)
+	if err != nil {
+		return err
+	}
+	mergedEnv := r.getMergedEnv(cfg, userConfig, slices.Concat(sourced, overlayEnv(cfg), allowedEnv(cfg, opts.Env)))
+	session := audit.NewSessionID()
 
-	args := []string{"exec", "-it", "--user", fmt.Sprintf("%s", userConfig.Name)}
+	// Without a terminal (e.g. a script piping commands into the shell), asking for a TTY fails.
+	tty := isTerminal(os.Stdin)
+	ioFlags := "-i"
+	if tty {
+		ioFlags = "-it"
+	}
+	args := []string{"exec", ioFlags, "--user", sessionUser(userConfig, opts.User)}
+	if wd := execWorkDir(cfg, userConfig, opts.WorkDir); wd != "" {
+		args = append(args, "-w", wd)
+	}
 	for _, e := range mergedEnv {
 		args = append(args, "-e", e)
 	}
-	args = append(args, containerName(cfg), "bash")
-	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+	args = append(args, "-e", "AIRLOCK_SESSION="+session)
+	shell := []string{cfg.Shell.Program}
+	if cfg.Shell.Enter == config.ShellLogin {
+		shell = append(shell, "-l")
+	}
+	args = append(args, containerName(cfg))
+	if tty {
+		args = append(args, sizeWrap(umaskWrap(cfg, shell))...)
+	} else {
+		args = append(args, umaskWrap(cfg, shell)...)
+	}
+	return sessionError(r.runSession(ctx, cfg, absProjectDir, session, shell, func() error {
+		if tty {
+			return r.runTTY(ctx, os.Stdin, args...)
+		}
+		return r.runCmdStdin(ctx, os.Stdin, r.engineBin(), args...)
+	}))
 }
 
-func (r *Runner) Exec(ctx context.Context, cfg *config.Config, absProjectDir string, env []string, cmd []string) error {
-	image := cfg.Image
-	if cfg.Build != nil {
-		image = cfg.Build.Tag
+// ExecOptions are per-invocation settings for Exec.
+type ExecOptions struct {
+	Env     []string  // extra KEY=VALUE pairs (the -e flag)
+	Stdin   io.Reader // fed to the command instead of the terminal, e.g. from --stdin-file
+	Output  io.Writer // receives the command's stdout and stderr instead of the terminal
+	WorkDir string    // run here instead of the workspace; relative paths are inside the workspace
+	User    string    // run as this user (name or uid[:gid]) instead of the sandbox user
+	// TTY forces (true) or suppresses (false) a TTY for the command; nil allocates one only when
+	// both stdin and stdout are terminals.
+	TTY *bool
+	// Network, when set, runs the command under this policy instead of the container's, in a
+	// throwaway container that shares the project's mounts, home, and cache.
+	Network *config.Network
+}
+
+// Exec runs cmd in the container. A TTY is only allocated when stdin and stdout are terminals, so
+// piped input and output (`cat data.json | airlock exec -- jq . > out.json`) and CI jobs stream
+// through unchanged.
+func (r *Runner) Exec(ctx context.Context, cfg *config.Config, absProjectDir string, cmd []string, opts ExecOptions) error {
+	if opts.Network != nil {
+		return r.execIsolated(ctx, cfg, absProjectDir, cmd, opts)
 	}
-	userConfig, err := r.inspectImage(ctx, image)
+	userConfig, err := r.userConfig(ctx, cfg)
 	if err != nil {
 		return err
 	}
 
-	mergedEnv := r.getMergedEnv(cfg, userConfig, env)
+	sourced, err := r.sessionEnv(ctx, cfg, absProjectDir)
+	if err != nil {
+		return err
+	}
+	mergedEnv := r.getMergedEnv(cfg, userConfig, slices.Concat(agentEnv(cfg, cmd), sourced, overlayEnv(cfg), allowedEnv(cfg, opts.Env)))
+	session := audit.NewSessionID()
+
+	stdin := opts.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	f, ok := stdin.(*os.File)
+	tty := ok && isTerminal(f) && isTerminal(os.Stdout) && opts.Output == nil
+	if opts.TTY != nil {
+		tty = *opts.TTY
+	}
+	ioFlags := "-i"
+	if tty {
+		ioFlags = "-it"
+	}
 
-	args := []string{"exec", "-it", "--user", fmt.Sprintf("%s", userConfig.Name)}
+	args := []string{"exec", ioFlags, "--user", sessionUser(userConfig, opts.User)}
+	if wd := execWorkDir(cfg, userConfig, opts.WorkDir); wd != "" {
+		args = append(args, "-w", wd)
+	}
 	for _, e := range mergedEnv {
 		args = append(args, "-e", e)
 	}
+	args = append(args, "-e", "AIRLOCK_SESSION="+session)
 	args = append(args, containerName(cfg))
-	args = append(args, cmd...)
-	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+	if tty {
+		args = append(args, sizeWrap(umaskWrap(cfg, shellWrap(cfg, cmd)))...)
+	} else {
+		args = append(args, umaskWrap(cfg, shellWrap(cfg, cmd))...)
+	}
+	return sessionError(r.runSession(ctx, cfg, absProjectDir, session, cmd, func() error {
+		switch {
+		case tty:
+			return r.runTTY(ctx, stdin, args...)
+		case opts.Output != nil:
+			return r.runCmdIO(ctx, stdin, opts.Output, opts.Output, r.engineBin(), args...)
+		}
+		return r.runCmdStdin(ctx, stdin, r.engineBin(), args...)
+	}))
+}
+
+// ExitError reports that the command of an enter or exec session exited with a non-zero status,
+// so callers can exit with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// sessionError turns the engine's exit status, which is the session command's own, into an
+// *ExitError. Sessions killed by a signal have no status and are returned as they are.
+func sessionError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return &ExitError{Code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+// runSession runs an engine exec with run and records its start and end in the project audit log,
+// along with the traffic to each allowlisted host when an egress allowlist is active.
+// Audit log failures are reported but never block the session.
+func (r *Runner) runSession(ctx context.Context, cfg *config.Config, absProjectDir string, session string, command []string, run func() error) error {
+	logPath := audit.Path(absProjectDir)
+	if err := audit.Append(logPath, audit.Event{Session: session, Kind: audit.KindSessionStart, Command: command}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+
+	before := r.trafficCounters(ctx, cfg)
+	runErr := run()
+	if before != nil {
+		if traffic := trafficDelta(before, r.trafficCounters(ctx, cfg)); len(traffic) > 0 {
+			if err := audit.Append(logPath, audit.Event{Session: session, Kind: audit.KindTraffic, Traffic: traffic}); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+			}
+		}
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if runErr != nil {
+		code = -1
+	}
+	if err := audit.Append(logPath, audit.Event{Session: session, Kind: audit.KindSessionEnd, ExitCode: &code}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+	// A fresh context so cleanup still runs when the session was interrupted.
+	r.runHostHooks(context.Background(), cfg, "onExit", cfg.Hooks.OnExit, "AIRLOCK_SESSION="+session, "AIRLOCK_EXIT_CODE="+strconv.Itoa(code))
+	return runErr
 }
 
 func (r *Runner) Down(ctx context.Context, cfg *config.Config, name string) error {
@@ -183,19 +646,67 @@ func (r *Runner) Down(ctx context.Context, cfg *config.Config, name string) erro
 	} else if !strings.HasPrefix(target, "airlock-") {
 		target = "airlock-" + target
 	}
+	if target == containerName(cfg) {
+		if _, running := r.containerState(ctx, target); running {
+			if err := r.runHooks(ctx, cfg, "preStop", cfg.Hooks.PreStop); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+			if cfg.Sync != nil {
+				absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+				if _, err := r.SyncWorkspace(ctx, cfg, absProjectDir); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: failed to sync the workspace back before stopping: %v\n", err)
+				}
+			}
+		}
+	}
 	_ = r.runCmdInteractive(ctx, r.engineBin(), "stop", target)
-	_ = r.runCmdInteractive(ctx, r.engineBin(), "rm", "-f", target)
+	// -v removes the anonymous volumes hiding .airlock and excluded directories; named ones stay.
+	_ = r.runCmdInteractive(ctx, r.engineBin(), "rm", "-f", "-v", target)
+	absProjectDir, _ := filepath.Abs(cfg.ProjectDir)
+	if target == containerName(cfg) {
+		if err := r.RemoveVolumes(ctx, cfg, true); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		if err := r.removeServices(ctx, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		if err := r.composeDown(ctx, cfg, absProjectDir); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		r.runHostHooks(ctx, cfg, "onDown", cfg.Hooks.OnDown)
+	}
+	r.GC(ctx, cfg, absProjectDir)
 	return nil
 }
 
-func (r *Runner) List(ctx context.Context) ([]string, error) {
+// Logs streams the container's output (the main process, not enter/exec sessions). With follow it keeps
+// streaming until interrupted; tail > 0 limits output to the last tail lines.
+func (r *Runner) Logs(ctx context.Context, cfg *config.Config, follow bool, tail int) error {
+	args := []string{"logs"}
+	if follow {
+		args = append(args, "-f")
+	}
+	if tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(tail))
+	}
+	args = append(args, containerName(cfg))
+	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+}
+
+func (r *Runner) List(ctx context.Context, opts ListOptions) ([]string, error) {
 	// We use --filter name=^airlock- to match containers starting with airlock-
 	// Both podman and docker support this.
 	// We don't use -a because the requirement is to show "running" containers.
+	filters, err := opts.filters(r.Engine)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"ps", "--filter", "name=^airlock-"}, filters...)
+	args = append(args, "--format", "{{.Names}}")
 	if r.Verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join([]string{"ps", "--filter", "name=^airlock-", "--format", "{{.Names}}"}, " "))
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
 	}
-	cmd := exec.CommandContext(ctx, r.engineBin(), "ps", "--filter", "name=^airlock-", "--format", "{{.Names}}")
+	cmd := exec.CommandContext(ctx, r.engineBin(), args...)
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list containers: %w", err)
@@ -219,19 +730,83 @@ func (r *Runner) engineBin() string {
 	return "podman"
 }
 
-func (r *Runner) buildImage(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+// buildImage builds the project image. Builds of the same tag are single-flighted across airlock
+// processes on this host: a concurrent invocation waits for the in-progress build and reuses its result.
+func (r *Runner) buildImage(ctx context.Context, cfg *config.Config, absProjectDir string, extraArgs ...string) error {
+	lockPath := filepath.Join(filelock.Dir(), "build-"+sanitizeLockName(cfg.Build.Tag)+".lock")
+	start := time.Now()
+	release, ok, err := filelock.TryLock(lockPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Waiting for a concurrent build of %s to finish...\n", cfg.Build.Tag)
+		if release, err = filelock.Lock(lockPath); err != nil {
+			return err
+		}
+		defer release()
+		if created, err := r.output(ctx, "image", "inspect", "--format", "{{.Created}}", cfg.Build.Tag); err == nil {
+			if t, err := parseEngineTime(created); err == nil && !t.Before(start.Add(-time.Second)) {
+				fmt.Fprintf(os.Stderr, "Reusing %s built by the concurrent invocation.\n", cfg.Build.Tag)
+				return nil
+			}
+		}
+	} else {
+		defer release()
+	}
+	return r.runBuild(ctx, cfg, absProjectDir, extraArgs...)
+}
+
+// ensureImage builds the project image unless it exists and was built from the current
+// Containerfile and build inputs. With a prebuilt image configured too, it pulls that first.
+func (r *Runner) ensureImage(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	hash, err := buildHash(cfg, absProjectDir)
+	if err != nil {
+		return err
+	}
+	built := r.imageBuildHash(ctx, cfg.Build.Tag)
+	switch {
+	case built == hash:
+		return nil
+	case cfg.Image != "":
+		if built == "" && r.reusePulled(ctx, cfg, absProjectDir) {
+			return nil
+		}
+		return r.pullOrBuild(ctx, cfg, absProjectDir, hash)
+	case built != "":
+		fmt.Fprintf(os.Stderr, "The Containerfile or build inputs changed; rebuilding %s\n", cfg.Build.Tag)
+	}
+	return r.buildImage(ctx, cfg, absProjectDir)
+}
+
+func (r *Runner) runBuild(ctx context.Context, cfg *config.Config, absProjectDir string, extraArgs ...string) error {
 	df := cfg.Build.Containerfile
 	if !filepath.IsAbs(df) {
 		df = filepath.Join(absProjectDir, df)
 	}
-	args := []string{"build", "-t", cfg.Build.Tag, "-f", df, cfg.Build.Context}
+	hash, err := buildHash(cfg, absProjectDir)
+	if err != nil {
+		return err
+	}
+	args := []string{"build", "-t", cfg.Build.Tag, "--label", labelProject + "=" + cfg.Name, "--label", labelBuildHash + "=" + hash}
+	args = append(args, mapFlags("--label", cfg.Labels)...)
+	args = append(args, platformArgs(cfg)...)
+	cacheArgs, err := r.buildCacheArgs(cfg, absProjectDir)
+	if err != nil {
+		return err
+	}
+	args = append(args, cacheArgs...)
+	args = append(args, extraArgs...)
+	args = append(args, "-f", df, cfg.Build.Context)
 	if !filepath.IsAbs(cfg.Build.Context) {
 		args[len(args)-1] = filepath.Join(absProjectDir, cfg.Build.Context)
 	}
 	return r.runCmdInteractive(ctx, r.engineBin(), args...)
 }
 
-func (r *Runner) inspectImage(ctx context.Context, image string) (*UserConfig, error) {
+// inspectImage returns the image's user config. Reading the image's /etc/passwd takes a throwaway
+// container, so it is reused from cached when that is for the same image ID.
+func (r *Runner) inspectImage(ctx context.Context, image string, cached *UserConfig) (*UserConfig, error) {
 	if r.Verbose {
 		fmt.Fprintf(os.Stderr, "+ %s image inspect %s\n", r.engineBin(), image)
 	}
@@ -242,10 +817,12 @@ func (r *Runner) inspectImage(ctx context.Context, image string) (*UserConfig, e
 	}
 
 	var data []struct {
+		ID     string `json:"Id"`
 		Config struct {
 			User       string   `json:"User"`
 			WorkingDir string   `json:"WorkingDir"`
 			Env        []string `json:"Env"`
+			Entrypoint []string `json:"Entrypoint"`
 		} `json:"Config"`
 	}
 	if err := json.Unmarshal(out, &data); err != nil {
@@ -266,23 +843,39 @@ func (r *Runner) inspectImage(ctx context.Context, image string) (*UserConfig, e
 	}
 
 	userConfig := &UserConfig{
-		Name:    userStr,
-		WorkDir: workdir,
-		Env:     env,
+		Name:       userStr,
+		WorkDir:    workdir,
+		Env:        env,
+		ImageID:    data[0].ID,
+		Entrypoint: data[0].Config.Entrypoint,
 	}
 
-	// Now we need to find the home directory. This is tricky because it depends on the user inside the container.
-	// Common convention is /home/username or /root.
-	// If we have a username but not UID/GID, we might need to look it up in the image (e.g. /etc/passwd).
-	// For now, let's make some assumptions or try to find it.
-	if userConfig.Name == "root" {
-		userConfig.Home = "/root"
-	} else if userConfig.Name != "" {
-		userConfig.Home = "/home/" + userConfig.Name
+	if cached != nil && cached.ImageID == userConfig.ImageID && cached.Passwd != nil {
+		userConfig.Passwd = cached.Passwd
+	} else if passwd, err := r.imagePasswd(ctx, image); err == nil {
+		userConfig.Passwd = parsePasswd(passwd)
+	} else {
+		fmt.Fprintf(os.Stderr, "warning: %v; assuming the user's home is /home/<user>\n", err)
 	}
+	resolveUser(userConfig)
 	return userConfig, nil
 }
 
+func (r *Runner) imageID(ctx context.Context, image string) (string, error) {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s image inspect --format {{.Id}} %s\n", r.engineBin(), image)
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	id := strings.TrimSpace(string(out))
+	if !strings.Contains(id, ":") {
+		id = "sha256:" + id
+	}
+	return id, nil
+}
+
 func (r *Runner) containerExists(ctx context.Context, name string) (bool, error) {
 	if r.Verbose {
 		fmt.Fprintf(os.Stderr, "+ %s container inspect %s\n", r.engineBin(), name)
@@ -294,6 +887,23 @@ func (r *Runner) containerExists(ctx context.Context, name string) (bool, error)
 	return true, nil
 }
 
+// containerState reports whether the container exists and whether it is running, with a single engine call.
+func (r *Runner) containerState(ctx context.Context, name string) (exists, running bool) {
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s container inspect -f {{.State.Running}} %s\n", r.engineBin(), name)
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), "container", "inspect", "-f", "{{.State.Running}}", name).Output()
+	if err != nil {
+		return false, false
+	}
+	return true, strings.TrimSpace(string(out)) == "true"
+}
+
+// containerImageID returns the ID of the image the container was created from.
+func (r *Runner) containerImageID(ctx context.Context, name string) (string, error) {
+	return r.output(ctx, "container", "inspect", "-f", "{{.Image}}", name)
+}
+
 func (r *Runner) containerRunning(ctx context.Context, name string) (bool, error) {
 	if r.Verbose {
 		fmt.Fprintf(os.Stderr, "+ %s inspect -f {{.State.Running}} %s\n", r.engineBin(), name)
@@ -306,7 +916,50 @@ func (r *Runner) containerRunning(ctx context.Context, name string) (bool, error
 }
 
 func (r *Runner) createContainer(ctx context.Context, cfg *config.Config, u *UserConfig, absProjectDir, homeHost, cacheHost, workDirHost string) error {
+	spec, err := r.createArgs(ctx, cfg, u, absProjectDir, homeHost, cacheHost, workDirHost)
+	if err != nil {
+		return err
+	}
+	if cfg.Resources != (config.Resources{}) && !r.capabilities(ctx).resourceLimits() {
+		fmt.Fprintln(os.Stderr, "warning: resource limits need cgroups v2 with rootless engines; creating the container without them")
+	}
+	warnRootlessDockerUID(cfg, r.capabilities(ctx))
+	if host := r.remoteDaemon(ctx); host != "" {
+		// The daemon resolves bind mount sources on its own machine.
+		if cfg.Sync != nil {
+			fmt.Fprintf(os.Stderr, "warning: the %s engine at %s is remote; home, cache, and mounts are bound from paths on that machine, so they must exist there too\n", r.Engine, host)
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: the %s engine at %s is remote; the workspace, home, cache, and mounts are bound from paths on that machine, so %s must exist there too (e.g. a synced checkout at the same path, or sync: in airlock.yaml)\n", r.Engine, host, absProjectDir)
+		}
+	}
+	args := []string{"run", "-d",
+		"--label", labelConfigHash + "=" + specHash(spec),
+		"--label", labelBaseHash + "=" + baseSpecHash(cfg, spec),
+	}
+	if cfg.Build != nil {
+		if hash, err := buildHash(cfg, absProjectDir); err == nil {
+			args = append(args, "--label", labelBuildHash+"="+hash)
+		}
+	}
+	args = append(args, spec...)
+	newVolumes, err := r.ensureVolumes(ctx, cfg, u)
+	if err != nil {
+		return err
+	}
+	if err := r.runCmdInteractive(ctx, r.engineBin(), args...); err != nil {
+		return err
+	}
+	// Anonymous volumes hiding excluded directories are new with every container.
+	excluded, _ := excludedTargets(cfg, absProjectDir)
+	r.chownVolumes(ctx, cfg, u, append(newVolumes, excluded...))
+	return nil
+}
+
+// createArgs returns the `run` arguments (after `run -d`) describing the project's container.
+// They are hashed into a label so a config change can be detected against the created container.
+func (r *Runner) createArgs(ctx context.Context, cfg *config.Config, u *UserConfig, absProjectDir, homeHost, cacheHost, workDirHost string) ([]string, error) {
 	name := containerName(cfg)
+	caps := r.capabilities(ctx)
 
 	mergedEnv := r.getMergedEnv(cfg, u, nil)
 
@@ -318,69 +971,428 @@ func (r *Runner) createContainer(ctx context.Context, cfg *config.Config, u *Use
 	home := u.Home
 
 	mountArgs := []string{
-		"-v", homeHost + ":" + home + ":Z",
-		"-v", cacheHost + ":" + home + "/.cache:Z",
+		"-v", bindSpec(caps, homeHost, home),
+		"-v", bindSpec(caps, cacheHost, home+"/.cache"),
 	}
 
 	workdirMounted := false
+	workspaceHost := workDirHost
 	for _, m := range cfg.Mounts {
+		opts, relabel := mountOptions(m)
+		switch m.Type {
+		case config.MountVolume:
+			mountArgs = append(mountArgs, "-v", mountSpec(volumeName(cfg, m), m.Target, opts...))
+			continue
+		case config.MountTmpfs:
+			// Mounted by tmpfsArgs, along with the tmpfs entries.
+			continue
+		}
 		src := resolveHostPath(absProjectDir, m.Source)
-		if m.Target == u.WorkDir {
+		if path.Clean(m.Target) == u.WorkDir {
 			workdirMounted = true
+			workspaceHost = src
 		}
-		mode := m.Mode
-		if mode == "" {
-			mode = "rw"
+		if relabel {
+			mountArgs = append(mountArgs, "-v", bindSpec(caps, src, m.Target, opts...))
+		} else {
+			mountArgs = append(mountArgs, "-v", mountSpec(src, m.Target, opts...))
 		}
-		// We add :Z for podman relabeling, similar to other mounts
-		mountArgs = append(mountArgs, "-v", fmt.Sprintf("%s:%s:%s,Z", src, m.Target, mode))
 	}
 
-	if !workdirMounted {
-		mountArgs = append([]string{"-v", workDirHost + ":" + u.WorkDir + ":Z"}, mountArgs...)
+	switch {
+	case cfg.Sync != nil && workdirMounted:
+		return nil, fmt.Errorf("mounts: %s is the workspace, which sync keeps on its own volume", u.WorkDir)
+	case cfg.Sync != nil:
+		// nocopy: the sync fills the volume from the host, not the image's files at the workspace.
+		mountArgs = append([]string{"-v", mountSpec(workspaceVolume(cfg), u.WorkDir, "nocopy")}, mountArgs...)
+	case !workdirMounted:
+		mountArgs = append([]string{"-v", bindSpec(caps, workDirHost, u.WorkDir)}, mountArgs...)
+	}
+
+	excluded, err := excludedTargets(cfg, absProjectDir)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	for _, t := range excluded {
+		mountArgs = append(mountArgs, "-v", t)
+	}
+
+	if cfg.Sync == nil {
+		// A synced workspace has no host files to mount read-only; the sync reverts changes to
+		// protected paths instead.
+		protected, err := protectedPaths(workspaceHost, cfg.Protect)
+		if err != nil {
+			return nil, fmt.Errorf("protect: %w", err)
+		}
+		for _, rel := range protected {
+			mountArgs = append(mountArgs, "-v", bindSpec(caps, filepath.Join(workspaceHost, filepath.FromSlash(rel)), path.Join(u.WorkDir, rel), "ro"))
+		}
 	}
 
 	// Always hide .airlock folder from the working directory mount
 	mountArgs = append(mountArgs, "-v", u.WorkDir+"/.airlock")
+	mountArgs = append(mountArgs, "-v", bindSpec(caps, sandboxInfoDir(cfg, absProjectDir), sandboxInfoTarget, "ro"))
+	mountArgs = append(mountArgs, localtimeArgs(cfg)...)
+
+	if cfg.Approvals {
+		mountArgs = append(mountArgs, "-v", bindSpec(caps, broker.Dir(absProjectDir), broker.ContainerDir))
+	}
+	if cfg.EngineSocket != nil {
+		mountArgs = append(mountArgs, "-v", bindSpec(caps, sockproxy.Dir(absProjectDir), engineSocketTarget))
+		envArgs = append(envArgs, "-e", "DOCKER_HOST=unix://"+engineSocketTarget+"/docker.sock")
+	}
+	ssoMounts, ssoEnv := ssoArgs(cfg, caps, absProjectDir)
+	mountArgs = append(mountArgs, ssoMounts...)
+	envArgs = append(envArgs, ssoEnv...)
 
 	args := []string{
-		"run", "-d",
 		"--init",
 		"--name", name,
+		"--label", labelProject + "=" + cfg.Name,
+		"--label", labelProjectDir + "=" + absProjectDir,
 		"-w", u.WorkDir,
 		"--user", fmt.Sprintf("%s", u.Name),
 	}
-	if r.Engine == EnginePodman {
-		args = append(args, "--userns=keep-id")
+	if cfg.SharedHost {
+		args = append(args, "--label", labelUser+"="+cfg.Owner)
+	}
+	args = append(args, userLabelArgs(cfg)...)
+	if caps.KeepID {
+		args = append(args, keepIDArg(cfg, caps))
+	}
+	args = append(args, usernsArgs(caps)...)
+	if cfg.Security.AuditSyscalls {
+		profile, err := writeAuditSeccompProfile(absProjectDir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--security-opt", "seccomp="+profile)
+	}
+	profileArgs, err := securityProfileArgs(cfg, absProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, profileArgs...)
+	if nnp := cfg.Security.NoNewPrivileges; nnp != nil && *nnp {
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	if cfg.Security.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, cp := range cfg.Security.CapDrop {
+		args = append(args, "--cap-drop", cp)
+	}
+	for _, cp := range cfg.Security.CapAdd {
+		args = append(args, "--cap-add", cp)
+	}
+	args = append(args, r.readOnlyArgs(cfg)...)
+	args = append(args, tmpfsArgs(cfg)...)
+	args = append(args, networkArgs(cfg)...)
+	args = append(args, resourceArgs(cfg, caps)...)
+	args = append(args, r.nestedArgs(cfg, caps)...)
+	for _, p := range cfg.Ports {
+		args = append(args, "-p", p.String())
 	}
 	args = append(args, envArgs...)
 	args = append(args, mountArgs...)
 	args = append(args, "--hostname", "airlock")
-	image := cfg.Image
-	if cfg.Build != nil {
-		image = cfg.Build.Tag
+	args = append(args, platformArgs(cfg)...)
+	if len(cfg.Command) > 0 {
+		// Open stdin and a TTY for the main process, so attach can interact with it.
+		args = append(args, "-i", "-t")
+		if len(cfg.Network.Allow) > 0 {
+			// up installs the allowlist after the start, so the main process (the image's
+			// entrypoint included) waits for it.
+			args = append(args, "--entrypoint", "sh", imageRef(cfg), "-c", egressWaitScript, "airlock-egress-wait")
+			return append(append(args, u.Entrypoint...), cfg.Command...), nil
+		}
+		args = append(args, imageRef(cfg))
+		return append(args, cfg.Command...), nil
 	}
-	args = append(args, image)
+	args = append(args, imageRef(cfg))
 	args = append(args, "sleep", "infinity")
-
-	return r.runCmdInteractive(ctx, r.engineBin(), args...)
+	return args, nil
 }
 
 func (r *Runner) runCmdInteractive(ctx context.Context, bin string, args ...string) error {
+	return r.runCmdStdin(ctx, os.Stdin, bin, args...)
+}
+
+func (r *Runner) runCmdStdin(ctx context.Context, stdin io.Reader, bin string, args ...string) error {
+	return r.runCmdIO(ctx, stdin, os.Stdout, os.Stderr, bin, args...)
+}
+
+func (r *Runner) runCmdIO(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, bin string, args ...string) error {
 	if r.Verbose {
 		fmt.Fprintf(os.Stderr, "+ %s %s\n", bin, strings.Join(args, " "))
 	}
 	cmd := exec.CommandContext(ctx, bin, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	return cmd.Run()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = stdin
+	// Sessions keep the terminal as their stderr, and their failures are the command's own.
+	if bin != r.engineBin() || len(args) == 0 || args[0] == "exec" {
+		return cmd.Run()
+	}
+	var flush func()
+	cmd.Stdout, cmd.Stderr, flush = plainOutput(args[0], stdout, stderr)
+	defer flush()
+	var tail stderrTail
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &tail)
+	return r.translateEngineError(cmd.Run(), string(tail.b))
+}
+
+// plainOutput strips the engine's terminal formatting (progress bars, colors) from output that goes
+// to a file or pipe, such as CI logs, so those get plain text. Output to a terminal is left alone,
+// as is the stdout of subcommands that stream data (`cp` to -, `save`, `export`).
+func plainOutput(subcommand string, stdout, stderr io.Writer) (io.Writer, io.Writer, func()) {
+	var flushes []func()
+	wrap := func(w io.Writer) io.Writer {
+		if f, ok := w.(*os.File); !ok || isTerminal(f) {
+			return w
+		}
+		sw := sanitize.NewWriter(w)
+		flushes = append(flushes, func() { _ = sw.Flush() })
+		return sw
+	}
+	switch subcommand {
+	case "cp", "save", "export":
+	default:
+		stdout = wrap(stdout)
+	}
+	stderr = wrap(stderr)
+	return stdout, stderr, func() {
+		for _, f := range flushes {
+			f()
+		}
+	}
+}
+
+// isTerminal reports whether f is a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// execWorkDir returns the in-container directory enter/exec should start in: override (--workdir,
+// relative to the workspace) if given, else the subdirectory of an active overlay, or "" to use the
+// container's default working directory.
+func execWorkDir(cfg *config.Config, u *UserConfig, override string) string {
+	if override != "" {
+		if path.IsAbs(override) {
+			return override
+		}
+		return path.Join(u.WorkDir, override)
+	}
+	if cfg.ExecDir == "" || cfg.ExecDir == "." {
+		return ""
+	}
+	return path.Join(u.WorkDir, cfg.ExecDir)
+}
+
+// sessionUser returns the --user for an enter/exec session: override (--user) if given, else the
+// sandbox user.
+func sessionUser(u *UserConfig, override string) string {
+	if override != "" {
+		return override
+	}
+	return u.Name
+}
+
+// resourceArgs returns the `run` flags for configured resource limits, or none when the engine
+// can't enforce them.
+func resourceArgs(cfg *config.Config, caps *Capabilities) []string {
+	if !caps.resourceLimits() {
+		return nil
+	}
+	var args []string
+	res := cfg.Resources
+	if res.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(res.CPUs, 'f', -1, 64))
+	}
+	if res.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(int64(res.Memory), 10))
+	}
+	if res.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(res.Pids, 10))
+	}
+	return args
+}
+
+// readOnlyArgs returns the `run` flags for security.readOnlyRootfs. Scratch directories get tmpfs
+// mounts; docker's default tmpfs options include noexec, which breaks tools that run binaries they
+// unpack to /tmp, so they are spelled out. Podman mounts the same directories itself with
+// --read-only-tmpfs, and rejects a second mount on them.
+func (r *Runner) readOnlyArgs(cfg *config.Config) []string {
+	if !cfg.Security.ReadOnlyRootfs {
+		return nil
+	}
+	if r.Engine == EnginePodman {
+		return []string{"--read-only", "--read-only-tmpfs=true"}
+	}
+	args := []string{"--read-only"}
+	for _, t := range []string{"/tmp:rw,exec,nosuid,nodev,mode=1777", "/var/tmp:rw,exec,nosuid,nodev,mode=1777", "/run:rw,nosuid,nodev,mode=755"} {
+		// A configured tmpfs on the same directory replaces the default one.
+		if !hasTmpfs(cfg, t[:strings.IndexByte(t, ':')]) {
+			args = append(args, "--tmpfs", t)
+		}
+	}
+	return args
+}
+
+// tmpfsArgs returns the --tmpfs flags for the tmpfs entries and the mounts of type tmpfs.
+func tmpfsArgs(cfg *config.Config) []string {
+	var args []string
+	for _, t := range cfg.TmpfsMounts() {
+		opts := "rw,exec,nosuid,nodev,mode=" + t.Mode
+		if t.Size > 0 {
+			opts += ",size=" + strconv.FormatInt(int64(t.Size), 10)
+		}
+		args = append(args, "--tmpfs", t.Target+":"+opts)
+	}
+	return args
+}
+
+func hasTmpfs(cfg *config.Config, target string) bool {
+	for _, t := range cfg.TmpfsMounts() {
+		if t.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedArgs returns the `run` flags that let podman run inside the sandbox: /dev/fuse for
+// fuse-overlayfs, and relaxed confinement for the mounts and user namespaces an inner engine
+// creates. Inner container storage lives in the persistent home (~/.local/share/containers).
+func (r *Runner) nestedArgs(cfg *config.Config, caps *Capabilities) []string {
+	if !cfg.NestedContainers {
+		return nil
+	}
+	args := []string{"--device", "/dev/fuse", "-e", "BUILDAH_ISOLATION=chroot"}
+	if caps.SELinux {
+		args = append(args, "--security-opt", "label=disable")
+	}
+	if r.Engine == EngineDocker {
+		// Docker's default seccomp and AppArmor profiles block mount and unshare, and it masks the
+		// /proc paths an inner engine needs; podman's defaults already allow nesting.
+		args = append(args,
+			"--security-opt", "seccomp=unconfined",
+			"--security-opt", "apparmor=unconfined",
+			"--security-opt", "systempaths=unconfined",
+		)
+	}
+	return args
+}
+
+// mountOptions returns a configured mount's options: its mode (rw unless the mode or an ro/rw
+// option says otherwise) followed by its other options. relabel is false when the options choose an
+// SELinux label themselves (z or Z), or opt out of relabeling with nolabel, which isn't passed on.
+func mountOptions(m config.Mount) (opts []string, relabel bool) {
+	mode, relabel := m.Mode, true
+	if mode == "" {
+		mode = "rw"
+	}
+	for _, o := range m.Options {
+		switch o {
+		case "ro", "rw":
+			mode = o
+			continue
+		case "nolabel":
+			relabel = false
+			continue
+		case "z", "Z":
+			relabel = false
+		}
+		opts = append(opts, o)
+	}
+	return append([]string{mode}, opts...), relabel
+}
+
+// bindSpec renders a -v bind mount, adding SELinux relabeling only where the host uses SELinux.
+func bindSpec(caps *Capabilities, src, target string, opts ...string) string {
+	if z := caps.relabel(); z != "" {
+		opts = append(opts, z)
+	}
+	return mountSpec(src, target, opts...)
+}
+
+// mountSpec returns a -v value: source, target, and the comma-separated options.
+func mountSpec(src, target string, opts ...string) string {
+	spec := src + ":" + target
+	if len(opts) > 0 {
+		spec += ":" + strings.Join(opts, ",")
+	}
+	return spec
+}
+
+// shellWrap applies shell.exec to an exec command. A single argument is handed to the shell as a
+// script (so `exec -- "make && make test"` works); several are passed through "$@" so no argument
+// is ever re-split or re-quoted.
+func shellWrap(cfg *config.Config, cmd []string) []string {
+	flags := ""
+	switch cfg.Shell.Exec {
+	case config.ShellLogin:
+		flags = "-lc"
+	case config.ShellPlain:
+		flags = "-c"
+	default:
+		return cmd
+	}
+	if len(cmd) == 1 {
+		return []string{cfg.Shell.Program, flags, cmd[0]}
+	}
+	return append([]string{cfg.Shell.Program, flags, `"$@"`, cfg.Shell.Program}, cmd...)
+}
+
+// keepIDArg maps the host user into a rootless podman container. With user.uid set (and podman
+// 4.3+), the host user becomes that uid instead of the same uid as on the host.
+func keepIDArg(cfg *config.Config, caps *Capabilities) string {
+	if cfg.User == nil || cfg.User.UID == nil || !versionAtLeast(caps.Version, 4, 3) {
+		return "--userns=keep-id"
+	}
+	uid, gid, _ := strings.Cut(cfg.User.Spec(), ":")
+	return "--userns=keep-id:uid=" + uid + ",gid=" + gid
+}
+
+// umaskWrap applies shell.umask to a session command. Engine exec has no umask flag, so a small sh
+// sets it and then execs the command in its place.
+func umaskWrap(cfg *config.Config, cmd []string) []string {
+	if cfg.Shell.Umask == "" {
+		return cmd
+	}
+	return append([]string{"sh", "-c", "umask " + cfg.Shell.Umask + ` && exec "$@"`, "sh"}, cmd...)
+}
+
+// imageRef returns the image the sandbox container runs: the build tag when building, else the configured image.
+func imageRef(cfg *config.Config) string {
+	if cfg.Build != nil {
+		return cfg.Build.Tag
+	}
+	return cfg.Image
+}
+
+// ContainerName returns the name of the project's sandbox container.
+func ContainerName(cfg *config.Config) string {
+	return containerName(cfg)
 }
 
 func containerName(cfg *config.Config) string {
+	if cfg.ContainerName != "" {
+		return cfg.ContainerName
+	}
 	return "airlock-" + cfg.Name
 }
 
+func sanitizeLockName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ':' || r == '\\' || r == '@' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
 func resolveHostPath(projectAbs, p string) string {
 	if filepath.IsAbs(p) {
 		return p
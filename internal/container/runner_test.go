@@ -0,0 +1,22 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+func TestReadOnlyArgsSkipsConfiguredTmpfs(t *testing.T) {
+	r := &Runner{Engine: EngineDocker}
+	for _, cfg := range []*config.Config{
+		{Tmpfs: []config.Tmpfs{{Target: "/tmp", Mode: "1777"}}},
+		{Mounts: []config.Mount{{Type: config.MountTmpfs, Target: "/tmp/"}}},
+	} {
+		cfg.Security.ReadOnlyRootfs = true
+		args := append(r.readOnlyArgs(cfg), tmpfsArgs(cfg)...)
+		if n := strings.Count(strings.Join(args, " "), "--tmpfs /tmp:"); n != 1 {
+			t.Errorf("expected one tmpfs on /tmp, got %d in %q", n, args)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// sandboxInfoTarget is where the sandbox sees its metadata (info.json), read-only.
+const sandboxInfoTarget = "/run/airlock"
+
+// sandboxInfo is the metadata published to the sandbox so scripts and agents can tell they run
+// inside airlock and adapt, e.g. refuse deploy commands. It carries nothing secret.
+type sandboxInfo struct {
+	Airlock   string   `json:"airlock"` // airlock version
+	Project   string   `json:"project"`
+	Container string   `json:"container"`
+	Instance  string   `json:"instance,omitempty"`
+	Image     string   `json:"image"`
+	User      string   `json:"user"`
+	WorkDir   string   `json:"workdir"`
+	Network   string   `json:"network"`
+	Allow     []string `json:"allow,omitempty"`
+	Approvals bool     `json:"approvals"`
+}
+
+// sandboxInfoDir is per instance, since instances of a project run side by side.
+func sandboxInfoDir(cfg *config.Config, absProjectDir string) string {
+	if cfg.Instance != "" {
+		return filepath.Join(absProjectDir, ".airlock", "state", "instances", cfg.Instance, "run")
+	}
+	return filepath.Join(absProjectDir, ".airlock", "state", "run")
+}
+
+// writeSandboxInfo refreshes info.json on the host. The directory is bind-mounted, so an existing
+// container sees the update without being recreated.
+func (r *Runner) writeSandboxInfo(cfg *config.Config, absProjectDir string, u *UserConfig) error {
+	info := sandboxInfo{
+		Airlock:   r.Version,
+		Project:   cfg.Name,
+		Container: containerName(cfg),
+		Instance:  cfg.Instance,
+		Image:     imageRef(cfg),
+		User:      u.Name,
+		WorkDir:   u.WorkDir,
+		Network:   cfg.Network.Mode,
+		Allow:     cfg.Network.Allow,
+		Approvals: cfg.Approvals,
+	}
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := sandboxInfoDir(cfg, absProjectDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ".info.json.tmp")
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "info.json"))
+}
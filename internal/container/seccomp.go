@@ -0,0 +1,141 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Audit mode must not widen what the sandbox can do: its profile allows no more than the engines'
+// default profiles do, without the capability-gated additions. Routine syscalls are allowed
+// silently, the rest of the default allowlist is allowed but logged by the kernel, surfacing
+// unusual activity, and everything else is denied and logged.
+
+// auditAllowedSyscalls are routine syscalls that are allowed silently in audit mode.
+var auditAllowedSyscalls = []string{
+	"accept", "accept4", "access", "alarm", "arch_prctl", "bind", "brk", "capget", "capset", "chdir", "chmod",
+	"chown", "clock_getres", "clock_gettime", "clock_nanosleep", "close", "close_range", "connect",
+	"copy_file_range", "creat", "dup", "dup2", "dup3", "epoll_create", "epoll_create1", "epoll_ctl", "epoll_pwait",
+	"epoll_pwait2", "epoll_wait", "eventfd", "eventfd2", "execve", "exit", "exit_group", "faccessat", "faccessat2",
+	"fadvise64", "fallocate", "fchdir", "fchmod", "fchmodat", "fchown", "fchownat", "fcntl", "fdatasync",
+	"fgetxattr", "flistxattr", "flock", "fork", "fremovexattr", "fsetxattr", "fstat", "fstatfs", "fsync",
+	"ftruncate", "futex", "futimesat", "getcpu", "getcwd", "getdents", "getdents64", "getegid", "geteuid",
+	"getgid", "getgroups", "getitimer", "getpeername", "getpgid", "getpgrp", "getpid", "getppid", "getpriority",
+	"getrandom", "getresgid", "getresuid", "getrlimit", "get_robust_list", "getrusage", "getsid", "getsockname",
+	"getsockopt", "get_thread_area", "gettid", "gettimeofday", "getuid", "getxattr", "inotify_add_watch",
+	"inotify_init", "inotify_init1", "inotify_rm_watch", "ioctl", "kill", "lchown", "lgetxattr", "link", "linkat",
+	"listen", "listxattr", "llistxattr", "lremovexattr", "lseek", "lsetxattr", "lstat", "madvise", "membarrier",
+	"mincore", "mkdir", "mkdirat", "mknod", "mknodat", "mlock", "mlock2", "mlockall", "mmap", "mprotect", "mremap",
+	"msync", "munlock", "munlockall", "munmap", "nanosleep", "newfstatat", "open", "openat", "pause", "pipe",
+	"pipe2", "poll", "ppoll", "prctl", "pread64", "preadv", "preadv2", "prlimit64", "pselect6", "pwrite64",
+	"pwritev", "pwritev2", "read", "readahead", "readlink", "readlinkat", "readv", "recvfrom", "recvmmsg",
+	"recvmsg", "removexattr", "rename", "renameat", "renameat2", "restart_syscall", "rmdir", "rseq",
+	"rt_sigaction", "rt_sigpending", "rt_sigprocmask", "rt_sigqueueinfo", "rt_sigreturn", "rt_sigsuspend",
+	"rt_sigtimedwait", "rt_tgsigqueueinfo", "sched_getaffinity", "sched_getattr", "sched_getparam",
+	"sched_get_priority_max", "sched_get_priority_min", "sched_getscheduler", "sched_rr_get_interval",
+	"sched_setaffinity", "sched_setattr", "sched_setparam", "sched_setscheduler", "sched_yield", "seccomp",
+	"select", "sendfile", "sendmmsg", "sendmsg", "sendto", "setfsgid", "setfsuid", "setgid", "setgroups",
+	"setitimer", "setpgid", "setpriority", "setregid", "setresgid", "setresuid", "setreuid", "setrlimit",
+	"set_robust_list", "setsid", "setsockopt", "set_thread_area", "set_tid_address", "setuid", "setxattr",
+	"shutdown", "sigaltstack", "signalfd", "signalfd4", "socket", "socketpair", "splice", "stat", "statfs",
+	"statx", "symlink", "symlinkat", "sync", "sync_file_range", "syncfs", "sysinfo", "tee", "tgkill", "time",
+	"timer_create", "timer_delete", "timerfd_create", "timerfd_gettime", "timerfd_settime", "timer_getoverrun",
+	"timer_gettime", "timer_settime", "times", "tkill", "truncate", "umask", "uname", "unlink", "unlinkat",
+	"utime", "utimensat", "utimes", "vfork", "vmsplice", "wait4", "waitid", "write", "writev",
+}
+
+// auditLoggedSyscalls are the rest of the engines' default allowlist: allowed, but logged in
+// audit mode.
+var auditLoggedSyscalls = []string{
+	"adjtimex", "cachestat", "chown32", "chroot", "clock_adjtime", "clock_adjtime64",
+	"clock_getres_time64", "clock_gettime64", "clock_nanosleep_time64", "epoll_ctl_old", "epoll_wait_old",
+	"execveat", "fadvise64_64", "fanotify_mark", "fchmodat2", "fchown32", "fcntl64", "fstat64",
+	"fstatat64", "fstatfs64", "ftruncate64", "futex_requeue", "futex_time64", "futex_wait", "futex_waitv",
+	"futex_wake", "getegid32", "geteuid32", "getgid32", "getgroups32", "getresgid32", "getresuid32",
+	"getuid32", "io_cancel", "io_destroy", "io_getevents", "io_pgetevents", "io_pgetevents_time64",
+	"io_setup", "io_submit", "ioprio_get", "ioprio_set", "ipc", "landlock_add_rule",
+	"landlock_create_ruleset", "landlock_restrict_self", "lchown32", "_llseek", "lstat64",
+	"map_shadow_stack", "memfd_create", "memfd_secret", "mmap2", "modify_ldt", "mq_getsetattr",
+	"mq_notify", "mq_open", "mq_timedreceive", "mq_timedreceive_time64", "mq_timedsend",
+	"mq_timedsend_time64", "mq_unlink", "msgctl", "msgget", "msgrcv", "msgsnd", "name_to_handle_at",
+	"_newselect", "openat2", "pidfd_open", "pidfd_send_signal", "pkey_alloc", "pkey_free", "pkey_mprotect",
+	"ppoll_time64", "process_mrelease", "process_vm_readv", "process_vm_writev", "pselect6_time64",
+	"ptrace", "recv", "recvmmsg_time64", "remap_file_pages", "rt_sigtimedwait_time64",
+	"sched_rr_get_interval_time64", "semctl", "semget", "semop", "semtimedop", "semtimedop_time64", "send",
+	"sendfile64", "setfsgid32", "setfsuid32", "setgid32", "setgroups32", "setregid32", "setresgid32",
+	"setresuid32", "setreuid32", "setuid32", "shmat", "shmctl", "shmdt", "shmget", "sigprocmask",
+	"sigreturn", "socketcall", "stat64", "statfs64", "timer_gettime64", "timer_settime64",
+	"timerfd_gettime64", "timerfd_settime64", "truncate64", "ugetrlimit", "utimensat_time64", "waitpid",
+}
+
+// cloneNamespaceFlags are the CLONE_NEW* flags. As in the default profiles, clone may not create
+// namespaces, and clone3, whose flags seccomp can't inspect, fails with ENOSYS so libc falls back
+// to clone.
+const cloneNamespaceFlags = 0x7E020000
+
+// auditPersonalities are the personality(2) arguments the default profiles allow.
+var auditPersonalities = []uint64{0x0, 0x8, 0x20000, 0x20008, 0xffffffff}
+
+type seccompArg struct {
+	Index    uint   `json:"index"`
+	Value    uint64 `json:"value"`
+	ValueTwo uint64 `json:"valueTwo"`
+	Op       string `json:"op"`
+}
+
+type seccompRule struct {
+	Names    []string     `json:"names"`
+	Action   string       `json:"action"`
+	Args     []seccompArg `json:"args,omitempty"`
+	ErrnoRet *int         `json:"errnoRet,omitempty"`
+}
+
+type seccompProfile struct {
+	DefaultAction   string        `json:"defaultAction"`
+	DefaultErrnoRet *int          `json:"defaultErrnoRet,omitempty"`
+	Flags           []string      `json:"flags,omitempty"`
+	Syscalls        []seccompRule `json:"syscalls"`
+}
+
+// auditSeccompProfile returns the logging seccomp profile used by audit mode.
+func auditSeccompProfile() seccompProfile {
+	eperm, enosys := 1, 38
+	p := seccompProfile{
+		DefaultAction:   "SCMP_ACT_ERRNO",
+		DefaultErrnoRet: &eperm,
+		// Also log denied syscalls, not just the ones allowed with SCMP_ACT_LOG.
+		Flags: []string{"SECCOMP_FILTER_FLAG_LOG"},
+		Syscalls: []seccompRule{
+			{Names: auditAllowedSyscalls, Action: "SCMP_ACT_ALLOW"},
+			{Names: auditLoggedSyscalls, Action: "SCMP_ACT_LOG"},
+			{Names: []string{"clone"}, Action: "SCMP_ACT_ALLOW", Args: []seccompArg{{Index: 0, Value: cloneNamespaceFlags, Op: "SCMP_CMP_MASKED_EQ"}}},
+			{Names: []string{"clone3"}, Action: "SCMP_ACT_ERRNO", ErrnoRet: &enosys},
+		},
+	}
+	for _, v := range auditPersonalities {
+		p.Syscalls = append(p.Syscalls, seccompRule{Names: []string{"personality"}, Action: "SCMP_ACT_LOG", Args: []seccompArg{{Index: 0, Value: v, Op: "SCMP_CMP_EQ"}}})
+	}
+	return p
+}
+
+// writeAuditSeccompProfile writes the logging seccomp profile used by audit mode into the project state
+// dir and returns its path.
+func writeAuditSeccompProfile(absProjectDir string) (string, error) {
+	b, err := json.MarshalIndent(auditSeccompProfile(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(stateDir(absProjectDir), "seccomp-audit.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// stateDir is where airlock keeps generated, machine-local files for a project.
+func stateDir(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "state")
+}
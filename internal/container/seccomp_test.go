@@ -0,0 +1,26 @@
+package container
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAuditSeccompProfileDoesNotWiden(t *testing.T) {
+	p := auditSeccompProfile()
+	if p.DefaultAction != "SCMP_ACT_ERRNO" {
+		t.Fatalf("expected unlisted syscalls to be denied, got default action %s", p.DefaultAction)
+	}
+	for _, rule := range p.Syscalls {
+		if rule.Action != "SCMP_ACT_ALLOW" && rule.Action != "SCMP_ACT_LOG" {
+			continue
+		}
+		for _, name := range []string{"unshare", "setns", "mount", "bpf", "keyctl", "clone3", "kexec_load"} {
+			if slices.Contains(rule.Names, name) {
+				t.Errorf("audit mode lets %s through (%s)", name, rule.Action)
+			}
+		}
+		if slices.Contains(rule.Names, "clone") && len(rule.Args) == 0 {
+			t.Error("audit mode lets clone create namespaces")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package container
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// apparmorProfilesFile lists the AppArmor profiles loaded into the kernel.
+const apparmorProfilesFile = "/sys/kernel/security/apparmor/profiles"
+
+var apparmorProfileDecl = regexp.MustCompile(`^\s*profile\s+("[^"]+"|\S+)`)
+
+// securityProfileArgs returns the --security-opt flags for security.seccompProfile and
+// security.apparmorProfile.
+func securityProfileArgs(cfg *config.Config, absProjectDir string) ([]string, error) {
+	var args []string
+	if p := cfg.Security.SeccompProfile; p != "" {
+		if p != "unconfined" {
+			p = resolveHostPath(absProjectDir, p)
+		}
+		args = append(args, "--security-opt", "seccomp="+p)
+	}
+	if cfg.Security.ApparmorProfile != "" {
+		name, _, err := apparmorProfile(cfg, absProjectDir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--security-opt", "apparmor="+name)
+	}
+	return args, nil
+}
+
+// apparmorProfile resolves security.apparmorProfile: a profile file in the project (its first
+// profile declaration names it) or the name of a profile already loaded on the host. file is the
+// profile file's path, or "" for a name.
+func apparmorProfile(cfg *config.Config, absProjectDir string) (name, file string, err error) {
+	p := cfg.Security.ApparmorProfile
+	file = resolveHostPath(absProjectDir, p)
+	if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+		return p, "", nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if m := apparmorProfileDecl.FindStringSubmatch(sc.Text()); m != nil {
+			return strings.Trim(m[1], `"`), file, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", fmt.Errorf("security.apparmorProfile: %s has no profile declaration", p)
+}
+
+// securityProfileProblems is Preflight's check of the security profiles: the seccomp profile must
+// be a JSON file, and on a local Linux engine the AppArmor profile must be loaded.
+func (r *Runner) securityProfileProblems(ctx context.Context, cfg *config.Config, absProjectDir string) []string {
+	var problems []string
+	if p := cfg.Security.SeccompProfile; p != "" && p != "unconfined" {
+		b, err := os.ReadFile(resolveHostPath(absProjectDir, p))
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("security.seccompProfile %s does not exist", p))
+		case !json.Valid(b):
+			problems = append(problems, fmt.Sprintf("security.seccompProfile %s is not a JSON seccomp profile", p))
+		}
+	}
+	if cfg.Security.ApparmorProfile == "" || cfg.Security.ApparmorProfile == "unconfined" {
+		return problems
+	}
+	name, file, err := apparmorProfile(cfg, absProjectDir)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	// Only a local Linux kernel's profiles can be checked; the profile must be loaded where the
+	// containers run.
+	if runtime.GOOS != "linux" || r.remoteDaemon(ctx) != "" {
+		return problems
+	}
+	loaded, err := os.ReadFile(apparmorProfilesFile)
+	if err != nil {
+		return problems
+	}
+	for _, line := range strings.Split(string(loaded), "\n") {
+		// Lines are "<name> (<mode>)".
+		if i := strings.LastIndex(line, " ("); i >= 0 && line[:i] == name {
+			return problems
+		}
+	}
+	if file == "" {
+		return append(problems, fmt.Sprintf("security.apparmorProfile %s is not loaded on this host", name))
+	}
+	return append(problems, fmt.Sprintf("security.apparmorProfile %s is not loaded on this host; load it with: sudo apparmor_parser -r -W %s", name, file))
+}
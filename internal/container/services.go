@@ -0,0 +1,130 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelService marks sidecar service containers with their service name.
+const labelService = "airlock.service"
+
+// servicesNetwork is the network the sandbox shares with the project's services.
+func servicesNetwork(cfg *config.Config) string {
+	return containerName(cfg) + "-net"
+}
+
+func serviceContainerName(cfg *config.Config, service string) string {
+	return containerName(cfg) + "-" + service
+}
+
+// serviceArgs returns the `run` arguments (after `run -d`) for a service. The service is reachable
+// from the sandbox under its own name.
+func serviceArgs(cfg *config.Config, name string, svc config.Service) []string {
+	args := []string{
+		"--name", serviceContainerName(cfg, name),
+		"--label", labelProject + "=" + cfg.Name,
+		"--label", labelService + "=" + name,
+		"--network", servicesNetwork(cfg),
+		"--network-alias", name,
+	}
+	args = append(args, userLabelArgs(cfg)...)
+	keys := make([]string, 0, len(svc.Env))
+	for k := range svc.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-e", k+"="+svc.Env[k])
+	}
+	for _, p := range svc.Ports {
+		args = append(args, "-p", p.String())
+	}
+	return append(args, svc.Image)
+}
+
+// startServices creates the services network and brings every configured service up. A service
+// whose configuration changed since it was created is recreated (losing data not kept in volumes).
+func (r *Runner) startServices(ctx context.Context, cfg *config.Config) error {
+	if len(cfg.Services) == 0 {
+		return nil
+	}
+	network := servicesNetwork(cfg)
+	if _, err := r.output(ctx, "network", "inspect", network); err != nil {
+		if _, err := r.output(ctx, "network", "create", "--label", labelProject+"="+cfg.Name, network); err != nil {
+			return fmt.Errorf("failed to create network %s: %w", network, err)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := serviceArgs(cfg, name, cfg.Services[name])
+		hash := specHash(spec)
+		cname := serviceContainerName(cfg, name)
+		exists, running := r.containerState(ctx, cname)
+		if exists {
+			created, _ := r.output(ctx, "inspect", "-f", `{{index .Config.Labels "`+labelConfigHash+`"}}`, cname)
+			if created != hash {
+				fmt.Fprintf(os.Stderr, "Recreating service %s (its configuration changed)\n", name)
+				if _, err := r.output(ctx, "rm", "-f", cname); err != nil {
+					return fmt.Errorf("failed to remove service %s: %w", name, err)
+				}
+				exists = false
+			}
+		}
+		switch {
+		case !exists:
+			args := append([]string{"run", "-d", "--label", labelConfigHash + "=" + hash}, spec...)
+			if _, err := r.output(ctx, args...); err != nil {
+				return fmt.Errorf("failed to start service %s: %w", name, err)
+			}
+		case !running:
+			if _, err := r.output(ctx, "start", cname); err != nil {
+				return fmt.Errorf("failed to start service %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// removeServices removes the project's service containers, including ones no longer configured,
+// and the services network.
+func (r *Runner) removeServices(ctx context.Context, cfg *config.Config) error {
+	out, err := r.output(ctx, "ps", "-a", "--filter", "label="+labelProject+"="+cfg.Name, "--filter", "label="+labelService, "--format", "{{.Names}}")
+	if err != nil {
+		return fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, name := range strings.Fields(out) {
+		if _, err := r.output(ctx, "rm", "-f", name); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	if _, err := r.output(ctx, "network", "inspect", servicesNetwork(cfg)); err == nil {
+		if _, err := r.output(ctx, "network", "rm", servicesNetwork(cfg)); err != nil {
+			return fmt.Errorf("failed to remove network %s: %w", servicesNetwork(cfg), err)
+		}
+	}
+	return nil
+}
+
+// networkSubnets returns the subnets of a network, which the egress allowlist must permit for the
+// sandbox to reach the services on it.
+func (r *Runner) networkSubnets(ctx context.Context, network string) ([]string, error) {
+	format := "{{range .Subnets}}{{.Subnet}} {{end}}"
+	if r.Engine == EngineDocker {
+		format = "{{range .IPAM.Config}}{{.Subnet}} {{end}}"
+	}
+	out, err := r.output(ctx, "network", "inspect", "--format", format, network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect network %s: %w", network, err)
+	}
+	return strings.Fields(out), nil
+}
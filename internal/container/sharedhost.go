@@ -0,0 +1,67 @@
+package container
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelUser records which UNIX user a shared-host sandbox belongs to (see config.SharedHost).
+const labelUser = "airlock.user"
+
+// enforcePrivate makes a shared-host state dir private to the current user: it refuses a dir owned
+// by someone else and strips group and other permissions, which MkdirAll leaves alone on an
+// existing dir.
+func enforcePrivate(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if uid, ok := fileOwner(fi); ok && uid != os.Getuid() {
+		return fmt.Errorf("%s belongs to uid %d, not you; on a shared host each user needs their own state dirs", dir, uid)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, fi.Mode().Perm()&0700)
+	}
+	return nil
+}
+
+// privateStateDirs applies enforcePrivate to a shared-host project's home, cache, and state dirs.
+func privateStateDirs(cfg *config.Config, absProjectDir, homeHost, cacheHost string) error {
+	if !cfg.SharedHost {
+		return nil
+	}
+	dirs := []string{homeHost, cacheHost}
+	if _, err := os.Stat(stateDir(absProjectDir)); err == nil {
+		dirs = append(dirs, stateDir(absProjectDir))
+	}
+	for _, d := range dirs {
+		if err := enforcePrivate(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListOptions adjusts List.
+type ListOptions struct {
+	// Owner limits the list to one shared-host user's sandboxes; empty lists every sandbox.
+	Owner string
+	// AllUsers lists other users' sandboxes too. With podman each user's rootless containers are
+	// private, so this needs root.
+	AllUsers bool
+}
+
+func (o ListOptions) filters(e Engine) ([]string, error) {
+	if o.AllUsers {
+		if e == EnginePodman && os.Getuid() != 0 {
+			return nil, fmt.Errorf("--all-users needs root with podman: each user's rootless containers are private to them")
+		}
+		return nil, nil
+	}
+	if o.Owner == "" {
+		return nil, nil
+	}
+	return []string{"--filter", "label=" + labelUser + "=" + o.Owner}, nil
+}
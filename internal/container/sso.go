@@ -0,0 +1,95 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// kerberosTarget is where the sandbox sees the copied Kerberos cache and krb5.conf (see config.SSO).
+const kerberosTarget = "/run/airlock-krb5"
+
+// hostKrb5Conf is the host Kerberos configuration copied next to the cache.
+const hostKrb5Conf = "/etc/krb5.conf"
+
+func kerberosDir(absProjectDir string) string {
+	return filepath.Join(stateDir(absProjectDir), "krb5")
+}
+
+// hostKerberosCache returns the host's file credential cache. Caches kept by a daemon (KCM,
+// KEYRING) can't be shared as a file; kinit -c FILE:<path> creates one that can.
+func hostKerberosCache() (string, error) {
+	name := os.Getenv("KRB5CCNAME")
+	if name == "" {
+		return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid()), nil
+	}
+	if kind, rest, ok := strings.Cut(name, ":"); ok && !filepath.IsAbs(name) {
+		if kind != "FILE" {
+			return "", fmt.Errorf("KRB5CCNAME is a %s cache, which can't be forwarded; use a FILE: cache (kinit -c FILE:/tmp/krb5cc_$(id -u))", kind)
+		}
+		name = rest
+	}
+	return name, nil
+}
+
+// refreshKerberos copies the host's current tickets (and krb5.conf) into the directory mounted into
+// the sandbox. Each file is replaced by rename, so a running sandbox never reads a partial cache.
+// Missing tickets are a warning: the sandbox simply has none until the next session after kinit.
+func refreshKerberos(cfg *config.Config, absProjectDir string) error {
+	if cfg.SSO == nil || !cfg.SSO.Kerberos {
+		return nil
+	}
+	dir := kerberosDir(absProjectDir)
+	cache, err := hostKerberosCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: sso.kerberos: %v\n", err)
+		return nil
+	}
+	if err := copyAtomic(cache, filepath.Join(dir, "krb5cc")); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("sso.kerberos: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: sso.kerberos: no Kerberos tickets at %s; run kinit on the host\n", cache)
+	}
+	if err := copyAtomic(hostKrb5Conf, filepath.Join(dir, "krb5.conf")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("sso.kerberos: %w", err)
+	}
+	return nil
+}
+
+func copyAtomic(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// ssoArgs returns the mounts and env that expose the forwarded credentials to the sandbox.
+func ssoArgs(cfg *config.Config, caps *Capabilities, absProjectDir string) (mounts, env []string) {
+	if cfg.SSO == nil {
+		return nil, nil
+	}
+	if cfg.SSO.Kerberos {
+		mounts = append(mounts, "-v", bindSpec(caps, kerberosDir(absProjectDir), kerberosTarget, "ro"))
+		env = append(env, "-e", "KRB5CCNAME=FILE:"+kerberosTarget+"/krb5cc")
+		if _, err := os.Stat(hostKrb5Conf); err == nil {
+			env = append(env, "-e", "KRB5_CONFIG="+kerberosTarget+"/krb5.conf")
+		}
+	}
+	for _, s := range cfg.SSO.Sockets {
+		// Connecting to a unix socket works through a read-only mount.
+		mounts = append(mounts, "-v", bindSpec(caps, s.Path(absProjectDir), s.Target, "ro"))
+		if s.Env != "" {
+			env = append(env, "-e", s.Env+"="+s.Target)
+		}
+	}
+	return mounts, env
+}
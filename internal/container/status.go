@@ -0,0 +1,163 @@
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// labelConfigHash records a hash of the arguments the container was created with.
+const labelConfigHash = "airlock.config.hash"
+
+// labelBaseHash records a hash of the create arguments without the env set in airlock.yaml, so an
+// env-only change can be told apart from one that needs the container recreated.
+const labelBaseHash = "airlock.config.basehash"
+
+// specHash returns a stable fingerprint of the container's create arguments.
+func specHash(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// baseSpecHash fingerprints the create arguments minus the -e entries for keys in cfg.Env.
+func baseSpecHash(cfg *config.Config, args []string) string {
+	var base []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-e" && i+1 < len(args) {
+			k, _, _ := strings.Cut(args[i+1], "=")
+			if _, ok := cfg.Env[k]; ok {
+				i++
+				continue
+			}
+		}
+		base = append(base, args[i])
+	}
+	return specHash(base)
+}
+
+// Drift describes how the project's container differs from what the current config would create.
+type Drift int
+
+const (
+	DriftNone Drift = iota
+	// DriftEnv means only env values changed. Every enter/exec session already passes the current
+	// env, so the container keeps working; only variables removed from airlock.yaml linger.
+	DriftEnv
+	// DriftFull means mounts, image, security, or other create-time settings changed.
+	DriftFull
+	// DriftBuild means only the Containerfile or build inputs changed: up rebuilds the image, but
+	// the container runs the old one until it is recreated.
+	DriftBuild
+)
+
+// Status reports the live state of the project's container: whether it exists and runs, its uptime,
+// the image it was created from, and whether the on-disk config has drifted since creation.
+func (r *Runner) Status(ctx context.Context, cfg *config.Config, absProjectDir string) (string, error) {
+	name := containerName(cfg)
+	lines := []string{"container: " + name}
+
+	exists, err := r.containerExists(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		lines = append(lines, "state: absent (run: airlock up)")
+		return strings.Join(lines, "\n"), nil
+	}
+	d, err := r.inspectContainer(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if d.State.Running {
+		state := "state: running"
+		if started, err := parseEngineTime(d.State.StartedAt); err == nil {
+			state += " (up " + time.Since(started).Round(time.Second).String() + ")"
+		}
+		lines = append(lines, state)
+	} else {
+		lines = append(lines, "state: stopped")
+	}
+
+	image := "image: " + imageRef(cfg) + " " + d.Image
+	if current, err := r.imageID(ctx, imageRef(cfg)); err == nil {
+		if !strings.HasPrefix(d.Image, "sha256:") {
+			d.Image = "sha256:" + d.Image
+		}
+		if current != d.Image {
+			image += " (outdated: image now " + current + ")"
+		}
+	}
+	lines = append(lines, image)
+
+	lines = append(lines, "config: "+r.driftState(ctx, cfg, absProjectDir, d))
+	return strings.Join(lines, "\n"), nil
+}
+
+// driftState compares the created container's config hash against the hash the current config would produce.
+func (r *Runner) driftState(ctx context.Context, cfg *config.Config, absProjectDir string, d *containerDetails) string {
+	if d.Config.Labels[labelConfigHash] == "" {
+		return "unknown (container predates drift tracking)"
+	}
+	drift, err := r.compareSpec(ctx, cfg, absProjectDir, d)
+	if err != nil {
+		return "unknown (" + err.Error() + ")"
+	}
+	switch drift {
+	case DriftEnv:
+		return "env changed (new sessions use it; run airlock up --recreate to drop removed variables)"
+	case DriftFull:
+		return "drifted (airlock.yaml changed since the container was created; run: airlock up --recreate)"
+	case DriftBuild:
+		return "image outdated (the Containerfile or build inputs changed since the container was created; run: airlock up --recreate)"
+	}
+	return "in sync"
+}
+
+// Drifted reports how the project's container differs from the effective config (mounts, env,
+// image, security settings) it would be created from now. A missing container, or one created
+// before drift tracking, is not considered drifted.
+func (r *Runner) Drifted(ctx context.Context, cfg *config.Config, absProjectDir string) (Drift, error) {
+	name := containerName(cfg)
+	if exists, _ := r.containerState(ctx, name); !exists {
+		return DriftNone, nil
+	}
+	d, err := r.inspectContainer(ctx, name)
+	if err != nil {
+		return DriftNone, err
+	}
+	if d.Config.Labels[labelConfigHash] == "" {
+		return DriftNone, nil
+	}
+	return r.compareSpec(ctx, cfg, absProjectDir, d)
+}
+
+// compareSpec compares the hashes recorded on the container with those of the current config and
+// build inputs. Containers created before env-only changes were tracked report any change as
+// DriftFull.
+func (r *Runner) compareSpec(ctx context.Context, cfg *config.Config, absProjectDir string, d *containerDetails) (Drift, error) {
+	u, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return DriftNone, err
+	}
+	spec, err := r.createArgs(ctx, cfg, u, absProjectDir,
+		resolveHostPath(absProjectDir, cfg.HomeDir),
+		resolveHostPath(absProjectDir, cfg.CacheDir),
+		resolveHostPath(absProjectDir, cfg.WorkDir))
+	if err != nil {
+		return DriftNone, err
+	}
+	switch {
+	case specHash(spec) != d.Config.Labels[labelConfigHash] && baseSpecHash(cfg, spec) != d.Config.Labels[labelBaseHash]:
+		return DriftFull, nil
+	case buildChanged(cfg, absProjectDir, d):
+		return DriftBuild, nil
+	case specHash(spec) != d.Config.Labels[labelConfigHash]:
+		return DriftEnv, nil
+	}
+	return DriftNone, nil
+}
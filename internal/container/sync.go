@@ -0,0 +1,238 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+	"github.com/donjaime/airlock/internal/filesync"
+)
+
+// workspaceVolume is the engine volume holding the container's copy of a synced workspace.
+func workspaceVolume(cfg *config.Config) string {
+	return "airlock-" + cfg.Name + "-workspace"
+}
+
+// SyncStateDir is where the workspace sync keeps its base tree, status, and lock.
+func SyncStateDir(absProjectDir string) string {
+	return filepath.Join(stateDir(absProjectDir), "sync")
+}
+
+// WorkspaceSyncer returns the syncer between the host workspace and the running container's copy
+// of it. The copy's generation is its volume's creation time, so a recreated volume is synced from
+// scratch rather than against the state of the old one.
+func (r *Runner) WorkspaceSyncer(ctx context.Context, cfg *config.Config, absProjectDir string) (*filesync.Syncer, error) {
+	if cfg.Sync == nil {
+		return nil, errors.New("the workspace isn't synced (set sync in airlock.yaml)")
+	}
+	if _, running := r.containerState(ctx, containerName(cfg)); !running {
+		return nil, errors.New("the container is not running (run: airlock up)")
+	}
+	u, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	created, err := r.output(ctx, "volume", "inspect", "--format", "{{.CreatedAt}}", workspaceVolume(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the workspace volume: %w", err)
+	}
+	ignore := filesync.NewMatcher(cfg.Sync.Ignore)
+	return &filesync.Syncer{
+		Host:       filesync.LocalDir{Root: resolveHostPath(absProjectDir, cfg.WorkDir)},
+		Container:  &workspaceSide{r: r, name: containerName(cfg), user: u.Name, dir: u.WorkDir},
+		StateDir:   SyncStateDir(absProjectDir),
+		Generation: created,
+		Ignore:     ignore,
+		Options: filesync.DiffOptions{
+			Prefer: cfg.Sync.Conflicts,
+			// The workspace isn't bind mounted, so protect can't mount these read-only; the sync
+			// reverts the sandbox's changes to them instead.
+			Protected: func(rel string) bool { return protectedPath(cfg.Protect, rel) },
+		},
+	}, nil
+}
+
+// SyncWorkspace runs one sync of the workspace, reporting conflicts on stderr.
+func (r *Runner) SyncWorkspace(ctx context.Context, cfg *config.Config, absProjectDir string) (*filesync.Plan, error) {
+	s, err := r.WorkspaceSyncer(ctx, cfg, absProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.Sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range plan.Conflicts {
+		fmt.Fprintf(os.Stderr, "airlock: %s\n", ConflictSummary(c))
+	}
+	return plan, nil
+}
+
+// syncStartTimeout is how long the background sync waits for the container to start.
+const syncStartTimeout = time.Minute
+
+// RunSync syncs the workspace every sync.interval until ctx is done or the container stops. It is
+// the background sync that up starts; a failed sync is logged and retried on the next tick.
+func (r *Runner) RunSync(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	if cfg.Sync == nil {
+		return errors.New("the workspace isn't synced (set sync in airlock.yaml)")
+	}
+	ticker := time.NewTicker(time.Duration(cfg.Sync.Interval))
+	defer ticker.Stop()
+	deadline := time.Now().Add(syncStartTimeout)
+	started := false
+	for {
+		if _, running := r.containerState(ctx, containerName(cfg)); running {
+			started = true
+			if _, err := r.SyncWorkspace(ctx, cfg, absProjectDir); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "%s sync failed: %v\n", time.Now().Format(time.RFC3339), err)
+			}
+		} else if started || time.Now().After(deadline) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ConflictSummary describes a sync conflict in one line.
+func ConflictSummary(c filesync.Conflict) string {
+	if c.Copy != "" {
+		return fmt.Sprintf("sync conflict on %s: kept the %s's version; the other is in %s", c.Path, c.Winner, c.Copy)
+	}
+	return fmt.Sprintf("sync conflict on %s: kept the %s's version", c.Path, c.Winner)
+}
+
+// workspaceSide is the container's copy of a synced workspace, reached through engine exec with the
+// tools every image has: find, stat, tar, xargs.
+type workspaceSide struct {
+	r    *Runner
+	name string
+	user string
+	dir  string
+}
+
+// exec runs cmd in the workspace. Its stderr is returned in the error.
+func (s *workspaceSide) exec(ctx context.Context, stdin io.Reader, stdout io.Writer, cmd ...string) error {
+	args := []string{"exec"}
+	if stdin != nil {
+		args = append(args, "-i")
+	}
+	args = append(append(args, "--user", s.user, "-w", s.dir, s.name), cmd...)
+	var stderr stderrTail
+	if err := s.r.runCmdIO(ctx, stdin, stdout, &stderr, s.r.engineBin(), args...); err != nil {
+		return &syncExecError{cmd: cmd[0], stderr: strings.TrimSpace(string(stderr.b)), err: err}
+	}
+	return nil
+}
+
+type syncExecError struct {
+	cmd, stderr string
+	err         error
+}
+
+func (e *syncExecError) Error() string {
+	if e.stderr != "" {
+		return fmt.Sprintf("%s in the container failed: %s", e.cmd, e.stderr)
+	}
+	return fmt.Sprintf("%s in the container failed: %v", e.cmd, e.err)
+}
+
+func (e *syncExecError) Unwrap() error { return e.err }
+
+// onlyVanished reports whether err is a command that only failed because files disappeared while it
+// ran, e.g. a build's temporary files. Its output is still good; the next sync sees the removal.
+func onlyVanished(err error) bool {
+	var ee *syncExecError
+	if !errors.As(err, &ee) || ee.stderr == "" {
+		return false
+	}
+	for _, line := range strings.Split(ee.stderr, "\n") {
+		if !strings.Contains(line, "No such file or directory") && !strings.Contains(line, "Exiting with failure status due to previous errors") {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan implements filesync.Side. Ignored directories are pruned in find itself, so e.g. a large
+// node_modules isn't walked on every sync.
+func (s *workspaceSide) Scan(ctx context.Context, ignore *filesync.Matcher) (filesync.Tree, error) {
+	cmd := []string{"find", ".", "-mindepth", "1", "(", "-path", "./.airlock", "-o", "-name", filesync.TempPrefix + "*"}
+	for _, p := range ignore.Patterns() {
+		if strings.Contains(p, "/") {
+			cmd = append(cmd, "-o", "-path", "./"+p)
+		} else {
+			cmd = append(cmd, "-o", "-name", p)
+		}
+	}
+	cmd = append(cmd, ")", "-prune", "-o", "(", "-type", "f", "-o", "-type", "d", "-o", "-type", "l", ")",
+		"-exec", "stat", "-c", "%f|%s|%Y|%n", "{}", "+")
+	var out bytes.Buffer
+	if err := s.exec(ctx, nil, &out, cmd...); err != nil && !onlyVanished(err) {
+		return nil, err
+	}
+	t := filesync.Tree{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		// %n comes last, so a "|" in a name is kept; a name with a newline doesn't parse and is skipped.
+		f := strings.SplitN(line, "|", 4)
+		if len(f) != 4 {
+			continue
+		}
+		mode, err1 := strconv.ParseUint(f[0], 16, 32)
+		size, err2 := strconv.ParseInt(f[1], 10, 64)
+		mtime, err3 := strconv.ParseInt(f[2], 10, 64)
+		rel := strings.TrimPrefix(f[3], "./")
+		if err1 != nil || err2 != nil || err3 != nil || rel == f[3] || ignore.Match(rel) {
+			continue
+		}
+		switch mode & 0xf000 {
+		case 0x4000:
+			t[rel] = filesync.Entry{Kind: filesync.Dir}
+		case 0x8000:
+			t[rel] = filesync.Entry{Kind: filesync.File, Size: size, MTime: mtime}
+		case 0xa000:
+			t[rel] = filesync.Entry{Kind: filesync.Symlink, Size: size, MTime: mtime}
+		}
+	}
+	return t, nil
+}
+
+// Read implements filesync.Side.
+func (s *workspaceSide) Read(ctx context.Context, paths []string, w io.Writer) error {
+	err := s.exec(ctx, strings.NewReader(strings.Join(paths, "\n")+"\n"), w, "tar", "-c", "-f", "-", "-T", "-")
+	if onlyVanished(err) {
+		return nil
+	}
+	return err
+}
+
+// Write implements filesync.Side.
+func (s *workspaceSide) Write(ctx context.Context, r io.Reader) error {
+	return s.exec(ctx, r, io.Discard, "tar", "-x", "-f", "-")
+}
+
+// Mkdir implements filesync.Side.
+func (s *workspaceSide) Mkdir(ctx context.Context, paths []string) error {
+	return s.exec(ctx, nulList(paths), io.Discard, "xargs", "-0", "mkdir", "-p", "--")
+}
+
+// Remove implements filesync.Side.
+func (s *workspaceSide) Remove(ctx context.Context, paths []string) error {
+	return s.exec(ctx, nulList(paths), io.Discard, "xargs", "-0", "rm", "-rf", "--")
+}
+
+func nulList(paths []string) io.Reader {
+	return strings.NewReader(strings.Join(paths, "\x00"))
+}
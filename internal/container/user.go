@@ -0,0 +1,51 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// defaultUserName names a user.uid without a user.name in /etc/passwd.
+const defaultUserName = "airlock"
+
+// addUserScript adds a passwd entry (and group) for uid unless the image has one. A user.name the
+// image already gives another uid is renamed, so name lookups keep resolving to the image's user.
+const addUserScript = `uid="$1" gid="$2" name="$3" home="$4"
+grep -q "^[^:]*:[^:]*:$uid:" /etc/passwd && exit 0
+grep -q "^$name:" /etc/passwd && name="$name-$uid"
+grep -q "^[^:]*:[^:]*:$gid:" /etc/group || echo "$name:x:$gid:" >> /etc/group
+shell=/bin/sh
+[ -x /bin/bash ] && shell=/bin/bash
+echo "$name:x:$uid:$gid:airlock sandbox user:$home:$shell" >> /etc/passwd`
+
+// ensureUser adds the sandbox's uid to a new container's /etc/passwd when the image has no such user
+// (a configured user.uid, or the host uid docker's userns mapping runs as; see mapDockerUser), so
+// tools that look the user up (whoami, ssh, git, sudo) work instead of reporting "I have no name!".
+// A user.name without a uid must exist in the image already.
+func (r *Runner) ensureUser(ctx context.Context, cfg *config.Config, u *UserConfig) {
+	if u.UID == "" || u.UID == "0" {
+		return
+	}
+	if _, ok := lookupPasswd(u.Passwd, u.UID); ok {
+		return
+	}
+	if cfg.Security.ReadOnlyRootfs {
+		fmt.Fprintf(os.Stderr, "warning: security.readOnlyRootfs keeps airlock from adding uid %s to /etc/passwd; add the user in the image if tools need to look it up\n", u.UID)
+		return
+	}
+	name := defaultUserName
+	if cfg.User != nil && cfg.User.Name != "" {
+		name = cfg.User.Name
+	}
+	gid := u.GID
+	if gid == "" {
+		gid = u.UID
+	}
+	args := []string{"exec", "--user", "0", containerName(cfg), "sh", "-c", addUserScript, "sh", u.UID, gid, name, u.Home}
+	if _, err := r.output(ctx, args...); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to add user %s (uid %s) to the container's /etc/passwd: %v\n", name, u.UID, err)
+	}
+}
@@ -0,0 +1,63 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// mapDockerUser is docker's counterpart to podman's --userns=keep-id: it picks the sandbox user so
+// files created in the bind-mounted workspace belong to the host user. Without a user.uid:
+//   - rootless docker maps only container root to the host user (every other uid lands in a
+//     subordinate range), so the sandbox runs as root, which is the host user outside. Not with
+//     network.allow or security.hardened, though: root could remove the egress allowlist, and
+//     dropped privileges mean little to it (see rootlessRootRefused);
+//   - a daemon with userns-remap runs the container with --userns=host (see usernsArgs), so the
+//     sandbox runs as the host uid:gid, added to /etc/passwd by ensureUser when the image lacks it.
+//
+// A user.uid is kept as configured; under rootless docker its files land in the subordinate range.
+func mapDockerUser(cfg *config.Config, caps *Capabilities, u *UserConfig) {
+	if caps.Engine != EngineDocker || (cfg.User != nil && cfg.User.UID != nil) {
+		return
+	}
+	switch {
+	case caps.Rootless && rootlessRootRefused(cfg):
+		// Keep the image's user.
+	case caps.Rootless:
+		u.Name, u.UID, u.GID = "0:0", "0", "0"
+	case caps.Userns && os.Getuid() >= 0:
+		u.UID, u.GID = strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+		u.Name = u.UID + ":" + u.GID
+	}
+}
+
+// usernsArgs opts the container out of a docker daemon's userns-remap, so container uids are host
+// uids again and the workspace keeps the ownership mapDockerUser picked.
+func usernsArgs(caps *Capabilities) []string {
+	if caps.Engine != EngineDocker || !caps.Userns || caps.Rootless {
+		return nil
+	}
+	return []string{"--userns=host"}
+}
+
+// rootlessRootRefused reports whether the config relies on an unprivileged sandbox user, so rootless
+// docker must not run it as root for the sake of workspace ownership.
+func rootlessRootRefused(cfg *config.Config) bool {
+	return len(cfg.Network.Allow) > 0 || cfg.Security.Hardened
+}
+
+// warnRootlessDockerUID tells a rootless docker user that a sandbox user other than root can't own
+// workspace files on the host: a user.uid, or the image's user kept by rootlessRootRefused.
+func warnRootlessDockerUID(cfg *config.Config, caps *Capabilities) {
+	if caps.Engine != EngineDocker || !caps.Rootless {
+		return
+	}
+	switch {
+	case cfg.User != nil && cfg.User.UID != nil && *cfg.User.UID != 0:
+		fmt.Fprintf(os.Stderr, "warning: rootless docker maps only container root to your host user, so files user.uid %d creates in the workspace are owned by a subordinate uid on the host; without user.uid (and without network.allow or security.hardened), the sandbox runs as root, which is your host user\n", *cfg.User.UID)
+	case (cfg.User == nil || cfg.User.UID == nil) && rootlessRootRefused(cfg):
+		fmt.Fprintln(os.Stderr, "warning: rootless docker maps only container root to your host user, but network.allow and security.hardened need an unprivileged sandbox user, so files the sandbox creates in the workspace are owned by a subordinate uid on the host")
+	}
+}
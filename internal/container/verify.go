@@ -0,0 +1,139 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// CheckStatus is the outcome of a single isolation check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "PASS"
+	CheckFail CheckStatus = "FAIL"
+	CheckWarn CheckStatus = "WARN"
+	CheckSkip CheckStatus = "SKIP"
+)
+
+// CheckResult is one line of the isolation report produced by Verify.
+type CheckResult struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// isolationCheck is a shell snippet run inside the sandbox as the sandbox user. The exit code
+// maps to the status (0 pass, 1 fail, 2 warn, 3 skip) and stdout becomes the detail.
+type isolationCheck struct {
+	name   string
+	script string
+}
+
+var isolationChecks = []isolationCheck{
+	{
+		name: "host processes hidden",
+		script: `comm=$(cat /proc/1/comm 2>/dev/null)
+case "$comm" in
+  systemd|init|launchd) echo "PID 1 is $comm: host PID namespace is shared"; exit 1 ;;
+esac
+echo "PID 1 is $comm ($(ls -d /proc/[0-9]* | wc -l) processes visible)"`,
+	},
+	{
+		name: "container root filesystem not writable",
+		script: `for d in /etc /usr /bin; do
+  if touch "$d/.airlock-verify" 2>/dev/null; then rm -f "$d/.airlock-verify"; echo "able to write to $d"; exit 1; fi
+done
+echo "writes outside mounts are denied"`,
+	},
+	{
+		name: "engine sockets not exposed",
+		script: `for s in /var/run/docker.sock /run/docker.sock /run/podman/podman.sock /run/user/*/podman/podman.sock; do
+  if [ -S "$s" ]; then echo "found $s"; exit 1; fi
+done
+echo "no docker/podman sockets visible"`,
+	},
+	{
+		name: "no passwordless sudo",
+		script: `if command -v sudo >/dev/null 2>&1 && sudo -n true 2>/dev/null; then echo "sudo -n succeeds"; exit 1; fi
+echo "sudo unavailable or requires a password"`,
+	},
+	{
+		name: "no effective capabilities",
+		script: `capeff=$(grep CapEff /proc/self/status | awk '{print $2}')
+if [ "$capeff" != "0000000000000000" ]; then echo "CapEff=$capeff"; exit 1; fi
+echo "CapEff=$capeff"`,
+	},
+	{
+		name: "setuid escalation blocked (no_new_privs)",
+		script: `nnp=$(grep NoNewPrivs /proc/self/status | awk '{print $2}')
+if [ "$nnp" = "1" ]; then echo "no_new_privs is set"; exit 0; fi
+n=$(find / -xdev -perm -4000 -type f 2>/dev/null | wc -l)
+if [ "$n" -gt 0 ]; then echo "no_new_privs unset and $n setuid binaries present"; exit 2; fi
+echo "no_new_privs unset but no setuid binaries found"`,
+	},
+	{
+		name: "cloud metadata endpoint unreachable",
+		script: `command -v bash >/dev/null 2>&1 || { echo "bash not available"; exit 3; }
+if timeout 3 bash -c 'exec 3<>/dev/tcp/169.254.169.254/80' 2>/dev/null; then echo "169.254.169.254:80 reachable"; exit 1; fi
+echo "169.254.169.254:80 unreachable"`,
+	},
+	{
+		name: "public internet egress",
+		script: `command -v bash >/dev/null 2>&1 || { echo "bash not available"; exit 3; }
+if timeout 3 bash -c 'exec 3<>/dev/tcp/1.1.1.1/443' 2>/dev/null; then echo "1.1.1.1:443 reachable"; exit 2; fi
+echo "1.1.1.1:443 unreachable"`,
+	},
+}
+
+// Verify runs a battery of isolation checks inside the sandbox and returns a report.
+// The container must already be up.
+func (r *Runner) Verify(ctx context.Context, cfg *config.Config) ([]CheckResult, error) {
+	userConfig, err := r.userConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []CheckResult
+	for _, c := range isolationChecks {
+		out, code, err := r.execCapture(ctx, cfg, userConfig.Name, []string{"sh", "-c", c.script})
+		if err != nil {
+			return nil, err
+		}
+		status := CheckFail
+		switch code {
+		case 0:
+			status = CheckPass
+		case 2:
+			status = CheckWarn
+		case 3:
+			status = CheckSkip
+		}
+		results = append(results, CheckResult{Name: c.name, Status: status, Detail: strings.TrimSpace(out)})
+	}
+	return results, nil
+}
+
+// execCapture runs a non-interactive command in the sandbox and returns its stdout and exit code.
+// A non-zero exit code is not an error; failing to run the engine is.
+func (r *Runner) execCapture(ctx context.Context, cfg *config.Config, user string, cmdArgs []string) (string, int, error) {
+	args := []string{"exec", "--user", user, containerName(cfg)}
+	args = append(args, cmdArgs...)
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %s\n", r.engineBin(), strings.Join(args, " "))
+	}
+	out, err := exec.CommandContext(ctx, r.engineBin(), args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return string(out), 0, nil
+}
@@ -0,0 +1,99 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+var volumeNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// volumeName returns the engine volume backing a volume mount. Volumes are scoped to the project
+// (and instance) by name, so two projects' node_modules never share one.
+func volumeName(cfg *config.Config, m config.Mount) string {
+	name := m.Source
+	if name == "" {
+		name = strings.Trim(strings.ReplaceAll(path.Clean(m.Target), "/", "-"), "-")
+	}
+	return "airlock-" + cfg.Name + "-" + name
+}
+
+// ensureVolumes creates the config's named volumes (and a synced workspace's) that don't exist yet,
+// labeled with the project so down can clean them up, and returns the targets of the ones it created.
+func (r *Runner) ensureVolumes(ctx context.Context, cfg *config.Config, u *UserConfig) ([]string, error) {
+	volumes := map[string]string{} // target -> name
+	for _, m := range cfg.Mounts {
+		if m.Type == config.MountVolume {
+			volumes[m.Target] = volumeName(cfg, m)
+		}
+	}
+	if cfg.Sync != nil {
+		volumes[u.WorkDir] = workspaceVolume(cfg)
+	}
+	var created []string
+	for target, name := range volumes {
+		if _, err := r.output(ctx, "volume", "inspect", name); err == nil {
+			continue
+		}
+		if _, err := r.output(ctx, "volume", "create", "--label", labelProject+"="+cfg.Name, name); err != nil {
+			return nil, fmt.Errorf("failed to create volume %s: %w", name, err)
+		}
+		created = append(created, target)
+	}
+	sort.Strings(created)
+	return created, nil
+}
+
+// chownVolumes hands freshly created volumes to the sandbox user. A new volume is owned by root
+// unless the image has files at its target, which would leave e.g. a node_modules volume unwritable.
+func (r *Runner) chownVolumes(ctx context.Context, cfg *config.Config, u *UserConfig, targets []string) {
+	if len(targets) == 0 {
+		return
+	}
+	args := append([]string{"exec", "--user", "0", containerName(cfg), "chown", u.Name}, targets...)
+	if _, err := r.output(ctx, args...); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to give the new volumes at %s to %s: %v\n", strings.Join(targets, ", "), u.Name, err)
+	}
+}
+
+// projectVolumes returns the names of the engine volumes created for the project.
+func (r *Runner) projectVolumes(ctx context.Context, cfg *config.Config) ([]string, error) {
+	out, err := r.output(ctx, "volume", "ls", "-q", "--filter", "label="+labelProject+"="+cfg.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	return strings.Fields(out), nil
+}
+
+// RemoveVolumes removes the project's named volumes: all of them, or with staleOnly, those no
+// mount in the config uses anymore. The container must be removed first.
+func (r *Runner) RemoveVolumes(ctx context.Context, cfg *config.Config, staleOnly bool) error {
+	names, err := r.projectVolumes(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	inUse := map[string]bool{}
+	if cfg.Sync != nil {
+		inUse[workspaceVolume(cfg)] = true
+	}
+	for _, m := range cfg.Mounts {
+		if m.Type == config.MountVolume {
+			inUse[volumeName(cfg, m)] = true
+		}
+	}
+	for _, name := range names {
+		if staleOnly && inUse[name] {
+			continue
+		}
+		if _, err := r.output(ctx, "volume", "rm", name); err != nil {
+			return fmt.Errorf("failed to remove volume %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package container
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// defaultWorkspace is where workdir is mounted when neither the config nor the image says where.
+const defaultWorkspace = "/workspace"
+
+// workspaceTarget returns where workdir is mounted in the container, which is also where sessions
+// start. In order of preference: the config's containerWorkdir, the target of a mount of workdir
+// itself, the image's WorkingDir, and defaultWorkspace when the image's is empty or / (which can't
+// hold the workspace mount). The warnings describe where the config, the image, and the mounts
+// disagree.
+func workspaceTarget(cfg *config.Config, absProjectDir, imageWorkDir string) (string, []string) {
+	workDirHost := resolveHostPath(absProjectDir, cfg.WorkDir)
+	imageUsable := imageWorkDir != "" && path.Clean(imageWorkDir) != "/"
+
+	var target, from string
+	if cfg.ContainerWorkDir != "" {
+		target, from = path.Clean(cfg.ContainerWorkDir), "containerWorkdir"
+	} else {
+		for i, m := range cfg.Mounts {
+			if m.IsBind() && path.IsAbs(m.Target) && resolveHostPath(absProjectDir, m.Source) == workDirHost {
+				target, from = path.Clean(m.Target), fmt.Sprintf("mounts[%d]", i)
+				break
+			}
+		}
+	}
+
+	var warnings []string
+	switch {
+	case target != "":
+		if imageUsable && target != path.Clean(imageWorkDir) {
+			warnings = append(warnings, fmt.Sprintf("the image's WorkingDir is %s, but %s puts workdir at %s; sessions start in %s", imageWorkDir, from, target, target))
+		}
+	case imageUsable:
+		target = path.Clean(imageWorkDir)
+	default:
+		target = defaultWorkspace
+		warnings = append(warnings, fmt.Sprintf("the image has no usable WorkingDir (%q); mounting workdir at %s (set containerWorkdir to choose another path)", imageWorkDir, target))
+	}
+
+	for i, m := range cfg.Mounts {
+		if path.Clean(m.Target) == target && (!m.IsBind() || resolveHostPath(absProjectDir, m.Source) != workDirHost) {
+			warnings = append(warnings, fmt.Sprintf("mounts[%d] (%s) is mounted over the workspace %s, so workdir %s is not visible in the container", i, m.Source, target, cfg.WorkDir))
+		}
+	}
+	return target, warnings
+}
@@ -0,0 +1,168 @@
+// Package daemon implements the optional `airlock daemon`: a long-lived process that remembers which
+// sandboxes are already up with a given config, so high-frequency exec calls can skip the engine
+// round-trips of bringing the container up. It listens on a unix socket and forgets a sandbox as
+// soon as the engine reports any event for its container.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/donjaime/airlock/internal/filelock"
+)
+
+// DefaultTTL bounds how long a sandbox is trusted to be ready without re-checking, e.g. so egress
+// allowlists pick up DNS changes.
+const DefaultTTL = 10 * time.Minute
+
+// SocketPath is where the daemon listens.
+func SocketPath() string {
+	return filepath.Join(filepath.Dir(filelock.Dir()), "daemon.sock")
+}
+
+type request struct {
+	Op   string `json:"op"` // "check", "mark", or "ping"
+	Key  string `json:"key,omitempty"`
+	Name string `json:"name,omitempty"` // container name, for mark
+}
+
+type response struct {
+	OK bool `json:"ok"`
+}
+
+type entry struct {
+	name string
+	at   time.Time
+}
+
+// Server tracks ready sandboxes.
+type Server struct {
+	TTL time.Duration
+
+	mu    sync.Mutex
+	ready map[string]entry
+}
+
+// NewServer returns a Server with the default TTL.
+func NewServer() *Server {
+	return &Server{TTL: DefaultTTL, ready: map[string]entry{}}
+}
+
+// Serve accepts connections on sock until ctx is done. events delivers container names the engine
+// reported activity for; any event invalidates that container's entries.
+func (s *Server) Serve(ctx context.Context, sock string, events <-chan string) error {
+	if err := os.MkdirAll(filepath.Dir(sock), 0700); err != nil {
+		return err
+	}
+	if c, err := net.DialTimeout("unix", sock, 100*time.Millisecond); err == nil {
+		c.Close()
+		return errors.New("a daemon is already listening on " + sock)
+	}
+	_ = os.Remove(sock)
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+	_ = os.Chmod(sock, 0600)
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go func() {
+		for name := range events {
+			s.forget(name)
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	sc := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for sc.Scan() {
+		var req request
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			return
+		}
+		_ = enc.Encode(response{OK: s.apply(req)})
+	}
+}
+
+func (s *Server) apply(req request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.Op {
+	case "ping":
+		return true
+	case "mark":
+		s.ready[req.Key] = entry{name: req.Name, at: time.Now()}
+		return true
+	case "check":
+		e, ok := s.ready[req.Key]
+		if ok && time.Since(e.at) > s.TTL {
+			delete(s.ready, req.Key)
+			return false
+		}
+		return ok
+	}
+	return false
+}
+
+func (s *Server) forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.ready {
+		if e.name == name {
+			delete(s.ready, k)
+		}
+	}
+}
+
+// Check asks the daemon at sock whether the sandbox identified by key is known to be up.
+// It returns false quickly when no daemon is running.
+func Check(sock, key string) bool {
+	return call(sock, request{Op: "check", Key: key})
+}
+
+// Mark tells the daemon at sock that the sandbox identified by key is up in container name.
+func Mark(sock, key, name string) {
+	call(sock, request{Op: "mark", Key: key, Name: name})
+}
+
+func call(sock string, req request) bool {
+	conn, err := net.DialTimeout("unix", sock, 50*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return false
+	}
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return false
+	}
+	return resp.OK
+}
@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeCheckMark(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-daemon-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "d.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan string)
+	srv := NewServer()
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, sock, events) }()
+
+	// Wait for the socket to come up.
+	for i := 0; i < 100 && !call(sock, request{Op: "ping"}); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if Check(sock, "k1") {
+		t.Fatalf("expected unknown key to be not ready")
+	}
+	Mark(sock, "k1", "airlock-demo")
+	Mark(sock, "k2", "airlock-other")
+	if !Check(sock, "k1") || !Check(sock, "k2") {
+		t.Fatalf("expected marked keys to be ready")
+	}
+
+	events <- "airlock-demo"
+	time.Sleep(20 * time.Millisecond)
+	if Check(sock, "k1") {
+		t.Errorf("expected an engine event to invalidate k1")
+	}
+	if !Check(sock, "k2") {
+		t.Errorf("expected k2 to be unaffected by another container's event")
+	}
+
+	srv.mu.Lock()
+	srv.TTL = 0
+	srv.mu.Unlock()
+	if Check(sock, "k2") {
+		t.Errorf("expected k2 to expire after the TTL")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	if Check(sock, "k1") {
+		t.Errorf("expected no answer after shutdown")
+	}
+}
@@ -0,0 +1,52 @@
+// Package filelock provides host-level advisory locks used to coordinate concurrent airlock processes.
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Lock blocks until it holds an exclusive lock on path, creating the file if needed.
+// It returns a func that releases the lock.
+func Lock(path string) (func(), error) {
+	f, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock(f, true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { unlock(f); f.Close() }, nil
+}
+
+// TryLock attempts to take the lock without blocking. ok is false if another process holds it.
+func TryLock(path string) (release func(), ok bool, err error) {
+	f, err := open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := lock(f, false); err != nil {
+		f.Close()
+		if isContended(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return func() { unlock(f); f.Close() }, true, nil
+}
+
+func open(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+}
+
+// Dir returns the per-user directory for airlock's host-level lock files.
+func Dir() string {
+	if d, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(d, "airlock", "locks")
+	}
+	return filepath.Join(os.TempDir(), "airlock-locks")
+}
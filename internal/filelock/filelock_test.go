@@ -0,0 +1,31 @@
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLockContended(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-lock-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "build.lock")
+
+	release, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, ok, err := TryLock(path); err != nil || ok {
+		t.Fatalf("expected TryLock to report contention, got ok=%v err=%v", ok, err)
+	}
+	release()
+
+	release, ok, err := TryLock(path)
+	if err != nil || !ok {
+		t.Fatalf("expected TryLock to succeed after release, got ok=%v err=%v", ok, err)
+	}
+	release()
+}
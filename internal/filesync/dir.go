@@ -0,0 +1,256 @@
+package filesync
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateDirName is airlock's own directory in the workspace, which is never synced.
+const stateDirName = ".airlock"
+
+// TempPrefix starts the names of files LocalDir.Write hasn't renamed into place yet, which
+// scans skip.
+const TempPrefix = ".airlock-sync-"
+
+// LocalDir is a Side on the local filesystem, rooted at Root.
+type LocalDir struct {
+	Root string
+}
+
+// Scan implements Side.
+func (d LocalDir) Scan(ctx context.Context, ignore *Matcher) (Tree, error) {
+	t := Tree{}
+	err := filepath.WalkDir(d.Root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if p != d.Root && errors.Is(err, fs.ErrNotExist) {
+				return nil // removed while walking
+			}
+			return err
+		}
+		if p == d.Root {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(strings.TrimPrefix(p, d.Root+string(filepath.Separator)))
+		if rel == stateDirName || strings.HasPrefix(de.Name(), TempPrefix) || ignore.Match(rel) {
+			if de.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fi, err := de.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			t[rel] = Entry{Kind: Dir}
+		case fi.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			t[rel] = Entry{Kind: Symlink, Size: int64(len(target)), MTime: fi.ModTime().Unix()}
+		case fi.Mode().IsRegular():
+			t[rel] = Entry{Kind: File, Size: fi.Size(), MTime: fi.ModTime().Unix()}
+		}
+		// Sockets, pipes, and devices aren't synced.
+		return nil
+	})
+	return t, err
+}
+
+// Read implements Side.
+func (d LocalDir) Read(ctx context.Context, paths []string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, rel := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := filepath.Join(d.Root, filepath.FromSlash(rel))
+		fi, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // removed since the scan; the next sync sees that
+		}
+		if err != nil {
+			return err
+		}
+		link := ""
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		} else if !fi.Mode().IsRegular() {
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		// Scans compare whole seconds, and the tar writer would round rather than truncate.
+		hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+		hdr.Uname, hdr.Gname, hdr.Uid, hdr.Gid = "", "", 0, 0
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if link != "" {
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		// A file that changed size since the header was written would corrupt the stream.
+		_, err = io.CopyN(tw, f, hdr.Size)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s changed while it was being read: %w", rel, err)
+		}
+	}
+	return tw.Close()
+}
+
+// Write implements Side. Files are written to a temporary name and renamed into place, so a reader
+// never sees one half written.
+func (d LocalDir) Write(ctx context.Context, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p, err := d.path(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := replaceSymlink(p, hdr.Linkname); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(p, tr, hdr.FileInfo().Mode().Perm(), hdr.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Mkdir implements Side.
+func (d LocalDir) Mkdir(_ context.Context, paths []string) error {
+	for _, rel := range paths {
+		p, err := d.path(rel)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove implements Side.
+func (d LocalDir) Remove(_ context.Context, paths []string) error {
+	for _, rel := range paths {
+		p, err := d.path(rel)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// path resolves a relative path the other side sent, refusing one that would reach outside the
+// tree: through "..", into .airlock, or through a symlink, which the other side (a sandbox) could
+// have pointed anywhere on the host.
+func (d LocalDir) path(name string) (string, error) {
+	rel := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || rel == stateDirName || strings.HasPrefix(rel, stateDirName+"/") {
+		return "", fmt.Errorf("refusing to change %q outside the synced tree", name)
+	}
+	p := d.Root
+	elems := strings.Split(rel, "/")
+	for _, e := range elems[:len(elems)-1] {
+		p = filepath.Join(p, e)
+		fi, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to change %q through the symlink %s", name, strings.Join(elems[:len(elems)-1], "/"))
+		}
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(rel)), nil
+}
+
+func writeFile(p string, r io.Reader, perm fs.FileMode, mtime time.Time) error {
+	f, err := os.CreateTemp(filepath.Dir(p), TempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, mtime, mtime)
+	}
+	if err == nil {
+		if fi, lerr := os.Lstat(p); lerr == nil && fi.IsDir() {
+			err = os.RemoveAll(p)
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func replaceSymlink(p, target string) error {
+	if err := os.RemoveAll(p); err != nil {
+		return err
+	}
+	return os.Symlink(target, p)
+}
@@ -0,0 +1,519 @@
+// Package filesync keeps two copies of a directory tree in sync in both directions: the host
+// workspace and its copy on an engine volume in the sandbox, for engines whose bind mounts are slow
+// (macOS, Windows) or can't reach the host at all (remote engines). Each sync compares both sides
+// with the tree as it was after the previous sync, so it can tell which side changed a path; a path
+// changed differently on both sides is a conflict.
+package filesync
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donjaime/airlock/internal/filelock"
+)
+
+// Kind is the type of a tree entry.
+type Kind byte
+
+const (
+	File    Kind = 'f'
+	Dir     Kind = 'd'
+	Symlink Kind = 'l'
+)
+
+// Entry is what a sync compares a path by: its kind, size, and modification time in seconds, the
+// resolution every side can report.
+type Entry struct {
+	Kind  Kind  `json:"k"`
+	Size  int64 `json:"s,omitempty"`
+	MTime int64 `json:"m,omitempty"`
+}
+
+// same reports whether a and b look like the same content. Directories match by kind, and symlinks
+// by kind and size, since not every tar restores a link's own mtime.
+func same(a, b Entry) bool {
+	switch {
+	case a.Kind != b.Kind:
+		return false
+	case a.Kind == Dir:
+		return true
+	case a.Kind == Symlink:
+		return a.Size == b.Size
+	}
+	return a.Size == b.Size && a.MTime == b.MTime
+}
+
+// Tree maps slash-separated paths, relative to the root, to their entries.
+type Tree map[string]Entry
+
+// Side is one copy of the tree.
+type Side interface {
+	// Scan lists the tree, leaving out the paths ignore matches.
+	Scan(ctx context.Context, ignore *Matcher) (Tree, error)
+	// Read writes a tar stream of the files and symlinks at paths to w.
+	Read(ctx context.Context, paths []string, w io.Writer) error
+	// Write extracts a tar stream produced by the other side's Read.
+	Write(ctx context.Context, r io.Reader) error
+	// Mkdir creates directories, with their parents.
+	Mkdir(ctx context.Context, paths []string) error
+	// Remove deletes paths, with everything under them.
+	Remove(ctx context.Context, paths []string) error
+}
+
+// Matcher decides which paths a sync leaves alone. A pattern with a slash matches the path from the
+// root (e.g. "build/out"); one without matches any path element (e.g. "node_modules" or "*.log").
+// Matching a directory leaves out everything under it.
+type Matcher struct {
+	patterns []string
+}
+
+// NewMatcher returns a Matcher for the glob patterns.
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{}
+	for _, p := range patterns {
+		if p = strings.Trim(path.Clean(p), "/"); p != "" && p != "." {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return m
+}
+
+// Patterns returns the cleaned patterns, for a side that filters its own scan.
+func (m *Matcher) Patterns() []string {
+	if m == nil {
+		return nil
+	}
+	return m.patterns
+}
+
+// Match reports whether the slash-separated relative path rel is left alone.
+func (m *Matcher) Match(rel string) bool {
+	if m == nil {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	for _, p := range m.patterns {
+		if !strings.Contains(p, "/") {
+			for _, e := range elems {
+				if ok, _ := path.Match(p, e); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for i := range elems {
+			if ok, _ := path.Match(p, strings.Join(elems[:i+1], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Side names, as recorded in conflicts.
+const (
+	HostSide      = "host"
+	ContainerSide = "container"
+)
+
+// Conflict is a path both sides changed differently since the previous sync.
+type Conflict struct {
+	Path   string    `json:"path"`
+	Winner string    `json:"winner"`         // HostSide or ContainerSide
+	Copy   string    `json:"copy,omitempty"` // where the losing version was kept, on the host
+	At     time.Time `json:"at"`
+}
+
+// copyAs is a losing version of a conflicting file, kept on the host under another name.
+type copyAs struct {
+	from, to string
+}
+
+// Plan is what a sync does to bring both sides to the same tree.
+type Plan struct {
+	ToContainer, ToHost       []string // files and symlinks to copy across
+	MkdirContainer, MkdirHost []string
+	RemoveContainer           []string
+	RemoveHost                []string
+	Conflicts                 []Conflict
+
+	keepHost, keepContainer []copyAs
+	result                  Tree
+}
+
+// Empty reports whether the plan changes nothing.
+func (p *Plan) Empty() bool {
+	return len(p.ToContainer)+len(p.ToHost)+len(p.MkdirContainer)+len(p.MkdirHost)+len(p.RemoveContainer)+len(p.RemoveHost) == 0
+}
+
+// DiffOptions tune Diff.
+type DiffOptions struct {
+	// Prefer is the side whose version wins a conflict: HostSide (the default) or ContainerSide.
+	Prefer string
+	// Protected reports paths the container may not change: the host's version always wins, and
+	// changes made in the container are reverted.
+	Protected func(rel string) bool
+	// Now stamps conflicts and the names of kept copies.
+	Now time.Time
+}
+
+// Diff plans a sync from the tree after the previous sync (base) and both sides' current trees.
+// A deletion never wins over a modification, and a conflict keeps the losing version of a file next
+// to the winner's, on the host.
+func Diff(base, host, ctr Tree, opts DiffOptions) *Plan {
+	p := &Plan{result: Tree{}}
+	paths := map[string]bool{}
+	for _, t := range []Tree{base, host, ctr} {
+		for rel := range t {
+			paths[rel] = true
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for rel := range paths {
+		sorted = append(sorted, rel)
+	}
+	sort.Strings(sorted)
+
+	stamp := opts.Now.Format("20060102-150405")
+	for _, rel := range sorted {
+		b, inBase := base[rel]
+		h, inHost := host[rel]
+		c, inCtr := ctr[rel]
+		hostChanged := inHost != inBase || (inHost && !same(h, b))
+		ctrChanged := inCtr != inBase || (inCtr && !same(c, b))
+		protected := opts.Protected != nil && opts.Protected(rel)
+
+		switch {
+		case !hostChanged && !ctrChanged:
+			if inBase {
+				p.result[rel] = b
+			}
+		case hostChanged && !ctrChanged, !hostChanged && protected:
+			p.toContainer(rel, h, inHost, c, inCtr)
+		case !hostChanged:
+			p.toHost(rel, c, inCtr, h, inHost)
+		case inHost == inCtr && (!inHost || same(h, c)):
+			// Both sides made the same change.
+			if inHost {
+				p.result[rel] = h
+			}
+		default:
+			winner := opts.Prefer
+			switch {
+			case protected:
+				winner = HostSide
+			case !inHost:
+				winner = ContainerSide
+			case !inCtr:
+				winner = HostSide
+			case winner != ContainerSide:
+				winner = HostSide
+			}
+			conflict := Conflict{Path: rel, Winner: winner, At: opts.Now}
+			if winner == HostSide {
+				if inCtr && c.Kind == File && !protected {
+					conflict.Copy = rel + ".conflict-container-" + stamp
+					p.keepContainer = append(p.keepContainer, copyAs{rel, conflict.Copy})
+				}
+				p.toContainer(rel, h, inHost, c, inCtr)
+			} else {
+				if inHost && h.Kind == File {
+					conflict.Copy = rel + ".conflict-host-" + stamp
+					p.keepHost = append(p.keepHost, copyAs{rel, conflict.Copy})
+				}
+				p.toHost(rel, c, inCtr, h, inHost)
+			}
+			p.Conflicts = append(p.Conflicts, conflict)
+		}
+	}
+	p.RemoveContainer = p.keepDirs(p.RemoveContainer)
+	p.RemoveHost = p.keepDirs(p.RemoveHost)
+	return p
+}
+
+// toContainer plans making the container's rel match the host's.
+func (p *Plan) toContainer(rel string, h Entry, inHost bool, c Entry, inCtr bool) {
+	if !inHost {
+		if inCtr {
+			p.RemoveContainer = append(p.RemoveContainer, rel)
+		}
+		return
+	}
+	p.result[rel] = h
+	if inCtr && c.Kind != h.Kind {
+		p.RemoveContainer = append(p.RemoveContainer, rel)
+	}
+	if h.Kind == Dir {
+		if !inCtr || c.Kind != Dir {
+			p.MkdirContainer = append(p.MkdirContainer, rel)
+		}
+		return
+	}
+	p.ToContainer = append(p.ToContainer, rel)
+}
+
+// toHost plans making the host's rel match the container's.
+func (p *Plan) toHost(rel string, c Entry, inCtr bool, h Entry, inHost bool) {
+	if !inCtr {
+		if inHost {
+			p.RemoveHost = append(p.RemoveHost, rel)
+		}
+		return
+	}
+	p.result[rel] = c
+	if inHost && h.Kind != c.Kind {
+		p.RemoveHost = append(p.RemoveHost, rel)
+	}
+	if c.Kind == Dir {
+		if !inHost || h.Kind != Dir {
+			p.MkdirHost = append(p.MkdirHost, rel)
+		}
+		return
+	}
+	p.ToHost = append(p.ToHost, rel)
+}
+
+// keepDirs drops removals of directories that still hold paths the sync keeps, such as a file the
+// host added to a directory the container deleted; removing one deletes everything under it.
+func (p *Plan) keepDirs(removals []string) []string {
+	if len(removals) == 0 {
+		return nil
+	}
+	parents := map[string]bool{}
+	for rel := range p.result {
+		for i := strings.LastIndexByte(rel, '/'); i > 0; i = strings.LastIndexByte(rel[:i], '/') {
+			parents[rel[:i]] = true
+		}
+	}
+	var kept []string
+	for _, rel := range removals {
+		if _, replaced := p.result[rel]; replaced || !parents[rel] {
+			kept = append(kept, rel)
+			continue
+		}
+		p.result[rel] = Entry{Kind: Dir}
+	}
+	return kept
+}
+
+// maxConflicts is how many recent conflicts the status keeps.
+const maxConflicts = 20
+
+// Status is the outcome of the most recent sync, as `airlock sync status` shows it.
+type Status struct {
+	LastSync    time.Time  `json:"lastSync"`
+	LastError   string     `json:"lastError,omitempty"`
+	Files       int        `json:"files"`
+	ToHost      int        `json:"toHost"`      // paths copied or removed on the host by the last sync
+	ToContainer int        `json:"toContainer"` // likewise in the container
+	Conflicts   []Conflict `json:"conflicts,omitempty"`
+}
+
+// state is the tree after the last sync. Generation identifies the container's copy (e.g. the
+// volume's creation time); when it changes, the copy was replaced and the base no longer applies.
+type state struct {
+	Generation string `json:"generation"`
+	Tree       Tree   `json:"tree"`
+}
+
+// Syncer syncs a host directory with the container's copy of it.
+type Syncer struct {
+	Host, Container Side
+	// StateDir holds the base tree, the status, and the lock that serializes syncs.
+	StateDir   string
+	Generation string
+	Ignore     *Matcher
+	Options    DiffOptions
+}
+
+// Sync brings both sides to the same tree, waiting for a sync another process is running.
+func (s *Syncer) Sync(ctx context.Context) (*Plan, error) {
+	release, err := filelock.Lock(filepath.Join(s.StateDir, "sync.lock"))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	plan, err := s.sync(ctx)
+	st, _ := ReadStatus(s.StateDir)
+	if st == nil {
+		st = &Status{}
+	}
+	st.LastSync = time.Now()
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	} else {
+		st.Files = len(plan.result)
+		st.ToHost = len(plan.ToHost) + len(plan.MkdirHost) + len(plan.RemoveHost)
+		st.ToContainer = len(plan.ToContainer) + len(plan.MkdirContainer) + len(plan.RemoveContainer)
+		st.Conflicts = append(st.Conflicts, plan.Conflicts...)
+		if n := len(st.Conflicts); n > maxConflicts {
+			st.Conflicts = st.Conflicts[n-maxConflicts:]
+		}
+	}
+	if werr := writeJSON(filepath.Join(s.StateDir, "status.json"), st); werr != nil && err == nil {
+		err = werr
+	}
+	return plan, err
+}
+
+func (s *Syncer) sync(ctx context.Context) (*Plan, error) {
+	var base state
+	if b, err := os.ReadFile(filepath.Join(s.StateDir, "base.json")); err == nil {
+		if err := json.Unmarshal(b, &base); err != nil {
+			return nil, fmt.Errorf("failed to read the sync state: %w", err)
+		}
+	}
+	if base.Generation != s.Generation {
+		base = state{Generation: s.Generation}
+	}
+	host, err := s.Host.Scan(ctx, s.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the host workspace: %w", err)
+	}
+	ctr, err := s.Container.Scan(ctx, s.Ignore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the container workspace: %w", err)
+	}
+	if len(base.Tree) > 0 && (len(host) == 0 || len(ctr) == 0) {
+		// A side that suddenly has nothing was far more likely replaced than emptied on purpose;
+		// syncing from scratch copies the other side over instead of deleting everything there.
+		base.Tree = nil
+	}
+	opts := s.Options
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	plan := Diff(base.Tree, host, ctr, opts)
+	if err := s.apply(ctx, plan); err != nil {
+		return nil, err
+	}
+	base.Tree = plan.result
+	return plan, writeJSON(filepath.Join(s.StateDir, "base.json"), &base)
+}
+
+// apply carries out plan: kept copies first, then removals, new directories, and copies.
+func (s *Syncer) apply(ctx context.Context, plan *Plan) error {
+	for _, k := range plan.keepHost {
+		if err := keepCopy(ctx, s.Host, s.Host, k); err != nil {
+			return fmt.Errorf("failed to keep the host's version of %s: %w", k.from, err)
+		}
+	}
+	for _, k := range plan.keepContainer {
+		if err := keepCopy(ctx, s.Container, s.Host, k); err != nil {
+			return fmt.Errorf("failed to keep the container's version of %s: %w", k.from, err)
+		}
+	}
+	steps := []struct {
+		paths []string
+		run   func(context.Context, []string) error
+	}{
+		{plan.RemoveHost, s.Host.Remove},
+		{plan.RemoveContainer, s.Container.Remove},
+		{plan.MkdirHost, s.Host.Mkdir},
+		{plan.MkdirContainer, s.Container.Mkdir},
+		{plan.ToHost, func(ctx context.Context, paths []string) error { return transfer(ctx, s.Container, s.Host, paths) }},
+		{plan.ToContainer, func(ctx context.Context, paths []string) error { return transfer(ctx, s.Host, s.Container, paths) }},
+	}
+	for _, step := range steps {
+		if len(step.paths) == 0 {
+			continue
+		}
+		if err := step.run(ctx, step.paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transfer copies paths from one side to the other, streaming the tar between them.
+func transfer(ctx context.Context, from, to Side, paths []string) error {
+	pr, pw := io.Pipe()
+	readErr := make(chan error, 1)
+	go func() {
+		err := from.Read(ctx, paths, pw)
+		pw.CloseWithError(err)
+		readErr <- err
+	}()
+	err := to.Write(ctx, pr)
+	pr.CloseWithError(errors.New("the receiving side stopped reading"))
+	if rerr := <-readErr; rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// keepCopy copies k.from on one side to k.to on the other (or the same) side.
+func keepCopy(ctx context.Context, from, to Side, k copyAs) error {
+	var in bytes.Buffer
+	if err := from.Read(ctx, []string{k.from}, &in); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	tr, tw := tar.NewReader(&in), tar.NewWriter(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if strings.Trim(hdr.Name, "/") == k.from {
+			hdr.Name = k.to
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return to.Write(ctx, &out)
+}
+
+// ReadStatus returns the status of the most recent sync recorded in stateDir, or nil if there was
+// none.
+func ReadStatus(stateDir string) (*Status, error) {
+	b, err := os.ReadFile(filepath.Join(stateDir, "status.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st Status
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func writeJSON(p string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,251 @@
+package filesync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatcher(t *testing.T) {
+	m := NewMatcher([]string{"node_modules", "*.log", "build/out/"})
+	cases := map[string]bool{
+		"node_modules":           true,
+		"web/node_modules/react": true,
+		"debug.log":              true,
+		"logs/app.log":           true,
+		"build/out":              true,
+		"build/out/bin":          true,
+		"src/build/out":          false,
+		"build/output":           false,
+		"src/main.go":            false,
+	}
+	for rel, want := range cases {
+		if got := m.Match(rel); got != want {
+			t.Errorf("Match(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	f := func(size, mtime int64) Entry { return Entry{Kind: File, Size: size, MTime: mtime} }
+	base := Tree{
+		"same":       f(1, 1),
+		"hostEdit":   f(1, 1),
+		"ctrEdit":    f(1, 1),
+		"both":       f(1, 1),
+		"hostDel":    f(1, 1),
+		"delVsEdit":  f(1, 1),
+		"d":          {Kind: Dir},
+		"d/old":      f(1, 1),
+		"protected":  f(1, 1),
+		"kind":       f(1, 1),
+		"sameChange": f(1, 1),
+	}
+	host := Tree{
+		"same":       f(1, 1),
+		"hostEdit":   f(2, 2),
+		"ctrEdit":    f(1, 1),
+		"both":       f(2, 2),
+		"delVsEdit":  f(2, 2),
+		"d/new":      f(1, 3),
+		"d":          {Kind: Dir},
+		"d/old":      f(1, 1),
+		"protected":  f(1, 1),
+		"kind":       {Kind: Dir},
+		"kind/a":     f(1, 1),
+		"sameChange": f(3, 3),
+		"hostNew":    f(1, 1),
+	}
+	ctr := Tree{
+		"same":       f(1, 1),
+		"hostEdit":   f(1, 1),
+		"ctrEdit":    f(3, 3),
+		"both":       f(3, 3),
+		"hostDel":    f(1, 1),
+		"protected":  f(9, 9),
+		"kind":       f(1, 1),
+		"sameChange": f(3, 3),
+		"ctrNew":     f(1, 1),
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := Diff(base, host, ctr, DiffOptions{
+		Now:       now,
+		Protected: func(rel string) bool { return rel == "protected" },
+	})
+
+	check := func(name string, got []string, want ...string) {
+		t.Helper()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	// "d" was deleted in the container, but keeps the file the host added to it.
+	check("ToContainer", p.ToContainer, "both", "d/new", "delVsEdit", "hostEdit", "hostNew", "kind/a", "protected")
+	check("ToHost", p.ToHost, "ctrEdit", "ctrNew")
+	check("RemoveContainer", p.RemoveContainer, "hostDel", "kind")
+	check("RemoveHost", p.RemoveHost, "d/old")
+	check("MkdirContainer", p.MkdirContainer, "kind")
+	check("MkdirHost", p.MkdirHost)
+	if len(p.Conflicts) != 2 || p.Conflicts[0].Path != "both" || p.Conflicts[1].Path != "delVsEdit" {
+		t.Fatalf("expected conflicts on both and delVsEdit, got %+v", p.Conflicts)
+	}
+	if c := p.Conflicts[0]; c.Winner != HostSide || c.Copy != "both.conflict-container-20240102-030405" {
+		t.Errorf("unexpected conflict %+v", c)
+	}
+	if c := p.Conflicts[1]; c.Winner != HostSide || c.Copy != "" {
+		t.Errorf("a deletion should lose to an edit without a kept copy, got %+v", c)
+	}
+
+	p = Diff(base, host, ctr, DiffOptions{Now: now, Prefer: ContainerSide})
+	if c := p.Conflicts[0]; c.Path != "both" || c.Winner != ContainerSide || c.Copy != "both.conflict-host-20240102-030405" {
+		t.Errorf("expected the container to win, got %+v", c)
+	}
+}
+
+func writeTestFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, p string) string {
+	t.Helper()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSync(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-filesync-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostDir, ctrDir := filepath.Join(dir, "host"), filepath.Join(dir, "ctr")
+	if err := os.MkdirAll(ctrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(hostDir, "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(hostDir, "pkg", "lib.go"), "package pkg\n")
+	writeTestFile(t, filepath.Join(hostDir, "node_modules", "dep.js"), "x")
+	writeTestFile(t, filepath.Join(hostDir, ".airlock", "state", "x"), "x")
+	if err := os.Symlink("main.go", filepath.Join(hostDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Syncer{
+		Host:       LocalDir{Root: hostDir},
+		Container:  LocalDir{Root: ctrDir},
+		StateDir:   filepath.Join(dir, "state"),
+		Generation: "1",
+		Ignore:     NewMatcher([]string{"node_modules"}),
+	}
+	ctx := context.Background()
+	if _, err := s.Sync(ctx); err != nil {
+		t.Fatalf("first Sync failed: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(ctrDir, "pkg", "lib.go")); got != "package pkg\n" {
+		t.Errorf("unexpected pkg/lib.go in the container: %q", got)
+	}
+	if target, err := os.Readlink(filepath.Join(ctrDir, "link")); err != nil || target != "main.go" {
+		t.Errorf("expected the symlink to be copied, got %q (%v)", target, err)
+	}
+	for _, rel := range []string{"node_modules", ".airlock"} {
+		if _, err := os.Stat(filepath.Join(ctrDir, rel)); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be synced, got %v", rel, err)
+		}
+	}
+
+	// Changes on both sides flow the other way; an edit on both is a conflict the host wins.
+	later := time.Now().Add(time.Hour)
+	writeTestFile(t, filepath.Join(ctrDir, "out.txt"), "generated")
+	writeTestFile(t, filepath.Join(ctrDir, "main.go"), "package main // container\n")
+	os.Chtimes(filepath.Join(ctrDir, "main.go"), later, later)
+	writeTestFile(t, filepath.Join(hostDir, "main.go"), "package main // host\n")
+	if err := os.RemoveAll(filepath.Join(hostDir, "pkg")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatalf("second Sync failed: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(hostDir, "out.txt")); got != "generated" {
+		t.Errorf("unexpected out.txt on the host: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(ctrDir, "pkg")); !os.IsNotExist(err) {
+		t.Errorf("expected pkg to be removed in the container, got %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(ctrDir, "main.go")); got != "package main // host\n" {
+		t.Errorf("expected the host's main.go to win, got %q", got)
+	}
+	if len(p.Conflicts) != 1 || p.Conflicts[0].Copy == "" {
+		t.Fatalf("expected one conflict with a kept copy, got %+v", p.Conflicts)
+	}
+	if got := readTestFile(t, filepath.Join(hostDir, p.Conflicts[0].Copy)); got != "package main // container\n" {
+		t.Errorf("expected the container's version to be kept, got %q", got)
+	}
+
+	st, err := ReadStatus(s.StateDir)
+	if err != nil || st == nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if st.LastError != "" || len(st.Conflicts) != 1 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	// The kept copy reaches the container, and then nothing is left to do.
+	if _, err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = s.Sync(ctx); err != nil || !p.Empty() {
+		t.Errorf("expected a no-op sync, got %+v (%v)", p, err)
+	}
+
+	// A replaced container copy starts over rather than deleting the host's files.
+	if err := os.RemoveAll(ctrDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(ctrDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(ctrDir, "out.txt")); got != "generated" {
+		t.Errorf("expected the host's files to be copied into the new container copy, got %q", got)
+	}
+}
+
+func TestLocalDirRefusesEscapes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-filesync-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	writeTestFile(t, filepath.Join(outside, "keep"), "x")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	d := LocalDir{Root: root}
+	for _, rel := range []string{"link/keep", "../outside/keep", ".airlock/state"} {
+		if err := d.Remove(context.Background(), []string{rel}); err == nil {
+			t.Errorf("expected removing %q to be refused", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "keep")); err != nil {
+		t.Errorf("expected the file outside the tree to survive, got %v", err)
+	}
+}
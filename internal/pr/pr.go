@@ -0,0 +1,159 @@
+// Package pr publishes the sandbox's committed work from the host: it pushes a branch with the
+// host's git credentials and opens a pull (or merge) request with gh or glab, so the sandbox itself
+// never needs push rights.
+package pr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Forge is a git hosting service with a CLI for opening pull requests.
+type Forge string
+
+const (
+	GitHub Forge = "github" // via gh
+	GitLab Forge = "gitlab" // via glab
+)
+
+// Options describe the pull request to open.
+type Options struct {
+	Remote string // default "origin"
+	Base   string // target branch; default: the remote's default branch
+	Branch string // branch to push; default: the current branch, or a new airlock/ branch when on Base
+	Title  string // default: filled from the commits
+	Draft  bool
+}
+
+// Repo is the git working tree the sandbox works in.
+type Repo struct {
+	Dir string
+}
+
+// Open publishes the commits on the current HEAD that aren't on the base branch and opens a pull
+// request for them. It returns the branch that was pushed.
+func (r *Repo) Open(ctx context.Context, project string, opts Options, now time.Time) (string, error) {
+	if opts.Remote == "" {
+		opts.Remote = "origin"
+	}
+	remoteURL, err := r.git(ctx, "remote", "get-url", opts.Remote)
+	if err != nil {
+		return "", fmt.Errorf("no git remote %q: %w", opts.Remote, err)
+	}
+	forge, err := DetectForge(remoteURL)
+	if err != nil {
+		return "", err
+	}
+	if opts.Base == "" {
+		opts.Base = r.defaultBranch(ctx, opts.Remote)
+	}
+
+	if _, err := r.git(ctx, "fetch", "--quiet", opts.Remote, opts.Base); err != nil {
+		return "", err
+	}
+	ahead, err := r.git(ctx, "rev-list", "--count", opts.Remote+"/"+opts.Base+"..HEAD")
+	if err != nil {
+		return "", err
+	}
+	if ahead == "0" {
+		return "", fmt.Errorf("HEAD has no commits that aren't on %s/%s; nothing to propose", opts.Remote, opts.Base)
+	}
+	if dirty, _ := r.git(ctx, "status", "--porcelain", "--untracked-files=no"); dirty != "" {
+		fmt.Fprintln(os.Stderr, "warning: uncommitted changes in the workspace are not part of the pull request")
+	}
+
+	if opts.Branch == "" {
+		current, _ := r.git(ctx, "symbolic-ref", "--quiet", "--short", "HEAD")
+		opts.Branch = current
+		if current == "" || current == opts.Base {
+			opts.Branch = BranchName(project, now)
+			if _, err := r.git(ctx, "branch", opts.Branch, "HEAD"); err != nil {
+				return "", err
+			}
+		}
+	}
+	if opts.Branch == opts.Base {
+		return "", fmt.Errorf("refusing to open a pull request from %s into itself", opts.Base)
+	}
+
+	if err := r.run(ctx, "git", "-C", r.Dir, "push", "--set-upstream", opts.Remote, "HEAD:refs/heads/"+opts.Branch); err != nil {
+		return "", fmt.Errorf("push failed: %w", err)
+	}
+	return opts.Branch, r.run(ctx, forgeCommand(forge, opts)...)
+}
+
+// DetectForge infers the hosting service from a remote URL.
+func DetectForge(remoteURL string) (Forge, error) {
+	switch u := strings.ToLower(remoteURL); {
+	case strings.Contains(u, "github"):
+		return GitHub, nil
+	case strings.Contains(u, "gitlab"):
+		return GitLab, nil
+	}
+	return "", fmt.Errorf("can't tell whether %s is GitHub or GitLab", remoteURL)
+}
+
+// BranchName returns the name of a fresh branch for the sandbox's work.
+func BranchName(project string, now time.Time) string {
+	return "airlock/" + project + "-" + now.UTC().Format("20060102-150405")
+}
+
+func forgeCommand(f Forge, opts Options) []string {
+	if f == GitLab {
+		cmd := []string{"glab", "mr", "create", "--source-branch", opts.Branch, "--target-branch", opts.Base, "--yes"}
+		if opts.Title != "" {
+			cmd = append(cmd, "--title", opts.Title, "--description", "")
+		} else {
+			cmd = append(cmd, "--fill")
+		}
+		if opts.Draft {
+			cmd = append(cmd, "--draft")
+		}
+		return cmd
+	}
+	cmd := []string{"gh", "pr", "create", "--head", opts.Branch, "--base", opts.Base}
+	if opts.Title != "" {
+		cmd = append(cmd, "--title", opts.Title, "--body", "")
+	} else {
+		cmd = append(cmd, "--fill")
+	}
+	if opts.Draft {
+		cmd = append(cmd, "--draft")
+	}
+	return cmd
+}
+
+// defaultBranch returns the remote's default branch, falling back to main.
+func (r *Repo) defaultBranch(ctx context.Context, remote string) string {
+	ref, err := r.git(ctx, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil || ref == "" {
+		return "main"
+	}
+	return strings.TrimPrefix(ref, remote+"/")
+}
+
+func (r *Repo) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.Dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// run runs a command in the repo with the terminal attached, so the host's credential prompts work.
+func (r *Repo) run(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = r.Dir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
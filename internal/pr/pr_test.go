@@ -0,0 +1,44 @@
+package pr
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectForge(t *testing.T) {
+	for url, want := range map[string]Forge{
+		"git@github.com:acme/app.git":            GitHub,
+		"https://github.example.com/acme/app":    GitHub,
+		"https://gitlab.com/acme/app.git":        GitLab,
+		"ssh://git@gitlab.internal:2222/a/b.git": GitLab,
+	} {
+		got, err := DetectForge(url)
+		if err != nil || got != want {
+			t.Errorf("DetectForge(%q) = %q, %v; want %q", url, got, err, want)
+		}
+	}
+	if _, err := DetectForge("https://bitbucket.org/acme/app.git"); err == nil {
+		t.Errorf("expected an error for an unknown forge")
+	}
+}
+
+func TestForgeCommand(t *testing.T) {
+	opts := Options{Branch: "airlock/x", Base: "main", Draft: true}
+	gh := strings.Join(forgeCommand(GitHub, opts), " ")
+	if gh != "gh pr create --head airlock/x --base main --fill --draft" {
+		t.Errorf("unexpected gh command: %s", gh)
+	}
+	opts.Title = "Fix it"
+	glab := strings.Join(forgeCommand(GitLab, opts), " ")
+	if !strings.HasPrefix(glab, "glab mr create --source-branch airlock/x --target-branch main") || !strings.Contains(glab, "--title Fix it") {
+		t.Errorf("unexpected glab command: %s", glab)
+	}
+}
+
+func TestBranchName(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if got := BranchName("demo", now); got != "airlock/demo-20240506-070809" {
+		t.Errorf("unexpected branch name %q", got)
+	}
+}
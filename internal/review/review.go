@@ -0,0 +1,203 @@
+// Package review computes what the sandbox changed in a git workspace since a recorded baseline and
+// reverts selected files or hunks, as a final human gate on agent output.
+package review
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// BasePath is where the reviewed baseline (a git tree ID) is recorded.
+func BasePath(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "state", "review-base")
+}
+
+// FileDiff is one changed file between the baseline and the current workspace.
+type FileDiff struct {
+	Path   string
+	Status string // "added", "modified", or "deleted"
+	Binary bool
+	Header string   // diff header lines, up to the first hunk
+	Hunks  []string // each hunk including its @@ line
+}
+
+// Workspace is a git working tree under review.
+type Workspace struct {
+	Top string // repository top level
+}
+
+// Open finds the git repository containing dir.
+func Open(ctx context.Context, dir string) (*Workspace, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not inside a git repository (review compares against git)", dir)
+	}
+	return &Workspace{Top: strings.TrimSpace(string(out))}, nil
+}
+
+// Snapshot records the full current workspace (tracked and untracked, honoring .gitignore) as a git
+// tree without touching the real index, HEAD, or any branch, and returns the tree ID.
+func (w *Workspace) Snapshot(ctx context.Context) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "airlock-review-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	index := filepath.Join(tmpDir, "index")
+
+	// Start from the real index so unchanged files are not rehashed.
+	if idx, err := w.git(ctx, nil, "rev-parse", "--git-path", "index"); err == nil {
+		p := strings.TrimSpace(idx)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(w.Top, p)
+		}
+		if b, err := os.ReadFile(p); err == nil {
+			_ = os.WriteFile(index, b, 0600)
+		}
+	}
+	env := []string{"GIT_INDEX_FILE=" + index}
+	// airlock's own state is never part of the review, even if it isn't gitignored.
+	if _, err := w.git(ctx, env, "add", "-A", "--", ".", ":(exclude,glob)**/.airlock/**"); err != nil {
+		return "", err
+	}
+	tree, err := w.git(ctx, env, "write-tree")
+	return strings.TrimSpace(tree), err
+}
+
+// Base returns the recorded baseline tree, or HEAD's tree when none was recorded.
+func (w *Workspace) Base(ctx context.Context, absProjectDir string) (string, error) {
+	if b, err := os.ReadFile(BasePath(absProjectDir)); err == nil && len(bytes.TrimSpace(b)) > 0 {
+		tree := strings.TrimSpace(string(b))
+		// Baseline trees are unreferenced objects, so `git gc` may eventually prune them.
+		if _, err := w.git(ctx, nil, "cat-file", "-e", tree); err != nil {
+			return "", fmt.Errorf("review baseline %s no longer exists in the repository (run: airlock review --mark)", tree)
+		}
+		return tree, nil
+	}
+	tree, err := w.git(ctx, nil, "rev-parse", "HEAD^{tree}")
+	if err != nil {
+		return "", fmt.Errorf("no review baseline recorded and no HEAD commit (run: airlock review --mark)")
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// Mark records the current workspace as the reviewed baseline.
+func (w *Workspace) Mark(ctx context.Context, absProjectDir string) (string, error) {
+	tree, err := w.Snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(BasePath(absProjectDir)), 0700); err != nil {
+		return "", err
+	}
+	return tree, os.WriteFile(BasePath(absProjectDir), []byte(tree+"\n"), 0600)
+}
+
+// Stat returns a `git diff --stat` summary between base and current.
+func (w *Workspace) Stat(ctx context.Context, base, current string) (string, error) {
+	return w.git(ctx, nil, "diff", "--stat", base, current)
+}
+
+// Changes returns per-file diffs between the base and current trees.
+func (w *Workspace) Changes(ctx context.Context, base, current string) ([]FileDiff, error) {
+	out, err := w.git(ctx, nil, "diff", "--no-color", "--no-ext-diff", "--no-renames", base, current)
+	if err != nil {
+		return nil, err
+	}
+	return parseDiff(out), nil
+}
+
+// RevertHunks reverts the selected hunks of f in the working tree.
+func (w *Workspace) RevertHunks(ctx context.Context, f FileDiff, hunks []int) error {
+	if len(hunks) == 0 {
+		return nil
+	}
+	patch := f.Header
+	for _, i := range hunks {
+		patch += f.Hunks[i]
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", w.Top, "apply", "-R", "--whitespace=nowarn", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to revert hunks in %s: %s", f.Path, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RevertFile restores f to its baseline content, removing it if the sandbox created it.
+func (w *Workspace) RevertFile(ctx context.Context, base string, f FileDiff) error {
+	abs := filepath.Join(w.Top, filepath.FromSlash(f.Path))
+	if f.Status == "added" {
+		return os.Remove(abs)
+	}
+	content, err := exec.CommandContext(ctx, "git", "-C", w.Top, "cat-file", "blob", base+":"+f.Path).Output()
+	if err != nil {
+		return fmt.Errorf("failed to read baseline %s: %w", f.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if strings.Contains(f.Header, "100755") {
+		mode = 0755
+	}
+	return os.WriteFile(abs, content, mode)
+}
+
+func (w *Workspace) git(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", w.Top}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// parseDiff splits unified git diff output into files and hunks.
+func parseDiff(out string) []FileDiff {
+	var files []FileDiff
+	var cur *FileDiff
+	inHunks := false
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "diff --git ") {
+			files = append(files, FileDiff{Status: "modified"})
+			cur = &files[len(files)-1]
+			inHunks = false
+			// "diff --git a/<path> b/<path>"
+			if i := strings.Index(line, " b/"); i >= 0 {
+				cur.Path = strings.TrimSpace(line[i+3:])
+			}
+		}
+		if cur == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunks = true
+			cur.Hunks = append(cur.Hunks, line)
+			continue
+		case inHunks:
+			cur.Hunks[len(cur.Hunks)-1] += line
+			continue
+		case strings.HasPrefix(line, "new file mode"):
+			cur.Status = "added"
+		case strings.HasPrefix(line, "deleted file mode"):
+			cur.Status = "deleted"
+		case strings.HasPrefix(line, "Binary files"):
+			cur.Binary = true
+		}
+		cur.Header += line
+	}
+	return files
+}
@@ -0,0 +1,95 @@
+package review
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestReviewRevert(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir, err := os.MkdirTemp("", "airlock-review-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	write("a.txt", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	write("b.txt", "keep\n")
+
+	w, err := Open(ctx, dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	project := filepath.Join(dir, "project")
+	if _, err := w.Mark(ctx, project); err != nil {
+		t.Fatalf("Mark failed: %v", err)
+	}
+
+	// Two separate hunks in a.txt, a deleted file, and a new file.
+	write("a.txt", "1 changed\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12 changed\n")
+	os.Remove(filepath.Join(dir, "b.txt"))
+	write("new.txt", "agent output\n")
+
+	base, err := w.Base(ctx, project)
+	if err != nil {
+		t.Fatalf("Base failed: %v", err)
+	}
+	current, err := w.Snapshot(ctx)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	changes, err := w.Changes(ctx, base, current)
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	byPath := map[string]FileDiff{}
+	for _, c := range changes {
+		byPath[c.Path] = c
+	}
+	if len(byPath) != 3 || byPath["new.txt"].Status != "added" || byPath["b.txt"].Status != "deleted" {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	a := byPath["a.txt"]
+	if len(a.Hunks) != 2 {
+		t.Fatalf("expected 2 hunks in a.txt, got %d", len(a.Hunks))
+	}
+
+	// Keep the first hunk, revert the second.
+	if err := w.RevertHunks(ctx, a, []int{1}); err != nil {
+		t.Fatalf("RevertHunks failed: %v", err)
+	}
+	got, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(got) != "1 changed\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n" {
+		t.Errorf("unexpected a.txt after hunk revert: %q", got)
+	}
+
+	for _, f := range []string{"b.txt", "new.txt"} {
+		if err := w.RevertFile(ctx, base, byPath[f]); err != nil {
+			t.Fatalf("RevertFile(%s) failed: %v", f, err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "b.txt")); string(got) != "keep\n" {
+		t.Errorf("expected b.txt restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected new.txt removed")
+	}
+}
@@ -0,0 +1,152 @@
+// Package sanitize turns terminal-oriented program output into plain text for logs and JSON: it
+// strips ANSI escape sequences and other control characters, turns carriage returns into newlines,
+// and replaces bytes that aren't valid UTF-8.
+package sanitize
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+const esc = 0x1b
+
+type state int
+
+const (
+	stateText      state = iota
+	stateEsc             // after ESC
+	stateCSI             // in ESC [ ... final byte
+	stateString          // in ESC ] (OSC), P (DCS), or similar, until BEL or ESC \
+	stateStringEsc       // ESC inside a string, possibly its terminator
+)
+
+// Writer sanitizes what is written to it and passes it on to an underlying writer. Escape sequences
+// and UTF-8 sequences may be split across writes; call Flush after the last write.
+type Writer struct {
+	w     io.Writer
+	state state
+	cr    bool   // the previous byte was \r
+	part  []byte // an incomplete UTF-8 sequence from the previous write
+}
+
+// NewWriter returns a Writer that writes sanitized text to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (s *Writer) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	s.sanitize(&out, p)
+	if out.Len() > 0 {
+		if _, err := s.w.Write(out.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes out what is held back waiting for the rest of a sequence.
+func (s *Writer) Flush() error {
+	var out bytes.Buffer
+	if len(s.part) > 0 {
+		out.WriteRune(utf8.RuneError)
+		s.part = nil
+	}
+	if s.cr {
+		out.WriteByte('\n')
+		s.cr = false
+	}
+	s.state = stateText
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := s.w.Write(out.Bytes())
+	return err
+}
+
+func (s *Writer) sanitize(out *bytes.Buffer, p []byte) {
+	if len(s.part) > 0 {
+		p = append(s.part, p...)
+		s.part = nil
+	}
+	for i := 0; i < len(p); {
+		c := p[i]
+		switch s.state {
+		case stateEsc:
+			switch c {
+			case '[':
+				s.state = stateCSI
+			case ']', 'P', 'X', '^', '_':
+				s.state = stateString
+			default:
+				s.state = stateText // a two-byte sequence such as ESC 7
+			}
+			i++
+			continue
+		case stateCSI:
+			if c >= 0x40 && c <= 0x7e {
+				s.state = stateText
+			}
+			i++
+			continue
+		case stateString:
+			switch c {
+			case 0x07:
+				s.state = stateText
+			case esc:
+				s.state = stateStringEsc
+			}
+			i++
+			continue
+		case stateStringEsc:
+			s.state = stateString
+			if c == '\\' {
+				s.state = stateText
+			}
+			i++
+			continue
+		}
+
+		if s.cr && c != '\n' {
+			// A lone \r redraws the line (progress bars); keep each redraw as its own line.
+			out.WriteByte('\n')
+		}
+		s.cr = false
+		switch {
+		case c == esc:
+			s.state = stateEsc
+		case c == '\r':
+			s.cr = true
+		case c == '\n' || c == '\t':
+			out.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			// Other control characters (bell, backspace, ...) are dropped.
+		case c < utf8.RuneSelf:
+			out.WriteByte(c)
+		default:
+			if !utf8.FullRune(p[i:]) {
+				s.part = append([]byte(nil), p[i:]...)
+				return
+			}
+			r, size := utf8.DecodeRune(p[i:])
+			if r == utf8.RuneError && size == 1 {
+				out.WriteRune(utf8.RuneError)
+			} else {
+				out.Write(p[i : i+size])
+			}
+			i += size
+			continue
+		}
+		i++
+	}
+}
+
+// Text returns b sanitized.
+func Text(b []byte) string {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.Write(b)
+	w.Flush()
+	return out.String()
+}
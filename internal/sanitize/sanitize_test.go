@@ -0,0 +1,44 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain\n", "plain\n"},
+		{"\x1b[1;32mok\x1b[0m done\n", "ok done\n"},
+		{"\x1b]0;title\x07text", "text"},
+		{"\x1b]8;;http://x\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"10%\r50%\r100%\n", "10%\n50%\n100%\n"},
+		{"windows\r\nline\r\n", "windows\nline\n"},
+		{"bell\x07 back\x08space\ttab", "bell backspace\ttab"},
+		{"bad \xff byte", "bad � byte"},
+		{"truncated \xe2\x82", "truncated �"},
+		{"héllo ✓", "héllo ✓"},
+	}
+	for _, c := range cases {
+		if got := Text([]byte(c.in)); got != c.want {
+			t.Errorf("Text(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestWriterSplitWrites(t *testing.T) {
+	in := "\x1b[31mred\x1b[0m ✓ done\r\nnext\r"
+	for split := 1; split < len(in); split++ {
+		var out strings.Builder
+		w := NewWriter(&out)
+		w.Write([]byte(in[:split]))
+		w.Write([]byte(in[split:]))
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := out.String(), "red ✓ done\nnext\n"; got != want {
+			t.Errorf("split at %d: got %q, want %q", split, got, want)
+		}
+	}
+}
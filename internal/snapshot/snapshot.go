@@ -0,0 +1,184 @@
+// Package snapshot keeps incremental, hardlink-based snapshots of a directory tree (rsync --link-dest
+// style): files unchanged since the previous snapshot are hardlinked to it instead of copied.
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HomeDir is where snapshots of the project's home dir are kept.
+func HomeDir(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "snapshots", "home")
+}
+
+// List returns snapshot names in root, oldest first.
+func List(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasSuffix(e.Name(), ".partial") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Create snapshots src into a new timestamped dir under root and returns its name.
+func Create(src, root string, now time.Time) (string, error) {
+	names, err := List(root)
+	if err != nil {
+		return "", err
+	}
+	prev := ""
+	if len(names) > 0 {
+		prev = filepath.Join(root, names[len(names)-1])
+	}
+
+	name := now.UTC().Format("20060102-150405")
+	for i := 1; contains(names, name); i++ {
+		name = fmt.Sprintf("%s.%d", now.UTC().Format("20060102-150405"), i)
+	}
+	dest := filepath.Join(root, name)
+	tmp := dest + ".partial"
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", err
+	}
+	_ = os.RemoveAll(tmp)
+
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(tmp, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if prev != "" && unchanged(filepath.Join(prev, rel), info) {
+				if os.Link(filepath.Join(prev, rel), target) == nil {
+					return nil
+				}
+			}
+			return copyFile(p, target, info)
+		}
+		// Sockets, fifos and devices are not worth preserving.
+		return nil
+	})
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Restore replaces the contents of dst with the snapshot name from root. Files are copied, never
+// linked, so later writes to dst can't alter any snapshot. dst itself is kept, so a container with
+// it bind-mounted keeps seeing it.
+func Restore(dst, root, name string) error {
+	snap := filepath.Join(root, name)
+	if fi, err := os.Stat(snap); err != nil || !fi.IsDir() {
+		return fmt.Errorf("snapshot %s not found", name)
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return filepath.WalkDir(snap, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(snap, p)
+		if rel == "." {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(p, target, info)
+		}
+	})
+}
+
+// unchanged reports whether the previous snapshot's copy of a file can be reused for info.
+func unchanged(prevPath string, info fs.FileInfo) bool {
+	pi, err := os.Lstat(prevPath)
+	if err != nil || !pi.Mode().IsRegular() {
+		return false
+	}
+	return pi.Size() == info.Size() && pi.ModTime().Equal(info.ModTime()) && pi.Mode() == info.Mode()
+}
+
+func copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Keep mtimes so the next snapshot can detect unchanged files.
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
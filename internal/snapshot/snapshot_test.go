@@ -0,0 +1,81 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateAndRestore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "airlock-snapshot-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	home := filepath.Join(dir, "home")
+	root := filepath.Join(dir, "snapshots")
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("export A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".config", "tool"), []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	first, err := Create(home, root, now)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Change one file and add another; the untouched file should be hardlinked, not copied.
+	if err := os.WriteFile(filepath.Join(home, ".config", "tool"), []byte("v2-changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "junk"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second, err := Create(home, root, now)
+	if err != nil {
+		t.Fatalf("second Create failed: %v", err)
+	}
+	if second == first {
+		t.Fatalf("expected distinct snapshot names, got %q twice", first)
+	}
+	a, _ := os.Stat(filepath.Join(root, first, ".bashrc"))
+	b, _ := os.Stat(filepath.Join(root, second, ".bashrc"))
+	if !os.SameFile(a, b) {
+		t.Errorf("expected unchanged .bashrc to be hardlinked between snapshots")
+	}
+
+	names, err := List(root)
+	if err != nil || len(names) != 2 {
+		t.Fatalf("expected 2 snapshots, got %v (%v)", names, err)
+	}
+
+	if err := Restore(home, root, first); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(home, ".config", "tool")); string(got) != "v1" {
+		t.Errorf("expected restored tool config v1, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, "junk")); !os.IsNotExist(err) {
+		t.Errorf("expected junk to be removed by restore")
+	}
+
+	// Writing to the restored home must not alter the snapshot.
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, first, ".bashrc")); string(got) != "export A=1\n" {
+		t.Errorf("snapshot was modified through the restored home: %q", got)
+	}
+
+	if err := Restore(home, root, "missing"); err == nil {
+		t.Errorf("expected error restoring a missing snapshot")
+	}
+}
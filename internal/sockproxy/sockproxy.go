@@ -0,0 +1,545 @@
+// Package sockproxy is a filtering proxy for the Docker engine API (as served by docker and by
+// podman's compatibility socket). The sandbox talks to the proxy instead of the raw engine socket,
+// which would be equivalent to root on the host: it may pull, build, and run allowlisted images and
+// manage the containers it created, but privileged or host-touching requests are refused.
+package sockproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy decides which images the sandbox may use through the proxy.
+type Policy struct {
+	// Images are glob patterns (path.Match) over normalized references such as
+	// "docker.io/library/postgres:16" or "ghcr.io/acme/*:*". Short names are normalized first,
+	// so "postgres:*" matches docker.io/library/postgres with any tag.
+	Images []string
+}
+
+// AllowImage reports whether ref matches one of the policy's patterns.
+func (p Policy) AllowImage(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	norm := NormalizeImage(ref)
+	for _, pat := range p.Images {
+		if ok, _ := path.Match(NormalizeImage(pat), norm); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeImage expands a short image reference to registry/namespace/name:tag form.
+func NormalizeImage(ref string) string {
+	name, digest, hasDigest := strings.Cut(ref, "@")
+	first, _, hasSlash := strings.Cut(name, "/")
+	if !hasSlash || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		if !hasSlash {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	if i := strings.LastIndex(name, ":"); i < 0 || strings.Contains(name[i:], "/") {
+		if !hasDigest {
+			name += ":latest"
+		}
+	}
+	if hasDigest {
+		return name + "@" + digest
+	}
+	return name
+}
+
+// Proxy forwards permitted engine API requests to the upstream engine socket.
+type Proxy struct {
+	Upstream string // path of the real engine socket
+	Policy   Policy
+
+	mu       sync.Mutex
+	owned    map[string]bool // IDs and names of containers created through the proxy
+	volumes  map[string]bool // names of volumes created through the proxy
+	networks map[string]bool // IDs and names of networks created through the proxy
+	rp       *httputil.ReverseProxy
+}
+
+// New returns a Proxy for the engine socket at upstream.
+func New(upstream string, policy Policy) *Proxy {
+	p := &Proxy{Upstream: upstream, Policy: policy, owned: map[string]bool{}, volumes: map[string]bool{}, networks: map[string]bool{}}
+	p.rp = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "engine"
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", upstream)
+			},
+		},
+		ModifyResponse: p.recordCreated,
+	}
+	return p
+}
+
+// Serve listens on the unix socket at sock until ctx is done.
+func (p *Proxy) Serve(ctx context.Context, sock string) error {
+	if err := os.MkdirAll(filepath.Dir(sock), 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(sock)
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+	// The sandbox user's UID may differ from ours; the directory is only reachable by the
+	// sandbox and the host user anyway.
+	_ = os.Chmod(sock, 0666)
+
+	srv := &http.Server{Handler: p}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := p.check(r); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "airlock: " + err.Error()})
+		return
+	}
+	p.rp.ServeHTTP(w, withCreatedName(r))
+}
+
+// createdNameKey carries a network create's requested name to recordCreated, since the engine's
+// response only has the ID.
+type createdNameKey struct{}
+
+func withCreatedName(r *http.Request) *http.Request {
+	parts := route(r.URL)
+	if r.Method != http.MethodPost || len(parts) != 2 || parts[0] != "networks" || parts[1] != "create" {
+		return r
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return r
+	}
+	var req struct{ Name string }
+	if json.Unmarshal(body, &req) != nil || req.Name == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), createdNameKey{}, req.Name))
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// route strips the optional API version prefix and splits the path.
+func route(u *url.URL) []string {
+	p := versionPrefix.ReplaceAllString(u.Path, "")
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+// check returns why r is refused, or nil if it may be forwarded.
+func (p *Proxy) check(r *http.Request) error {
+	parts := route(r.URL)
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+	switch parts[0] {
+	case "_ping", "version", "info", "events":
+		if read {
+			return nil
+		}
+	case "images":
+		switch {
+		case read:
+			return nil
+		case len(parts) == 2 && parts[1] == "create":
+			ref := r.URL.Query().Get("fromImage")
+			if tag := r.URL.Query().Get("tag"); tag != "" && !strings.Contains(ref, "@") {
+				ref += ":" + tag
+			}
+			return p.image(ref)
+		case r.Method == http.MethodDelete && len(parts) >= 2:
+			return p.image(strings.Join(parts[1:], "/"))
+		}
+	case "build":
+		q := r.URL.Query()
+		if q.Get("networkmode") == "host" {
+			return fmt.Errorf("builds with host networking are not allowed")
+		}
+		tags := q["t"]
+		if len(tags) == 0 {
+			return fmt.Errorf("builds must be tagged with an allowed image name")
+		}
+		for _, t := range tags {
+			if err := p.image(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "containers":
+		if len(parts) == 1 || parts[1] == "json" {
+			if read {
+				return nil
+			}
+			break
+		}
+		if parts[1] == "create" {
+			return p.checkCreate(r)
+		}
+		if !p.owns(parts[1]) {
+			return fmt.Errorf("container %s was not created through airlock's engine socket", parts[1])
+		}
+		return nil
+	case "exec":
+		// Exec instances can only be created on owned containers (POST /containers/{id}/exec).
+		return nil
+	case "networks":
+		if read {
+			return nil
+		}
+		if len(parts) == 2 && parts[1] == "create" {
+			return checkNetworkCreate(r)
+		}
+		if len(parts) >= 2 && !p.ownsNetwork(parts[1]) {
+			return fmt.Errorf("network %s was not created through airlock's engine socket", parts[1])
+		}
+		if len(parts) == 2 && r.Method == http.MethodDelete {
+			return nil
+		}
+		if len(parts) == 3 && (parts[2] == "connect" || parts[2] == "disconnect") {
+			return p.checkNetworkConnect(r)
+		}
+	case "volumes":
+		if read {
+			return nil
+		}
+		if len(parts) == 2 && parts[1] == "create" {
+			return checkVolumeCreate(r)
+		}
+	}
+	return fmt.Errorf("%s %s is not allowed", r.Method, r.URL.Path)
+}
+
+func (p *Proxy) image(ref string) error {
+	if !p.Policy.AllowImage(ref) {
+		return fmt.Errorf("image %q is not in engineSocket.images", ref)
+	}
+	return nil
+}
+
+// createRequest is the subset of a container create body the policy inspects.
+type createRequest struct {
+	Image            string
+	NetworkingConfig struct {
+		EndpointsConfig map[string]json.RawMessage
+	}
+	HostConfig struct {
+		Privileged bool
+		CapAdd     []string
+		Devices    []json.RawMessage
+		Binds      []string
+		Mounts     []struct {
+			Type          string
+			Source        string
+			BindOptions   json.RawMessage
+			VolumeOptions struct{ DriverConfig json.RawMessage }
+		}
+		VolumesFrom       []string
+		NetworkMode       string
+		PidMode           string
+		IpcMode           string
+		UTSMode           string
+		UsernsMode        string
+		CgroupnsMode      string
+		SecurityOpt       []string
+		CgroupParent      string
+		DeviceCgroupRules []string
+		DeviceRequests    []json.RawMessage
+		Runtime           string
+		Sysctls           map[string]string
+	}
+}
+
+// defaultNetworks are the network modes a created container may use without owning the network.
+var defaultNetworks = []string{"", "default", "bridge", "none"}
+
+// allowedSecurityOpts are the only security options a created container may set; anything else
+// (seccomp, apparmor, or SELinux labels such as type:spc_t) could lift its confinement.
+var allowedSecurityOpts = []string{"no-new-privileges", "no-new-privileges:true", "no-new-privileges=true"}
+
+func (p *Proxy) checkCreate(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var req createRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return fmt.Errorf("unreadable container create request: %v", err)
+	}
+	if err := p.image(req.Image); err != nil {
+		return err
+	}
+	hc := req.HostConfig
+	switch {
+	case hc.Privileged:
+		return fmt.Errorf("privileged containers are not allowed")
+	case len(hc.CapAdd) > 0:
+		return fmt.Errorf("adding capabilities is not allowed")
+	case len(hc.Devices) > 0 || len(hc.DeviceCgroupRules) > 0 || len(hc.DeviceRequests) > 0:
+		return fmt.Errorf("host devices are not allowed")
+	case hc.Runtime != "":
+		return fmt.Errorf("choosing a container runtime is not allowed")
+	case len(hc.Sysctls) > 0:
+		return fmt.Errorf("sysctls are not allowed")
+	case len(hc.VolumesFrom) > 0:
+		return fmt.Errorf("volumes-from is not allowed")
+	case hc.CgroupParent != "":
+		return fmt.Errorf("custom cgroup parents are not allowed")
+	}
+	for _, b := range hc.Binds {
+		// Volumes created through the proxy ("name:/path") are fine; host paths are not.
+		src, _, _ := strings.Cut(b, ":")
+		if strings.HasPrefix(src, "/") || strings.HasPrefix(src, ".") {
+			return fmt.Errorf("bind mounts of host paths are not allowed (%s)", src)
+		}
+		if err := p.checkVolume(src); err != nil {
+			return err
+		}
+	}
+	for _, m := range hc.Mounts {
+		// A volume's driver options can bind a host path too (local, type=none, o=bind).
+		switch {
+		case m.Type == "bind" || !isNull(m.BindOptions):
+			return fmt.Errorf("bind mounts of host paths are not allowed")
+		case !isNull(m.VolumeOptions.DriverConfig):
+			return fmt.Errorf("volume driver options are not allowed")
+		case m.Type != "volume" && m.Type != "tmpfs":
+			return fmt.Errorf("%q mounts are not allowed", m.Type)
+		case m.Type == "volume" && m.Source != "":
+			if err := p.checkVolume(m.Source); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mode := range []string{hc.NetworkMode, hc.PidMode, hc.IpcMode, hc.UTSMode, hc.UsernsMode, hc.CgroupnsMode} {
+		if mode == "host" || strings.HasPrefix(mode, "container:") {
+			return fmt.Errorf("sharing host or other containers' namespaces is not allowed")
+		}
+	}
+	networks := []string{hc.NetworkMode}
+	for name := range req.NetworkingConfig.EndpointsConfig {
+		networks = append(networks, name)
+	}
+	for _, n := range networks {
+		if !slices.Contains(defaultNetworks, n) && !p.ownsNetwork(n) {
+			return fmt.Errorf("network %s was not created through airlock's engine socket", n)
+		}
+	}
+	for _, opt := range hc.SecurityOpt {
+		if !slices.Contains(allowedSecurityOpts, opt) {
+			return fmt.Errorf("security option %q is not allowed", opt)
+		}
+	}
+	return nil
+}
+
+// checkVolume allows mounting the named volume only if it was created through the proxy, so the
+// sandbox can't mount other projects' volumes, such as their workspaces and homes.
+func (p *Proxy) checkVolume(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.volumes[name] {
+		return fmt.Errorf("volume %s was not created through airlock's engine socket", name)
+	}
+	return nil
+}
+
+// isNull reports whether a JSON field was absent or null.
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
+
+// readBody reads r's body and puts it back for forwarding.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// checkVolumeCreate allows only plain local volumes: driver options could bind a host path
+// (type=none, o=bind, device=/) into any container that mounts the volume by name.
+func checkVolumeCreate(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Driver     string
+		DriverOpts map[string]string
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("unreadable volume create request: %v", err)
+		}
+	}
+	switch {
+	case req.Driver != "" && req.Driver != "local":
+		return fmt.Errorf("volume driver %q is not allowed", req.Driver)
+	case len(req.DriverOpts) > 0:
+		return fmt.Errorf("volume driver options are not allowed")
+	}
+	return nil
+}
+
+// checkNetworkCreate allows only bridge networks; macvlan and ipvlan would put containers
+// directly on the host's network.
+func checkNetworkCreate(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Driver     string
+		ConfigFrom json.RawMessage
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return fmt.Errorf("unreadable network create request: %v", err)
+	}
+	switch {
+	case req.Driver != "" && req.Driver != "bridge":
+		return fmt.Errorf("network driver %q is not allowed", req.Driver)
+	case !isNull(req.ConfigFrom):
+		return fmt.Errorf("networks created from another network's config are not allowed")
+	}
+	return nil
+}
+
+func (p *Proxy) checkNetworkConnect(r *http.Request) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	var req struct{ Container string }
+	if err := json.Unmarshal(body, &req); err != nil {
+		return fmt.Errorf("unreadable network request: %v", err)
+	}
+	if !p.owns(req.Container) {
+		return fmt.Errorf("container %s was not created through airlock's engine socket", req.Container)
+	}
+	return nil
+}
+
+// recordCreated remembers containers and volumes created through the proxy so later requests may
+// manage and mount them.
+func (p *Proxy) recordCreated(resp *http.Response) error {
+	req := resp.Request
+	parts := route(req.URL)
+	if req.Method != http.MethodPost || len(parts) != 2 || parts[1] != "create" || resp.StatusCode != http.StatusCreated {
+		return nil
+	}
+	if parts[0] != "containers" && parts[0] != "volumes" && parts[0] != "networks" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var created struct{ Id, Name string }
+	if json.Unmarshal(body, &created) != nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case parts[0] == "volumes" && created.Name != "":
+		p.volumes[created.Name] = true
+	case parts[0] == "networks" && created.Id != "":
+		p.networks[created.Id] = true
+		if name, _ := req.Context().Value(createdNameKey{}).(string); name != "" {
+			p.networks[name] = true
+		}
+	case parts[0] == "containers" && created.Id != "":
+		p.owned[created.Id] = true
+		if name := req.URL.Query().Get("name"); name != "" {
+			p.owned[name] = true
+		}
+	}
+	return nil
+}
+
+// owns reports whether ref (an ID, ID prefix, or name) is a container created through the proxy.
+func (p *Proxy) owns(ref string) bool {
+	return p.ownsIn(p.owned, strings.TrimPrefix(ref, "/"))
+}
+
+// ownsNetwork reports whether ref (an ID, ID prefix, or name) is a network created through the proxy.
+func (p *Proxy) ownsNetwork(ref string) bool {
+	return p.ownsIn(p.networks, ref)
+}
+
+func (p *Proxy) ownsIn(set map[string]bool, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if set[ref] {
+		return true
+	}
+	if len(ref) < 12 {
+		return false
+	}
+	for id := range set {
+		if strings.HasPrefix(id, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dir is the host directory holding the proxy socket, mounted into the sandbox.
+func Dir(absProjectDir string) string {
+	return filepath.Join(absProjectDir, ".airlock", "state", "engine")
+}
+
+// SocketPath is the proxy socket for a project.
+func SocketPath(absProjectDir string) string {
+	return filepath.Join(Dir(absProjectDir), "docker.sock")
+}
+
+// Running reports whether a proxy is accepting connections on sock.
+func Running(sock string) bool {
+	conn, err := net.DialTimeout("unix", sock, 100*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,213 @@
+package sockproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeImage(t *testing.T) {
+	cases := map[string]string{
+		"postgres":                    "docker.io/library/postgres:latest",
+		"postgres:16":                 "docker.io/library/postgres:16",
+		"acme/api":                    "docker.io/acme/api:latest",
+		"ghcr.io/acme/api:v1":         "ghcr.io/acme/api:v1",
+		"localhost:5000/api":          "localhost:5000/api:latest",
+		"redis@sha256:abc":            "docker.io/library/redis@sha256:abc",
+		"docker.io/library/redis:7.2": "docker.io/library/redis:7.2",
+	}
+	for in, want := range cases {
+		if got := NormalizeImage(in); got != want {
+			t.Errorf("NormalizeImage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAllowImage(t *testing.T) {
+	p := Policy{Images: []string{"postgres:*", "ghcr.io/acme/*:*", "testcontainers/ryuk:*"}}
+	for _, ref := range []string{"postgres:16", "docker.io/library/postgres:15", "ghcr.io/acme/api:v2", "testcontainers/ryuk:0.5.1"} {
+		if !p.AllowImage(ref) {
+			t.Errorf("AllowImage(%q) = false, want true", ref)
+		}
+	}
+	for _, ref := range []string{"", "mysql:8", "ghcr.io/other/api:v1", "postgresql:16"} {
+		if p.AllowImage(ref) {
+			t.Errorf("AllowImage(%q) = true, want false", ref)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := New("/nonexistent.sock", Policy{Images: []string{"postgres:*", "app:*"}})
+	p.owned["0123456789abcdef0123"] = true
+	p.owned["db"] = true
+	p.volumes["pgdata"] = true
+	p.networks["net1"] = true
+
+	cases := []struct {
+		method, target, body string
+		allow                bool
+	}{
+		{"GET", "/_ping", "", true},
+		{"GET", "/v1.43/version", "", true},
+		{"GET", "/v1.43/containers/json?all=1", "", true},
+		{"POST", "/v1.43/images/create?fromImage=postgres&tag=16", "", true},
+		{"POST", "/v1.43/images/create?fromImage=mysql&tag=8", "", false},
+		{"POST", "/v1.43/build?t=app:dev", "", true},
+		{"POST", "/v1.43/build?t=app:dev&networkmode=host", "", false},
+		{"POST", "/v1.43/build", "", false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16"}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"mysql:8"}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Privileged":true}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Binds":["/:/host"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Binds":["pgdata:/var/lib/postgresql"]}}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"bind"}]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"NetworkMode":"host"}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"PidMode":"container:airlock-x"}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"CapAdd":["SYS_ADMIN"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"SecurityOpt":["seccomp=unconfined"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"SecurityOpt":["label=type:spc_t"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"SecurityOpt":["no-new-privileges"]}}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"DeviceCgroupRules":["b *:* rwm"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"DeviceRequests":[{"Driver":"nvidia","Count":-1}]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Runtime":"runc-unsafe"}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Sysctls":{"kernel.shm_rmid_forced":"1"}}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Binds":["airlock-other-home:/steal"]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"volume","Source":"airlock-other-workspace","Target":"/steal"}]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"volume","Target":"/scratch"}]}}`, true},
+		{"POST", "/v1.43/containers/0123456789ab/start", "", true},
+		{"POST", "/v1.43/containers/db/stop", "", true},
+		{"DELETE", "/v1.43/containers/db?force=1", "", true},
+		{"POST", "/v1.43/containers/airlock-other/exec", "", false},
+		{"GET", "/v1.43/containers/airlock-other/json", "", false},
+		{"POST", "/v1.43/networks/net1/connect", `{"Container":"db"}`, true},
+		{"POST", "/v1.43/networks/net1/connect", `{"Container":"airlock-other"}`, false},
+		{"POST", "/v1.43/networks/airlock-other-services/connect", `{"Container":"db"}`, false},
+		{"DELETE", "/v1.43/networks/net1", "", true},
+		{"DELETE", "/v1.43/networks/bridge", "", false},
+		{"DELETE", "/v1.43/networks/airlock-other-services", "", false},
+		{"POST", "/v1.43/networks/prune", "", false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"NetworkMode":"net1"}}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"NetworkMode":"bridge"}}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"NetworkMode":"airlock-other-services"}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","NetworkingConfig":{"EndpointsConfig":{"airlock-other-services":{}}}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"volume","Source":"pgdata","Target":"/data"}]}}`, true},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"volume","Source":"x","Target":"/host","VolumeOptions":{"DriverConfig":{"Name":"local","Options":{"type":"none","o":"bind","device":"/"}}}}]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"volume","Source":"x","Target":"/host","BindOptions":{"Propagation":"rshared"}}]}}`, false},
+		{"POST", "/v1.43/containers/create", `{"Image":"postgres:16","HostConfig":{"Mounts":[{"Type":"npipe"}]}}`, false},
+		{"POST", "/v1.43/volumes/create", `{}`, true},
+		{"POST", "/v1.43/volumes/create", `{"Name":"pgdata","Driver":"local"}`, true},
+		{"POST", "/v1.43/volumes/create", `{"Name":"x","Driver":"local","DriverOpts":{"type":"none","o":"bind","device":"/"}}`, false},
+		{"POST", "/v1.43/volumes/create", `{"Name":"x","Driver":"nfs"}`, false},
+		{"GET", "/v1.43/volumes", "", true},
+		{"DELETE", "/v1.43/volumes/airlock-test-workspace", "", false},
+		{"POST", "/v1.43/volumes/prune", "", false},
+		{"POST", "/v1.43/networks/create", `{"Name":"tc"}`, true},
+		{"POST", "/v1.43/networks/create", `{"Name":"tc","Driver":"bridge"}`, true},
+		{"POST", "/v1.43/networks/create", `{"Name":"tc","Driver":"macvlan","Options":{"parent":"eth0"}}`, false},
+		{"POST", "/v1.43/networks/create", `{"Name":"tc","Driver":"ipvlan"}`, false},
+		{"POST", "/v1.43/networks/create", `{"Name":"tc","ConfigFrom":{"Network":"lan-config"}}`, false},
+		{"POST", "/v1.43/plugins/pull", "", false},
+		{"POST", "/v1.43/swarm/init", "", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		err := p.check(r)
+		if (err == nil) != c.allow {
+			t.Errorf("%s %s %s: allowed=%v (err %v), want %v", c.method, c.target, c.body, err == nil, err, c.allow)
+		}
+	}
+}
+
+func TestProxyTracksCreatedResources(t *testing.T) {
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "engine.sock")
+	ln, err := net.Listen("unix", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/containers/create") {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"abcdef0123456789abcdef"}`)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/networks/create") {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"0123456789abcdef0123456789"}`)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/volumes/create") {
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Name":"pgdata","Driver":"local"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go engine.Serve(ln)
+	defer engine.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sock := filepath.Join(dir, "proxy.sock")
+	go New(upstream, Policy{Images: []string{"postgres:*"}}).Serve(ctx, sock)
+	for i := 0; i < 100 && !Running(sock); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	post := func(target, body string) int {
+		resp, err := client.Post("http://engine"+target, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post("/v1.43/containers/abcdef012345/start", ""); code != http.StatusForbidden {
+		t.Errorf("start before create: status %d, want 403", code)
+	}
+	if code := post("/v1.43/containers/create?name=db", `{"Image":"postgres:16"}`); code != http.StatusCreated {
+		t.Fatalf("create: status %d, want 201", code)
+	}
+	for _, target := range []string{"/v1.43/containers/abcdef012345/start", "/v1.43/containers/db/stop"} {
+		if code := post(target, ""); code != http.StatusNoContent {
+			t.Errorf("%s: status %d, want 204", target, code)
+		}
+	}
+
+	bind := `{"Image":"postgres:16","HostConfig":{"Binds":["pgdata:/var/lib/postgresql/data"]}}`
+	if code := post("/v1.43/containers/create", bind); code != http.StatusForbidden {
+		t.Errorf("create with a volume not created through the proxy: status %d, want 403", code)
+	}
+	if code := post("/v1.43/volumes/create", `{"Name":"pgdata"}`); code != http.StatusCreated {
+		t.Fatalf("volume create: status %d, want 201", code)
+	}
+	if code := post("/v1.43/containers/create", bind); code != http.StatusCreated {
+		t.Errorf("create with a volume created through the proxy: status %d, want 201", code)
+	}
+
+	if code := post("/v1.43/networks/tc/connect", `{"Container":"db"}`); code != http.StatusForbidden {
+		t.Errorf("connect to a network not created through the proxy: status %d, want 403", code)
+	}
+	if code := post("/v1.43/networks/create", `{"Name":"tc"}`); code != http.StatusCreated {
+		t.Fatalf("network create: status %d, want 201", code)
+	}
+	for _, target := range []string{"/v1.43/networks/tc/connect", "/v1.43/networks/0123456789ab/disconnect"} {
+		if code := post(target, `{"Container":"db"}`); code != http.StatusNoContent {
+			t.Errorf("%s: status %d, want 204", target, code)
+		}
+	}
+}
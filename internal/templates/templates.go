@@ -0,0 +1,264 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Data is the context templates are rendered with.
+type Data struct {
+	Name   string
+	Params map[string]string // answers to the manifest's params, e.g. {{.Params.PythonVersion}}
+}
+
+// ManifestFileName is the optional file in a template's root that declares its params. It is read
+// by init and never copied into the project.
+const ManifestFileName = "airlock-template.yaml"
+
+// Manifest declares the questions a template asks before it is rendered.
+type Manifest struct {
+	Params []Param `yaml:"params"`
+}
+
+// Param is one template parameter.
+type Param struct {
+	Name    string   `yaml:"name"`    // referenced as {{.Params.<name>}}
+	Prompt  string   `yaml:"prompt"`  // question shown to the user; defaults to the name
+	Default string   `yaml:"default"` // used when not answered; no default makes the param required
+	Choices []string `yaml:"choices"` // if set, the only accepted answers
+}
+
+var paramNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadManifest reads the manifest in dir. A template without one has no params.
+func LoadManifest(dir string) (*Manifest, error) {
+	path := filepath.Join(dir, ManifestFileName)
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", ManifestFileName)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ManifestFileName, err)
+	}
+	seen := map[string]bool{}
+	for _, p := range m.Params {
+		if !paramNameRe.MatchString(p.Name) {
+			return nil, fmt.Errorf("%s: param name %q must be a template identifier", ManifestFileName, p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("%s: param %s is declared more than once", ManifestFileName, p.Name)
+		}
+		seen[p.Name] = true
+		if p.Default != "" && len(p.Choices) > 0 && !slices.Contains(p.Choices, p.Default) {
+			return nil, fmt.Errorf("%s: default %q of param %s is not one of its choices", ManifestFileName, p.Default, p.Name)
+		}
+	}
+	return &m, nil
+}
+
+// Resolve answers every param: a value in given (e.g. from --set) wins, then ask (when non-nil,
+// e.g. an interactive prompt returning "" to accept the default), then the default.
+func (m *Manifest) Resolve(given map[string]string, ask func(Param) (string, error)) (map[string]string, error) {
+	params := map[string]string{}
+	for _, p := range m.Params {
+		v, ok := given[p.Name]
+		if !ok && ask != nil {
+			answer, err := ask(p)
+			if err != nil {
+				return nil, err
+			}
+			v = answer
+		}
+		if v == "" {
+			v = p.Default
+		}
+		if v == "" {
+			return nil, fmt.Errorf("template param %s is required (pass --set %s=<value>)", p.Name, p.Name)
+		}
+		if len(p.Choices) > 0 && !slices.Contains(p.Choices, v) {
+			return nil, fmt.Errorf("template param %s must be one of %s, got %q", p.Name, strings.Join(p.Choices, ", "), v)
+		}
+		params[p.Name] = v
+	}
+	for k := range given {
+		if _, ok := params[k]; !ok {
+			return nil, fmt.Errorf("the template has no param %s", k)
+		}
+	}
+	return params, nil
+}
+
+// Source is a parsed template location in go-getter style: <repo>//<subdir>?ref=<ref>.
+type Source struct {
+	Repo   string // git URL or local directory
+	Subdir string
+	Ref    string
+	Local  bool
+}
+
+// ParseSource parses a template location such as
+// github.com/org/airlock-templates//python?ref=v1 or a local directory path.
+func ParseSource(src string) (Source, error) {
+	if src == "" {
+		return Source{}, errors.New("empty template source")
+	}
+	if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+		return Source{Repo: src, Local: true}, nil
+	}
+
+	var s Source
+	rest := strings.TrimPrefix(src, "git::")
+	if i := strings.Index(rest, "?"); i >= 0 {
+		for _, kv := range strings.Split(rest[i+1:], "&") {
+			if v, ok := strings.CutPrefix(kv, "ref="); ok {
+				s.Ref = v
+			}
+		}
+		rest = rest[:i]
+	}
+
+	// Split off the subdirectory, skipping the "//" of a URL scheme.
+	searchFrom := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		searchFrom = i + 3
+	}
+	if i := strings.Index(rest[searchFrom:], "//"); i >= 0 {
+		s.Subdir = strings.Trim(rest[searchFrom+i+2:], "/")
+		rest = rest[:searchFrom+i]
+		if slices.Contains(strings.Split(s.Subdir, "/"), "..") {
+			return Source{}, fmt.Errorf("template subdirectory %q must stay inside the repository", s.Subdir)
+		}
+	}
+
+	if !strings.Contains(rest, "://") && !strings.HasPrefix(rest, "git@") {
+		rest = "https://" + rest
+	}
+	s.Repo = rest
+	return s, nil
+}
+
+// Fetch makes the template available on disk and returns its directory along with a cleanup func.
+// Remote sources are shallow-cloned with git into a temporary directory.
+func Fetch(ctx context.Context, src Source) (string, func(), error) {
+	if src.Local {
+		return src.Repo, func() {}, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "airlock-template-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(tmp) }
+
+	args := []string{"clone", "--depth", "1"}
+	if src.Ref != "" {
+		args = append(args, "--branch", src.Ref)
+	}
+	args = append(args, src.Repo, tmp)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to fetch template %s: %w", src.Repo, err)
+	}
+
+	// The clone is untrusted: a symlink on the way to the subdirectory must not lead out of it.
+	dir, err := filepath.EvalSymlinks(filepath.Join(tmp, filepath.FromSlash(src.Subdir)))
+	root, rerr := filepath.EvalSymlinks(tmp)
+	if err != nil || rerr != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("template subdirectory %q not found in %s", src.Subdir, src.Repo)
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		cleanup()
+		return "", nil, fmt.Errorf("template subdirectory %q leads outside %s", src.Subdir, src.Repo)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		cleanup()
+		return "", nil, fmt.Errorf("template subdirectory %q not found in %s", src.Subdir, src.Repo)
+	}
+	return dir, cleanup, nil
+}
+
+// Render writes the template in srcDir into dstDir. Files ending in ".tmpl" are rendered with data
+// and written without the suffix; everything else except the manifest is copied verbatim. Existing
+// files are left untouched. A template holding a symlink or other irregular file is refused, so a
+// cloned template can't copy host files into the project.
+// It returns the paths (relative to dstDir) that were written.
+func Render(srcDir, dstDir string, data Data) ([]string, error) {
+	var written []string
+	err := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dstDir, rel), 0755)
+		}
+		if rel == ManifestFileName {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("template file %s is not a regular file", rel)
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, ".tmpl") {
+			rel = strings.TrimSuffix(rel, ".tmpl")
+			t, err := template.New(rel).Option("missingkey=error").Parse(string(b))
+			if err != nil {
+				return fmt.Errorf("failed to parse template %s: %w", rel, err)
+			}
+			var sb strings.Builder
+			if err := t.Execute(&sb, data); err != nil {
+				return fmt.Errorf("failed to render template %s: %w", rel, err)
+			}
+			b = []byte(sb.String())
+		}
+
+		dst := filepath.Join(dstDir, rel)
+		if _, err := os.Stat(dst); err == nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, b, info.Mode().Perm()); err != nil {
+			return err
+		}
+		written = append(written, rel)
+		return nil
+	})
+	return written, err
+}
@@ -0,0 +1,167 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Source
+	}{
+		{
+			in:   "github.com/org/airlock-templates//python",
+			want: Source{Repo: "https://github.com/org/airlock-templates", Subdir: "python"},
+		},
+		{
+			in:   "github.com/org/airlock-templates//go/web?ref=v1.2.0",
+			want: Source{Repo: "https://github.com/org/airlock-templates", Subdir: "go/web", Ref: "v1.2.0"},
+		},
+		{
+			in:   "git::https://example.com/templates.git//node",
+			want: Source{Repo: "https://example.com/templates.git", Subdir: "node"},
+		},
+		{
+			in:   "git@github.com:org/templates.git",
+			want: Source{Repo: "git@github.com:org/templates.git"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseSource(tt.in)
+		if err != nil {
+			t.Fatalf("ParseSource(%q) failed: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseSource(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseSource("github.com/org/airlock-templates//python/../../etc"); err == nil {
+		t.Error("expected an error for a subdirectory leaving the repository")
+	}
+}
+
+func TestRenderRefusesSymlinks(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(secret, []byte("private key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(src, "key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Render(src, dst, Data{Name: "demo"}); err == nil {
+		t.Error("expected a symlinked template file to be refused")
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "key")); err == nil {
+		t.Error("symlink target was copied into the project")
+	}
+}
+
+func TestRender(t *testing.T) {
+	src, err := os.MkdirTemp("", "airlock-tmpl-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := os.MkdirTemp("", "airlock-tmpl-dst-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	if err := os.WriteFile(filepath.Join(src, "airlock.yaml.tmpl"), []byte("name: {{.Name}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Containerfile"), []byte("RUN echo {{not a template}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "Containerfile"), []byte("existing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := Render(src, dst, Data{Name: "demo"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if len(written) != 1 || written[0] != "airlock.yaml" {
+		t.Errorf("expected only airlock.yaml to be written, got %v", written)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "airlock.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "name: demo\n" {
+		t.Errorf("unexpected rendered airlock.yaml: %q", string(b))
+	}
+	b, err = os.ReadFile(filepath.Join(dst, "Containerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "existing\n" {
+		t.Errorf("expected existing Containerfile to be preserved, got %q", string(b))
+	}
+}
+
+func TestManifestParams(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	manifest := `params:
+  - name: PythonVersion
+    prompt: Python version
+    default: "3.12"
+    choices: ["3.11", "3.12"]
+  - name: Registry
+    prompt: Registry host
+`
+	if err := os.WriteFile(filepath.Join(src, ManifestFileName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "Containerfile.tmpl"), []byte("FROM {{.Params.Registry}}/python:{{.Params.PythonVersion}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadManifest(src)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if _, err := m.Resolve(nil, nil); err == nil {
+		t.Error("expected an error for the required Registry param")
+	}
+	if _, err := m.Resolve(map[string]string{"Registry": "r", "PythonVersion": "2.7"}, nil); err == nil {
+		t.Error("expected an error for an answer outside the choices")
+	}
+	if _, err := m.Resolve(map[string]string{"Registry": "r", "Other": "x"}, nil); err == nil {
+		t.Error("expected an error for an undeclared param")
+	}
+
+	var asked []string
+	params, err := m.Resolve(map[string]string{"Registry": "registry.corp"}, func(p Param) (string, error) {
+		asked = append(asked, p.Name)
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(asked) != 1 || asked[0] != "PythonVersion" {
+		t.Errorf("asked %v, want only PythonVersion", asked)
+	}
+
+	written, err := Render(src, dst, Data{Name: "demo", Params: params})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if len(written) != 1 || written[0] != "Containerfile" {
+		t.Errorf("expected only Containerfile to be written (not the manifest), got %v", written)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "Containerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "FROM registry.corp/python:3.12\n" {
+		t.Errorf("unexpected rendered Containerfile: %q", string(b))
+	}
+}
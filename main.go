@@ -1,15 +1,42 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/donjaime/airlock/internal/audit"
+	"github.com/donjaime/airlock/internal/background"
+	"github.com/donjaime/airlock/internal/batch"
+	"github.com/donjaime/airlock/internal/broker"
 	"github.com/donjaime/airlock/internal/config"
 	"github.com/donjaime/airlock/internal/container"
+	"github.com/donjaime/airlock/internal/daemon"
+	"github.com/donjaime/airlock/internal/filelock"
+	"github.com/donjaime/airlock/internal/filesync"
+	"github.com/donjaime/airlock/internal/pr"
+	"github.com/donjaime/airlock/internal/review"
+	"github.com/donjaime/airlock/internal/sanitize"
+	"github.com/donjaime/airlock/internal/snapshot"
+	"github.com/donjaime/airlock/internal/sockproxy"
+	"github.com/donjaime/airlock/internal/templates"
+	"github.com/donjaime/airlock/pkg/airlock"
 )
 
 const version = "0.5.0"
@@ -18,26 +45,72 @@ func usage() {
 	fmt.Fprintf(os.Stderr, `airlock v%s
 
 Usage:
-  airlock [--config path] [-e var] [-v] <command> [args]
+  airlock [--config path] [--profile name] [--instance name] [-e var] [-v] <command> [args]
 
 Commands:
-  init [name]  Create airlock.yaml, Containerfile, and .airlock/airlock.local.yaml (if missing) + ensure .airlock dirs + .gitignore entry
-  up         Build (if needed) and create the airlock container (idempotent)
-  enter      Enter the airlock container (interactive shell)
-  exec       Execute a command inside the airlock container
-  down [name]    Stop and remove the airlock container (keeps .airlock state dirs)
-  list           List all running airlock containers
-  info           Print detected engine, paths, and config
+  init [--template src [--set NAME=VALUE]] [name]  Create airlock.yaml, Containerfile, and .airlock/airlock.local.yaml (if missing) + ensure .airlock dirs + .gitignore entry
+  up [--recreate] [--wait [--timeout 2m]]  Build (if needed) and create the airlock container (idempotent); --recreate applies airlock.yaml changes, --wait blocks until ready
+  prefetch [--wait]  Pull or build the images up needs, in the background (so a slow network doesn't block the first up)
+  rebuild [--no-cache]  Force an image rebuild (or pull) and recreate the container
+  push [ref]     Build the image if needed, then tag and push it to ref (default build.publish)
+  enter [--env-file f] [--workdir dir] [--user u]  Enter the airlock container (interactive shell)
+  exec [-d] [--env-file f] [--stdin-file f] [--network none|allowlist:<profile>] [--tty|--no-tty] [--workdir dir] [--user u] -- <cmd...>  Execute a command inside the airlock container (stdin is streamed when piped; -d starts a background job)
+  exec --each services|workspace|<glob> [--user u] -- <cmd...>  Run a command in several containers at once, with prefixed output
+  sync status | sync flush  Show the workspace sync's last run and conflicts, or sync now (requires sync)
+  cp <src> <dst>  Copy files between the host and the container; name the container side container:<path> (relative paths are in the workspace)
+  batch [--report file] <steps.yaml|->  Run exec, copy, and snapshot steps in order with per-step timeouts; print a JSON report
+  jobs           List background jobs started with exec -d
+  attach [job]   Attach to the container's main process (see command), or follow a background job's output until it ends (Ctrl-C detaches)
+  logs [-f] [--tail N]  Show the container's output (useful when up succeeds but enter fails)
+  down [--volumes] [name]  Stop and remove the airlock container (keeps .airlock state dirs; --volumes also removes named volumes)
+  list [--all-users]  List all running airlock containers
+  image save [file]  Save the sandbox image to an archive (default airlock-<name>.tar) and update airlock.lock
+  image load [file]  Load a sandbox image archive and update airlock.lock
+  home snapshot | home list | home rollback [name]  Snapshot the sandbox home dir or roll it back (workspace untouched)
+  verify         Run isolation self-tests inside the sandbox and print a pass/fail report
+  bench [--size MB] [--files N]  Measure filesystem throughput/latency of bind mounts vs the container fs
+  audit syscalls [--since 24h]  Summarize unusual syscalls per exec session (requires security.auditSyscalls)
+  audit commits [--since 720h]  List commits made in sandbox sessions, with their session (requires git.provenance)
+  net report [--since 24h]  Summarize bytes sent to and received from each allowlisted host (requires network.allow)
+  approvals      Review access requests filed from inside the sandbox (requires approvals: true)
+  review [--mark] [--stat]  Review workspace changes since the last mark and revert files or hunks
+  pr [--base b] [--branch b] [--title t] [--draft]  Push the sandbox's commits with host credentials and open a PR via gh/glab
+  allow mount <path> [target] [--rw] --for 1h   Temporarily mount a host path into the sandbox
+  allow network <domain> --for 15m              Temporarily allow egress to a domain
+  ws up|down|status|prefetch  Run up, down, status, or prefetch in every project listed in airlock.workspace.yaml
+  ws exec -- <cmd...>  Run a command in every workspace project's sandbox, one after another
+  doctor [--fix]  Check that the engine is reachable and a podman machine's clock matches the host's; --fix resets it
+  daemon         Stay in the foreground and let enter/exec skip re-checking sandboxes that are already up
+  grants         List active access grants and when they expire
+  checkpoint [file]  Freeze the running container to disk with CRIU (podman only), optionally exporting to a file
+  restore [file]     Resume a checkpointed container, optionally importing from a file
+  info           Print detected engine, paths, config, and the live container's mounts, env, user, network, and limits
+  status         Show whether the container exists and runs, its uptime, image, and config drift
+  which          Print which airlock.yaml is used from here, the project root, and container state
   help           Print this help message
   version        Print version
 
 Examples:
   airlock init
+  airlock init --template github.com/org/airlock-templates//python myproject
   airlock up
+  airlock --profile gpu up
+  airlock --instance featureX up
   airlock -e ANTHROPIC_API_KEY enter
   airlock -e SOME_VAR exec -- git status
+  airlock exec -e DEBUG=1 -- make test
   airlock down [container-name]
-  airlock list
+  airlock list [--all-users]
+
+Environment:
+  AIRLOCK_CONFIG        Path to airlock.yaml (like --config)
+  AIRLOCK_VERBOSE       true/false (like -v)
+  AIRLOCK_PROFILE       Profile to use (like --profile)
+  AIRLOCK_INSTANCE      Instance to use (like --instance)
+  AIRLOCK_ENGINE        podman or docker, overriding engine in airlock.yaml
+  AIRLOCK_PROJECT_DIR   Project root, overriding the config file's directory
+  AIRLOCK_SHARED_HOST   1/true to namespace sandboxes per user (like sharedHost in airlock.yaml)
+  Flags take precedence over the environment, which takes precedence over airlock.yaml.
 
 Flags:
 `, version)
@@ -45,9 +118,11 @@ Flags:
 }
 
 var (
-	configPath = flag.String("config", "", "Path to airlock.yaml (default: ./airlock.yaml or ./airlock.yml)")
+	configPath = flag.String("config", "", "Path to airlock.yaml (default: nearest airlock.yaml or airlock.yml in this or a parent directory)")
 	verbose    = flag.Bool("v", false, "Enable verbose output (print underlying podman/docker commands)")
-	envVars    = stringSliceFlag("e", "Forward ambient environment variable into the container")
+	profile    = flag.String("profile", "", "Use this profile from airlock.yaml's profiles (its own container, sharing home and cache)")
+	instance   = flag.String("instance", "", "Use a parallel copy of the sandbox with its own container, home, and cache (e.g. one per branch)")
+	envVars    = stringSliceFlag("e", "Set KEY=VALUE, or forward the ambient value of KEY, into the container (repeatable)")
 )
 
 func init() {
@@ -56,6 +131,7 @@ func init() {
 
 func main() {
 	flag.Parse()
+	applyEnvDefaults()
 
 	args := flag.Args()
 	if len(args) < 1 {
@@ -75,9 +151,23 @@ func main() {
 		fmt.Println(version)
 
 	case "init":
+		fs := flag.NewFlagSet("init", flag.ExitOnError)
+		tmpl := fs.String("template", "", "Template to initialize from: a local dir or go-getter style git source (e.g. github.com/org/repo//python?ref=v1)")
+		var sets stringSlice
+		fs.Var(&sets, "set", "Answer a template param as NAME=VALUE instead of being asked (repeatable)")
+		_ = fs.Parse(cmdArgs)
 		name := ""
-		if len(cmdArgs) > 0 {
-			name = cmdArgs[0]
+		if fs.NArg() > 0 {
+			name = fs.Arg(0)
+		}
+		if *tmpl != "" {
+			if name == "" {
+				name = config.DefaultProjectName
+			}
+			if err := initFromTemplate(ctx, *tmpl, name, sets); err != nil {
+				fmt.Fprintf(os.Stderr, "init error: %v\n", err)
+				os.Exit(1)
+			}
 		}
 		if err := config.InitFiles(".", name); err != nil {
 			fmt.Fprintf(os.Stderr, "init error: %v\n", err)
@@ -85,15 +175,41 @@ func main() {
 		}
 		fmt.Println("Created airlock.yaml, Containerfile, and .airlock/airlock.local.yaml (if missing), ensured .airlock dirs, and updated .gitignore.")
 
-	case "list", "down", "info", "up", "enter", "exec":
-		cfg, _, err := loadConfig(*configPath)
+	case "ws":
+		if err := runWorkspace(ctx, cmdArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "ws error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "doctor":
+		if err := runDoctor(ctx, cmdArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "doctor error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "daemon":
+		if err := runDaemon(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "daemon error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "list", "down", "info", "status", "which", "logs", "up", "rebuild", "enter", "exec", "image", "home", "checkpoint", "restore", "verify", "bench", "audit", "net", "approvals", "review", "pr", "allow", "grants", "engine-proxy", "prefetch", "jobs", "attach", "cp", "batch", "push", "sync":
+		// exec --each targets other containers, so it doesn't need a project config of its own.
+		if cmd == "exec" && hasFlag(cmdArgs, "each") {
+			if err := runExecEach(ctx, cmdArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+		cfg, cfgFile, err := loadConfig(*configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to load config: %v. Run: airlock init\n", err)
 			os.Exit(1)
 		}
 
 		absProj, _ := filepath.Abs(cfg.ProjectDir)
-		eng, err := container.DetectEngine(cfg.Engine)
+		eng, err := container.DetectEngine(cfg.Engine.Type)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to detect container engine: %v\n", err)
 			os.Exit(1)
@@ -101,10 +217,61 @@ func main() {
 
 		runner := container.NewRunner(eng)
 		runner.Verbose = *verbose
+		runner.Version = version
+
+		warm := false
+		switch cmd {
+		case "up", "enter", "exec":
+			if cfg.EngineSocket != nil {
+				if err := ensureEngineProxy(cfgFile, absProj); err != nil {
+					fmt.Fprintf(os.Stderr, "engine socket error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if cfg.Sync != nil {
+				// It waits for the container up is about to start.
+				if err := ensureSyncDaemon(cfgFile, absProj); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: the background workspace sync didn't start: %v\n", err)
+				}
+			}
+			// A running daemon remembers sandboxes already brought up with this exact config, so
+			// frequent enter/exec calls can skip straight to the engine exec.
+			if cmd != "up" && daemon.Check(daemon.SocketPath(), daemonKey(eng, cfg)) {
+				warm = true
+				break
+			}
+			if fresh, err := revokeExpiredGrants(ctx, runner, cfg, cfgFile, absProj); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to revoke expired grants: %v\n", err)
+			} else {
+				cfg = fresh
+			}
+			if cmd != "up" {
+				// Env-only changes need no warning: every session passes the current env.
+				switch drift, _ := runner.Drifted(ctx, cfg, absProj); {
+				case drift == container.DriftFull:
+					fmt.Fprintln(os.Stderr, "warning: airlock.yaml changed since the container was created and the change is not applied; run: airlock up --recreate")
+				case drift == container.DriftBuild && cfg.Build.AutoRecreate:
+					fmt.Fprintln(os.Stderr, "The Containerfile or build inputs changed; rebuilding the image and recreating the container")
+					if err := runner.Recreate(ctx, cfg, absProj); err != nil {
+						fmt.Fprintf(os.Stderr, "up error: %v\n", err)
+						os.Exit(1)
+					}
+				case drift == container.DriftBuild:
+					fmt.Fprintln(os.Stderr, "warning: the Containerfile or build inputs changed since the container was created; run: airlock up --recreate")
+				}
+			}
+		}
 
 		switch cmd {
 		case "list":
-			names, err := runner.List(ctx)
+			fs := flag.NewFlagSet("list", flag.ExitOnError)
+			allUsers := fs.Bool("all-users", false, "On a shared host, also list other users' sandboxes")
+			_ = fs.Parse(cmdArgs)
+			opts := container.ListOptions{AllUsers: *allUsers}
+			if cfg.SharedHost {
+				opts.Owner = cfg.Owner
+			}
+			names, err := runner.List(ctx, opts)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "list error: %v\n", err)
 				os.Exit(1)
@@ -114,14 +281,30 @@ func main() {
 			}
 
 		case "down":
+			fs := flag.NewFlagSet("down", flag.ExitOnError)
+			volumes := fs.Bool("volumes", false, "Also remove the project's named volumes")
+			_ = fs.Parse(cmdArgs)
 			var target string
-			if len(cmdArgs) > 0 {
-				target = cmdArgs[0]
+			if fs.NArg() > 0 {
+				target = fs.Arg(0)
+			}
+			if target == "" {
+				// down syncs the workspace back one last time itself.
+				stopSyncDaemon(absProj)
 			}
 			if err := runner.Down(ctx, cfg, target); err != nil {
 				fmt.Fprintf(os.Stderr, "down error: %v\n", err)
 				os.Exit(1)
 			}
+			if *volumes && target == "" {
+				if err := runner.RemoveVolumes(ctx, cfg, false); err != nil {
+					fmt.Fprintf(os.Stderr, "down error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if target == "" {
+				stopEngineProxy(absProj)
+			}
 
 		case "info":
 			info, err := runner.Info(ctx, cfg, absProj)
@@ -131,34 +314,523 @@ func main() {
 			}
 			fmt.Println(info)
 
+		case "status":
+			status, err := runner.Status(ctx, cfg, absProj)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "status error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(status)
+
+		case "which":
+			which, err := runner.Which(ctx, cfg, cfgFile, absProj)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "which error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(which)
+
 		case "up":
+			fs := flag.NewFlagSet("up", flag.ExitOnError)
+			recreate := fs.Bool("recreate", false, "Recreate the container if airlock.yaml changed since it was created")
+			wait := fs.Bool("wait", false, "Block until the container is running, healthy, and its ports are listening; print the status as JSON")
+			timeout := fs.Duration("timeout", 2*time.Minute, "How long --wait waits before failing")
+			_ = fs.Parse(cmdArgs)
+			drift, err := runner.Drifted(ctx, cfg, absProj)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not check for config changes: %v\n", err)
+			}
+			if drift == container.DriftFull && !*recreate {
+				fmt.Fprintln(os.Stderr, "up error: airlock.yaml changed since the container was created (mounts, image, or security); rerun with: airlock up --recreate")
+				os.Exit(1)
+			}
+			if drift == container.DriftBuild && !*recreate {
+				if cfg.Build.AutoRecreate || stdinIsTerminal() && prompt(bufio.NewReader(os.Stdin), "The Containerfile or build inputs changed. Rebuild the image and recreate the container? Running sessions will end. [y/N] ") == "y" {
+					*recreate = true
+				} else {
+					fmt.Fprintln(os.Stderr, "The image is rebuilt, but the container keeps running the old one until: airlock up --recreate")
+				}
+			}
+			if drift == container.DriftEnv && !*recreate {
+				// Sessions pass the current env, so the running container and its sessions are left alone.
+				fmt.Fprintln(os.Stderr, "Env changed in airlock.yaml; new enter/exec sessions use it. Variables removed from airlock.yaml stay set until: airlock up --recreate")
+			}
+			up := runner.Up
+			if drift != container.DriftNone && *recreate {
+				up = runner.Recreate
+			}
+			if err := up(ctx, cfg, absProj); err != nil {
+				fmt.Fprintf(os.Stderr, "up error: %v\n", err)
+				os.Exit(1)
+			}
+			daemon.Mark(daemon.SocketPath(), daemonKey(eng, cfg), container.ContainerName(cfg))
+			if *wait {
+				status, err := runner.WaitReady(ctx, cfg, *timeout)
+				if status != nil {
+					b, _ := json.MarshalIndent(status, "", "  ")
+					fmt.Println(string(b))
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "up error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+		case "verify":
+			if err := runner.Up(ctx, cfg, absProj); err != nil {
+				fmt.Fprintf(os.Stderr, "up error: %v\n", err)
+				os.Exit(1)
+			}
+			results, err := runner.Verify(ctx, cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "verify error: %v\n", err)
+				os.Exit(1)
+			}
+			failed := false
+			for _, res := range results {
+				fmt.Printf("%-4s  %-42s %s\n", res.Status, res.Name, res.Detail)
+				if res.Status == container.CheckFail {
+					failed = true
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+
+		case "bench":
+			fs := flag.NewFlagSet("bench", flag.ExitOnError)
+			size := fs.Int("size", 256, "Size in MB of the sequential read/write test file")
+			files := fs.Int("files", 1000, "Number of small files for the create/stat test")
+			_ = fs.Parse(cmdArgs)
 			if err := runner.Up(ctx, cfg, absProj); err != nil {
 				fmt.Fprintf(os.Stderr, "up error: %v\n", err)
 				os.Exit(1)
 			}
+			results, err := runner.Bench(ctx, cfg, container.BenchOptions{SizeMB: *size, Files: *files})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "bench error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%-18s %12s %12s %14s %10s\n", "TARGET", "WRITE MB/s", "READ MB/s", "CREATE files/s", "STAT")
+			for _, res := range results {
+				fmt.Printf("%-18s %12.1f %12.1f %14.0f %10s\n", res.Target, res.WriteMBps, res.ReadMBps, res.CreatePerS, res.StatLatency.Round(time.Millisecond))
+			}
+
+		case "audit":
+			if len(cmdArgs) == 0 || (cmdArgs[0] != "syscalls" && cmdArgs[0] != "commits") {
+				fmt.Fprintln(os.Stderr, "audit requires a subcommand: syscalls or commits")
+				os.Exit(2)
+			}
+			if cmdArgs[0] == "commits" {
+				fs := flag.NewFlagSet("audit commits", flag.ExitOnError)
+				since := fs.Duration("since", 30*24*time.Hour, "How far back to report")
+				_ = fs.Parse(cmdArgs[1:])
+				workDir := cfg.WorkDir
+				if !filepath.IsAbs(workDir) {
+					workDir = filepath.Join(absProj, workDir)
+				}
+				if err := printCommitReport(ctx, absProj, workDir, time.Now().Add(-*since)); err != nil {
+					fmt.Fprintf(os.Stderr, "audit error: %v\n", err)
+					os.Exit(1)
+				}
+				break
+			}
+			fs := flag.NewFlagSet("audit syscalls", flag.ExitOnError)
+			since := fs.Duration("since", 24*time.Hour, "How far back to report")
+			_ = fs.Parse(cmdArgs[1:])
+			if err := printSyscallReport(ctx, absProj, time.Now().Add(-*since)); err != nil {
+				fmt.Fprintf(os.Stderr, "audit error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "net":
+			if len(cmdArgs) == 0 || cmdArgs[0] != "report" {
+				fmt.Fprintln(os.Stderr, "net requires a subcommand: report")
+				os.Exit(2)
+			}
+			fs := flag.NewFlagSet("net report", flag.ExitOnError)
+			since := fs.Duration("since", 24*time.Hour, "How far back to report")
+			_ = fs.Parse(cmdArgs[1:])
+			if err := printTrafficReport(absProj, time.Now().Add(-*since)); err != nil {
+				fmt.Fprintf(os.Stderr, "net error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "pr":
+			fs := flag.NewFlagSet("pr", flag.ExitOnError)
+			var opts pr.Options
+			fs.StringVar(&opts.Base, "base", "", "Target branch (default: the remote's default branch)")
+			fs.StringVar(&opts.Branch, "branch", "", "Branch to push (default: the current branch, or a new airlock/ branch when on the base)")
+			fs.StringVar(&opts.Title, "title", "", "Pull request title (default: filled from the commits)")
+			fs.StringVar(&opts.Remote, "remote", "origin", "Remote to push to")
+			fs.BoolVar(&opts.Draft, "draft", false, "Open the pull request as a draft")
+			_ = fs.Parse(cmdArgs)
+			workDir := cfg.WorkDir
+			if !filepath.IsAbs(workDir) {
+				workDir = filepath.Join(absProj, workDir)
+			}
+			repo := &pr.Repo{Dir: workDir}
+			branch, err := repo.Open(ctx, cfg.Name, opts, time.Now())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "pr error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Pushed %s.\n", branch)
+
+		case "approvals":
+			if err := reviewApprovals(ctx, runner, cfg, absProj); err != nil {
+				fmt.Fprintf(os.Stderr, "approvals error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "allow":
+			if err := allowTemporarily(ctx, runner, cfgFile, absProj, cmdArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "allow error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "grants":
+			if len(cmdArgs) > 0 && cmdArgs[0] == "expire" {
+				// Scheduled by `allow`: wait for the grant to lapse, then revoke it.
+				fs := flag.NewFlagSet("grants expire", flag.ExitOnError)
+				at := fs.String("at", "", "RFC3339 time to revoke at")
+				_ = fs.Parse(cmdArgs[1:])
+				if t, err := time.Parse(time.RFC3339, *at); err == nil {
+					time.Sleep(time.Until(t))
+				}
+				if _, err := revokeExpiredGrants(ctx, runner, cfg, cfgFile, absProj); err != nil {
+					fmt.Fprintf(os.Stderr, "grants error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			grants, err := config.ReadGrants(absProj)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "grants error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, g := range grants {
+				until := "permanent"
+				if g.Expires != nil {
+					until = "until " + g.Expires.Local().Format(time.RFC3339)
+					if g.Expired(time.Now()) {
+						until = "expired"
+					}
+				}
+				desc := g.Kind + " " + g.Value
+				if g.Target != "" {
+					desc += " -> " + g.Target + " (" + g.Mode + ")"
+				}
+				fmt.Printf("%-60s %s\n", desc, until)
+			}
+
+		case "prefetch":
+			fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+			wait := fs.Bool("wait", false, "Run in the foreground instead of in the background")
+			_ = fs.Parse(cmdArgs)
+			if !*wait {
+				absCfg, _ := filepath.Abs(cfgFile)
+				logPath := filepath.Join(absProj, ".airlock", "state", "prefetch.log")
+				if _, err := background.Start([]string{"--config", absCfg, "prefetch", "--wait"}, logPath); err != nil {
+					fmt.Fprintf(os.Stderr, "prefetch error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Prefetching images for %s in the background (log: %s)\n", cfg.Name, logPath)
+				return
+			}
+			if err := runner.Prefetch(ctx, cfg, absProj); err != nil {
+				fmt.Fprintf(os.Stderr, "prefetch error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Prefetched images for %s\n", cfg.Name)
+
+		case "sync":
+			if err := runSync(ctx, runner, cfg, absProj, cmdArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "sync error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "engine-proxy":
+			// Started in the background by ensureEngineProxy; serves until `down` stops it.
+			if cfg.EngineSocket == nil {
+				fmt.Fprintln(os.Stderr, "engine-proxy error: engineSocket is not configured")
+				os.Exit(1)
+			}
+			upstream, err := runner.EngineSocketPath(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "engine-proxy error: %v\n", err)
+				os.Exit(1)
+			}
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			sock := sockproxy.SocketPath(absProj)
+			fmt.Fprintf(os.Stderr, "engine proxy listening on %s (upstream %s)\n", sock, upstream)
+			proxy := sockproxy.New(upstream, sockproxy.Policy{Images: cfg.EngineSocket.Images})
+			if err := proxy.Serve(ctx, sock); err != nil {
+				fmt.Fprintf(os.Stderr, "engine-proxy error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "checkpoint", "restore":
+			var archive string
+			if len(cmdArgs) > 0 {
+				archive = cmdArgs[0]
+			}
+			if cmd == "checkpoint" {
+				err = runner.Checkpoint(ctx, cfg, archive)
+			} else {
+				err = runner.Restore(ctx, cfg, archive)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s error: %v\n", cmd, err)
+				os.Exit(1)
+			}
+
+		case "logs":
+			fs := flag.NewFlagSet("logs", flag.ExitOnError)
+			follow := fs.Bool("f", false, "Follow log output")
+			tail := fs.Int("tail", 0, "Only show the last N lines")
+			_ = fs.Parse(cmdArgs)
+			if err := runner.Logs(ctx, cfg, *follow, *tail); err != nil {
+				fmt.Fprintf(os.Stderr, "logs error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "rebuild":
+			fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+			noCache := fs.Bool("no-cache", false, "Build without using the engine's layer cache")
+			_ = fs.Parse(cmdArgs)
+			if err := runner.Rebuild(ctx, cfg, absProj, *noCache); err != nil {
+				fmt.Fprintf(os.Stderr, "rebuild error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "push":
+			var ref string
+			if len(cmdArgs) > 0 {
+				ref = cmdArgs[0]
+			}
+			pushed, err := runner.Push(ctx, cfg, absProj, ref)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "push error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Pushed %s; teammates can set image: %s to run it without building\n", pushed, pushed)
+
+		case "home":
+			if err := runHome(cfg, absProj, cmdArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "home error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "review":
+			fs := flag.NewFlagSet("review", flag.ExitOnError)
+			mark := fs.Bool("mark", false, "Record the current workspace as reviewed and exit")
+			statOnly := fs.Bool("stat", false, "Only print a summary of changed files")
+			_ = fs.Parse(cmdArgs)
+			if err := reviewChanges(ctx, cfg, absProj, *mark, *statOnly); err != nil {
+				fmt.Fprintf(os.Stderr, "review error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "image":
+			if len(cmdArgs) == 0 {
+				fmt.Fprintln(os.Stderr, "image requires a subcommand: save or load")
+				os.Exit(2)
+			}
+			var archive string
+			if len(cmdArgs) > 1 {
+				archive = cmdArgs[1]
+			}
+			switch cmdArgs[0] {
+			case "save":
+				err = runner.SaveImage(ctx, cfg, absProj, archive)
+			case "load":
+				err = runner.LoadImage(ctx, cfg, absProj, archive)
+			default:
+				fmt.Fprintf(os.Stderr, "Unknown image subcommand: %s\n", cmdArgs[0])
+				os.Exit(2)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "image %s error: %v\n", cmdArgs[0], err)
+				os.Exit(1)
+			}
 
 		case "enter":
-			if err := runner.Enter(ctx, cfg, absProj, envVars); err != nil {
+			fs := flag.NewFlagSet("enter", flag.ExitOnError)
+			var localEnv stringSlice
+			fs.Var(&localEnv, "e", "Set KEY=VALUE, or forward the ambient value of KEY (repeatable)")
+			var envFiles stringSlice
+			fs.Var(&envFiles, "env-file", "Read KEY=VALUE pairs from a dotenv file (repeatable; -e wins)")
+			workdir := fs.String("workdir", "", "Start in this directory (relative to the workspace, or absolute)")
+			user := fs.String("user", "", "Run as this user (name or uid[:gid]), e.g. root for package installs")
+			_ = fs.Parse(cmdArgs)
+			env, err := resolveEnvFlags(envFiles, append(*envVars, localEnv...))
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "enter error: %v\n", err)
-				os.Exit(1)
+				os.Exit(2)
+			}
+			flushSync(ctx, runner, cfg, absProj)
+			err = runner.Enter(ctx, cfg, absProj, container.EnterOptions{Env: env, WorkDir: *workdir, User: *user})
+			flushSync(ctx, runner, cfg, absProj)
+			if err != nil {
+				exitWithSession("enter", err)
 			}
 
 		case "exec":
+			fs := flag.NewFlagSet("exec", flag.ExitOnError)
+			stdinFile := fs.String("stdin-file", "", "Feed this host file to the command's stdin")
+			network := fs.String("network", "", "Run this command under a stricter network policy: none, or allowlist:<profile> from network.profiles")
+			workdir := fs.String("workdir", "", "Run in this directory (relative to the workspace, or absolute)")
+			user := fs.String("user", "", "Run as this user (name or uid[:gid]), e.g. root for package installs")
+			detach := fs.Bool("d", false, "Start the command as a background job and return its ID (see: airlock jobs, airlock attach)")
+			forceTTY := fs.Bool("tty", false, "Always allocate a TTY for the command")
+			noTTY := fs.Bool("no-tty", false, "Never allocate a TTY, even on a terminal")
+			var localEnv stringSlice
+			fs.Var(&localEnv, "e", "Set KEY=VALUE, or forward the ambient value of KEY (repeatable)")
+			var envFiles stringSlice
+			fs.Var(&envFiles, "env-file", "Read KEY=VALUE pairs from a dotenv file (repeatable; -e wins)")
+			_ = fs.Parse(cmdArgs)
+			cmdArgs = fs.Args()
 			if len(cmdArgs) == 0 {
 				fmt.Fprintln(os.Stderr, "exec requires a command, e.g. airlock exec -- ls -la")
 				os.Exit(2)
 			}
-			if cmdArgs[0] == "--" {
-				cmdArgs = cmdArgs[1:]
+			env, err := resolveEnvFlags(envFiles, append(*envVars, localEnv...))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+				os.Exit(2)
+			}
+			opts := container.ExecOptions{Env: env, WorkDir: *workdir, User: *user}
+			switch {
+			case *forceTTY && *noTTY:
+				fmt.Fprintln(os.Stderr, "exec error: --tty and --no-tty are mutually exclusive")
+				os.Exit(2)
+			case *forceTTY, *noTTY:
+				opts.TTY = forceTTY
+			}
+			if *stdinFile != "" {
+				f, err := os.Open(*stdinFile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				opts.Stdin = f
+			}
+			if *network != "" {
+				n, err := cfg.Network.Restrict(*network)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+					os.Exit(2)
+				}
+				opts.Network = &n
+			}
+			if !warm {
+				if err := runner.Up(ctx, cfg, absProj); err != nil {
+					fmt.Fprintf(os.Stderr, "up error: %v\n", err)
+					os.Exit(1)
+				}
+				daemon.Mark(daemon.SocketPath(), daemonKey(eng, cfg), container.ContainerName(cfg))
+			}
+			if *detach {
+				if opts.Network != nil || opts.Stdin != nil || opts.TTY != nil {
+					fmt.Fprintln(os.Stderr, "exec error: -d can't be combined with --network, --stdin-file, --tty, or --no-tty")
+					os.Exit(2)
+				}
+				job, err := runner.ExecDetached(ctx, cfg, absProj, cmdArgs, opts)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(job.ID)
+				fmt.Fprintf(os.Stderr, "Started job %s; follow it with: airlock attach %s\n", job.ID, job.ID)
+				return
+			}
+			if warm {
+				// up, which syncs the workspace, was skipped.
+				flushSync(ctx, runner, cfg, absProj)
+			}
+			err = runner.Exec(ctx, cfg, absProj, cmdArgs, opts)
+			flushSync(ctx, runner, cfg, absProj)
+			if err != nil {
+				exitWithSession("exec", err)
+			}
+
+		case "cp":
+			if len(cmdArgs) != 2 {
+				fmt.Fprintln(os.Stderr, "cp requires a source and a destination, one of them container:<path>, e.g. airlock cp container:dist/app.tar.gz .")
+				os.Exit(2)
+			}
+			if err := runner.Copy(ctx, cfg, cmdArgs[0], cmdArgs[1]); err != nil {
+				fmt.Fprintf(os.Stderr, "cp error: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "batch":
+			fs := flag.NewFlagSet("batch", flag.ExitOnError)
+			reportPath := fs.String("report", "", "Write the JSON report to this file instead of stdout")
+			_ = fs.Parse(cmdArgs)
+			if fs.NArg() != 1 {
+				fmt.Fprintln(os.Stderr, "batch requires a steps file (YAML or JSON, - for stdin)")
+				os.Exit(2)
+			}
+			plan, err := batch.Load(fs.Arg(0))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "batch error: %v\n", err)
+				os.Exit(2)
 			}
 			if err := runner.Up(ctx, cfg, absProj); err != nil {
 				fmt.Fprintf(os.Stderr, "up error: %v\n", err)
 				os.Exit(1)
 			}
-			if err := runner.Exec(ctx, cfg, absProj, envVars, cmdArgs); err != nil {
-				fmt.Fprintf(os.Stderr, "exec error: %v\n", err)
+			report := batch.Run(ctx, plan, &batchSandbox{runner: runner, cfg: cfg, absProj: absProj}, os.Stderr)
+			b, _ := json.MarshalIndent(report, "", "  ")
+			if *reportPath != "" {
+				err = os.WriteFile(*reportPath, append(b, '\n'), 0644)
+			} else {
+				_, err = fmt.Println(string(b))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "batch error: %v\n", err)
+				os.Exit(1)
+			}
+			if !report.OK {
+				os.Exit(1)
+			}
+
+		case "jobs":
+			jobs, err := runner.Jobs(ctx, cfg, absProj)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "jobs error: %v\n", err)
 				os.Exit(1)
 			}
+			for _, j := range jobs {
+				status := j.Status
+				if j.Status == container.JobExited {
+					status = fmt.Sprintf("exited(%d)", j.ExitCode)
+				}
+				fmt.Printf("%s  %-10s  %s  %s\n", j.ID, status, j.Started.Local().Format("2006-01-02 15:04"), strings.Join(j.Command, " "))
+			}
+
+		case "attach":
+			if len(cmdArgs) == 0 {
+				if err := runner.Attach(ctx, cfg); err != nil {
+					fmt.Fprintf(os.Stderr, "attach error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			actx, stop := signal.NotifyContext(ctx, os.Interrupt)
+			err := runner.AttachJob(actx, cfg, absProj, cmdArgs[0], os.Stdout)
+			stop()
+			if actx.Err() != nil && err == nil {
+				fmt.Fprintln(os.Stderr, "\nDetached; the job keeps running.")
+				return
+			}
+			if err != nil {
+				exitWithSession("attach", err)
+			}
 		}
 
 	default:
@@ -184,27 +856,1064 @@ func (s *stringSlice) Set(value string) error {
 }
 
 // Helper function to allow one-line assignment
-func stringSliceFlag(name string, usage string) []string {
+func stringSliceFlag(name string, usage string) *stringSlice {
 	var s stringSlice
 	flag.Var(&s, name, usage)
-	return s
+	return &s
 }
 
-func loadConfig(path string) (*config.Config, string, error) {
-	cfgFile := path
-	if cfgFile == "" {
-		for _, cand := range []string{"airlock.yaml", "airlock.yml"} {
-			if _, err := os.Stat(cand); err == nil {
-				cfgFile = cand
-				break
+// resolveEnvFlags turns --env-file contents and -e values into KEY=VALUE pairs, in that order so
+// -e wins. KEY=VALUE is passed as given; a bare KEY forwards the host's value, with a warning (and
+// nothing forwarded) when it isn't set.
+func resolveEnvFlags(envFiles, values []string) ([]string, error) {
+	var env []string
+	for _, f := range envFiles {
+		entries, err := config.ReadEnvFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("--env-file: %w", err)
+		}
+		env = append(env, entries...)
+	}
+	for _, v := range values {
+		key, val, explicit := strings.Cut(v, "=")
+		if !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("-e %q: %q is not a valid variable name", v, key)
+		}
+		if !explicit {
+			var ok bool
+			if val, ok = os.LookupEnv(key); !ok {
+				fmt.Fprintf(os.Stderr, "warning: -e %s: not set on the host; not forwarding it\n", key)
+				continue
 			}
 		}
+		env = append(env, key+"="+val)
 	}
-	if cfgFile == "" {
-		return nil, "", fmt.Errorf("no airlock.yaml found")
+	return env, nil
+}
+
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reviewApprovals prompts for each pending in-sandbox access request, records approved ones as grants,
+// and offers to recreate the container so they take effect.
+func reviewApprovals(ctx context.Context, runner *container.Runner, cfg *config.Config, absProj string) error {
+	dir := broker.Dir(absProj)
+	pending, err := broker.Pending(dir)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("No pending requests.")
+		return nil
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	needsRecreate, needsPolicy := false, false
+	for _, req := range pending {
+		// The request comes from the sandbox: escape sequences in it could repaint the prompt.
+		fmt.Printf("Request %s: %s\n", sanitize.Text([]byte(req.ID)), sanitize.Text([]byte(req.String())))
+		decision := "skipped"
+		switch prompt(in, "Approve? [y/N/s(kip)] ") {
+		case "y", "yes":
+			decision = "approved"
+		case "s", "skip":
+			continue
+		default:
+			decision = "rejected"
+		}
+
+		if decision == "approved" {
+			switch req.Kind {
+			case broker.KindMount:
+				if err := config.AddGrant(absProj, config.Grant{Kind: req.Kind, Value: req.Value, Target: req.Target, Mode: req.Mode}); err != nil {
+					return err
+				}
+				needsRecreate = true
+			case broker.KindPort:
+				port, err := config.ParsePort(req.Value)
+				if err != nil {
+					fmt.Printf("Invalid port request (%v); rejecting.\n", err)
+					decision = "rejected: " + err.Error()
+					break
+				}
+				// Ports requested from inside the sandbox are only published on loopback unless an address was given.
+				if port.HostIP == "" {
+					port.HostIP = "127.0.0.1"
+				}
+				if err := config.AddGrant(absProj, config.Grant{Kind: req.Kind, Value: port.String()}); err != nil {
+					return err
+				}
+				needsRecreate = true
+			case broker.KindDomain:
+				if err := config.AddGrant(absProj, config.Grant{Kind: req.Kind, Value: req.Value}); err != nil {
+					return err
+				}
+				needsPolicy = true
+			default:
+				fmt.Printf("Request kind %q is not supported yet; rejecting.\n", req.Kind)
+				decision = "rejected: unsupported request kind"
+			}
+		}
+
+		if err := broker.Resolve(dir, req, decision); err != nil {
+			return err
+		}
+		if err := audit.Append(audit.Path(absProj), audit.Event{Kind: audit.KindApproval, Detail: decision + ": " + req.String()}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+		}
+	}
+
+	if needsRecreate {
+		if prompt(in, "Recreate the container now to apply approved access? Running sessions will end. [y/N] ") != "y" {
+			fmt.Println("Approved access applies the next time the container is created (airlock down && airlock up).")
+			return nil
+		}
+		updated, _, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		return runner.Recreate(ctx, updated, absProj)
+	}
+	if needsPolicy {
+		updated, _, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if len(updated.Network.Allow) == 0 {
+			fmt.Println("Note: the sandbox network is unrestricted (no network.allow list), so approved domains have no effect.")
+		}
+		return runner.ApplyNetworkPolicy(ctx, updated)
+	}
+	return nil
+}
+
+// allowTemporarily records a time-boxed grant, applies it, and schedules its revocation.
+func allowTemporarily(ctx context.Context, runner *container.Runner, cfgFile string, absProj string, args []string) error {
+	fs := flag.NewFlagSet("allow", flag.ExitOnError)
+	dur := fs.Duration("for", time.Hour, "How long the grant lasts, e.g. 15m or 1h")
+	rw := fs.Bool("rw", false, "Mount read-write (mount grants are read-only by default)")
+	pos := parseInterspersed(fs, args)
+	if len(pos) < 2 {
+		return fmt.Errorf("usage: airlock allow mount <path> [target] [--rw] --for 1h | airlock allow network <domain> --for 15m")
+	}
+
+	expires := time.Now().Add(*dur).UTC().Truncate(time.Second)
+	g := config.Grant{Value: pos[1], Expires: &expires}
+	switch pos[0] {
+	case "mount":
+		src, err := filepath.Abs(pos[1])
+		if err != nil {
+			return err
+		}
+		g.Kind = "mount"
+		g.Value = src
+		g.Target = "/mnt/airlock/" + filepath.Base(src)
+		if len(pos) > 2 {
+			g.Target = pos[2]
+		}
+		g.Mode = "ro"
+		if *rw {
+			g.Mode = "rw"
+		}
+	case "network":
+		g.Kind = "domain"
+	default:
+		return fmt.Errorf("unknown grant type %q (expected mount or network)", pos[0])
+	}
+
+	if err := config.AddGrant(absProj, g); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("%s %s until %s", g.Kind, g.Value, expires.Local().Format(time.RFC3339))
+	if err := audit.Append(audit.Path(absProj), audit.Event{Kind: audit.KindGrant, Detail: "granted " + detail}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+
+	absCfg, _ := filepath.Abs(cfgFile)
+	logPath := filepath.Join(absProj, ".airlock", "state", "grants.log")
+	if _, err := background.Start([]string{"--config", absCfg, "grants", "expire", "--at", expires.Format(time.RFC3339)}, logPath); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to schedule revocation (it will happen on the next airlock command after expiry): %v\n", err)
+	}
+	fmt.Println("Allowed " + detail)
+
+	switch g.Kind {
+	case "mount":
+		cfg, _, err := loadConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Recreating the container to apply the mount...")
+		return runner.Recreate(ctx, cfg, absProj)
+	case "domain":
+		cfg, _, err := loadConfig(cfgFile)
+		if err != nil {
+			return err
+		}
+		if len(cfg.Network.Allow) == 0 {
+			fmt.Println("Note: the sandbox network is unrestricted (no network.allow list), so this grant has no effect.")
+			return nil
+		}
+		if exists, _ := runner.Exists(ctx, cfg); exists {
+			return runner.ApplyNetworkPolicy(ctx, cfg)
+		}
 	}
+	return nil
+}
 
-	cfg, err := config.Load(cfgFile)
+// grantRevoker is the part of container.Runner that revokeExpiredGrants needs.
+type grantRevoker interface {
+	Exists(ctx context.Context, cfg *config.Config) (bool, error)
+	ApplyNetworkPolicy(ctx context.Context, cfg *config.Config) error
+	Recreate(ctx context.Context, cfg *config.Config, absProjectDir string) error
+}
+
+// revokeExpiredGrants drops lapsed grants and recreates the container (or reapplies its network
+// policy) if it was running with any of them. cfg may predate the expiry (`grants expire` loads it
+// before sleeping until then), so the config is reloaded without the lapsed grants first; the
+// reloaded config is returned for the caller to carry on with.
+func revokeExpiredGrants(ctx context.Context, runner grantRevoker, cfg *config.Config, cfgFile, absProj string) (*config.Config, error) {
+	expired, err := config.PruneExpiredGrants(absProj, time.Now())
+	if err != nil || len(expired) == 0 {
+		return cfg, err
+	}
+	recreate, reapply := false, false
+	for _, g := range expired {
+		if err := audit.Append(audit.Path(absProj), audit.Event{Kind: audit.KindGrant, Detail: "expired " + g.Kind + " " + g.Value}); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+		}
+		switch g.Kind {
+		case "mount", "port":
+			recreate = true
+		case "domain":
+			reapply = true
+		}
+	}
+	fresh, _, err := loadConfig(cfgFile)
+	if err != nil {
+		return cfg, err
+	}
+	if !recreate && !reapply {
+		return fresh, nil
+	}
+	exists, err := runner.Exists(ctx, fresh)
+	if err != nil || !exists {
+		return fresh, err
+	}
+	if !recreate {
+		return fresh, runner.ApplyNetworkPolicy(ctx, fresh)
+	}
+	fmt.Fprintln(os.Stderr, "Temporary grant expired; recreating the container to revoke it.")
+	return fresh, runner.Recreate(ctx, fresh, absProj)
+}
+
+// runWorkspace implements `airlock ws`: it runs up, down, status, prefetch, or exec in every project listed in
+// the nearest airlock.workspace.yaml, one after another, and fails if any project failed.
+func runWorkspace(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("ws requires a subcommand: up, down, status, prefetch, or exec")
+	}
+	sub, subArgs := args[0], args[1:]
+	switch sub {
+	case "up", "down", "status", "prefetch":
+	case "exec":
+		if len(subArgs) == 0 {
+			return fmt.Errorf("ws exec requires a command")
+		}
+	default:
+		return fmt.Errorf("unknown ws subcommand %q (expected up, down, status, prefetch, or exec)", sub)
+	}
+
+	wsFile, err := config.FindWorkspace(".")
+	if err != nil {
+		return err
+	}
+	ws, err := config.LoadWorkspace(wsFile)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, p := range ws.Projects {
+		cfgFile, _ := ws.ProjectConfig(p)
+		childArgs := []string{"--config", cfgFile}
+		if *verbose {
+			childArgs = append(childArgs, "-v")
+		}
+		if *profile != "" {
+			childArgs = append(childArgs, "--profile", *profile)
+		}
+		if *instance != "" {
+			childArgs = append(childArgs, "--instance", *instance)
+		}
+		for _, e := range *envVars {
+			childArgs = append(childArgs, "-e", e)
+		}
+		childArgs = append(childArgs, sub)
+		childArgs = append(childArgs, subArgs...)
+
+		fmt.Fprintf(os.Stderr, "==> %s\n", p)
+		child := exec.CommandContext(ctx, self, childArgs...)
+		child.Dir = ws.ProjectDir(p)
+		child.Stdout = os.Stdout
+		child.Stderr = os.Stderr
+		if err := child.Run(); err != nil {
+			failed = append(failed, p)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s failed in %d of %d projects: %s", sub, len(failed), len(ws.Projects), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// hasFlag reports whether args, before any "--", set the named flag.
+func hasFlag(args []string, name string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if !strings.HasPrefix(a, "-") {
+			continue
+		}
+		a = strings.TrimLeft(a, "-")
+		if a == name || strings.HasPrefix(a, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// runExecEach implements `airlock exec --each <pattern> -- <cmd...>`: the command runs concurrently
+// in every matching container, with each output line prefixed by the container (or project) name.
+// The pattern is "services" (this project's services), "workspace" (every workspace project's
+// sandbox, each a full exec session), or a glob over running airlock container names.
+func runExecEach(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	pattern := fs.String("each", "", "Run in every container matching: services, workspace, or a name glob")
+	user := fs.String("user", "", "Run as this user (name or uid[:gid])")
+	var localEnv stringSlice
+	fs.Var(&localEnv, "e", "Set KEY=VALUE, or forward the ambient value of KEY (repeatable)")
+	_ = fs.Parse(args)
+	cmdArgs := fs.Args()
+	if len(cmdArgs) == 0 {
+		return errors.New("exec --each requires a command, e.g. airlock exec --each 'web-*' -- git pull")
+	}
+	if *pattern == "" {
+		return errors.New("--each requires a pattern: services, workspace, or a container name glob")
+	}
+	env, err := resolveEnvFlags(nil, append(*envVars, localEnv...))
+	if err != nil {
+		return err
+	}
+
+	var targets []container.FanoutTarget
+	if *pattern == "workspace" {
+		wsFile, err := config.FindWorkspace(".")
+		if err != nil {
+			return err
+		}
+		ws, err := config.LoadWorkspace(wsFile)
+		if err != nil {
+			return err
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		for _, p := range ws.Projects {
+			cfgFile, _ := ws.ProjectConfig(p)
+			childArgs := []string{"--config", cfgFile}
+			if *verbose {
+				childArgs = append(childArgs, "-v")
+			}
+			if *profile != "" {
+				childArgs = append(childArgs, "--profile", *profile)
+			}
+			if *instance != "" {
+				childArgs = append(childArgs, "--instance", *instance)
+			}
+			for _, e := range env {
+				childArgs = append(childArgs, "-e", e)
+			}
+			childArgs = append(childArgs, "exec", "--no-tty")
+			if *user != "" {
+				childArgs = append(childArgs, "--user", *user)
+			}
+			childArgs = append(append(childArgs, "--"), cmdArgs...)
+			child := exec.CommandContext(ctx, self, childArgs...)
+			child.Dir = ws.ProjectDir(p)
+			targets = append(targets, container.FanoutTarget{Name: p, Cmd: child})
+		}
+	} else {
+		cfg, _, cfgErr := loadConfig(*configPath)
+		engineName := ""
+		if cfgErr == nil {
+			engineName = cfg.Engine.Type
+		}
+		eng, err := container.DetectEngine(engineName)
+		if err != nil {
+			return err
+		}
+		runner := container.NewRunner(eng)
+		runner.Verbose = *verbose
+		var names []string
+		if *pattern == "services" {
+			if cfgErr != nil {
+				return fmt.Errorf("--each services needs the project's config: %w", cfgErr)
+			}
+			names = container.ServiceContainers(cfg)
+		} else {
+			var opts container.ListOptions
+			if cfgErr == nil && cfg.SharedHost {
+				opts.Owner = cfg.Owner
+			}
+			if names, err = runner.MatchContainers(ctx, *pattern, opts); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			targets = append(targets, container.FanoutTarget{Name: name, Cmd: runner.ExecCommand(ctx, name, env, *user, cmdArgs)})
+		}
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no containers match %q", *pattern)
+	}
+
+	if failed := container.Fanout(targets, os.Stdout, os.Stderr); len(failed) > 0 {
+		return fmt.Errorf("failed in %d of %d: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// runDoctor implements `airlock doctor`. Like daemon, it works outside a project, using the
+// project's engine when there is one.
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "Repair what can be repaired (the podman machine's clock, low inotify limits)")
+	_ = fs.Parse(args)
+	engineName := ""
+	if cfg, _, err := loadConfig(*configPath); err == nil {
+		engineName = cfg.Engine.Type
+	}
+	eng, err := container.DetectEngine(engineName)
+	if err != nil {
+		return err
+	}
+	runner := container.NewRunner(eng)
+	runner.Verbose = *verbose
+
+	failed := 0
+	for _, res := range runner.Doctor(ctx, *fix) {
+		fmt.Printf("%-4s  %-8s %s\n", res.Status, res.Name, res.Detail)
+		if res.Status == container.CheckFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// runDaemon implements `airlock daemon`: it serves readiness lookups until interrupted, forgetting a
+// sandbox whenever the engine reports an event for its container.
+func runDaemon(ctx context.Context) error {
+	engineName := ""
+	if cfg, _, err := loadConfig(*configPath); err == nil {
+		engineName = cfg.Engine.Type
+	}
+	eng, err := container.DetectEngine(engineName)
+	if err != nil {
+		return err
+	}
+	runner := container.NewRunner(eng)
+	runner.Verbose = *verbose
+	runner.Version = version
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	events, err := runner.ContainerEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s events: %w", eng, err)
+	}
+	sock := daemon.SocketPath()
+	fmt.Fprintf(os.Stderr, "airlock daemon listening on %s\n", sock)
+	return daemon.NewServer().Serve(ctx, sock, events)
+}
+
+// daemonKey identifies a sandbox brought up with a specific engine and effective config.
+func daemonKey(eng container.Engine, cfg *config.Config) string {
+	b, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(append([]byte(string(eng)+"\n"), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+// engineProxyPIDPath records the background engine socket proxy's PID. It lives outside the
+// directory mounted into the sandbox so the sandbox can't point `down` at another process.
+func engineProxyPIDPath(absProj string) string {
+	return filepath.Join(absProj, ".airlock", "state", "engine-proxy.pid")
+}
+
+// ensureEngineProxy starts the project's engine socket proxy in the background unless it is
+// already serving, and waits for its socket to accept connections.
+func ensureEngineProxy(cfgFile, absProj string) error {
+	sock := sockproxy.SocketPath(absProj)
+	if sockproxy.Running(sock) {
+		return nil
+	}
+	absCfg, _ := filepath.Abs(cfgFile)
+	logPath := filepath.Join(absProj, ".airlock", "state", "engine-proxy.log")
+	pid, err := background.Start([]string{"--config", absCfg, "engine-proxy"}, logPath)
+	if err != nil {
+		return err
+	}
+	_ = os.WriteFile(engineProxyPIDPath(absProj), []byte(strconv.Itoa(pid)+"\n"), 0600)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if sockproxy.Running(sock) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("engine socket proxy did not start (see %s)", logPath)
+}
+
+// stopEngineProxy stops the project's engine socket proxy, if one is serving.
+func stopEngineProxy(absProj string) {
+	pidPath := engineProxyPIDPath(absProj)
+	b, err := os.ReadFile(pidPath)
+	if err != nil {
+		return
+	}
+	_ = os.Remove(pidPath)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || !sockproxy.Running(sockproxy.SocketPath(absProj)) {
+		return
+	}
+	if proc, err := os.FindProcess(pid); err == nil {
+		_ = proc.Kill()
+	}
+}
+
+// syncDaemonPIDPath records the background workspace sync's PID, like engineProxyPIDPath.
+func syncDaemonPIDPath(absProj string) string {
+	return filepath.Join(absProj, ".airlock", "state", "sync.pid")
+}
+
+// syncDaemonLockPath is held by the background workspace sync for as long as it runs.
+func syncDaemonLockPath(absProj string) string {
+	return filepath.Join(absProj, ".airlock", "state", "sync-daemon.lock")
+}
+
+// syncDaemonRunning reports whether the project's background workspace sync is running.
+func syncDaemonRunning(absProj string) bool {
+	release, ok, err := filelock.TryLock(syncDaemonLockPath(absProj))
+	if err != nil {
+		return false
+	}
+	if ok {
+		release()
+	}
+	return !ok
+}
+
+// ensureSyncDaemon starts the project's background workspace sync unless it is already running.
+func ensureSyncDaemon(cfgFile, absProj string) error {
+	if syncDaemonRunning(absProj) {
+		return nil
+	}
+	absCfg, _ := filepath.Abs(cfgFile)
+	logPath := filepath.Join(absProj, ".airlock", "state", "sync.log")
+	pid, err := background.Start([]string{"--config", absCfg, "sync", "run"}, logPath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(syncDaemonPIDPath(absProj), []byte(strconv.Itoa(pid)+"\n"), 0600)
+}
+
+// stopSyncDaemon stops the project's background workspace sync, if one is running.
+func stopSyncDaemon(absProj string) {
+	pidPath := syncDaemonPIDPath(absProj)
+	b, err := os.ReadFile(pidPath)
+	if err != nil {
+		return
+	}
+	_ = os.Remove(pidPath)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || !syncDaemonRunning(absProj) {
+		return
+	}
+	if proc, err := os.FindProcess(pid); err == nil {
+		_ = proc.Kill()
+	}
+}
+
+// flushSync syncs a synced workspace around an enter or exec session, so the session starts with the
+// host's latest edits and its output is on the host when airlock returns.
+func flushSync(ctx context.Context, runner *container.Runner, cfg *config.Config, absProj string) {
+	if cfg.Sync == nil {
+		return
+	}
+	if _, err := runner.SyncWorkspace(ctx, cfg, absProj); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to sync the workspace: %v\n", err)
+	}
+}
+
+// runSync implements `airlock sync`: status and flush, plus run, the background loop up starts.
+func runSync(ctx context.Context, runner *container.Runner, cfg *config.Config, absProj string, args []string) error {
+	if cfg.Sync == nil {
+		return errors.New("the workspace isn't synced (set sync in airlock.yaml)")
+	}
+	if len(args) == 0 {
+		return errors.New("sync requires a subcommand: status or flush")
+	}
+	switch args[0] {
+	case "status":
+		if syncDaemonRunning(absProj) {
+			fmt.Printf("background sync: running, every %s\n", time.Duration(cfg.Sync.Interval))
+		} else {
+			fmt.Println("background sync: not running (start it with: airlock up)")
+		}
+		st, err := filesync.ReadStatus(container.SyncStateDir(absProj))
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			fmt.Println("last sync: never")
+			return nil
+		}
+		fmt.Printf("last sync: %s (%s ago), %d paths\n", st.LastSync.Format(time.RFC3339), time.Since(st.LastSync).Round(time.Second), st.Files)
+		if st.LastError != "" {
+			fmt.Printf("last error: %s\n", st.LastError)
+		}
+		if len(st.Conflicts) > 0 {
+			fmt.Println("recent conflicts:")
+			for _, c := range st.Conflicts {
+				fmt.Printf("  %s  %s\n", c.At.Format(time.RFC3339), container.ConflictSummary(c))
+			}
+		}
+	case "flush":
+		plan, err := runner.SyncWorkspace(ctx, cfg, absProj)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Synced %d paths to the host and %d to the container\n",
+			len(plan.ToHost)+len(plan.MkdirHost)+len(plan.RemoveHost), len(plan.ToContainer)+len(plan.MkdirContainer)+len(plan.RemoveContainer))
+	case "run":
+		// Started in the background by ensureSyncDaemon; syncs until `down` stops it or the
+		// container stops.
+		release, ok, err := filelock.TryLock(syncDaemonLockPath(absProj))
+		if err != nil || !ok {
+			return err
+		}
+		defer release()
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return runner.RunSync(ctx, cfg, absProj)
+	default:
+		return fmt.Errorf("unknown sync subcommand %q (expected status or flush)", args[0])
+	}
+	return nil
+}
+
+// reviewChanges walks the user through every file changed since the review baseline, letting them
+// keep or revert whole files or individual hunks.
+func reviewChanges(ctx context.Context, cfg *config.Config, absProj string, mark, statOnly bool) error {
+	workDir := cfg.WorkDir
+	if !filepath.IsAbs(workDir) {
+		workDir = filepath.Join(absProj, workDir)
+	}
+	ws, err := review.Open(ctx, workDir)
+	if err != nil {
+		return err
+	}
+	if mark {
+		tree, err := ws.Mark(ctx, absProj)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Marked the current workspace as reviewed (tree " + tree[:12] + ")")
+		return nil
+	}
+
+	base, err := ws.Base(ctx, absProj)
+	if err != nil {
+		return err
+	}
+	current, err := ws.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	stat, err := ws.Stat(ctx, base, current)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(stat) == "" {
+		fmt.Println("No changes since the last review.")
+		return nil
+	}
+	fmt.Print(stat)
+	if statOnly {
+		return nil
+	}
+
+	changes, err := ws.Changes(ctx, base, current)
+	if err != nil {
+		return err
+	}
+	in := bufio.NewReader(os.Stdin)
+	reverted := 0
+	for _, f := range changes {
+		fmt.Printf("\n== %s (%s)\n", f.Path, f.Status)
+		choices := "[k]eep/[r]evert file/[h]unks/[q]uit"
+		if f.Binary || f.Status != "modified" || len(f.Hunks) < 2 {
+			choices = "[k]eep/[r]evert file/[q]uit"
+			fmt.Print(strings.Join(f.Hunks, ""))
+		}
+		switch prompt(in, choices+" ") {
+		case "r", "revert":
+			if err := ws.RevertFile(ctx, base, f); err != nil {
+				return err
+			}
+			reverted++
+		case "h", "hunks":
+			var revert []int
+			for i, h := range f.Hunks {
+				fmt.Print(h)
+				if prompt(in, fmt.Sprintf("Hunk %d/%d: [k]eep/[r]evert ", i+1, len(f.Hunks))) == "r" {
+					revert = append(revert, i)
+				}
+			}
+			if err := ws.RevertHunks(ctx, f, revert); err != nil {
+				return err
+			}
+			reverted += len(revert)
+		case "q", "quit":
+			return nil
+		}
+	}
+
+	fmt.Printf("\nReverted %d file(s)/hunk(s).\n", reverted)
+	if prompt(in, "Mark the workspace as reviewed now? [y/N] ") == "y" {
+		if _, err := ws.Mark(ctx, absProj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchSandbox carries out `airlock batch` steps in the project's sandbox.
+type batchSandbox struct {
+	runner  *container.Runner
+	cfg     *config.Config
+	absProj string
+}
+
+func (b *batchSandbox) Exec(ctx context.Context, step batch.Step, out io.Writer) error {
+	var env []string
+	for k, v := range step.Env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	noTTY := false
+	opts := container.ExecOptions{Env: env, WorkDir: step.WorkDir, User: step.User, Stdin: strings.NewReader(""), Output: out, TTY: &noTTY}
+	return b.runner.Exec(ctx, b.cfg, b.absProj, step.Exec, opts)
+}
+
+func (b *batchSandbox) Copy(ctx context.Context, from, to string) error {
+	return b.runner.Copy(ctx, b.cfg, from, to)
+}
+
+func (b *batchSandbox) SnapshotHome(ctx context.Context) (string, error) {
+	homeDir := b.cfg.HomeDir
+	if !filepath.IsAbs(homeDir) {
+		homeDir = filepath.Join(b.absProj, homeDir)
+	}
+	return snapshot.Create(homeDir, snapshot.HomeDir(b.absProj), time.Now())
+}
+
+// runHome implements `airlock home`: incremental snapshots of the sandbox home dir and rollback to them.
+func runHome(cfg *config.Config, absProj string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("home requires a subcommand: snapshot, list, or rollback")
+	}
+	homeDir := cfg.HomeDir
+	if !filepath.IsAbs(homeDir) {
+		homeDir = filepath.Join(absProj, homeDir)
+	}
+	root := snapshot.HomeDir(absProj)
+
+	switch args[0] {
+	case "snapshot":
+		name, err := snapshot.Create(homeDir, root, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Println("Created home snapshot " + name)
+	case "list":
+		names, err := snapshot.List(root)
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			fmt.Println(n)
+		}
+	case "rollback":
+		names, err := snapshot.List(root)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no home snapshots (create one with: airlock home snapshot)")
+		}
+		target := names[len(names)-1]
+		if len(args) > 1 {
+			target = args[1]
+		}
+		// Keep the current state too, so a rollback can itself be undone.
+		saved, err := snapshot.Create(homeDir, root, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := snapshot.Restore(homeDir, root, target); err != nil {
+			return err
+		}
+		fmt.Printf("Rolled home back to %s (previous state saved as %s)\n", target, saved)
+	default:
+		return fmt.Errorf("unknown home subcommand %q", args[0])
+	}
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between, or after positional args.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos
+		}
+		if args[0] == "--" {
+			return append(pos, args[1:]...)
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// stdinIsTerminal reports whether airlock can ask the user a question.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func prompt(in *bufio.Reader, question string) string {
+	fmt.Print(question)
+	answer, _ := in.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+func printSyscallReport(ctx context.Context, absProj string, since time.Time) error {
+	events, err := audit.Read(audit.Path(absProj))
+	if err != nil {
+		return err
+	}
+	var sessions []audit.Session
+	for _, s := range audit.Sessions(events) {
+		if s.End.IsZero() || s.End.After(since) {
+			sessions = append(sessions, s)
+		}
+	}
+	syscalls, err := audit.ReadKernelSeccomp(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	bySession, rest := audit.BySession(sessions, syscalls)
+	printCounts := func(events []audit.SyscallEvent) {
+		if len(events) == 0 {
+			fmt.Println("  (no unusual syscalls)")
+			return
+		}
+		for _, c := range audit.Summarize(events) {
+			fmt.Printf("  %6d  %-20s %-6s %s\n", c.Count, c.Syscall, c.Action, c.Comm)
+		}
+	}
+	for _, s := range sessions {
+		fmt.Printf("session %s  %s  %s\n", s.ID, s.Start.Local().Format(time.RFC3339), strings.Join(s.Command, " "))
+		printCounts(bySession[s.ID])
+	}
+	if len(rest) > 0 {
+		fmt.Println("outside airlock sessions")
+		printCounts(rest)
+	}
+	return nil
+}
+
+// printCommitReport lists the commits in workDir carrying provenance trailers, each with the
+// session that made it as recorded in the audit log.
+func printCommitReport(ctx context.Context, absProj, workDir string, since time.Time) error {
+	commits, err := audit.ReadCommits(ctx, workDir, since)
+	if err != nil {
+		return err
+	}
+	events, err := audit.Read(audit.Path(absProj))
+	if err != nil {
+		return err
+	}
+	sessions := make(map[string]audit.Session)
+	for _, s := range audit.Sessions(events) {
+		sessions[s.ID] = s
+	}
+	if len(commits) == 0 {
+		fmt.Println("(no commits made in airlock sessions)")
+		return nil
+	}
+	for _, c := range commits {
+		agent := c.Agent
+		if agent == "" {
+			agent = "-"
+		}
+		fmt.Printf("%.12s  %s  %s  %-10s  %s\n", c.Hash, c.Time.Local().Format(time.RFC3339), c.Session, agent, c.Subject)
+		if s, ok := sessions[c.Session]; ok {
+			status := "running"
+			if !s.End.IsZero() {
+				status = fmt.Sprintf("exit %d", s.ExitCode)
+			}
+			fmt.Printf("  session: %s (%s)\n", strings.Join(s.Command, " "), status)
+		} else {
+			fmt.Println("  session: not in this project's audit log")
+		}
+	}
+	return nil
+}
+
+func printTrafficReport(absProj string, since time.Time) error {
+	events, err := audit.Read(audit.Path(absProj))
+	if err != nil {
+		return err
+	}
+	report := audit.TrafficReport(events, since)
+	if len(report) == 0 {
+		fmt.Println("no traffic recorded (traffic is only accounted when network.allow is set)")
+		return nil
+	}
+	fmt.Printf("%-40s %14s %14s %9s\n", "HOST", "SENT BYTES", "RECV BYTES", "SESSIONS")
+	for _, h := range report {
+		fmt.Printf("%-40s %14d %14d %9d\n", h.Host, h.Sent, h.Received, h.Sessions)
+	}
+	return nil
+}
+
+// initFromTemplate renders a template into the current directory. Params declared in its manifest
+// are taken from --set, asked for on a terminal, or left at their defaults.
+func initFromTemplate(ctx context.Context, src string, name string, sets []string) error {
+	given := map[string]string{}
+	for _, kv := range sets {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("--set %q must be NAME=VALUE", kv)
+		}
+		given[k] = v
+	}
+	parsed, err := templates.ParseSource(src)
+	if err != nil {
+		return err
+	}
+	dir, cleanup, err := templates.Fetch(ctx, parsed)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	manifest, err := templates.LoadManifest(dir)
+	if err != nil {
+		return err
+	}
+	var ask func(templates.Param) (string, error)
+	if stdinIsTerminal() {
+		in := bufio.NewReader(os.Stdin)
+		ask = func(p templates.Param) (string, error) {
+			q := p.Prompt
+			if q == "" {
+				q = p.Name
+			}
+			if len(p.Choices) > 0 {
+				q += " (" + strings.Join(p.Choices, ", ") + ")"
+			}
+			if p.Default != "" {
+				q += " [" + p.Default + "]"
+			}
+			fmt.Print(q + ": ")
+			answer, err := in.ReadString('\n')
+			if err != nil && answer == "" {
+				return "", nil
+			}
+			return strings.TrimSpace(answer), nil
+		}
+	}
+	params, err := manifest.Resolve(given, ask)
+	if err != nil {
+		return err
+	}
+
+	written, err := templates.Render(dir, ".", templates.Data{Name: name, Params: params})
+	if err != nil {
+		return err
+	}
+	for _, f := range written {
+		fmt.Println("Wrote " + f)
+	}
+	return nil
+}
+
+// applyEnvDefaults lets AIRLOCK_CONFIG, AIRLOCK_PROFILE, AIRLOCK_INSTANCE, and AIRLOCK_VERBOSE stand in for flags that weren't given.
+// AIRLOCK_ENGINE and AIRLOCK_PROJECT_DIR override the config and are applied in loadConfig.
+func applyEnvDefaults() {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if v := os.Getenv("AIRLOCK_CONFIG"); v != "" && !set["config"] {
+		*configPath = v
+	}
+	if v := os.Getenv("AIRLOCK_PROFILE"); v != "" && !set["profile"] {
+		*profile = v
+	}
+	if v := os.Getenv("AIRLOCK_INSTANCE"); v != "" && !set["instance"] {
+		*instance = v
+	}
+	if v := os.Getenv("AIRLOCK_VERBOSE"); v != "" && !set["v"] {
+		if b, err := strconv.ParseBool(v); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring AIRLOCK_VERBOSE=%q (expected true or false)\n", v)
+		} else {
+			*verbose = b
+		}
+	}
+}
+
+// exitWithSession exits after a failed enter or exec. A command that ran and failed has already
+// reported its own error, so airlock just exits with its status, letting CI see the real code.
+func exitWithSession(cmd string, err error) {
+	var exitErr *container.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	fmt.Fprintf(os.Stderr, "%s error: %v\n", cmd, err)
+	os.Exit(1)
+}
+
+func loadConfig(path string) (*config.Config, string, error) {
+	cfgFile := path
+	if cfgFile == "" {
+		found, err := config.Find(".")
+		if err != nil {
+			return nil, "", err
+		}
+		cfgFile = found
+	}
+	cfg, err := airlock.Load(cfgFile, airlock.LoadOptions{Profile: *profile, Instance: *instance})
 	if err != nil {
 		return nil, "", err
 	}
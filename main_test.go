@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/donjaime/airlock/internal/config"
+)
+
+// fakeRevoker records the configs revokeExpiredGrants hands to the runner.
+type fakeRevoker struct {
+	recreated []*config.Config
+	applied   []*config.Config
+}
+
+func (f *fakeRevoker) Exists(ctx context.Context, cfg *config.Config) (bool, error) { return true, nil }
+
+func (f *fakeRevoker) ApplyNetworkPolicy(ctx context.Context, cfg *config.Config) error {
+	f.applied = append(f.applied, cfg)
+	return nil
+}
+
+func (f *fakeRevoker) Recreate(ctx context.Context, cfg *config.Config, absProjectDir string) error {
+	f.recreated = append(f.recreated, cfg)
+	return nil
+}
+
+func TestRevokeExpiredGrantsReloadsConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "airlock.yaml")
+	if err := os.WriteFile(cfgFile, []byte("name: grants\nimage: alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(50 * time.Millisecond)
+	if err := config.AddGrant(dir, config.Grant{Kind: "mount", Value: "/data", Target: "/mnt/data", Mode: "ro", Expires: &expires}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Like `grants expire`, load the config while the grant is still live, then wait it out.
+	stale, _, err := loadConfig(cfgFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale.Mounts) != 1 {
+		t.Fatalf("expected the live grant's mount, got %+v", stale.Mounts)
+	}
+	time.Sleep(time.Until(expires) + 10*time.Millisecond)
+
+	runner := &fakeRevoker{}
+	fresh, err := revokeExpiredGrants(context.Background(), runner, stale, cfgFile, dir)
+	if err != nil {
+		t.Fatalf("revokeExpiredGrants failed: %v", err)
+	}
+	if len(runner.recreated) != 1 {
+		t.Fatalf("expected one recreate, got %d", len(runner.recreated))
+	}
+	for _, cfg := range []*config.Config{runner.recreated[0], fresh} {
+		for _, m := range cfg.Mounts {
+			if m.Source == "/data" {
+				t.Errorf("expired mount grant still in the recreated config: %+v", cfg.Mounts)
+			}
+		}
+	}
+	if grants, _ := config.ReadGrants(dir); len(grants) != 0 {
+		t.Errorf("expected the grant to be pruned, got %+v", grants)
+	}
+}
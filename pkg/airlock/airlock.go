@@ -0,0 +1,177 @@
+// Package airlock embeds airlock sandboxes in other Go programs, such as IDE plugins and CI
+// orchestrators, without shelling out to the CLI. It loads a project's airlock.yaml the way the
+// CLI does and drives the same container lifecycle:
+//
+//	cfg, err := airlock.Load("", airlock.LoadOptions{})
+//	...
+//	r, err := airlock.NewRunner(cfg, airlock.RunnerOptions{})
+//	...
+//	err = r.Up(ctx)
+//	err = r.Exec(ctx, []string{"make", "test"}, airlock.ExecOptions{})
+//	err = r.Down(ctx)
+//
+// The API in this package is kept stable; the internal packages it wraps are not.
+package airlock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/donjaime/airlock/internal/config"
+	"github.com/donjaime/airlock/internal/container"
+)
+
+// Config is a loaded project configuration; its fields mirror airlock.yaml.
+type Config = config.Config
+
+// Network is a network policy, as in the network section of airlock.yaml.
+type Network = config.Network
+
+// ExecOptions adjusts a single Exec.
+type ExecOptions = container.ExecOptions
+
+// EnterOptions adjusts a single Enter.
+type EnterOptions = container.EnterOptions
+
+// ExitError is returned by Enter and Exec when the session's command exits non-zero.
+type ExitError = container.ExitError
+
+// LoadOptions adjusts how a config is loaded.
+type LoadOptions struct {
+	// Profile is a profile from the config's profiles section to layer on, like --profile.
+	Profile string
+	// Instance is a parallel copy of the sandbox to use, like --instance.
+	Instance string
+	// Dir is where overlay files are looked up from (see airlock.yaml overlays); defaults to the
+	// current directory, like the CLI.
+	Dir string
+}
+
+// Find walks up from dir to the project's airlock config file.
+func Find(dir string) (string, error) {
+	return config.Find(dir)
+}
+
+// Load reads the config at path, or the one found from the current directory when path is empty,
+// and applies the same environment overrides (AIRLOCK_ENGINE, AIRLOCK_PROJECT_DIR), profile,
+// instance, and overlays as the CLI. An engine host, context, or connection in the config is exported to the
+// process environment (unless already set there) so every engine invocation uses it.
+func Load(path string, opts LoadOptions) (*Config, error) {
+	if path == "" {
+		found, err := config.Find(".")
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("AIRLOCK_ENGINE"); v != "" {
+		cfg.Engine.Switch(v)
+	}
+	// The engine CLIs (and everything airlock runs through them) read the daemon from these; a value
+	// already in the environment wins, like AIRLOCK_* variables do.
+	if cfg.Engine.Host != "" && os.Getenv("DOCKER_HOST") == "" {
+		os.Setenv("DOCKER_HOST", cfg.Engine.Host)
+	}
+	if cfg.Engine.Context != "" && os.Getenv("DOCKER_CONTEXT") == "" {
+		os.Setenv("DOCKER_CONTEXT", cfg.Engine.Context)
+	}
+	// Podman's equivalent of --connection for every invocation.
+	if cfg.Engine.Connection != "" && os.Getenv("CONTAINER_CONNECTION") == "" {
+		os.Setenv("CONTAINER_CONNECTION", cfg.Engine.Connection)
+	}
+	if v := os.Getenv("AIRLOCK_PROJECT_DIR"); v != "" {
+		abs, err := filepath.Abs(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ProjectDir = abs
+	}
+	if err := cfg.ApplyProfile(opts.Profile); err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyInstance(opts.Instance); err != nil {
+		return nil, err
+	}
+	dir := opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if err := cfg.ApplyOverlays(dir); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// RunnerOptions adjusts a Runner.
+type RunnerOptions struct {
+	Verbose bool   // print each engine command to stderr
+	Version string // reported to the sandbox as AIRLOCK_VERSION; defaults to "embedded"
+}
+
+// Runner manages one project's sandbox.
+type Runner struct {
+	cfg        *Config
+	projectDir string
+	r          *container.Runner
+}
+
+// NewRunner detects the engine the config asks for (or the first of podman and docker on PATH)
+// and returns a Runner for the project.
+func NewRunner(cfg *Config, opts RunnerOptions) (*Runner, error) {
+	if cfg.EngineSocket != nil {
+		// The socket proxy runs as a separate airlock process the CLI manages.
+		return nil, errors.New("engineSocket is only supported by the airlock CLI")
+	}
+	abs, err := filepath.Abs(cfg.ProjectDir)
+	if err != nil {
+		return nil, err
+	}
+	eng, err := container.DetectEngine(cfg.Engine.Type)
+	if err != nil {
+		return nil, err
+	}
+	r := container.NewRunner(eng)
+	r.Verbose = opts.Verbose
+	r.Version = opts.Version
+	if r.Version == "" {
+		r.Version = "embedded"
+	}
+	return &Runner{cfg: cfg, projectDir: abs, r: r}, nil
+}
+
+// Engine returns the engine in use: "podman" or "docker".
+func (r *Runner) Engine() string { return string(r.r.Engine) }
+
+// Up builds or pulls the image if needed and creates and starts the sandbox.
+func (r *Runner) Up(ctx context.Context) error {
+	return r.r.Up(ctx, r.cfg, r.projectDir)
+}
+
+// Enter starts an interactive shell in the sandbox on the process's terminal, bringing it up
+// first.
+func (r *Runner) Enter(ctx context.Context, opts EnterOptions) error {
+	if err := r.Up(ctx); err != nil {
+		return err
+	}
+	return r.r.Enter(ctx, r.cfg, r.projectDir, opts)
+}
+
+// Exec runs cmd in the sandbox, bringing it up first. A failing command returns an *ExitError
+// carrying its exit code.
+func (r *Runner) Exec(ctx context.Context, cmd []string, opts ExecOptions) error {
+	if err := r.Up(ctx); err != nil {
+		return err
+	}
+	return r.r.Exec(ctx, r.cfg, r.projectDir, cmd, opts)
+}
+
+// Down stops and removes the sandbox. Home and cache directories are kept.
+func (r *Runner) Down(ctx context.Context) error {
+	return r.r.Down(ctx, r.cfg, "")
+}
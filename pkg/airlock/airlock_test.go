@@ -0,0 +1,52 @@
+package airlock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfgPath := filepath.Join(tmpDir, "airlock.yaml")
+	content := `name: test
+image: alpine
+engine:
+  host: ssh://me@buildbox
+profiles:
+  big:
+    image: alpine:edge
+`
+	if err := os.WriteFile(cfgPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("AIRLOCK_ENGINE", "")
+	t.Setenv("AIRLOCK_PROJECT_DIR", "")
+
+	cfg, err := Load(cfgPath, LoadOptions{Profile: "big", Dir: tmpDir})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Image != "alpine:edge" {
+		t.Errorf("image = %q, want the profile's alpine:edge", cfg.Image)
+	}
+	if got := os.Getenv("DOCKER_HOST"); got != "ssh://me@buildbox" {
+		t.Errorf("DOCKER_HOST = %q, want engine.host", got)
+	}
+
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("AIRLOCK_ENGINE", "podman")
+	cfg, err = Load(cfgPath, LoadOptions{Dir: tmpDir})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Engine.Type != "podman" || cfg.Engine.Host != "" || os.Getenv("DOCKER_HOST") != "" {
+		t.Errorf("AIRLOCK_ENGINE=podman: engine = %+v, DOCKER_HOST = %q, want podman without the docker host", cfg.Engine, os.Getenv("DOCKER_HOST"))
+	}
+	t.Setenv("AIRLOCK_ENGINE", "")
+
+	if _, err := Load(cfgPath, LoadOptions{Profile: "missing", Dir: tmpDir}); err == nil {
+		t.Error("expected error for an unknown profile")
+	}
+}